@@ -10,19 +10,51 @@ DO $$ BEGIN
 END $$;
 
 -- -----------------------------------------------------------
--- 2. USERS Table (Authentication and RBAC)
+-- 2. USERS & ORGANIZATION MEMBERS (Authentication and RBAC)
 -- -----------------------------------------------------------
+-- Numbers for generated account IDs (PAT0010009: prefix, six digits, Luhn check digit).
+-- One sequence for every prefix, starting above the hand-chosen seed IDs.
+CREATE SEQUENCE IF NOT EXISTS user_number_seq START WITH 1000;
+
 CREATE TABLE IF NOT EXISTS users (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-    unique_user_id VARCHAR(50) UNIQUE NOT NULL, -- e.g., PAT001, CLI002
-    mobile_number VARCHAR(15) UNIQUE NOT NULL,
+    unique_user_id VARCHAR(50) UNIQUE NOT NULL, -- e.g., PAT0010009; seed accounts use PAT001, CLI002
+    mobile_number VARCHAR(15) UNIQUE, -- NULL for dependents managed from a guardian's account
     hashed_password TEXT NOT NULL, -- Storing plain passwords for mock/demo, should be HASHED in production!
     name VARCHAR(100) NOT NULL,
+    -- Patient profile data used by the dose range checks (vitals at the visit take precedence)
+    date_of_birth DATE,
+    weight_kg NUMERIC(5, 2),
+    gender VARCHAR(20), -- male, female, other
+    preferred_language VARCHAR(15), -- e.g., hi; prescriptions and summaries are translated into it. NULL for English
+    registered_by VARCHAR(50) REFERENCES users(unique_user_id), -- Clinic of a walk-in registration
+    disabled_at TIMESTAMP WITH TIME ZONE, -- Disabled accounts cannot log in or use existing tokens
+    disabled_reason TEXT,
+    sessions_valid_after TIMESTAMP WITH TIME ZONE, -- Tokens issued earlier are rejected (forced logout)
     -- The role column is essential for RBAC enforced by the Go API
     role user_role NOT NULL, 
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Staff of a clinic or scanning center. The organization itself is the users row (e.g., CLI002);
+-- members log in with OTP on their own mobile number and act on the organization's behalf.
+CREATE TABLE IF NOT EXISTS organization_members (
+    id SERIAL PRIMARY KEY,
+    org_id VARCHAR(50) NOT NULL REFERENCES users(unique_user_id),
+    mobile_number VARCHAR(15) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    roles TEXT[] NOT NULL, -- org_admin, doctor, receptionist, technician
+    qualifications VARCHAR(200),
+    registration_number VARCHAR(50), -- Medical council registration of doctors
+    status VARCHAR(20) NOT NULL DEFAULT 'invited', -- invited, active, deactivated
+    invited_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    joined_at TIMESTAMP WITH TIME ZONE,
+    deactivated_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (org_id, mobile_number)
+);
+
+CREATE INDEX IF NOT EXISTS idx_organization_members_mobile ON organization_members (mobile_number);
+
 -- -----------------------------------------------------------
 -- 3. PRESCRIPTIONS Table (Structured Medical Record)
 -- -----------------------------------------------------------
@@ -39,21 +71,64 @@ CREATE TABLE IF NOT EXISTS prescriptions (
     instructions JSONB NOT NULL, 
     
     -- AI-Processed Fields for the Patient App
-    translated_text TEXT, 
+    translated_text TEXT, -- Legacy single translation; served when neither translations nor the narration templates cover the patient's language and it matches the instructions
     audio_file_url TEXT,
     original_doctor_text TEXT,
 
-    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+    -- Prescription safety checks (interactions, duplicate therapy) and the doctor's override
+    safety_warnings JSONB,
+    override_warnings BOOLEAN NOT NULL DEFAULT FALSE,
+
+    -- Lifecycle: this row holds the latest version; every issued version is kept in prescription_versions
+    status VARCHAR(20) NOT NULL DEFAULT 'issued', -- draft, issued, cancelled
+    version INT NOT NULL DEFAULT 1, -- 0 while a draft
+    cancel_reason TEXT,
+
+    -- Repeat prescriptions: refills are new prescriptions pointing back at the original
+    refills_allowed INT NOT NULL DEFAULT 0,
+    refill_interval_days INT NOT NULL DEFAULT 0,
+    refills_used INT NOT NULL DEFAULT 0,
+    last_refill_at TIMESTAMP WITH TIME ZONE,
+    refill_of UUID REFERENCES prescriptions(id),
+
+    -- The doctor who issued it, when issued from a staff login (NULL for the organization account)
+    prescribed_by INT REFERENCES organization_members(id),
+
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
 -- -----------------------------------------------------------
--- 4. REPORTS Table (Diagnostic Results)
+-- 4. REFERRALS, REPORTS & REPORT SHARES Tables (Diagnostic Orders, Results and Delivery)
 -- -----------------------------------------------------------
+-- Tests a clinic orders for a patient at a scanning center; reports uploaded for a
+-- referral go back to the referring clinic.
+CREATE TABLE IF NOT EXISTS referrals (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    patient_id VARCHAR(50) NOT NULL REFERENCES users(unique_user_id),
+    clinic_id VARCHAR(50) NOT NULL REFERENCES users(unique_user_id),
+    scanning_center_id VARCHAR(50) NOT NULL REFERENCES users(unique_user_id),
+    referred_by_member INT REFERENCES organization_members(id), -- Referring doctor; NULL for the clinic account
+    prescription_id UUID REFERENCES prescriptions(id), -- Visit the tests were ordered at
+    tests TEXT[] NOT NULL,
+    priority VARCHAR(10) NOT NULL DEFAULT 'routine', -- stat, urgent, routine
+    clinical_notes TEXT, -- Encrypted at application level
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, accepted, completed, declined, cancelled
+    status_reason TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_referrals_scanning_center ON referrals (scanning_center_id, status);
+CREATE INDEX IF NOT EXISTS idx_referrals_clinic ON referrals (clinic_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_referrals_patient ON referrals (patient_id, created_at DESC);
+
 CREATE TABLE IF NOT EXISTS reports (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     patient_id VARCHAR(50) NOT NULL REFERENCES users(unique_user_id), -- Ensures Data Isolation
     referring_clinic_id VARCHAR(50) REFERENCES users(unique_user_id), -- For multi-party sharing
     scanning_center_id VARCHAR(50) REFERENCES users(unique_user_id),
+    referral_id UUID REFERENCES referrals(id), -- Sets referring_clinic_id; NULL for walk-in scans
     
     scan_type VARCHAR(100),
     original_file_url TEXT NOT NULL, -- URL/Path to the technical report (PDF/DICOM)
@@ -62,10 +137,27 @@ CREATE TABLE IF NOT EXISTS reports (
     simplified_summary TEXT, -- Patient-friendly summary
     full_technical_report TEXT, -- Optionally extracted text or link to original
 
-    status VARCHAR(50) NOT NULL DEFAULT 'Uploaded', -- Status: Uploaded, AI Processing, Ready to Share
+    status VARCHAR(50) NOT NULL DEFAULT 'Uploaded', -- Status: Uploaded, AI Processing, Ready to Share, Shared
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
+-- One row per recipient of a finalized report: the patient gets the simplified
+-- summary, the referring clinic the technical original. Recipients can only
+-- fetch reports shared with them.
+CREATE TABLE IF NOT EXISTS report_shares (
+    id SERIAL PRIMARY KEY,
+    report_id UUID NOT NULL REFERENCES reports(id),
+    recipient_id VARCHAR(50) NOT NULL REFERENCES users(unique_user_id),
+    recipient_type VARCHAR(20) NOT NULL, -- patient, clinic
+    access VARCHAR(20) NOT NULL, -- summary, original
+    shared_by VARCHAR(50) NOT NULL REFERENCES users(unique_user_id),
+    shared_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    read_at TIMESTAMP WITH TIME ZONE, -- Read receipt shown to the scanning center
+    UNIQUE (report_id, recipient_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_report_shares_recipient ON report_shares (recipient_id, shared_at DESC);
+
 -- -----------------------------------------------------------
 -- 5. ADHERENCE Table (Medicine Tracker Logging)
 -- -----------------------------------------------------------
@@ -78,10 +170,410 @@ CREATE TABLE IF NOT EXISTS adherence (
 );
 
 -- -----------------------------------------------------------
--- 6. Initial Dummy Data (For testing login and RBAC)
+-- 6. PATIENT ALLERGIES & CONDITIONS (Checked at prescription time)
+-- -----------------------------------------------------------
+CREATE TABLE IF NOT EXISTS patient_allergies (
+    id BIGSERIAL PRIMARY KEY,
+    patient_id VARCHAR(50) NOT NULL REFERENCES users(unique_user_id),
+    substance VARCHAR(200) NOT NULL, -- Normalized ingredient or drug class, e.g., 'penicillin'
+    reaction TEXT,
+    severity VARCHAR(20),
+    recorded_by VARCHAR(50) REFERENCES users(unique_user_id), -- Clinic that recorded it
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    -- Set when another clinic removes it; the record stays visible but is not safety checked
+    removed_by VARCHAR(50) REFERENCES users(unique_user_id),
+    removal_reason TEXT,
+    removed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS patient_conditions (
+    id BIGSERIAL PRIMARY KEY,
+    patient_id VARCHAR(50) NOT NULL REFERENCES users(unique_user_id),
+    condition VARCHAR(100) NOT NULL, -- Normalized, e.g., 'pregnancy', 'renal_impairment'
+    notes TEXT,
+    recorded_by VARCHAR(50) REFERENCES users(unique_user_id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    removed_by VARCHAR(50) REFERENCES users(unique_user_id), -- As for patient_allergies
+    removal_reason TEXT,
+    removed_at TIMESTAMP WITH TIME ZONE
+);
+
+-- -----------------------------------------------------------
+-- 7. CLINIC FORMULARY & PRESCRIPTION TEMPLATES
+-- -----------------------------------------------------------
+CREATE TABLE IF NOT EXISTS clinic_formulary (
+    clinic_id VARCHAR(50) NOT NULL REFERENCES users(unique_user_id),
+    drug_id VARCHAR(50) NOT NULL, -- Catalog drug; no FK since catalog imports replace the drugs table
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    notes TEXT,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (clinic_id, drug_id)
+);
+
+CREATE TABLE IF NOT EXISTS clinic_drugs (
+    id VARCHAR(120) PRIMARY KEY, -- e.g., 'local-cli002-kadha'
+    clinic_id VARCHAR(50) NOT NULL REFERENCES users(unique_user_id),
+    data JSONB NOT NULL, -- The drug in the catalog's JSON shape
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS prescription_templates (
+    id BIGSERIAL PRIMARY KEY,
+    clinic_id VARCHAR(50) NOT NULL REFERENCES users(unique_user_id),
+    name VARCHAR(100) NOT NULL, -- e.g., 'Adult URTI'
+    diagnosis TEXT,
+    instructions JSONB NOT NULL, -- Default dosage instructions, same shape as prescriptions.instructions
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (clinic_id, name)
+);
+
+-- -----------------------------------------------------------
+-- 8. PRESCRIPTION VERSIONS, SIGNING KEYS & NOTIFICATIONS
+-- -----------------------------------------------------------
+-- Each clinic signs its prescriptions with an Ed25519 key; retired keys are kept to verify old printouts
+CREATE TABLE IF NOT EXISTS clinic_signing_keys (
+    id SERIAL PRIMARY KEY,
+    clinic_id VARCHAR(50) NOT NULL REFERENCES users(unique_user_id),
+    public_key BYTEA NOT NULL,
+    private_key TEXT NOT NULL, -- Encrypted seed, like prescriptions.diagnosis
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    retired_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_clinic_signing_keys_active ON clinic_signing_keys (clinic_id) WHERE retired_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS prescription_versions (
+    prescription_id UUID NOT NULL REFERENCES prescriptions(id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    change_type VARCHAR(30) NOT NULL, -- issued, amended, drug_discontinued, cancelled
+    reason TEXT,
+    changed_by VARCHAR(50) REFERENCES users(unique_user_id),
+    changed_by_member INT REFERENCES organization_members(id),
+    status VARCHAR(20) NOT NULL,
+    diagnosis TEXT, -- Encrypted, like prescriptions.diagnosis
+    vitals JSONB,
+    instructions JSONB NOT NULL,
+    safety_warnings JSONB,
+    refills_allowed INT NOT NULL DEFAULT 0,
+    refill_interval_days INT NOT NULL DEFAULT 0,
+    signature BYTEA, -- Ed25519 signature of the canonical form of this version
+    signing_key_id INT REFERENCES clinic_signing_keys(id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (prescription_id, version)
+);
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id BIGSERIAL PRIMARY KEY,
+    user_id VARCHAR(50) NOT NULL REFERENCES users(unique_user_id),
+    type VARCHAR(50) NOT NULL, -- e.g., 'prescription_amended'
+    title VARCHAR(200) NOT NULL,
+    message TEXT,
+    resource_type VARCHAR(50), -- e.g., 'prescription'
+    resource_id VARCHAR(100),
+    read_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications (user_id, created_at DESC);
+
+-- -----------------------------------------------------------
+-- 9. REFILL REQUESTS
+-- -----------------------------------------------------------
+CREATE TABLE IF NOT EXISTS refill_requests (
+    id BIGSERIAL PRIMARY KEY,
+    prescription_id UUID NOT NULL REFERENCES prescriptions(id) ON DELETE CASCADE,
+    patient_id VARCHAR(50) NOT NULL REFERENCES users(unique_user_id),
+    clinic_id VARCHAR(50) NOT NULL REFERENCES users(unique_user_id),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, approved, denied
+    patient_note TEXT,
+    decision_note TEXT,
+    decided_by VARCHAR(50) REFERENCES users(unique_user_id),
+    new_prescription_id UUID REFERENCES prescriptions(id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    decided_at TIMESTAMP WITH TIME ZONE
+);
+
+-- At most one open request per prescription
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refill_requests_pending ON refill_requests (prescription_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_refill_requests_clinic ON refill_requests (clinic_id, status);
+
+-- -----------------------------------------------------------
+-- 10. ORGANIZATION PROFILES (Letterheads of clinics and scanning centers)
+-- -----------------------------------------------------------
+CREATE TABLE IF NOT EXISTS organization_profiles (
+    org_id VARCHAR(50) PRIMARY KEY REFERENCES users(unique_user_id),
+    org_type user_role NOT NULL, -- 'Clinic' or 'Scanning'
+    name VARCHAR(200) NOT NULL,
+    legal_name VARCHAR(200),
+    address TEXT,
+    phone VARCHAR(30),
+    email VARCHAR(200),
+    working_hours VARCHAR(100),
+    licence_number VARCHAR(100),
+    signatory_name VARCHAR(100),
+    qualifications VARCHAR(200),
+    registration_number VARCHAR(50),
+    letterhead_template VARCHAR(20) NOT NULL DEFAULT 'classic', -- classic, centered, minimal
+    logo_path TEXT,      -- PNG or JPEG under ASSET_STORAGE_PATH
+    signature_path TEXT, -- PNG or JPEG, ideally on a transparent background
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- -----------------------------------------------------------
+-- 11. PATIENT DUPLICATE FLAGS (Same person registered twice, e.g., by two clinics)
+-- -----------------------------------------------------------
+CREATE TABLE IF NOT EXISTS patient_duplicate_flags (
+    id SERIAL PRIMARY KEY,
+    patient_id VARCHAR(50) NOT NULL REFERENCES users(unique_user_id),   -- The newer registration
+    duplicate_of VARCHAR(50) NOT NULL REFERENCES users(unique_user_id), -- The existing patient it matches
+    reason VARCHAR(50) NOT NULL, -- e.g., same_name_and_date_of_birth
+    flagged_by VARCHAR(50) REFERENCES users(unique_user_id), -- Clinic that confirmed the registration; NULL for self-registration
+    status VARCHAR(20) NOT NULL DEFAULT 'open', -- open, merged, dismissed
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (patient_id, duplicate_of)
+);
+
+CREATE INDEX IF NOT EXISTS idx_users_patient_name_dob ON users (lower(name), date_of_birth) WHERE role = 'Patient';
+
+-- -----------------------------------------------------------
+-- 12. FAMILY PROFILES & CAREGIVER ACCESS (Several patients managed from one mobile number)
+-- -----------------------------------------------------------
+CREATE TABLE IF NOT EXISTS patient_links (
+    id SERIAL PRIMARY KEY,
+    patient_id VARCHAR(50) NOT NULL REFERENCES users(unique_user_id),     -- The profile acted on
+    linked_user_id VARCHAR(50) NOT NULL REFERENCES users(unique_user_id), -- The guardian or caregiver account
+    relationship VARCHAR(30) NOT NULL, -- e.g., child, parent, spouse
+    permissions TEXT[] NOT NULL, -- view, log_adherence, manage
+    guardian BOOLEAN NOT NULL DEFAULT FALSE, -- Created the dependent profile; cannot be revoked
+    granted_by VARCHAR(50) REFERENCES users(unique_user_id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_patient_links_active ON patient_links (patient_id, linked_user_id) WHERE revoked_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_patient_links_linked_user ON patient_links (linked_user_id) WHERE revoked_at IS NULL;
+
+-- -----------------------------------------------------------
+-- 13. ACCOUNT ADMINISTRATION (Login history and audit log of admin actions)
+-- -----------------------------------------------------------
+CREATE TABLE IF NOT EXISTS login_events (
+    id BIGSERIAL PRIMARY KEY,
+    user_id VARCHAR(50) REFERENCES users(unique_user_id), -- NULL when the number matched no account
+    member_id INT REFERENCES organization_members(id),   -- Staff member logging in for the organization
+    mobile_number VARCHAR(15) NOT NULL,
+    method VARCHAR(20) NOT NULL, -- password, otp
+    success BOOLEAN NOT NULL,
+    failure_reason VARCHAR(100),
+    ip_address VARCHAR(45),
+    user_agent TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_events_user ON login_events (user_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS admin_audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    admin_id VARCHAR(50) NOT NULL REFERENCES users(unique_user_id),
+    action VARCHAR(50) NOT NULL, -- e.g., account_created, role_changed, account_disabled
+    target_user_id VARCHAR(50) REFERENCES users(unique_user_id),
+    details JSONB,
+    ip_address VARCHAR(45),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_admin_audit_log_target ON admin_audit_log (target_user_id, created_at DESC);
+
+-- -----------------------------------------------------------
+-- 14. SHARE LINKS (Expiring links to one report or prescription, for people not on MediBridge)
+-- -----------------------------------------------------------
+CREATE TABLE IF NOT EXISTS share_links (
+    id VARCHAR(32) PRIMARY KEY, -- Random; carried in the signed token
+    patient_id VARCHAR(50) NOT NULL REFERENCES users(unique_user_id),
+    created_by VARCHAR(50) NOT NULL REFERENCES users(unique_user_id), -- The patient or their guardian
+    resource_type VARCHAR(20) NOT NULL, -- report, prescription
+    resource_id UUID NOT NULL,
+    label VARCHAR(100),
+    pin_hash TEXT, -- Keyed hash of the optional PIN
+    failed_pin_attempts INT NOT NULL DEFAULT 0,
+    max_views INT NOT NULL DEFAULT 0, -- 0 for no limit
+    view_count INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    revoked_reason VARCHAR(20), -- patient, locked (too many wrong PINs)
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_share_links_patient ON share_links (patient_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS share_link_accesses (
+    id BIGSERIAL PRIMARY KEY,
+    link_id VARCHAR(32) REFERENCES share_links(id), -- NULL for tokens that are not ours
+    outcome VARCHAR(20) NOT NULL, -- viewed, pin_required, wrong_pin, locked, expired, used_up, revoked, invalid_token
+    format VARCHAR(10) NOT NULL, -- json, pdf
+    ip_address VARCHAR(45),
+    user_agent TEXT,
+    accessed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_share_link_accesses_link ON share_link_accesses (link_id, accessed_at DESC);
+
+-- -----------------------------------------------------------
+-- 15. LAB RESULTS (Structured results of reports, flagged against reference ranges)
+-- -----------------------------------------------------------
+-- Catalog of common tests: the name, unit and adult reference range used when a
+-- scanning center submits a result without its own range
+CREATE TABLE IF NOT EXISTS lab_tests (
+    code VARCHAR(30) PRIMARY KEY, -- e.g., CHOL
+    name VARCHAR(200) NOT NULL,
+    unit VARCHAR(30) NOT NULL,
+    ref_low NUMERIC,  -- NULL when the range has no lower bound
+    ref_high NUMERIC  -- NULL when the range has no upper bound
+);
+
+INSERT INTO lab_tests (code, name, unit, ref_low, ref_high) VALUES
+('CHOL', 'Serum Cholesterol', 'mg/dL', NULL, 200),
+('LDL', 'LDL Cholesterol', 'mg/dL', NULL, 100),
+('HDL', 'HDL Cholesterol', 'mg/dL', 40, NULL),
+('TG', 'Triglycerides', 'mg/dL', NULL, 150),
+('GLU_F', 'Fasting Blood Glucose', 'mg/dL', 70, 100),
+('HBA1C', 'Glycated Hemoglobin (HbA1c)', '%', 4.0, 5.6),
+('HB', 'Hemoglobin', 'g/dL', 12.0, 17.5),
+('CREAT', 'Serum Creatinine', 'mg/dL', 0.6, 1.3),
+('TSH', 'Thyroid Stimulating Hormone', 'mIU/L', 0.4, 4.0),
+('VITD', 'Vitamin D (25-OH)', 'ng/mL', 30, 100)
+ON CONFLICT (code) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS lab_observations (
+    id BIGSERIAL PRIMARY KEY,
+    report_id UUID NOT NULL REFERENCES reports(id),
+    patient_id VARCHAR(50) NOT NULL REFERENCES users(unique_user_id),
+    test_code VARCHAR(30) NOT NULL, -- Upper-cased, so results from different labs trend together
+    test_name VARCHAR(200) NOT NULL,
+    value NUMERIC NOT NULL,
+    unit VARCHAR(30) NOT NULL DEFAULT '',
+    ref_low NUMERIC,
+    ref_high NUMERIC,
+    flag VARCHAR(10), -- low, normal, high; NULL without a reference range
+    observed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (report_id, test_code)
+);
+
+CREATE INDEX IF NOT EXISTS idx_lab_observations_trend ON lab_observations (patient_id, test_code, observed_at);
+
+-- -----------------------------------------------------------
+-- 16. MEDICAL GLOSSARY (Simple definitions of terms in simplified reports)
+-- -----------------------------------------------------------
+-- Terms and aliases are stored lowercase, words separated by single spaces
+CREATE TABLE IF NOT EXISTS glossary_terms (
+    term VARCHAR(100) PRIMARY KEY, -- e.g., cholesterol
+    category VARCHAR(50), -- e.g., condition, test, anatomy
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS glossary_aliases (
+    alias VARCHAR(100) PRIMARY KEY, -- Other names, in any language, e.g., high blood pressure
+    term VARCHAR(100) NOT NULL REFERENCES glossary_terms(term) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS glossary_definitions (
+    term VARCHAR(100) NOT NULL REFERENCES glossary_terms(term) ON DELETE CASCADE,
+    language VARCHAR(15) NOT NULL, -- e.g., en, hi
+    definition TEXT NOT NULL,
+    PRIMARY KEY (term, language)
+);
+
+INSERT INTO glossary_terms (term, category) VALUES
+('cholesterol', 'test'),
+('ldl cholesterol', 'test'),
+('triglycerides', 'test'),
+('hba1c', 'test'),
+('hemoglobin', 'test'),
+('hypertension', 'condition'),
+('fracture', 'condition'),
+('benign', 'finding')
+ON CONFLICT (term) DO NOTHING;
+
+INSERT INTO glossary_aliases (alias, term) VALUES
+('serum cholesterol', 'cholesterol'),
+('total cholesterol', 'cholesterol'),
+('कोलेस्ट्रॉल', 'cholesterol'),
+('ldl', 'ldl cholesterol'),
+('bad cholesterol', 'ldl cholesterol'),
+('triglyceride', 'triglycerides'),
+('glycated hemoglobin', 'hba1c'),
+('a1c', 'hba1c'),
+('haemoglobin', 'hemoglobin'),
+('हीमोग्लोबिन', 'hemoglobin'),
+('high blood pressure', 'hypertension'),
+('उच्च रक्तचाप', 'hypertension')
+ON CONFLICT (alias) DO NOTHING;
+
+INSERT INTO glossary_definitions (term, language, definition) VALUES
+('cholesterol', 'en', 'A waxy fat your body needs in small amounts. Too much of it in the blood can build up in blood vessels and raise the risk of heart disease.'),
+('cholesterol', 'hi', 'एक मोम जैसी वसा जिसकी शरीर को थोड़ी मात्रा में ज़रूरत होती है। खून में इसकी अधिक मात्रा नसों में जमा होकर दिल की बीमारी का खतरा बढ़ा सकती है।'),
+('ldl cholesterol', 'en', 'Often called "bad" cholesterol. High levels can clog blood vessels.'),
+('ldl cholesterol', 'hi', 'इसे अक्सर "खराब" कोलेस्ट्रॉल कहते हैं। इसकी अधिक मात्रा नसों को बंद कर सकती है।'),
+('triglycerides', 'en', 'A type of fat in the blood that comes from food. High levels can raise the risk of heart disease.'),
+('triglycerides', 'hi', 'खून में मौजूद एक प्रकार की वसा जो भोजन से आती है। इसकी अधिक मात्रा दिल की बीमारी का खतरा बढ़ा सकती है।'),
+('hba1c', 'en', 'A blood test that shows your average blood sugar over the past two to three months.'),
+('hba1c', 'hi', 'खून की एक जाँच जो पिछले दो-तीन महीनों की औसत शुगर बताती है।'),
+('hemoglobin', 'en', 'The protein in red blood cells that carries oxygen around the body. Too little of it is called anemia.'),
+('hemoglobin', 'hi', 'लाल रक्त कोशिकाओं में मौजूद प्रोटीन जो पूरे शरीर में ऑक्सीजन पहुँचाता है। इसकी कमी को एनीमिया कहते हैं।'),
+('hypertension', 'en', 'Blood pressure that stays higher than normal. It often has no symptoms but strains the heart and blood vessels.'),
+('hypertension', 'hi', 'जब रक्तचाप लगातार सामान्य से ज़्यादा रहता है। इसके अक्सर कोई लक्षण नहीं होते, पर यह दिल और नसों पर ज़ोर डालता है।'),
+('fracture', 'en', 'A break or crack in a bone.'),
+('fracture', 'hi', 'हड्डी का टूटना या उसमें दरार आना।'),
+('benign', 'en', 'Not cancer. A benign growth does not spread to other parts of the body.'),
+('benign', 'hi', 'कैंसर नहीं। ऐसी गांठ शरीर के दूसरे हिस्सों में नहीं फैलती।')
+ON CONFLICT (term, language) DO NOTHING;
+
+-- -----------------------------------------------------------
+-- 17. TRANSLATIONS (Prescriptions and report summaries in the patient's language)
+-- -----------------------------------------------------------
+-- One row per translated field and language. A translation is only served while
+-- source_hash matches the current source text, so amending a prescription or
+-- rewriting a summary retires its translations until they are redone.
+CREATE TABLE IF NOT EXISTS translations (
+    id BIGSERIAL PRIMARY KEY,
+    resource_type VARCHAR(20) NOT NULL, -- prescription, report
+    resource_id UUID NOT NULL,
+    field VARCHAR(30) NOT NULL, -- instructions (prescription), simplified_summary (report)
+    language VARCHAR(15) NOT NULL, -- e.g., hi, ta
+    text TEXT, -- NULL until translated
+    source_hash CHAR(64) NOT NULL, -- SHA-256 of the English source text
+    status VARCHAR(10) NOT NULL DEFAULT 'pending', -- pending, ready, failed
+    translated_by VARCHAR(50), -- ai (cross-checked against the instructions when served), or the clinic or scanning center that wrote it
+    requested_by VARCHAR(50) REFERENCES users(unique_user_id), -- NULL when requested for the preferred language
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (resource_type, resource_id, field, language)
+);
+
+-- -----------------------------------------------------------
+-- 18. Initial Dummy Data (For testing login and RBAC)
 -- -----------------------------------------------------------
 INSERT INTO users (unique_user_id, mobile_number, hashed_password, name, role) VALUES
 ('PAT001', '9876543210', 'patientpass', 'Amit Sharma', 'Patient'),
 ('CLI002', '1122334455', 'clinicpass', 'Dr. Priya Varma', 'Clinic'),
-('SCN003', '9988776655', 'scanpass', 'Alpha Diagnostics', 'Scanning')
+('SCN003', '9988776655', 'scanpass', 'Alpha Diagnostics', 'Scanning'),
+('ADM005', '5555555555', 'adminpass', 'MediBridge Admin', 'Admin')
 ON CONFLICT (unique_user_id) DO NOTHING;
+
+-- A dependent of Amit Sharma, reached by switching profile after logging in as PAT001
+INSERT INTO users (unique_user_id, mobile_number, hashed_password, name, date_of_birth, gender, role) VALUES
+('PAT004', NULL, '', 'Anya Sharma', '2018-06-14', 'female', 'Patient')
+ON CONFLICT (unique_user_id) DO NOTHING;
+
+INSERT INTO patient_links (patient_id, linked_user_id, relationship, permissions, guardian, granted_by)
+SELECT 'PAT004', 'PAT001', 'child', ARRAY['view', 'log_adherence', 'manage'], TRUE, 'PAT001'
+WHERE NOT EXISTS (SELECT 1 FROM patient_links WHERE patient_id = 'PAT004' AND revoked_at IS NULL);
+
+INSERT INTO organization_members (org_id, mobile_number, name, roles, registration_number, status, joined_at) VALUES
+('CLI002', '1122334456', 'Dr. Arjun Rao', ARRAY['doctor'], 'KMC 67890', 'active', CURRENT_TIMESTAMP),
+('CLI002', '1122334457', 'Meena Iyer', ARRAY['receptionist'], NULL, 'active', CURRENT_TIMESTAMP),
+('SCN003', '9988776656', 'Ravi Kumar', ARRAY['technician'], NULL, 'active', CURRENT_TIMESTAMP)
+ON CONFLICT (org_id, mobile_number) DO NOTHING;
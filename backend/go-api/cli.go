@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"Medibridge/go-api/handlers"
+	"Medibridge/go-api/utils"
+)
+
+// runImportDrugs implements the import-drugs subcommand, which imports a drug
+// catalog without starting the HTTP server:
+//
+//	medibridge_api import-drugs [-file path] [-format csv|json|xlsx] [-map "Product Name=name"] [-preview] [-json]
+//
+// Without -file the configured DRUG_CATALOG_PATH is used. It returns the exit code.
+func runImportDrugs(args []string) int {
+	catalogPath, opts, err := handlers.DrugCatalogSource()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("import-drugs", flag.ContinueOnError)
+	file := flags.String("file", catalogPath, "catalog file to import")
+	format := flags.String("format", opts.Format, "file format: csv, json or xlsx (default: from the extension)")
+	columnMap := flags.String("map", "", `column mapping, e.g. "Product Name=name;Company=manufacturer"`)
+	preview := flags.Bool("preview", false, "stage the version for review without applying it")
+	asJSON := flags.Bool("json", false, "print the full result as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	opts.Format = *format
+	opts.CreatedBy = "cli"
+	opts.Apply = !*preview
+	if *columnMap != "" {
+		if opts.ColumnMap, err = utils.ParseColumnMapping(*columnMap); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+
+	if err := utils.InitDatabase(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize database: %v\n", err)
+		return 1
+	}
+	defer utils.CloseDatabase()
+
+	result, err := handlers.ImportDrugCatalogFile(*file, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Import failed: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(result)
+	}
+	if len(result.Errors) > 0 {
+		if !*asJSON {
+			for _, rowErr := range result.Errors {
+				fmt.Fprintf(os.Stderr, "line %d: %s\n", rowErr.Line, rowErr.Message)
+			}
+		}
+		fmt.Fprintf(os.Stderr, "%s has %d invalid rows; the drug catalog was not changed\n", *file, len(result.Errors))
+		return 1
+	}
+	if *asJSON {
+		return 0
+	}
+
+	switch {
+	case result.Unchanged:
+		fmt.Printf("%s is identical to catalog version %d; nothing to change\n", *file, result.Version.ID)
+	case *preview:
+		fmt.Printf("Staged %d drugs as catalog version %d (+%d ~%d -%d); apply it to make it live\n",
+			result.Version.DrugCount, result.Version.ID, result.Version.Added, result.Version.Changed, result.Version.Removed)
+	default:
+		fmt.Printf("Applied %d drugs as catalog version %d (+%d ~%d -%d)\n",
+			result.Version.DrugCount, result.Version.ID, result.Version.Added, result.Version.Changed, result.Version.Removed)
+	}
+	return 0
+}
@@ -0,0 +1,573 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"Medibridge/go-api/models"
+	"Medibridge/go-api/utils"
+)
+
+// accountRoles are the roles an administrator can move an account to.
+var accountRoles = []string{"Patient", "Clinic", "Scanning", "Admin"}
+
+// creatableAccountRoles are the accounts administrators create; patients register themselves.
+var creatableAccountRoles = []string{"Clinic", "Scanning"}
+
+// temporaryPasswordAlphabet leaves out characters that are easily confused when read out.
+const temporaryPasswordAlphabet = "abcdefghjkmnpqrstuvwxyzACDEFGHJKLMNPQRTUVWXY346789"
+
+// accountColumns is the column list read by scanAccount.
+const accountColumns = `u.unique_user_id, COALESCE(u.mobile_number, ''), u.name, u.role,
+	COALESCE(u.disabled_reason, ''), u.hashed_password <> '', COALESCE(u.registered_by, ''),
+	u.created_at, u.disabled_at,
+	(SELECT max(e.created_at) FROM login_events e WHERE e.user_id = u.unique_user_id AND e.success)`
+
+// scanAccount reads one row selected with accountColumns from users u.
+func scanAccount(row rowScanner) (models.Account, error) {
+	var a models.Account
+	var createdAt time.Time
+	var disabledAt, lastLoginAt sql.NullTime
+	err := row.Scan(&a.ID, &a.Mobile, &a.Name, &a.Role, &a.DisabledReason, &a.HasPassword,
+		&a.RegisteredBy, &createdAt, &disabledAt, &lastLoginAt)
+	if err != nil {
+		return a, err
+	}
+	a.CreatedAt = createdAt.Unix()
+	a.Status = models.AccountActive
+	if disabledAt.Valid {
+		a.Status = models.AccountDisabled
+		a.DisabledAt = disabledAt.Time.Unix()
+	}
+	if lastLoginAt.Valid {
+		a.LastLoginAt = lastLoginAt.Time.Unix()
+	}
+	return a, nil
+}
+
+// accountByID fetches one account; it returns sql.ErrNoRows if there is none.
+func accountByID(id string) (models.Account, error) {
+	return scanAccount(utils.DB.QueryRow(`SELECT `+accountColumns+` FROM users u WHERE u.unique_user_id = $1`, id))
+}
+
+// loadAccount fetches the account named by the :id parameter, responding with
+// 404 (or 500) itself when it cannot.
+func loadAccount(c *gin.Context) (models.Account, bool) {
+	account, err := accountByID(c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return account, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch account"})
+		return account, false
+	}
+	return account, true
+}
+
+// temporaryPassword returns a random password for an administrator to hand over;
+// the account holder should change it (or use OTP login) afterwards.
+func temporaryPassword() (string, error) {
+	max := big.NewInt(int64(len(temporaryPasswordAlphabet)))
+	password := make([]byte, 12)
+	for i := range password {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		password[i] = temporaryPasswordAlphabet[n.Int64()]
+	}
+	return string(password), nil
+}
+
+// recordLogin stores a login attempt in the login history. Failures are only
+// logged: the history must never decide whether a login succeeds.
+func recordLogin(c *gin.Context, e models.LoginEvent) {
+	_, err := utils.DB.Exec(`
+		INSERT INTO login_events (user_id, member_id, mobile_number, method, success, failure_reason, ip_address, user_agent)
+		VALUES (NULLIF($1, ''), NULLIF($2, 0), $3, $4, $5, NULLIF($6, ''), $7, $8)
+	`, e.UserID, e.MemberID, e.Mobile, e.Method, e.Success, e.FailureReason, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		log.Printf("Warning: Could not record login of %s: %v", e.Mobile, err)
+	}
+}
+
+// sessionRejection returns why a token issued at issuedAt for the given accounts
+// is no longer accepted, or "" if it still is.
+func sessionRejection(issuedAt time.Time, accountIDs ...string) (string, error) {
+	rows, err := utils.DB.Query(`
+		SELECT disabled_at IS NOT NULL, sessions_valid_after FROM users WHERE unique_user_id = ANY($1)
+	`, pq.Array(accountIDs))
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var disabled bool
+		var validAfter sql.NullTime
+		if err := rows.Scan(&disabled, &validAfter); err != nil {
+			return "", err
+		}
+		if disabled {
+			return "Account is disabled", nil
+		}
+		// Token times have whole seconds; a token issued in the second of the logout may survive it.
+		if validAfter.Valid && issuedAt.Before(validAfter.Time.Truncate(time.Second)) {
+			return "Session has ended; log in again", nil
+		}
+	}
+	return "", rows.Err()
+}
+
+// auditAdminAction records an administrator's action within the transaction
+// that makes the change, so no change goes unaudited.
+func auditAdminAction(tx *sql.Tx, c *gin.Context, action, targetUserID string, details gin.H) error {
+	var data []byte
+	if details != nil {
+		var err error
+		if data, err = json.Marshal(details); err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec(`
+		INSERT INTO admin_audit_log (admin_id, action, target_user_id, details, ip_address)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5)
+	`, c.GetString("userID"), action, targetUserID, data, c.ClientIP())
+	return err
+}
+
+// updateAccount applies an administrative change to the account named by :id
+// and audits it, in one transaction. It responds with an error itself and
+// reports whether the change was made.
+func updateAccount(c *gin.Context, action string, details gin.H, query string, args ...interface{}) bool {
+	tx, err := utils.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(query, args...); err == nil {
+		err = auditAdminAction(tx, c, action, c.Param("id"), details)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This mobile number is registered to another account"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account"})
+		return false
+	}
+	return true
+}
+
+// respondAccount answers with the account named by :id as it is now.
+func respondAccount(c *gin.Context, extra gin.H) {
+	account, ok := loadAccount(c)
+	if !ok {
+		return
+	}
+	if extra == nil {
+		c.JSON(http.StatusOK, account)
+		return
+	}
+	extra["account"] = account
+	c.JSON(http.StatusOK, extra)
+}
+
+// notSelf refuses changes an administrator would make to their own account.
+func notSelf(c *gin.Context) bool {
+	if c.Param("id") == c.GetString("userID") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot do this to your own account"})
+		return false
+	}
+	return true
+}
+
+// ListAccounts handles GET /v1/admin/users?q=&role=&status=&limit=&offset=
+// Returns accounts newest first. 'q' matches the name, the account ID or the
+// start of the mobile number; 'status' is active or disabled.
+func ListAccounts(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'limit'; expected 1 to 200"})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'offset'"})
+		return
+	}
+	role, status := c.Query("role"), c.Query("status")
+	if role != "" && !containsString(accountRoles, role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'role'; expected one of: " + strings.Join(accountRoles, ", ")})
+		return
+	}
+	if status != "" && status != models.AccountActive && status != models.AccountDisabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'status'; expected active or disabled"})
+		return
+	}
+
+	q := strings.TrimSpace(c.Query("q"))
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(q) + "%"
+	rows, err := utils.DB.Query(`
+		SELECT `+accountColumns+`
+		FROM users u
+		WHERE ($1 = '' OR u.name ILIKE $2 OR u.unique_user_id ILIKE $2 OR u.mobile_number LIKE $3)
+			AND ($4 = '' OR u.role::text = $4)
+			AND ($5 = '' OR (u.disabled_at IS NOT NULL) = ($5 = 'disabled'))
+		ORDER BY u.created_at DESC, u.unique_user_id
+		LIMIT $6 OFFSET $7
+	`, q, pattern, strings.TrimPrefix(pattern, "%"), role, status, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch accounts"})
+		return
+	}
+	defer rows.Close()
+
+	accounts := []models.Account{}
+	for rows.Next() {
+		a, err := scanAccount(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch accounts"})
+			return
+		}
+		accounts = append(accounts, a)
+	}
+	c.JSON(http.StatusOK, accounts)
+}
+
+// GetAccount handles GET /v1/admin/users/:id
+// Returns one account with its status and last successful login.
+func GetAccount(c *gin.Context) {
+	respondAccount(c, nil)
+}
+
+// CreateAccount handles POST /v1/admin/users
+// Creates a clinic or scanning center account under a generated ID and returns
+// its temporary password, which is shown only this once.
+func CreateAccount(c *gin.Context) {
+	var req models.CreateAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account; 'role', 'name' and 'mobile' are required"})
+		return
+	}
+	if !containsString(creatableAccountRoles, req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'role'; expected one of: " + strings.Join(creatableAccountRoles, ", ")})
+		return
+	}
+	req.Name = normalizePersonName(req.Name)
+	req.Mobile = strings.TrimSpace(req.Mobile)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account; 'name' is required"})
+		return
+	}
+	if !mobilePattern.MatchString(req.Mobile) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'mobile'; expected 10 to 15 digits"})
+		return
+	}
+	password, err := temporaryPassword()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate password"})
+		return
+	}
+
+	tx, err := utils.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	id, err := nextUserID(tx, req.Role)
+	if err == nil {
+		// Passwords are stored as given, like the rest of the demo accounts (see LoginHandler)
+		_, err = tx.Exec(`
+			INSERT INTO users (unique_user_id, mobile_number, hashed_password, name, role)
+			VALUES ($1, $2, $3, $4, $5)
+		`, id, req.Mobile, password, req.Name, req.Role)
+	}
+	if err == nil {
+		err = auditAdminAction(tx, c, models.AuditAccountCreated, id, gin.H{"role": req.Role, "name": req.Name, "mobile": req.Mobile})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This mobile number is registered to another account"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create account"})
+		return
+	}
+
+	account, err := accountByID(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch account"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"account": account, "temporary_password": password})
+}
+
+// ChangeAccountRole handles PUT /v1/admin/users/:id/role
+// Moves an account to another role. Tokens carry the role, so the account's
+// sessions are ended and it logs in again under the new one.
+func ChangeAccountRole(c *gin.Context) {
+	var req models.RoleChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || !containsString(accountRoles, req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'role'; expected one of: " + strings.Join(accountRoles, ", ")})
+		return
+	}
+	if !notSelf(c) {
+		return
+	}
+	account, ok := loadAccount(c)
+	if !ok {
+		return
+	}
+	if account.Role == req.Role {
+		c.JSON(http.StatusOK, account)
+		return
+	}
+	if account.Mobile == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Dependent profiles cannot log in and stay patients"})
+		return
+	}
+
+	if updateAccount(c, models.AuditRoleChanged, gin.H{"from": account.Role, "to": req.Role}, `
+		UPDATE users SET role = $2, sessions_valid_after = CURRENT_TIMESTAMP WHERE unique_user_id = $1
+	`, account.ID, req.Role) {
+		respondAccount(c, nil)
+	}
+}
+
+// DisableAccount handles POST /v1/admin/users/:id/disable
+// Blocks the account from logging in and rejects its existing tokens. Staff
+// members of a disabled organization are locked out with it.
+func DisableAccount(c *gin.Context) {
+	var req models.DisableAccountRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+			return
+		}
+	}
+	if !notSelf(c) {
+		return
+	}
+	account, ok := loadAccount(c)
+	if !ok {
+		return
+	}
+	if account.Status == models.AccountDisabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Account is already disabled"})
+		return
+	}
+
+	if updateAccount(c, models.AuditAccountDisabled, gin.H{"reason": req.Reason}, `
+		UPDATE users SET disabled_at = CURRENT_TIMESTAMP, disabled_reason = NULLIF($2, '') WHERE unique_user_id = $1
+	`, account.ID, strings.TrimSpace(req.Reason)) {
+		respondAccount(c, nil)
+	}
+}
+
+// EnableAccount handles POST /v1/admin/users/:id/enable
+// Lets a disabled account log in again; tokens from before it was disabled stay invalid.
+func EnableAccount(c *gin.Context) {
+	account, ok := loadAccount(c)
+	if !ok {
+		return
+	}
+	if account.Status == models.AccountActive {
+		c.JSON(http.StatusConflict, gin.H{"error": "Account is not disabled"})
+		return
+	}
+
+	if updateAccount(c, models.AuditAccountEnabled, gin.H{"disabled_reason": account.DisabledReason}, `
+		UPDATE users SET disabled_at = NULL, disabled_reason = NULL,
+			sessions_valid_after = GREATEST(sessions_valid_after, disabled_at)
+		WHERE unique_user_id = $1
+	`, account.ID) {
+		respondAccount(c, nil)
+	}
+}
+
+// RevokeAccountSessions handles POST /v1/admin/users/:id/logout
+// Ends every session of the account, including its staff members' and, for
+// patients, the profiles they switched into.
+func RevokeAccountSessions(c *gin.Context) {
+	account, ok := loadAccount(c)
+	if !ok {
+		return
+	}
+	if updateAccount(c, models.AuditSessionsRevoked, nil, `
+		UPDATE users SET sessions_valid_after = CURRENT_TIMESTAMP WHERE unique_user_id = $1
+	`, account.ID) {
+		c.JSON(http.StatusOK, gin.H{"message": "All sessions of " + account.ID + " ended"})
+	}
+}
+
+// ResetAccountCredentials handles POST /v1/admin/users/:id/reset-credentials
+// Ends the account's sessions and pending OTPs and, for accounts that log in
+// with a password, issues a temporary one (shown only this once). An optional
+// 'mobile' moves the login to a new number, e.g., after a lost phone.
+func ResetAccountCredentials(c *gin.Context) {
+	var req models.CredentialResetRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+			return
+		}
+	}
+	req.Mobile = strings.TrimSpace(req.Mobile)
+	if req.Mobile != "" && !mobilePattern.MatchString(req.Mobile) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'mobile'; expected 10 to 15 digits"})
+		return
+	}
+	account, ok := loadAccount(c)
+	if !ok {
+		return
+	}
+	if account.Mobile == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Dependent profiles have no login; reset their guardian's account"})
+		return
+	}
+
+	password := ""
+	if account.HasPassword {
+		var err error
+		if password, err = temporaryPassword(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate password"})
+			return
+		}
+	}
+	mobile := account.Mobile
+	if req.Mobile != "" {
+		mobile = req.Mobile
+	}
+
+	details := gin.H{"password_reset": account.HasPassword}
+	if mobile != account.Mobile {
+		details["old_mobile"], details["new_mobile"] = account.Mobile, mobile
+	}
+	if !updateAccount(c, models.AuditCredentialsReset, details, `
+		UPDATE users SET mobile_number = $2, hashed_password = CASE WHEN $3 = '' THEN hashed_password ELSE $3 END,
+			sessions_valid_after = CURRENT_TIMESTAMP
+		WHERE unique_user_id = $1
+	`, account.ID, mobile, password) {
+		return
+	}
+	deleteOTP(account.Mobile)
+
+	// In production: tell the account holder by SMS, on the new number, that
+	// their credentials were reset. For demo: Log to console, without the number
+	fmt.Printf("Credentials of %s reset\n", account.ID)
+
+	result := gin.H{"message": "Credentials reset; all sessions ended"}
+	if password != "" {
+		result["temporary_password"] = password
+	}
+	respondAccount(c, result)
+}
+
+// GetAccountLogins handles GET /v1/admin/users/:id/logins?limit=
+// Returns the account's login attempts, newest first, including failed ones and
+// those of its staff members.
+func GetAccountLogins(c *gin.Context) {
+	account, ok := loadAccount(c)
+	if !ok {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'limit'; expected 1 to 500"})
+		return
+	}
+
+	// Failed attempts on an unknown number are kept under the number alone.
+	rows, err := utils.DB.Query(`
+		SELECT id, COALESCE(user_id, ''), COALESCE(member_id, 0), mobile_number, method, success,
+			COALESCE(failure_reason, ''), COALESCE(ip_address, ''), COALESCE(user_agent, ''), created_at
+		FROM login_events
+		WHERE user_id = $1 OR (user_id IS NULL AND mobile_number = $2)
+		ORDER BY created_at DESC
+		LIMIT $3
+	`, account.ID, account.Mobile, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch login history"})
+		return
+	}
+	defer rows.Close()
+
+	events := []models.LoginEvent{}
+	for rows.Next() {
+		var e models.LoginEvent
+		var createdAt time.Time
+		if err := rows.Scan(&e.ID, &e.UserID, &e.MemberID, &e.Mobile, &e.Method, &e.Success,
+			&e.FailureReason, &e.IPAddress, &e.UserAgent, &createdAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch login history"})
+			return
+		}
+		e.CreatedAt = createdAt.Unix()
+		events = append(events, e)
+	}
+	c.JSON(http.StatusOK, events)
+}
+
+// GetAdminAuditLog handles GET /v1/admin/audit?user_id=&admin_id=&action=&limit=
+// Returns administrative actions on accounts, newest first.
+func GetAdminAuditLog(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'limit'; expected 1 to 500"})
+		return
+	}
+
+	rows, err := utils.DB.Query(`
+		SELECT id, admin_id, action, COALESCE(target_user_id, ''), details, COALESCE(ip_address, ''), created_at
+		FROM admin_audit_log
+		WHERE ($1 = '' OR target_user_id = $1) AND ($2 = '' OR admin_id = $2) AND ($3 = '' OR action = $3)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4
+	`, c.Query("user_id"), c.Query("admin_id"), c.Query("action"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var e models.AuditEntry
+		var details []byte
+		var createdAt time.Time
+		if err := rows.Scan(&e.ID, &e.AdminID, &e.Action, &e.TargetUserID, &details, &e.IPAddress, &createdAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+			return
+		}
+		if len(details) > 0 {
+			if err := json.Unmarshal(details, &e.Details); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+				return
+			}
+		}
+		e.CreatedAt = createdAt.Unix()
+		entries = append(entries, e)
+	}
+	c.JSON(http.StatusOK, entries)
+}
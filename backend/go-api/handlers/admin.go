@@ -1,182 +1,155 @@
 package handlers
 
 import (
-	"encoding/csv"
-	"io"
+	"errors"
 	"net/http"
 	"os"
-	"log"
+	"path/filepath"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"Medibridge/go-api/models"
 	"Medibridge/go-api/utils"
 )
 
-// The path for temporary file storage within the container's filesystem.
-const TempUploadPath = "/tmp/uploads" 
+// maxCatalogUploadBytes caps drug catalog and interaction uploads.
+const maxCatalogUploadBytes = 50 << 20
+
+// catalogUploadTypes are the accepted catalog file types. CSV and JSON sniff as
+// text, or as binary when UTF-16 without a BOM or with stray control bytes;
+// utils.DecodeText then works out the encoding. XLSX is a zip archive.
+var catalogUploadTypes = map[string][]string{
+	"csv":  {"text/plain", "application/octet-stream"},
+	"json": {"text/plain", "application/octet-stream"},
+	"xlsx": {"application/zip"},
+}
 
 // UploadDrugCSV handles POST /v1/admin/drugs/upload
-// Accepts a multipart form file (field name: "csv") containing a CSV of drugs.
-// The file is temporarily saved, loaded into the database, and then deleted.
+// Accepts a multipart form file (field name: "csv" or "file") containing a drug
+// catalog as CSV, JSON or XLSX. The format is taken from the optional "format"
+// field or the file extension, and the optional "column_map" field renames source
+// columns ("Product Name=name;Company=manufacturer"); both may also be sent as
+// query parameters. The file is parsed as it streams in and staged as a catalog version.
 func UploadDrugCSV(c *gin.Context) {
-	// Parse multipart form
-	file, header, err := c.Request.FormFile("csv")
+	// Stage the file as a new catalog version; it is only applied if every row is valid.
+	// With ?preview=true the version is staged for review and applied later.
+	preview := c.Query("preview") == "true"
+
+	var filename string
+	var result DrugImportResult
+	policy := uploadPolicy{Fields: []string{"csv", "file"}, MaxBytes: maxCatalogUploadBytes, Types: catalogUploadTypes}
+	err := receiveUpload(c, policy, func(u *upload) error {
+		filename = u.Filename
+		opts := DrugImportOptions{
+			Source:    u.Filename,
+			Format:    strings.ToLower(u.formValue(c, "format")),
+			CreatedBy: c.GetString("userID"),
+			Apply:     !preview,
+		}
+		if opts.Format == "" {
+			opts.Format = u.Ext
+		}
+		if spec := u.formValue(c, "column_map"); spec != "" {
+			mapping, err := utils.ParseColumnMapping(spec)
+			if err != nil {
+				return &uploadError{Status: http.StatusBadRequest, Message: err.Error()}
+			}
+			opts.ColumnMap = mapping
+		}
+
+		var err error
+		result, err = importDrugCatalog(u.Body, opts)
+		var fileErr *catalogFileError
+		if errors.As(err, &fileErr) {
+			return invalidUpload(fileErr.Err, policy, "Failed to load drugs from catalog file")
+		}
+		return err
+	})
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "CSV file required (field name: 'csv')"})
+		respondUploadError(c, err, "Failed to load drugs from catalog file")
 		return
 	}
-	defer file.Close()
-
-	// 1. Ensure the temporary upload directory exists
-	if err := os.MkdirAll(TempUploadPath, 0755); err != nil {
-		log.Printf("Error creating temp directory: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not prepare file storage"})
+	if len(result.Errors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "Catalog file has invalid rows; the drug catalog was not changed",
+			"errors": result.Errors,
+		})
 		return
 	}
 
-	// 2. Save file to the temporary path
-	dstPath := TempUploadPath + "/" + header.Filename
-	dst, err := os.Create(dstPath)
-	if err != nil {
-		log.Printf("Error creating destination file: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create destination file"})
-		return
+	message := "Drugs CSV uploaded and loaded successfully"
+	switch {
+	case result.Unchanged:
+		message = "Drugs CSV is identical to the current catalog; nothing to change"
+	case preview:
+		message = "Drugs CSV staged for preview; apply the version to make it live"
 	}
-	defer dst.Close()
 
-	if _, err := io.Copy(dst, file); err != nil {
-		log.Printf("Error saving file: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save uploaded file"})
-		return
-	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"filename": filename,
+		"count": result.Version.DrugCount,
+		"version": result.Version,
+		"diff": result.Diff,
+	})
+}
 
-	// 3. Process the CSV file
-	count, err := processDrugCSV(dstPath)
+// UploadInteractionCSV handles POST /v1/admin/interactions/upload
+// Accepts a multipart form file (field name: "csv") with the columns drug_a, drug_b,
+// severity and description, and replaces the drug interaction table with it. The
+// table is only replaced if every row is valid; otherwise the row errors are returned.
+func UploadInteractionCSV(c *gin.Context) {
+	var filename string
+	var count int
+	var rowErrors []models.DrugImportError
+	policy := uploadPolicy{
+		Fields:   []string{"csv"},
+		MaxBytes: maxCatalogUploadBytes,
+		Types:    map[string][]string{"csv": catalogUploadTypes["csv"]},
+	}
+	err := receiveUpload(c, policy, func(u *upload) error {
+		filename = u.Filename
+		interactions, errs, err := parseInteractions(u.Body)
+		if err != nil {
+			return invalidUpload(err, policy, "Failed to load interactions from CSV")
+		}
+		if rowErrors = errs; len(rowErrors) > 0 {
+			return nil
+		}
+		count, err = saveInteractions(interactions)
+		return err
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load drugs from CSV", "details": err.Error()})
+		respondUploadError(c, err, "Failed to load interactions from CSV")
 		return
 	}
-	
-	// 4. Clean up the temporary file
-	if err := os.Remove(dstPath); err != nil {
-		log.Printf("Warning: Failed to delete temporary file %s: %v", dstPath, err)
+	if len(rowErrors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "Interaction CSV has invalid rows; the interaction table was not changed",
+			"errors": rowErrors,
+		})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Drugs CSV uploaded and loaded successfully",
-		"filename": header.Filename,
+		"message": "Interaction CSV uploaded and loaded successfully",
+		"filename": filename,
 		"count": count,
 	})
 }
 
-// processDrugCSV processes a CSV file and loads drugs into the database
-func processDrugCSV(filePath string) (int, error) {
+// ImportDrugCatalogFile imports a drug catalog file as a new catalog version,
+// applying it to the live catalog when opts.Apply is set. The file name is
+// recorded as the version's source unless opts.Source is set.
+func ImportDrugCatalogFile(filePath string, opts DrugImportOptions) (DrugImportResult, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return 0, err
+		return DrugImportResult{}, err
 	}
 	defer file.Close()
 
-	reader := csv.NewReader(file)
-	
-	// Read header
-	headers, err := reader.Read()
-	if err != nil {
-		return 0, err
+	if opts.Source == "" {
+		opts.Source = filepath.Base(filePath)
 	}
-
-	// Find column indices
-	nameIdx := -1
-	idIdx := -1
-	typeIdx := -1
-	strengthIdx := -1
-
-	for i, header := range headers {
-		h := strings.ToLower(strings.TrimSpace(header))
-		switch h {
-		case "name":
-			nameIdx = i
-		case "id":
-			idIdx = i
-		case "type":
-			typeIdx = i
-		case "strength":
-			strengthIdx = i
-		}
-	}
-
-	if nameIdx == -1 {
-		return 0, err
-	}
-
-	// Create table if not exists
-	_, err = utils.DB.Exec(`
-		CREATE TABLE IF NOT EXISTS drugs (
-			id VARCHAR(50) PRIMARY KEY,
-			name VARCHAR(200) NOT NULL,
-			type VARCHAR(50),
-			strength VARCHAR(50)
-		)
-	`)
-	if err != nil {
-		return 0, err
-	}
-
-	// Clear existing data
-	_, err = utils.DB.Exec(`TRUNCATE TABLE drugs`)
-	if err != nil {
-		log.Printf("Warning: Failed to clear drugs table: %v", err)
-	}
-
-	// Insert drugs
-	count := 0
-	for {
-		record, err := reader.Read()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			continue
-		}
-
-		if len(record) <= nameIdx {
-			continue
-		}
-
-		name := strings.TrimSpace(record[nameIdx])
-		if name == "" {
-			continue
-		}
-
-		id := ""
-		if idIdx != -1 && idIdx < len(record) {
-			id = strings.TrimSpace(record[idIdx])
-		}
-		if id == "" {
-			id = "drug-" + strings.ToLower(strings.ReplaceAll(name, " ", "-"))
-		}
-
-		drugType := "allopathy"
-		if typeIdx != -1 && typeIdx < len(record) {
-			drugType = strings.TrimSpace(record[typeIdx])
-		}
-
-		strength := ""
-		if strengthIdx != -1 && strengthIdx < len(record) {
-			strength = strings.TrimSpace(record[strengthIdx])
-		}
-
-		_, err = utils.DB.Exec(`
-			INSERT INTO drugs (id, name, type, strength) 
-			VALUES ($1, $2, $3, $4)
-			ON CONFLICT (id) DO UPDATE 
-			SET name = $2, type = $3, strength = $4
-		`, id, name, drugType, strength)
-
-		if err == nil {
-			count++
-		}
-	}
-
-	return count, nil
-}
\ No newline at end of file
+	return importDrugCatalog(file, opts)
+}
@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"Medibridge/go-api/models"
+	"Medibridge/go-api/utils"
+)
+
+// conditionKey normalizes a condition name, e.g., "Renal Impairment" -> "renal_impairment".
+func conditionKey(condition string) string {
+	fields := strings.FieldsFunc(strings.ToLower(condition), func(r rune) bool {
+		return r == ' ' || r == '-' || r == '_'
+	})
+	return strings.Join(fields, "_")
+}
+
+// patientExists reports whether a patient with the given unique ID exists.
+func patientExists(patientID string) (bool, error) {
+	var exists bool
+	err := utils.DB.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM users WHERE unique_user_id = $1 AND role = 'Patient')`,
+		patientID,
+	).Scan(&exists)
+	return exists, err
+}
+
+// clinicCaresFor reports whether a clinic has a care relationship with a
+// patient: it registered them, issued them a prescription, referred them for
+// tests or received one of their reports. Drafts and medical profile entries do
+// not count, as any clinic could create them.
+func clinicCaresFor(clinicID, patientID string) (bool, error) {
+	var cares bool
+	err := utils.DB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM users WHERE unique_user_id = $2 AND role = 'Patient' AND registered_by = $1)
+			OR EXISTS(SELECT 1 FROM prescriptions WHERE clinic_id = $1 AND patient_id = $2 AND status <> $3)
+			OR EXISTS(SELECT 1 FROM referrals WHERE clinic_id = $1 AND patient_id = $2)
+			OR EXISTS(SELECT 1 FROM report_shares s JOIN reports r ON r.id = s.report_id
+				WHERE s.recipient_id = $1 AND r.patient_id = $2)
+	`, clinicID, patientID, models.PrescriptionDraft).Scan(&cares)
+	return cares, err
+}
+
+// requireClinicCare checks that the calling clinic cares for the patient (see
+// clinicCaresFor). Otherwise it answers 404, as if the patient did not exist.
+func requireClinicCare(c *gin.Context, patientID string) bool {
+	cares, err := clinicCaresFor(c.GetString("userID"), patientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if !cares {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Patient not found"})
+		return false
+	}
+	return true
+}
+
+// loadMedicalProfile fetches the allergy and condition records of a patient,
+// removed ones included.
+func loadMedicalProfile(patientID string) (models.MedicalProfile, error) {
+	profile := models.MedicalProfile{
+		PatientID:  patientID,
+		Allergies:  []models.PatientAllergy{},
+		Conditions: []models.PatientCondition{},
+	}
+
+	rows, err := utils.DB.Query(`
+		SELECT id, substance, COALESCE(reaction, ''), COALESCE(severity, ''), COALESCE(recorded_by, ''), created_at,
+			COALESCE(removed_by, ''), COALESCE(removal_reason, ''), removed_at
+		FROM patient_allergies
+		WHERE patient_id = $1
+		ORDER BY created_at
+	`, patientID)
+	if err != nil {
+		return profile, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		allergy := models.PatientAllergy{PatientID: patientID}
+		var createdAt time.Time
+		var removedAt sql.NullTime
+		if err := rows.Scan(&allergy.ID, &allergy.Substance, &allergy.Reaction, &allergy.Severity, &allergy.RecordedBy, &createdAt,
+			&allergy.RemovedBy, &allergy.RemovalReason, &removedAt); err != nil {
+			return profile, err
+		}
+		allergy.CreatedAt = createdAt.Unix()
+		if removedAt.Valid {
+			allergy.RemovedAt = removedAt.Time.Unix()
+		}
+		profile.Allergies = append(profile.Allergies, allergy)
+	}
+	if err := rows.Err(); err != nil {
+		return profile, err
+	}
+
+	condRows, err := utils.DB.Query(`
+		SELECT id, condition, COALESCE(notes, ''), COALESCE(recorded_by, ''), created_at,
+			COALESCE(removed_by, ''), COALESCE(removal_reason, ''), removed_at
+		FROM patient_conditions
+		WHERE patient_id = $1
+		ORDER BY created_at
+	`, patientID)
+	if err != nil {
+		return profile, err
+	}
+	defer condRows.Close()
+
+	for condRows.Next() {
+		condition := models.PatientCondition{PatientID: patientID}
+		var createdAt time.Time
+		var removedAt sql.NullTime
+		if err := condRows.Scan(&condition.ID, &condition.Condition, &condition.Notes, &condition.RecordedBy, &createdAt,
+			&condition.RemovedBy, &condition.RemovalReason, &removedAt); err != nil {
+			return profile, err
+		}
+		condition.CreatedAt = createdAt.Unix()
+		if removedAt.Valid {
+			condition.RemovedAt = removedAt.Time.Unix()
+		}
+		profile.Conditions = append(profile.Conditions, condition)
+	}
+
+	return profile, condRows.Err()
+}
+
+// GetPatientMedicalProfile handles GET /v1/clinic/patients/:id/medical-profile
+// Returns the patient's recorded allergies and conditions to a clinic that
+// cares for them (see clinicCaresFor); other clinics get a 404.
+func GetPatientMedicalProfile(c *gin.Context) {
+	patientID := c.Param("id")
+	if !requireClinicCare(c, patientID) {
+		return
+	}
+
+	profile, err := loadMedicalProfile(patientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch medical profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// GetMyMedicalProfile handles GET /v1/patient/medical-profile
+// Lets the authenticated patient view (but not edit) their allergies and conditions.
+func GetMyMedicalProfile(c *gin.Context) {
+	profile, err := loadMedicalProfile(c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch medical profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// AddPatientAllergy handles POST /v1/clinic/patients/:id/allergies
+// Records an allergy to an ingredient or drug class (e.g., "penicillin") for a
+// patient the clinic cares for.
+func AddPatientAllergy(c *gin.Context) {
+	patientID := c.Param("id")
+	var allergy models.PatientAllergy
+
+	if err := c.ShouldBindJSON(&allergy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid allergy data format"})
+		return
+	}
+
+	allergy.Substance = ingredientKey(allergy.Substance)
+	if allergy.Substance == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Allergy substance is required"})
+		return
+	}
+
+	if !requireClinicCare(c, patientID) {
+		return
+	}
+
+	allergy.PatientID = patientID
+	allergy.RecordedBy = c.GetString("userID")
+
+	var createdAt time.Time
+	err := utils.DB.QueryRow(`
+		INSERT INTO patient_allergies (patient_id, substance, reaction, severity, recorded_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, allergy.PatientID, allergy.Substance, allergy.Reaction, allergy.Severity, allergy.RecordedBy).Scan(&allergy.ID, &createdAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save allergy"})
+		return
+	}
+	allergy.CreatedAt = createdAt.Unix()
+
+	c.JSON(http.StatusCreated, allergy)
+}
+
+// DeletePatientAllergy handles DELETE /v1/clinic/patients/:id/allergies/:allergyId
+// See deleteMedicalRecord.
+func DeletePatientAllergy(c *gin.Context) {
+	deleteMedicalRecord(c, "patient_allergies", c.Param("allergyId"))
+}
+
+// AddPatientCondition handles POST /v1/clinic/patients/:id/conditions
+// Records a condition such as "pregnancy" or "renal_impairment" for a patient
+// the clinic cares for.
+func AddPatientCondition(c *gin.Context) {
+	patientID := c.Param("id")
+	var condition models.PatientCondition
+
+	if err := c.ShouldBindJSON(&condition); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid condition data format"})
+		return
+	}
+
+	condition.Condition = conditionKey(condition.Condition)
+	if condition.Condition == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Condition is required"})
+		return
+	}
+
+	if !requireClinicCare(c, patientID) {
+		return
+	}
+
+	condition.PatientID = patientID
+	condition.RecordedBy = c.GetString("userID")
+
+	var createdAt time.Time
+	err := utils.DB.QueryRow(`
+		INSERT INTO patient_conditions (patient_id, condition, notes, recorded_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`, condition.PatientID, condition.Condition, condition.Notes, condition.RecordedBy).Scan(&condition.ID, &createdAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save condition"})
+		return
+	}
+	condition.CreatedAt = createdAt.Unix()
+
+	c.JSON(http.StatusCreated, condition)
+}
+
+// DeletePatientCondition handles DELETE /v1/clinic/patients/:id/conditions/:conditionId
+// See deleteMedicalRecord.
+func DeletePatientCondition(c *gin.Context) {
+	deleteMedicalRecord(c, "patient_conditions", c.Param("conditionId"))
+}
+
+// deleteMedicalRecord removes one allergy or condition of a patient the clinic
+// cares for. The clinic that recorded it deletes it outright; any other clinic
+// must give a {"reason": ...}, and the record is only marked removed, staying in
+// the medical profile with who removed it and why.
+// table is always a constant chosen by the caller, never user input.
+func deleteMedicalRecord(c *gin.Context, table, recordID string) {
+	id, err := strconv.ParseInt(recordID, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid record ID"})
+		return
+	}
+	patientID := c.Param("id")
+	if !requireClinicCare(c, patientID) {
+		return
+	}
+	clinicID := c.GetString("userID")
+
+	var recordedBy string
+	err = utils.DB.QueryRow(`
+		SELECT COALESCE(recorded_by, '') FROM `+table+`
+		WHERE id = $1 AND patient_id = $2 AND removed_at IS NULL
+	`, id, patientID).Scan(&recordedBy)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Record not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete record"})
+		return
+	}
+
+	if recordedBy == clinicID {
+		if _, err := utils.DB.Exec(`DELETE FROM `+table+` WHERE id = $1 AND recorded_by = $2`, id, clinicID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete record"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Record deleted successfully."})
+		return
+	}
+
+	reason, ok := bindReason(c)
+	if !ok {
+		return
+	}
+	result, err := utils.DB.Exec(`
+		UPDATE `+table+` SET removed_by = $1, removal_reason = $2, removed_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND removed_at IS NULL
+	`, clinicID, reason, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete record"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Record not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Record marked as removed; as another clinic recorded it, it stays in the medical profile."})
+}
+
@@ -19,20 +19,23 @@ func LoginHandler(c *gin.Context) {
 	// Query the database for the user
 	var user models.User
 	query := `
-		SELECT unique_user_id, name, role, hashed_password 
+		SELECT unique_user_id, name, role, hashed_password, disabled_at IS NOT NULL
 		FROM users 
 		WHERE mobile_number = $1
 	`
 	
+	var disabled bool
 	err := utils.DB.QueryRow(query, req.Mobile).Scan(
 		&user.ID,
 		&user.Name,
 		&user.Role,
 		&user.Password,
+		&disabled,
 	)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
+			recordLogin(c, models.LoginEvent{Mobile: req.Mobile, Method: models.LoginPassword, FailureReason: "Unknown mobile number"})
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid mobile number or password"})
 			return
 		}
@@ -43,9 +46,15 @@ func LoginHandler(c *gin.Context) {
 	// Verify password (in production, use bcrypt.CompareHashAndPassword)
 	// For now, we're comparing plain text as per init.sql
 	if user.Password != req.Password {
+		recordLogin(c, models.LoginEvent{UserID: user.ID, Mobile: req.Mobile, Method: models.LoginPassword, FailureReason: "Wrong password"})
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid mobile number or password"})
 		return
 	}
+	if disabled {
+		recordLogin(c, models.LoginEvent{UserID: user.ID, Mobile: req.Mobile, Method: models.LoginPassword, FailureReason: "Account disabled"})
+		c.JSON(http.StatusForbidden, gin.H{"error": "This account is disabled"})
+		return
+	}
 
 	// Generate JWT token
 	token, err := utils.GenerateToken(user.ID, user.Role)
@@ -54,6 +63,8 @@ func LoginHandler(c *gin.Context) {
 		return
 	}
 
+	recordLogin(c, models.LoginEvent{UserID: user.ID, Mobile: req.Mobile, Method: models.LoginPassword, Success: true})
+
 	response := models.LoginResponse{
 		Token: token,
 		Role:  user.Role,
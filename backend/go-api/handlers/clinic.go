@@ -4,7 +4,6 @@ import (
 	"net/http"
 	"github.com/gin-gonic/gin"
 	"Medibridge/go-api/models"
-	"Medibridge/go-api/utils"
 )
 
 // CreateNewPrescription handles POST /v1/clinic/prescriptions/new
@@ -18,19 +17,35 @@ func CreateNewPrescription(c *gin.Context) {
 		return
 	}
 
-	// 1. Save the structured data to PostgreSQL.
+	if prescriptionData.PatientID == "" || len(prescriptionData.Instructions) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "patient_id and at least one instruction are required"})
+		return
+	}
 	prescriptionData.ClinicID = clinicID
-	// TODO: Add PostgreSQL INSERT logic, ensuring sensitive patient data is Encrypted (utils.Encrypt).
-	
-	// 2. Trigger internal gRPC call to Python AI Service for translation and audio generation.
-	if err := utils.TriggerTranslationAndAudio(prescriptionData); err != nil {
-		// Log error but may return 202 Accepted if saving the original record succeeded
-		c.JSON(http.StatusAccepted, gin.H{"message": "Prescription saved, but AI translation failed. Check AI Service logs."}) 
+	prescriptionData.PrescribedBy = c.GetInt64("memberID")
+	prescriptionData.RefillOf = ""
+	if err := normalizeRefills(&prescriptionData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 1. Run the safety checks against the new drugs and the patient's active prescriptions.
+	// Blocking warnings are returned to the doctor, who must resubmit with override_warnings set.
+	if !runSafetyChecks(c, &prescriptionData) {
+		return
+	}
+
+	// 2. Save the structured data to PostgreSQL as version 1 (diagnosis is encrypted by insertPrescription).
+	prescriptionData.Status = models.PrescriptionIssued
+	if err := insertPrescription(&prescriptionData); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save prescription"})
 		return
 	}
 
-	// 3. This action immediately pushes the complete digital prescription to the Patient App.
-	c.JSON(http.StatusOK, gin.H{"message": "Prescription created, saved, and AI processing triggered successfully."})
+	// 3. Trigger internal gRPC call to Python AI Service for translation and audio generation,
+	// and push the complete digital prescription to the Patient App.
+	respondPrescriptionIssued(c, prescriptionData, models.ChangeIssued, "",
+		"Prescription created, saved, and AI processing triggered successfully.")
 }
 
 // SearchPatients handles GET /v1/clinic/patients/search
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"Medibridge/go-api/models"
+	"Medibridge/go-api/utils"
+)
+
+// patientMetrics holds the patient data needed for the dose range checks.
+// Zero values mean the metric is unknown.
+type patientMetrics struct {
+	AgeYears float64
+	WeightKg float64
+}
+
+var (
+	// strengthPattern matches strengths such as "500 mg", "1g", "250 mcg" and "125 mg/5 ml".
+	strengthPattern = regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)\s*(mg|mcg|µg|ug|gm|g)\b(?:\s*/\s*(\d+(?:\.\d+)?)?\s*ml\b)?`)
+	// quantityPattern matches quantities such as "1 Tablet", "1/2 tab", "2" and "5 ml".
+	quantityPattern = regexp.MustCompile(`(?i)^\s*(\d+(?:\.\d+)?)(?:\s*/\s*(\d+))?\s*([a-zµ]*)`)
+	// numberPattern extracts the leading number of a vitals value such as "18.5 kg".
+	numberPattern = regexp.MustCompile(`\d+(?:\.\d+)?`)
+	// timesPerDayPattern matches frequencies such as "3 times a day" or "2x daily".
+	timesPerDayPattern = regexp.MustCompile(`(?i)(\d+)\s*(?:times|x)\b`)
+	// scheduleNotationPattern matches the common Indian "1-0-1" morning-noon-night notation.
+	scheduleNotationPattern = regexp.MustCompile(`^\s*\d+(?:\.\d+)?(?:\s*-\s*\d+(?:\.\d+)?)+\s*$`)
+)
+
+// frequencyCodes maps the usual prescription abbreviations to doses per day.
+var frequencyCodes = map[string]int{
+	"od": 1, "qd": 1, "hs": 1, "once daily": 1, "once a day": 1,
+	"bd": 2, "bid": 2, "twice daily": 2, "twice a day": 2,
+	"tds": 3, "tid": 3, "thrice daily": 3,
+	"qid": 4, "qds": 4,
+}
+
+// timesOfDay are the schedule words the clinic app sends in Frequency ("Morning, Night").
+var timesOfDay = map[string]bool{
+	"morning": true, "afternoon": true, "noon": true, "evening": true, "night": true, "bedtime": true,
+}
+
+// loadPatientMetrics returns the patient's age and weight, preferring the vitals
+// recorded at this visit over the stored profile.
+func loadPatientMetrics(patientID string, vitals map[string]string) (patientMetrics, error) {
+	var metrics patientMetrics
+
+	var dob sql.NullTime
+	var weight sql.NullFloat64
+	err := utils.DB.QueryRow(
+		`SELECT date_of_birth, weight_kg FROM users WHERE unique_user_id = $1`,
+		patientID,
+	).Scan(&dob, &weight)
+	if err != nil && err != sql.ErrNoRows {
+		return metrics, err
+	}
+	if dob.Valid {
+		metrics.AgeYears = time.Since(dob.Time).Hours() / 24 / 365.25
+	}
+	if weight.Valid {
+		metrics.WeightKg = weight.Float64
+	}
+
+	for key, value := range vitals {
+		number, err := strconv.ParseFloat(numberPattern.FindString(value), 64)
+		if err != nil || number <= 0 {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "age", "age_years":
+			metrics.AgeYears = number
+		case "weight", "weight_kg":
+			metrics.WeightKg = number
+		}
+	}
+
+	return metrics, nil
+}
+
+// parseStrength converts a strength to mg per unit. For liquids ("125 mg/5 ml") it
+// also returns the volume in ml that the amount refers to.
+func parseStrength(strength string) (mg float64, perML float64, ok bool) {
+	match := strengthPattern.FindStringSubmatch(strength)
+	if match == nil {
+		return 0, 0, false
+	}
+
+	amount, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	switch strings.ToLower(match[2]) {
+	case "g", "gm":
+		amount *= 1000
+	case "mcg", "µg", "ug":
+		amount /= 1000
+	}
+
+	if strings.Contains(strings.ToLower(match[0]), "ml") {
+		perML = 1
+		if match[3] != "" {
+			perML, _ = strconv.ParseFloat(match[3], 64)
+		}
+		if perML <= 0 {
+			return 0, 0, false
+		}
+	}
+	return amount, perML, true
+}
+
+// parseQuantity parses a dosage quantity into an amount and its unit ("ml" for
+// liquids, "mg" for direct amounts, or "unit" for tablets, capsules and the like).
+func parseQuantity(quantity string) (float64, string, bool) {
+	match := quantityPattern.FindStringSubmatch(quantity)
+	if match == nil {
+		return 0, "", false
+	}
+
+	amount, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, "", false
+	}
+	if match[2] != "" {
+		denominator, err := strconv.ParseFloat(match[2], 64)
+		if err != nil || denominator == 0 {
+			return 0, "", false
+		}
+		amount /= denominator
+	}
+
+	switch strings.ToLower(match[3]) {
+	case "ml":
+		return amount, "ml", true
+	case "mg":
+		return amount, "mg", true
+	case "g", "gm":
+		return amount * 1000, "mg", true
+	case "mcg", "µg", "ug":
+		return amount / 1000, "mg", true
+	}
+	return amount, "unit", true
+}
+
+// singleDoseMg works out the amount of drug taken per dose, in mg.
+func singleDoseMg(instr models.DosageInstruction) (float64, bool) {
+	quantity := instr.DosageQuantity
+	if strings.TrimSpace(quantity) == "" {
+		quantity = "1"
+	}
+	amount, unit, ok := parseQuantity(quantity)
+	if !ok {
+		return 0, false
+	}
+	if unit == "mg" {
+		return amount, true
+	}
+
+	// Fall back to the strength in the drug name ("Amoxicillin 500 mg").
+	mg, perML, ok := parseStrength(instr.Strength)
+	if !ok {
+		mg, perML, ok = parseStrength(instr.DrugName)
+	}
+	if !ok {
+		return 0, false
+	}
+
+	switch {
+	case unit == "ml" && perML > 0:
+		return mg * amount / perML, true
+	case unit == "unit" && perML == 0:
+		return mg * amount, true
+	}
+	return 0, false // e.g., "1 spoon" of a syrup: the volume is unknown
+}
+
+// dosesPerDay works out how many doses a day a frequency describes.
+func dosesPerDay(frequency string) (int, bool) {
+	f := strings.ToLower(strings.TrimSpace(frequency))
+	if f == "" {
+		return 0, false
+	}
+	if n, ok := frequencyCodes[f]; ok {
+		return n, true
+	}
+	if match := timesPerDayPattern.FindStringSubmatch(f); match != nil {
+		n, err := strconv.Atoi(match[1])
+		return n, err == nil && n > 0
+	}
+	if scheduleNotationPattern.MatchString(f) {
+		n := 0
+		for _, part := range strings.Split(f, "-") {
+			if value, err := strconv.ParseFloat(strings.TrimSpace(part), 64); err == nil && value > 0 {
+				n++
+			}
+		}
+		return n, n > 0
+	}
+
+	n := 0
+	for _, part := range strings.FieldsFunc(f, func(r rune) bool { return r == ',' || r == '/' || r == '&' || r == '+' }) {
+		for _, word := range strings.Fields(part) {
+			if timesOfDay[word] {
+				n++
+				break
+			}
+		}
+	}
+	return n, n > 0
+}
+
+// checkDoseRanges compares each prescribed dose against the drug's dosing limits,
+// using weight-based limits for children when their weight is known.
+func checkDoseRanges(catalog drugCatalog, instructions []models.DosageInstruction, patient patientMetrics) []models.SafetyWarning {
+	warnings := []models.SafetyWarning{}
+
+	for _, instr := range instructions {
+		limits := catalog.groups(instr.DrugName).Limits
+		if limits == (models.DoseLimits{}) {
+			continue // No limits configured for this drug
+		}
+
+		dose, ok := singleDoseMg(instr)
+		if !ok {
+			warnings = append(warnings, doseWarning(instr, models.SeverityMinor,
+				fmt.Sprintf("Could not work out the dose of %s from strength %q and quantity %q; the dose was not checked.",
+					instr.DrugName, instr.Strength, instr.DosageQuantity)))
+			continue
+		}
+
+		maxSingle, maxDaily := limits.MaxSingleDoseMg, limits.MaxDailyDoseMg
+		basis := "adult"
+		pediatric := patient.AgeYears > 0 && patient.AgeYears < models.PediatricAgeYears
+		hasPediatricLimits := limits.PediatricMaxSingleMgPerKg > 0 || limits.PediatricMaxDailyMgPerKg > 0
+		if pediatric && hasPediatricLimits {
+			if patient.WeightKg <= 0 {
+				warnings = append(warnings, doseWarning(instr, models.SeverityModerate,
+					fmt.Sprintf("Patient is %.0f years old but no weight is recorded, so the weight-based dose of %s could not be checked. Record the weight in vitals.",
+						patient.AgeYears, instr.DrugName)))
+			} else {
+				basis = fmt.Sprintf("pediatric, %.1f kg", patient.WeightKg)
+				if limits.PediatricMaxSingleMgPerKg > 0 {
+					maxSingle = minPositive(maxSingle, limits.PediatricMaxSingleMgPerKg*patient.WeightKg)
+				}
+				if limits.PediatricMaxDailyMgPerKg > 0 {
+					maxDaily = minPositive(maxDaily, limits.PediatricMaxDailyMgPerKg*patient.WeightKg)
+				}
+			}
+		}
+
+		if maxSingle > 0 && dose > maxSingle {
+			warnings = append(warnings, doseWarning(instr, models.SeverityMajor,
+				fmt.Sprintf("Single dose of %s is %s mg, above the maximum of %s mg (%s).",
+					instr.DrugName, formatMg(dose), formatMg(maxSingle), basis)))
+		}
+		if limits.MinSingleDoseMg > 0 && dose < limits.MinSingleDoseMg {
+			warnings = append(warnings, doseWarning(instr, models.SeverityMinor,
+				fmt.Sprintf("Single dose of %s is %s mg, below the usual minimum of %s mg.",
+					instr.DrugName, formatMg(dose), formatMg(limits.MinSingleDoseMg))))
+		}
+
+		if maxDaily > 0 {
+			if perDay, ok := dosesPerDay(instr.Frequency); ok && dose*float64(perDay) > maxDaily {
+				warnings = append(warnings, doseWarning(instr, models.SeverityMajor,
+					fmt.Sprintf("Daily dose of %s is %s mg (%s mg x %d), above the maximum of %s mg per day (%s).",
+						instr.DrugName, formatMg(dose*float64(perDay)), formatMg(dose), perDay, formatMg(maxDaily), basis)))
+			}
+		}
+	}
+
+	return warnings
+}
+
+// doseWarning builds a dose range warning for one instruction.
+func doseWarning(instr models.DosageInstruction, severity, message string) models.SafetyWarning {
+	return models.SafetyWarning{
+		Type:     models.WarningDoseRange,
+		Severity: severity,
+		Drugs:    []string{instr.DrugName},
+		Message:  message,
+	}
+}
+
+// minPositive returns the smaller of two limits, ignoring a zero (unset) limit.
+func minPositive(a, b float64) float64 {
+	if a <= 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// formatMg formats an mg amount to at most two decimals, e.g., 500 or 12.5.
+func formatMg(mg float64) string {
+	return strconv.FormatFloat(math.Round(mg*100)/100, 'f', -1, 64)
+}
@@ -0,0 +1,563 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"Medibridge/go-api/models"
+	"Medibridge/go-api/utils"
+)
+
+// errVersionNotFound is returned when a catalog version ID does not exist.
+var errVersionNotFound = errors.New("catalog version not found")
+
+// catalogFileError is a catalog file that could not be read or parsed, as
+// opposed to a failure to stage or apply it.
+type catalogFileError struct {
+	Err error
+}
+
+func (e *catalogFileError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *catalogFileError) Unwrap() error {
+	return e.Err
+}
+
+// DrugImportResult is the outcome of staging a catalog file.
+type DrugImportResult struct {
+	Version   models.DrugCatalogVersion `json:"version"`
+	Diff      models.DrugCatalogDiff    `json:"diff"`
+	Errors    []models.DrugImportError  `json:"errors,omitempty"`
+	Unchanged bool                      `json:"unchanged"` // Same file as the current version
+}
+
+// DrugImportOptions describes a catalog file and what to do with it.
+type DrugImportOptions struct {
+	Source    string            // File name recorded on the version
+	Format    string            // csv, json or xlsx; detected from Source when empty
+	ColumnMap map[string]string // Source column -> catalog column, e.g., "Product Name" -> "name"
+	CreatedBy string
+	Apply     bool // Make the version live instead of staging it for review
+}
+
+// ensureCatalogVersionTables creates the tables that hold staged and past catalog versions.
+func ensureCatalogVersionTables() error {
+	_, err := utils.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS drug_catalog_versions (
+			id BIGSERIAL PRIMARY KEY,
+			source VARCHAR(255),
+			checksum VARCHAR(64),
+			created_by VARCHAR(50),
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			is_current BOOLEAN NOT NULL DEFAULT FALSE,
+			drug_count INT NOT NULL DEFAULT 0,
+			added INT NOT NULL DEFAULT 0,
+			changed INT NOT NULL DEFAULT 0,
+			removed INT NOT NULL DEFAULT 0,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			applied_at TIMESTAMP WITH TIME ZONE
+		);
+
+		CREATE TABLE IF NOT EXISTS drug_catalog_version_drugs (
+			version_id BIGINT NOT NULL REFERENCES drug_catalog_versions(id) ON DELETE CASCADE,
+			drug_id VARCHAR(50) NOT NULL,
+			data JSONB NOT NULL,
+			PRIMARY KEY (version_id, drug_id)
+		);
+	`)
+	return err
+}
+
+// importDrugCatalog parses and validates a whole catalog file, stages it as a new
+// pending version and, when opts.Apply is set, makes it the live catalog.
+// Files with invalid rows are rejected with every row error and nothing is staged;
+// the live catalog is never touched until a fully valid version is applied.
+// Files that cannot be read or parsed fail with a *catalogFileError.
+func importDrugCatalog(r io.Reader, opts DrugImportOptions) (DrugImportResult, error) {
+	result := DrugImportResult{}
+
+	format := opts.Format
+	if format == "" {
+		format = utils.DetectFormat(opts.Source)
+	}
+
+	hash := sha256.New()
+	rows, err := utils.NewRowReader(format, io.TeeReader(r, hash), opts.ColumnMap)
+	if err != nil {
+		return result, &catalogFileError{err}
+	}
+	drugs, rowErrors, err := parseDrugCatalog(rows)
+	if err != nil {
+		return result, &catalogFileError{err}
+	}
+	// Parsers may stop before the end of the input; hash all of it.
+	if _, err := io.Copy(io.Discard, io.TeeReader(r, hash)); err != nil {
+		return result, &catalogFileError{err}
+	}
+	if len(rowErrors) > 0 {
+		result.Errors = rowErrors
+		return result, nil
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+
+	if err := ensureDrugTable(); err != nil {
+		return result, err
+	}
+
+	// Skip re-importing the file the live catalog was built from (e.g., on every restart).
+	current, err := currentCatalogVersion()
+	if err != nil && err != errVersionNotFound {
+		return result, err
+	}
+	if err == nil && current.checksum == checksum {
+		result.Version = current.DrugCatalogVersion
+		result.Unchanged = true
+		return result, nil
+	}
+
+	live, err := loadLiveDrugs()
+	if err != nil {
+		return result, err
+	}
+	result.Diff = diffDrugCatalogs(live, drugs)
+
+	result.Version, err = stageCatalogVersion(drugs, result.Diff, opts.Source, checksum, opts.CreatedBy)
+	if err != nil {
+		return result, err
+	}
+
+	if opts.Apply {
+		if err := applyCatalogVersion(result.Version.ID); err != nil {
+			return result, err
+		}
+		result.Version.Status = models.CatalogVersionApplied
+		result.Version.IsCurrent = true
+		result.Version.AppliedAt = time.Now().Unix()
+	}
+
+	return result, nil
+}
+
+// parseDrugCatalog reads every row of a catalog file, collecting row errors with
+// their line numbers instead of skipping bad rows.
+func parseDrugCatalog(rows utils.RowReader) ([]models.Drug, []models.DrugImportError, error) {
+	drugs := []models.Drug{}
+	rowErrors := []models.DrugImportError{}
+	seen := map[string]int{}
+	checkedHeader := false
+
+	for {
+		row, err := rows.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var rowErr *utils.RowError
+			if errors.As(err, &rowErr) {
+				rowErrors = append(rowErrors, models.DrugImportError{Line: rowErr.Line, Message: rowErr.Err.Error()})
+				continue
+			}
+			return nil, nil, err
+		}
+		if !checkedHeader {
+			if _, ok := row.Fields["name"]; !ok {
+				return nil, nil, fmt.Errorf("file must have a 'name' column (map one with the column mapping)")
+			}
+			checkedHeader = true
+		}
+
+		drug, err := parseDrugRecord(row.Fields)
+		if err != nil {
+			rowErrors = append(rowErrors, models.DrugImportError{Line: row.Line, Message: err.Error()})
+			continue
+		}
+		if first, ok := seen[drug.ID]; ok {
+			rowErrors = append(rowErrors, models.DrugImportError{
+				Line:    row.Line,
+				Message: fmt.Sprintf("duplicate drug id %q (first used on line %d)", drug.ID, first),
+			})
+			continue
+		}
+		seen[drug.ID] = row.Line
+		drugs = append(drugs, drug)
+	}
+
+	if len(drugs) == 0 && len(rowErrors) == 0 {
+		rowErrors = append(rowErrors, models.DrugImportError{Line: 1, Message: "file contains no drugs"})
+	}
+	return drugs, rowErrors, nil
+}
+
+// loadLiveDrugs returns the live catalog keyed by drug ID.
+func loadLiveDrugs() (map[string]models.Drug, error) {
+	rows, err := utils.DB.Query(`SELECT ` + drugColumns + ` FROM drugs`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	live := map[string]models.Drug{}
+	for rows.Next() {
+		drug, err := scanDrug(rows)
+		if err != nil {
+			return nil, err
+		}
+		live[drug.ID] = drug
+	}
+	return live, rows.Err()
+}
+
+// diffDrugCatalogs lists the drugs added, changed and removed going from old to next.
+func diffDrugCatalogs(old map[string]models.Drug, next []models.Drug) models.DrugCatalogDiff {
+	diff := models.DrugCatalogDiff{
+		Added:   []models.DrugRef{},
+		Changed: []models.DrugChange{},
+		Removed: []models.DrugRef{},
+	}
+
+	inNext := map[string]bool{}
+	for _, drug := range next {
+		inNext[drug.ID] = true
+		previous, ok := old[drug.ID]
+		if !ok {
+			diff.Added = append(diff.Added, models.DrugRef{ID: drug.ID, Name: drug.Name})
+			continue
+		}
+		if fields := changedDrugFields(previous, drug); len(fields) > 0 {
+			diff.Changed = append(diff.Changed, models.DrugChange{ID: drug.ID, Name: drug.Name, Fields: fields})
+		}
+	}
+
+	for id, drug := range old {
+		if !inNext[id] {
+			diff.Removed = append(diff.Removed, models.DrugRef{ID: id, Name: drug.Name})
+		}
+	}
+	sort.Slice(diff.Removed, func(i, j int) bool { return diff.Removed[i].Name < diff.Removed[j].Name })
+
+	return diff
+}
+
+// changedDrugFields returns the JSON names of the fields that differ between two drugs.
+func changedDrugFields(a, b models.Drug) []string {
+	var fieldsA, fieldsB map[string]interface{}
+	rawA, _ := json.Marshal(a)
+	rawB, _ := json.Marshal(b)
+	json.Unmarshal(rawA, &fieldsA)
+	json.Unmarshal(rawB, &fieldsB)
+
+	changed := []string{}
+	for name, value := range fieldsA {
+		if isEmptyJSON(value) && isEmptyJSON(fieldsB[name]) {
+			continue // null, [] and {} all mean "no value"
+		}
+		if !reflect.DeepEqual(value, fieldsB[name]) {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// isEmptyJSON reports whether a decoded JSON value is null or an empty list or object.
+func isEmptyJSON(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// stageCatalogVersion stores a validated catalog as a new pending version in one transaction.
+func stageCatalogVersion(drugs []models.Drug, diff models.DrugCatalogDiff, source, checksum, createdBy string) (models.DrugCatalogVersion, error) {
+	version := models.DrugCatalogVersion{
+		Source:    source,
+		CreatedBy: createdBy,
+		Status:    models.CatalogVersionPending,
+		DrugCount: len(drugs),
+		Added:     len(diff.Added),
+		Changed:   len(diff.Changed),
+		Removed:   len(diff.Removed),
+	}
+
+	if err := ensureCatalogVersionTables(); err != nil {
+		return version, err
+	}
+
+	tx, err := utils.DB.Begin()
+	if err != nil {
+		return version, err
+	}
+	defer tx.Rollback()
+
+	var createdAt time.Time
+	err = tx.QueryRow(`
+		INSERT INTO drug_catalog_versions (source, checksum, created_by, status, drug_count, added, changed, removed)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`, source, checksum, createdBy, version.Status, version.DrugCount,
+		version.Added, version.Changed, version.Removed).Scan(&version.ID, &createdAt)
+	if err != nil {
+		return version, err
+	}
+	version.CreatedAt = createdAt.Unix()
+
+	for _, drug := range drugs {
+		data, err := json.Marshal(drug)
+		if err != nil {
+			return version, err
+		}
+		_, err = tx.Exec(
+			`INSERT INTO drug_catalog_version_drugs (version_id, drug_id, data) VALUES ($1, $2, $3)`,
+			version.ID, drug.ID, data,
+		)
+		if err != nil {
+			return version, err
+		}
+	}
+
+	return version, tx.Commit()
+}
+
+// loadVersionDrugs returns the drugs stored for a catalog version.
+func loadVersionDrugs(q interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}, versionID int64) ([]models.Drug, error) {
+	rows, err := q.Query(`SELECT data FROM drug_catalog_version_drugs WHERE version_id = $1`, versionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	drugs := []models.Drug{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var drug models.Drug
+		if err := json.Unmarshal(data, &drug); err != nil {
+			return nil, err
+		}
+		drugs = append(drugs, drug)
+	}
+	return drugs, rows.Err()
+}
+
+// applyCatalogVersion atomically replaces the live catalog with the drugs of a version.
+// Applying an earlier version is how a catalog import is rolled back.
+func applyCatalogVersion(versionID int64) error {
+	if err := ensureCatalogVersionTables(); err != nil {
+		return err
+	}
+
+	tx, err := utils.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRow(`SELECT id FROM drug_catalog_versions WHERE id = $1 FOR UPDATE`, versionID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return errVersionNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	// Serialize concurrent applies and imports. Plain reads still run and see
+	// the old catalog until the transaction commits.
+	if _, err := tx.Exec(`LOCK TABLE drugs IN EXCLUSIVE MODE`); err != nil {
+		return err
+	}
+
+	drugs, err := loadVersionDrugs(tx, versionID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM drugs`); err != nil {
+		return err
+	}
+	for _, drug := range drugs {
+		if err := upsertDrug(tx, drug); err != nil {
+			return fmt.Errorf("could not apply drug %s: %w", drug.ID, err)
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE drug_catalog_versions SET is_current = FALSE WHERE is_current`); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE drug_catalog_versions
+		SET status = $2, is_current = TRUE, applied_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, versionID, models.CatalogVersionApplied)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// The live catalog changed; searches must see the new drugs immediately.
+	if err := RebuildDrugSearchIndex(); err != nil {
+		log.Printf("Warning: Failed to rebuild drug search index: %v", err)
+	}
+	return nil
+}
+
+// catalogVersionRow is a version together with the checksum of its source file.
+type catalogVersionRow struct {
+	models.DrugCatalogVersion
+	checksum string
+}
+
+// catalogVersionColumns is the column list read by scanCatalogVersion.
+const catalogVersionColumns = `id, COALESCE(source, ''), COALESCE(checksum, ''), COALESCE(created_by, ''),
+	status, is_current, drug_count, added, changed, removed, created_at, applied_at`
+
+// scanCatalogVersion reads one row selected with catalogVersionColumns.
+func scanCatalogVersion(row rowScanner) (catalogVersionRow, error) {
+	var v catalogVersionRow
+	var createdAt time.Time
+	var appliedAt sql.NullTime
+	err := row.Scan(&v.ID, &v.Source, &v.checksum, &v.CreatedBy, &v.Status, &v.IsCurrent,
+		&v.DrugCount, &v.Added, &v.Changed, &v.Removed, &createdAt, &appliedAt)
+	if err != nil {
+		return v, err
+	}
+	v.CreatedAt = createdAt.Unix()
+	if appliedAt.Valid {
+		v.AppliedAt = appliedAt.Time.Unix()
+	}
+	return v, nil
+}
+
+// currentCatalogVersion returns the version the live catalog was built from.
+func currentCatalogVersion() (catalogVersionRow, error) {
+	if err := ensureCatalogVersionTables(); err != nil {
+		return catalogVersionRow{}, err
+	}
+	v, err := scanCatalogVersion(utils.DB.QueryRow(
+		`SELECT ` + catalogVersionColumns + ` FROM drug_catalog_versions WHERE is_current`,
+	))
+	if err == sql.ErrNoRows {
+		return v, errVersionNotFound
+	}
+	return v, err
+}
+
+// ListDrugCatalogVersions handles GET /v1/admin/drugs/versions
+// Returns every staged and applied catalog version, newest first.
+func ListDrugCatalogVersions(c *gin.Context) {
+	if err := ensureCatalogVersionTables(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch catalog versions"})
+		return
+	}
+
+	rows, err := utils.DB.Query(`SELECT ` + catalogVersionColumns + ` FROM drug_catalog_versions ORDER BY id DESC`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch catalog versions"})
+		return
+	}
+	defer rows.Close()
+
+	versions := []models.DrugCatalogVersion{}
+	for rows.Next() {
+		v, err := scanCatalogVersion(rows)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, v.DrugCatalogVersion)
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
+
+// GetDrugCatalogVersion handles GET /v1/admin/drugs/versions/:id
+// Returns a version with a preview of what applying it would change in the live catalog.
+func GetDrugCatalogVersion(c *gin.Context) {
+	versionID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version ID"})
+		return
+	}
+
+	if err := ensureCatalogVersionTables(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch catalog version"})
+		return
+	}
+
+	v, err := scanCatalogVersion(utils.DB.QueryRow(
+		`SELECT `+catalogVersionColumns+` FROM drug_catalog_versions WHERE id = $1`, versionID,
+	))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Catalog version not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch catalog version"})
+		return
+	}
+
+	drugs, err := loadVersionDrugs(utils.DB, versionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load catalog version drugs"})
+		return
+	}
+	live, err := loadLiveDrugs()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load the live catalog"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"version": v.DrugCatalogVersion,
+		"diff":    diffDrugCatalogs(live, drugs),
+	})
+}
+
+// ApplyDrugCatalogVersion handles POST /v1/admin/drugs/versions/:id/apply
+// Makes a staged version live, or rolls the catalog back to an earlier version.
+func ApplyDrugCatalogVersion(c *gin.Context) {
+	versionID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version ID"})
+		return
+	}
+
+	if err := applyCatalogVersion(versionID); err != nil {
+		if err == errVersionNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Catalog version not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply catalog version", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Drug catalog version applied successfully",
+		"version_id": versionID,
+	})
+}
@@ -0,0 +1,411 @@
+package handlers
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"Medibridge/go-api/models"
+	"Medibridge/go-api/utils"
+)
+
+const (
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+	// clinicFrequencyTTL is how long a clinic's prescribing counts are cached.
+	clinicFrequencyTTL = 5 * time.Minute
+)
+
+// searchTerm is one searchable name of a drug with the weight of a match on it.
+type searchTerm struct {
+	text   string
+	words  []string
+	weight float64
+}
+
+// indexedDrug is a catalog drug together with its searchable names.
+type indexedDrug struct {
+	drug  models.Drug
+	terms []searchTerm
+	// keys are the lowercase names and ingredient keys used to match prescribing counts.
+	keys []string
+}
+
+// drugSearchIndex is an in-memory index of the live catalog, rebuilt after every
+// catalog import so searches never hit the database.
+type drugSearchIndex struct {
+	mu       sync.RWMutex
+	built    bool
+	drugs    []indexedDrug
+	trigrams map[string][]int // trigram -> positions in drugs
+}
+
+// clinicFrequency caches how often a clinic has prescribed each drug.
+type clinicFrequency struct {
+	counts    map[string]int
+	fetchedAt time.Time
+}
+
+var (
+	searchIndex = &drugSearchIndex{}
+
+	frequencyMu    sync.Mutex
+	frequencyCache = map[string]clinicFrequency{}
+)
+
+// RebuildDrugSearchIndex reloads the search index from the live catalog.
+// It is called from main.go on startup and after a catalog version is applied.
+func RebuildDrugSearchIndex() error {
+	rows, err := utils.DB.Query(`SELECT ` + drugColumns + ` FROM drugs WHERE discontinued = FALSE`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	drugs := []indexedDrug{}
+	trigrams := map[string][]int{}
+	for rows.Next() {
+		drug, err := scanDrug(rows)
+		if err != nil {
+			return err
+		}
+
+		entry := newIndexedDrug(drug)
+		position := len(drugs)
+		seen := map[string]bool{}
+		for _, term := range entry.terms {
+			for _, gram := range trigramsOf(term.text) {
+				if !seen[gram] {
+					seen[gram] = true
+					trigrams[gram] = append(trigrams[gram], position)
+				}
+			}
+		}
+		drugs = append(drugs, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	searchIndex.mu.Lock()
+	searchIndex.drugs = drugs
+	searchIndex.trigrams = trigrams
+	searchIndex.built = true
+	searchIndex.mu.Unlock()
+
+	log.Printf("Drug search index rebuilt with %d drugs", len(drugs))
+	return nil
+}
+
+// newIndexedDrug collects the searchable names and prescribing-count keys of a drug.
+func newIndexedDrug(drug models.Drug) indexedDrug {
+	entry := indexedDrug{drug: drug}
+	entry.addTerm(drug.Name, 1.0)
+	entry.addTerm(drug.GenericName, 0.9)
+	for _, brand := range drug.BrandNames {
+		entry.addTerm(brand, 0.9)
+	}
+	for _, name := range drug.RegionalNames {
+		entry.addTerm(name, 0.8)
+	}
+	for _, key := range append([]string{strings.ToLower(drug.Name)}, drug.Ingredients...) {
+		if !containsString(entry.keys, key) {
+			entry.keys = append(entry.keys, key)
+		}
+	}
+	return entry
+}
+
+// addTerm adds a searchable name to the drug.
+func (d *indexedDrug) addTerm(text string, weight float64) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	if text == "" {
+		return
+	}
+	d.terms = append(d.terms, searchTerm{text: text, words: strings.Fields(text), weight: weight})
+}
+
+// SearchDrugs handles GET /v1/clinic/drugs/search?q=...&limit=...
+// Returns drugs ranked by how well their name, generic name or brand names match
+// the query (exact, prefix, word prefix, substring, then typo-tolerant matches),
+// boosted by how often the requesting clinic prescribes them. Drugs disabled in
+// the clinic's formulary are left out and its local drugs are searched too.
+func SearchDrugs(c *gin.Context) {
+	query := strings.ToLower(strings.TrimSpace(c.Query("q")))
+	if query == "" || len(query) < 2 {
+		c.JSON(http.StatusOK, []interface{}{})
+		return
+	}
+
+	limit := defaultSearchLimit
+	if value, err := strconv.Atoi(c.Query("limit")); err == nil && value > 0 {
+		limit = value
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	if err := ensureSearchIndex(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search drugs"})
+		return
+	}
+
+	clinicID := c.GetString("userID")
+	formulary, err := loadClinicFormulary(clinicID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search drugs"})
+		return
+	}
+	frequency := loadClinicFrequency(clinicID)
+
+	type hit struct {
+		drug  models.Drug
+		score float64
+	}
+	hits := []hit{}
+	consider := func(entry indexedDrug) {
+		if score := searchScore(query, entry, frequency); score > 0 {
+			hits = append(hits, hit{drug: entry.drug, score: score})
+		}
+	}
+
+	searchIndex.mu.RLock()
+	for _, position := range searchIndex.candidates(query) {
+		if entry := searchIndex.drugs[position]; !formulary.disabled[entry.drug.ID] {
+			consider(entry)
+		}
+	}
+	searchIndex.mu.RUnlock()
+
+	for _, drug := range formulary.local {
+		consider(newIndexedDrug(drug))
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		return hits[i].drug.Name < hits[j].drug.Name
+	})
+
+	drugs := []models.Drug{}
+	for i := 0; i < len(hits) && i < limit; i++ {
+		drugs = append(drugs, hits[i].drug)
+	}
+
+	c.JSON(http.StatusOK, drugs)
+}
+
+// searchScore scores a drug against the query: its best matching name, plus a
+// boost for how often the clinic prescribes it. Zero means no match.
+func searchScore(query string, entry indexedDrug, frequency map[string]int) float64 {
+	score := 0.0
+	for _, term := range entry.terms {
+		if s := matchScore(query, term) * term.weight; s > score {
+			score = s
+		}
+	}
+	if score == 0 {
+		return 0
+	}
+
+	// Prescribing frequency breaks ties and lifts the clinic's usual drugs,
+	// but never outranks a clearly better text match.
+	count := 0
+	for _, key := range entry.keys {
+		count += frequency[key]
+	}
+	return score + math.Min(maxFrequencyBoost, 5*math.Log2(1+float64(count)))
+}
+
+// maxFrequencyBoost caps the prescribing frequency boost below the smallest gap
+// between matchScore tiers (10, e.g., exact 100 over prefix at most 90), so a
+// frequently prescribed drug only moves up within its tier.
+const maxFrequencyBoost = 9
+
+// ensureSearchIndex builds the index on first use if startup could not.
+func ensureSearchIndex() error {
+	searchIndex.mu.RLock()
+	built := searchIndex.built
+	searchIndex.mu.RUnlock()
+	if built {
+		return nil
+	}
+	return RebuildDrugSearchIndex()
+}
+
+// candidates returns the drugs sharing at least one trigram with the query.
+// Very short queries have too few trigrams and are checked against every drug.
+// The caller must hold the read lock.
+func (idx *drugSearchIndex) candidates(query string) []int {
+	grams := trigramsOf(query)
+	if len([]rune(query)) < 4 || len(grams) == 0 {
+		all := make([]int, len(idx.drugs))
+		for i := range all {
+			all[i] = i
+		}
+		return all
+	}
+
+	seen := map[int]bool{}
+	positions := []int{}
+	for _, gram := range grams {
+		for _, position := range idx.trigrams[gram] {
+			if !seen[position] {
+				seen[position] = true
+				positions = append(positions, position)
+			}
+		}
+	}
+	return positions
+}
+
+// matchScore scores how well the query matches one searchable name.
+func matchScore(query string, term searchTerm) float64 {
+	switch {
+	case term.text == query:
+		return 100
+	case strings.HasPrefix(term.text, query):
+		// Prefer names where the query covers more of the name.
+		return 80 + 10*float64(len(query))/float64(len(term.text))
+	}
+	for _, word := range term.words {
+		if strings.HasPrefix(word, query) {
+			return 65
+		}
+	}
+	if strings.Contains(term.text, query) {
+		return 45
+	}
+
+	// Typo tolerance: compare against each word and against the start of the name,
+	// allowing one edit for short queries and two for longer ones.
+	queryLen := len([]rune(query))
+	maxEdits := 1
+	if queryLen > 5 {
+		maxEdits = 2
+	}
+	if queryLen < 3 {
+		return 0
+	}
+
+	best := maxEdits + 1
+	candidates := append([]string{}, term.words...)
+	if runes := []rune(term.text); len(runes) > queryLen {
+		candidates = append(candidates, string(runes[:queryLen]))
+	}
+	for _, candidate := range candidates {
+		if d := editDistance(query, candidate); d < best {
+			best = d
+		}
+	}
+	if best > maxEdits {
+		return 0
+	}
+	return 35 - 10*float64(best)
+}
+
+// editDistance is the optimal string alignment distance (Levenshtein plus
+// transpositions) between two strings.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	rows := make([][]int, len(ra)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(rb)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			best := rows[i-1][j] + 1
+			if v := rows[i][j-1] + 1; v < best {
+				best = v
+			}
+			if v := rows[i-1][j-1] + cost; v < best {
+				best = v
+			}
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				if v := rows[i-2][j-2] + 1; v < best {
+					best = v
+				}
+			}
+			rows[i][j] = best
+		}
+	}
+	return rows[len(ra)][len(rb)]
+}
+
+// trigramsOf returns the distinct three-letter sequences of a lowercase string.
+func trigramsOf(text string) []string {
+	runes := []rune(text)
+	seen := map[string]bool{}
+	grams := []string{}
+	for i := 0; i+3 <= len(runes); i++ {
+		gram := string(runes[i : i+3])
+		if strings.ContainsRune(gram, ' ') || seen[gram] {
+			continue
+		}
+		seen[gram] = true
+		grams = append(grams, gram)
+	}
+	return grams
+}
+
+// loadClinicFrequency returns how many prescriptions from the clinic included each
+// drug, keyed by lowercase drug name and ingredient key. Errors only disable the boost.
+func loadClinicFrequency(clinicID string) map[string]int {
+	if clinicID == "" {
+		return nil
+	}
+
+	frequencyMu.Lock()
+	cached, ok := frequencyCache[clinicID]
+	frequencyMu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < clinicFrequencyTTL {
+		return cached.counts
+	}
+
+	rows, err := utils.DB.Query(`
+		SELECT LOWER(TRIM(instr->>'drug_name')), COUNT(*)
+		FROM prescriptions, jsonb_array_elements(instructions) AS instr
+		WHERE clinic_id = $1 AND status <> 'draft'
+		GROUP BY 1
+	`, clinicID)
+	if err != nil {
+		log.Printf("Warning: Could not load prescribing frequency for %s: %v", clinicID, err)
+		return nil
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var name string
+		var count int
+		if err := rows.Scan(&name, &count); err != nil {
+			continue
+		}
+		counts[name] += count
+		if key := ingredientKey(name); key != name {
+			counts[key] += count
+		}
+	}
+
+	frequencyMu.Lock()
+	frequencyCache[clinicID] = clinicFrequency{counts: counts, fetchedAt: time.Now()}
+	frequencyMu.Unlock()
+
+	return counts
+}
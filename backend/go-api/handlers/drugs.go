@@ -1,148 +1,141 @@
 package handlers
 
 import (
-	"encoding/csv"
-	"io"
+	"database/sql"
+	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 
-	"github.com/gin-gonic/gin"
+	"Medibridge/go-api/models"
 	"Medibridge/go-api/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
 )
 
+// drugColumns is the column list read by scanDrug.
+const drugColumns = `id, name, COALESCE(type, ''), COALESCE(strength, ''), COALESCE(generic_name, ''),
+	COALESCE(ingredients, '{}'), COALESCE(brand_names, '{}'), COALESCE(drug_class, ''),
+	COALESCE(dosage_form, ''), COALESCE(route, ''), COALESCE(manufacturer, ''), COALESCE(schedule, ''),
+	COALESCE(pack_sizes, '{}'), COALESCE(regional_names, '{}'), COALESCE(contraindications, '{}'), discontinued,
+	COALESCE(min_single_dose_mg, 0), COALESCE(max_single_dose_mg, 0), COALESCE(max_daily_dose_mg, 0),
+	COALESCE(pediatric_max_single_mg_per_kg, 0), COALESCE(pediatric_max_daily_mg_per_kg, 0)`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
 // GetDrugDatabase handles GET /v1/clinic/drugs
-// Returns all drugs from the database
+// Returns all drugs from the database, as filtered by the requesting clinic's
+// formulary (disabled drugs removed, local drugs added). Discontinued drugs are
+// only included with ?include_discontinued=true.
 func GetDrugDatabase(c *gin.Context) {
-	query := `SELECT id, name, type, strength FROM drugs ORDER BY name`
-	
-	rows, err := utils.DB.Query(query)
+	formulary, err := loadClinicFormulary(c.GetString("userID"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch drugs"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch formulary"})
 		return
 	}
-	defer rows.Close()
 
-	type Drug struct {
-		ID       string `json:"id"`
-		Name     string `json:"name"`
-		Type     string `json:"type"`
-		Strength string `json:"strength"`
+	query := `SELECT ` + drugColumns + ` FROM drugs WHERE discontinued = FALSE OR $1 ORDER BY name`
+
+	rows, err := utils.DB.Query(query, c.Query("include_discontinued") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch drugs"})
+		return
 	}
+	defer rows.Close()
 
-	drugs := []Drug{}
+	drugs := []models.Drug{}
 	for rows.Next() {
-		var drug Drug
-		if err := rows.Scan(&drug.ID, &drug.Name, &drug.Type, &drug.Strength); err != nil {
+		drug, err := scanDrug(rows)
+		if err != nil {
 			continue
 		}
 		drugs = append(drugs, drug)
 	}
 
-	c.JSON(http.StatusOK, drugs)
+	c.JSON(http.StatusOK, applyFormulary(drugs, formulary))
 }
 
-// SearchDrugs handles GET /v1/clinic/drugs/search?q=...
-// Returns filtered drugs based on search query
-func SearchDrugs(c *gin.Context) {
-	query := c.Query("q")
-	if query == "" || len(query) < 2 {
-		c.JSON(http.StatusOK, []interface{}{})
-		return
-	}
+// defaultDrugCatalogPath is used when DRUG_CATALOG_PATH is not set.
+const defaultDrugCatalogPath = "/app/drugs.csv"
 
-	sqlQuery := `
-		SELECT id, name, type, strength 
-		FROM drugs 
-		WHERE LOWER(name) LIKE $1 
-		ORDER BY name 
-		LIMIT 10
-	`
-	
-	rows, err := utils.DB.Query(sqlQuery, "%"+strings.ToLower(query)+"%")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search drugs"})
-		return
-	}
-	defer rows.Close()
+// DrugCatalogSource returns the configured catalog file and how to read it:
+// DRUG_CATALOG_PATH, DRUG_CATALOG_FORMAT (csv, json or xlsx; detected from the
+// extension when empty) and DRUG_CATALOG_COLUMN_MAP ("Product Name=name;Company=manufacturer").
+func DrugCatalogSource() (string, DrugImportOptions, error) {
+	opts := DrugImportOptions{Format: strings.ToLower(os.Getenv("DRUG_CATALOG_FORMAT"))}
 
-	type Drug struct {
-		ID       string `json:"id"`
-		Name     string `json:"name"`
-		Type     string `json:"type"`
-		Strength string `json:"strength"`
+	catalogPath := os.Getenv("DRUG_CATALOG_PATH")
+	if catalogPath == "" {
+		catalogPath = defaultDrugCatalogPath
 	}
 
-	drugs := []Drug{}
-	for rows.Next() {
-		var drug Drug
-		if err := rows.Scan(&drug.ID, &drug.Name, &drug.Type, &drug.Strength); err != nil {
-			continue
+	if spec := os.Getenv("DRUG_CATALOG_COLUMN_MAP"); spec != "" {
+		mapping, err := utils.ParseColumnMapping(spec)
+		if err != nil {
+			return catalogPath, opts, fmt.Errorf("DRUG_CATALOG_COLUMN_MAP: %w", err)
 		}
-		drugs = append(drugs, drug)
+		opts.ColumnMap = mapping
 	}
-
-	c.JSON(http.StatusOK, drugs)
+	return catalogPath, opts, nil
 }
 
-// LoadDrugsFromCSV loads drugs from CSV file into database
-// This is called from main.go on startup
-func LoadDrugsFromCSV(filePath ...string) error {
-	// Default path
-	csvPath := "/app/drugs.csv"
+// LoadDrugCatalog loads the configured drug catalog file into the database,
+// or filePath when given. This is called from main.go on startup.
+func LoadDrugCatalog(filePath ...string) error {
+	catalogPath, opts, err := DrugCatalogSource()
+	if err != nil {
+		return err
+	}
 	if len(filePath) > 0 && filePath[0] != "" {
-		csvPath = filePath[0]
+		catalogPath = filePath[0]
 	}
 
-	// Check if file exists
-	if _, err := os.Stat(csvPath); os.IsNotExist(err) {
-		log.Printf("CSV file not found at %s, skipping drug database load", csvPath)
-		return nil // Not a critical error
+	// Make sure the catalog columns exist even when there is nothing to load
+	if err := ensureDrugTable(); err != nil {
+		return err
 	}
 
-	file, err := os.Open(csvPath)
-	if err != nil {
-		log.Printf("Warning: Could not open CSV file: %v", err)
-		return nil // Not critical
+	// Check if file exists
+	if _, err := os.Stat(catalogPath); os.IsNotExist(err) {
+		log.Printf("Drug catalog not found at %s, skipping drug database load", catalogPath)
+		return nil // Not a critical error
 	}
-	defer file.Close()
 
-	reader := csv.NewReader(file)
-	
-	// Read header
-	headers, err := reader.Read()
+	opts.CreatedBy = "system"
+	opts.Apply = true
+	result, err := ImportDrugCatalogFile(catalogPath, opts)
 	if err != nil {
 		return err
 	}
-
-	// Find column indices
-	nameIdx := -1
-	idIdx := -1
-	typeIdx := -1
-	strengthIdx := -1
-
-	for i, header := range headers {
-		h := strings.ToLower(strings.TrimSpace(header))
-		switch h {
-		case "name":
-			nameIdx = i
-		case "id":
-			idIdx = i
-		case "type":
-			typeIdx = i
-		case "strength":
-			strengthIdx = i
-		}
+	if len(result.Errors) > 0 {
+		first := result.Errors[0]
+		return fmt.Errorf("%s has %d invalid rows (line %d: %s); keeping the current catalog",
+			catalogPath, len(result.Errors), first.Line, first.Message)
 	}
-
-	if nameIdx == -1 {
-		log.Println("Warning: CSV must have a 'name' column")
+	if result.Unchanged {
+		log.Printf("Drug catalog unchanged since catalog version %d, skipping import", result.Version.ID)
 		return nil
 	}
 
-	// Create table if not exists
-	_, err = utils.DB.Exec(`
+	log.Printf("Successfully loaded %d drugs from %s as catalog version %d", result.Version.DrugCount, catalogPath, result.Version.ID)
+	return nil
+}
+
+// ensureDrugTable creates the drugs table if it does not exist and adds the
+// catalog, safety and dosing limit columns to tables created by older versions.
+func ensureDrugTable() error {
+	_, err := utils.DB.Exec(`
 		CREATE TABLE IF NOT EXISTS drugs (
 			id VARCHAR(50) PRIMARY KEY,
 			name VARCHAR(200) NOT NULL,
@@ -151,66 +144,203 @@ func LoadDrugsFromCSV(filePath ...string) error {
 		)
 	`)
 	if err != nil {
-		log.Printf("Failed to create drugs table: %v", err)
 		return err
 	}
 
-	// Clear existing data
-	_, err = utils.DB.Exec(`TRUNCATE TABLE drugs`)
+	_, err = utils.DB.Exec(`
+		ALTER TABLE drugs
+			ADD COLUMN IF NOT EXISTS generic_name VARCHAR(200),
+			ADD COLUMN IF NOT EXISTS ingredients TEXT[],
+			ADD COLUMN IF NOT EXISTS brand_names TEXT[],
+			ADD COLUMN IF NOT EXISTS drug_class VARCHAR(100),
+			ADD COLUMN IF NOT EXISTS dosage_form VARCHAR(50),
+			ADD COLUMN IF NOT EXISTS route VARCHAR(50),
+			ADD COLUMN IF NOT EXISTS manufacturer VARCHAR(200),
+			ADD COLUMN IF NOT EXISTS schedule VARCHAR(10),
+			ADD COLUMN IF NOT EXISTS pack_sizes TEXT[],
+			ADD COLUMN IF NOT EXISTS regional_names JSONB,
+			ADD COLUMN IF NOT EXISTS contraindications TEXT[],
+			ADD COLUMN IF NOT EXISTS discontinued BOOLEAN NOT NULL DEFAULT FALSE,
+			ADD COLUMN IF NOT EXISTS min_single_dose_mg NUMERIC,
+			ADD COLUMN IF NOT EXISTS max_single_dose_mg NUMERIC,
+			ADD COLUMN IF NOT EXISTS max_daily_dose_mg NUMERIC,
+			ADD COLUMN IF NOT EXISTS pediatric_max_single_mg_per_kg NUMERIC,
+			ADD COLUMN IF NOT EXISTS pediatric_max_daily_mg_per_kg NUMERIC
+	`)
+	return err
+}
+
+// scanDrug reads one row selected with drugColumns.
+func scanDrug(row rowScanner) (models.Drug, error) {
+	var drug models.Drug
+	var regionalNames []byte
+	limits := &drug.Limits
+
+	err := row.Scan(&drug.ID, &drug.Name, &drug.Type, &drug.Strength, &drug.GenericName,
+		pq.Array(&drug.Ingredients), pq.Array(&drug.BrandNames), &drug.Class,
+		&drug.DosageForm, &drug.Route, &drug.Manufacturer, &drug.Schedule,
+		pq.Array(&drug.PackSizes), &regionalNames, pq.Array(&drug.Contraindications), &drug.Discontinued,
+		&limits.MinSingleDoseMg, &limits.MaxSingleDoseMg, &limits.MaxDailyDoseMg,
+		&limits.PediatricMaxSingleMgPerKg, &limits.PediatricMaxDailyMgPerKg)
 	if err != nil {
-		log.Printf("Failed to clear drugs table: %v", err)
+		return drug, err
 	}
 
-	// Insert drugs
-	count := 0
-	for {
-		record, err := reader.Read()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			continue
-		}
+	drug.RegionalNames = map[string]string{}
+	if err := json.Unmarshal(regionalNames, &drug.RegionalNames); err != nil {
+		return drug, err
+	}
+	return drug, nil
+}
 
-		if len(record) <= nameIdx {
-			continue
-		}
+// parseDrugRecord builds a drug from one catalog row keyed by lowercase column
+// name; only "name" is required. List cells are semicolon-separated and regional
+// names come from "name_<language>" columns (e.g., "name_hi"), or from
+// "regional_names_<language>" as a JSON catalog's regional_names object is flattened.
+func parseDrugRecord(fields map[string]string) (models.Drug, error) {
+	field := func(column string) string {
+		return strings.TrimSpace(fields[column])
+	}
 
-		name := strings.TrimSpace(record[nameIdx])
-		if name == "" {
-			continue
+	drug := models.Drug{
+		ID:                field("id"),
+		Name:              field("name"),
+		Type:              field("type"),
+		Strength:          field("strength"),
+		GenericName:       field("generic_name"),
+		Ingredients:       splitList(field("ingredients"), strings.TrimSpace),
+		BrandNames:        splitList(field("brand_names"), strings.TrimSpace),
+		Class:             field("class"),
+		DosageForm:        field("dosage_form"),
+		Route:             field("route"),
+		Manufacturer:      field("manufacturer"),
+		Schedule:          field("schedule"),
+		PackSizes:         splitList(field("pack_sizes"), strings.TrimSpace),
+		Contraindications: splitList(field("contraindications"), strings.TrimSpace),
+		RegionalNames:     map[string]string{},
+	}
+
+	if err := normalizeDrug(&drug); err != nil {
+		return drug, err
+	}
+
+	switch strings.ToLower(field("discontinued")) {
+	case "true", "yes", "y", "1":
+		drug.Discontinued = true
+	}
+
+	for column := range fields {
+		for _, prefix := range []string{"name_", "regional_names_"} {
+			if lang := strings.TrimPrefix(column, prefix); lang != column && lang != "" {
+				if name := field(column); name != "" {
+					drug.RegionalNames[lang] = name
+				}
+			}
 		}
+	}
 
-		id := ""
-		if idIdx != -1 && idIdx < len(record) {
-			id = strings.TrimSpace(record[idIdx])
+	// Dosing limits in mg; empty cells mean no limit.
+	limits := []struct {
+		column string
+		value  *float64
+	}{
+		{"min_single_dose_mg", &drug.Limits.MinSingleDoseMg},
+		{"max_single_dose_mg", &drug.Limits.MaxSingleDoseMg},
+		{"max_daily_dose_mg", &drug.Limits.MaxDailyDoseMg},
+		{"pediatric_max_single_mg_per_kg", &drug.Limits.PediatricMaxSingleMgPerKg},
+		{"pediatric_max_daily_mg_per_kg", &drug.Limits.PediatricMaxDailyMgPerKg},
+	}
+	for _, limit := range limits {
+		cell := field(limit.column)
+		if cell == "" {
+			continue
 		}
-		if id == "" {
-			id = "drug-" + strings.ToLower(strings.ReplaceAll(name, " ", "-"))
+		value, err := strconv.ParseFloat(cell, 64)
+		if err != nil || value < 0 {
+			return drug, fmt.Errorf("invalid %s %q for %s", limit.column, cell, drug.Name)
 		}
+		*limit.value = value
+	}
 
-		drugType := "allopathy"
-		if typeIdx != -1 && typeIdx < len(record) {
-			drugType = strings.TrimSpace(record[typeIdx])
-		}
+	return drug, nil
+}
 
-		strength := ""
-		if strengthIdx != -1 && strengthIdx < len(record) {
-			strength = strings.TrimSpace(record[strengthIdx])
+// normalizeDrug validates a drug and fills in its defaults: the ID from the name,
+// the allopathy type, and the normalized ingredient, class and contraindication
+// keys. Ingredient and class groups drive the allergy and interaction checks;
+// without ingredients the generic name, then the drug name, is used.
+func normalizeDrug(drug *models.Drug) error {
+	drug.Name = strings.TrimSpace(drug.Name)
+	if drug.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if drug.ID == "" {
+		drug.ID = "drug-" + strings.ToLower(strings.ReplaceAll(drug.Name, " ", "-"))
+	}
+	if drug.Type == "" {
+		drug.Type = "allopathy"
+	}
+	drug.Schedule = strings.ToUpper(strings.TrimSpace(drug.Schedule))
+	if !models.DrugSchedules[drug.Schedule] {
+		return fmt.Errorf("unknown schedule %q for %s", drug.Schedule, drug.Name)
+	}
+
+	drug.Ingredients = splitList(strings.Join(drug.Ingredients, ";"), ingredientKey)
+	if len(drug.Ingredients) == 0 {
+		if key := ingredientKey(drug.GenericName); key != "" {
+			drug.Ingredients = []string{key}
+		} else {
+			drug.Ingredients = []string{ingredientKey(drug.Name)}
 		}
+	}
+	drug.Class = ingredientKey(drug.Class)
+	drug.Contraindications = splitList(strings.Join(drug.Contraindications, ";"), conditionKey)
+	if drug.RegionalNames == nil {
+		drug.RegionalNames = map[string]string{}
+	}
+	return nil
+}
+
+// upsertDrug inserts or replaces one drug. db is either utils.DB or a transaction.
+func upsertDrug(db execer, drug models.Drug) error {
+	regionalNames, err := json.Marshal(drug.RegionalNames)
+	if err != nil {
+		return err
+	}
 
-		_, err = utils.DB.Exec(`
-			INSERT INTO drugs (id, name, type, strength) 
-			VALUES ($1, $2, $3, $4)
-			ON CONFLICT (id) DO UPDATE 
-			SET name = $2, type = $3, strength = $4
-		`, id, name, drugType, strength)
+	_, err = db.Exec(`
+		INSERT INTO drugs (id, name, type, strength, generic_name, ingredients, brand_names, drug_class,
+			dosage_form, route, manufacturer, schedule, pack_sizes, regional_names, contraindications, discontinued,
+			min_single_dose_mg, max_single_dose_mg, max_daily_dose_mg,
+			pediatric_max_single_mg_per_kg, pediatric_max_daily_mg_per_kg)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
+		ON CONFLICT (id) DO UPDATE
+		SET name = $2, type = $3, strength = $4, generic_name = $5, ingredients = $6, brand_names = $7,
+			drug_class = $8, dosage_form = $9, route = $10, manufacturer = $11, schedule = $12, pack_sizes = $13,
+			regional_names = $14, contraindications = $15, discontinued = $16,
+			min_single_dose_mg = $17, max_single_dose_mg = $18, max_daily_dose_mg = $19,
+			pediatric_max_single_mg_per_kg = $20, pediatric_max_daily_mg_per_kg = $21
+	`, drug.ID, drug.Name, drug.Type, drug.Strength, drug.GenericName,
+		pq.Array(drug.Ingredients), pq.Array(drug.BrandNames), drug.Class,
+		drug.DosageForm, drug.Route, drug.Manufacturer, drug.Schedule,
+		pq.Array(drug.PackSizes), regionalNames, pq.Array(drug.Contraindications), drug.Discontinued,
+		nullIfZero(drug.Limits.MinSingleDoseMg), nullIfZero(drug.Limits.MaxSingleDoseMg), nullIfZero(drug.Limits.MaxDailyDoseMg),
+		nullIfZero(drug.Limits.PediatricMaxSingleMgPerKg), nullIfZero(drug.Limits.PediatricMaxDailyMgPerKg))
+	return err
+}
 
-		if err == nil {
-			count++
+// nullIfZero stores an unset (zero) limit as NULL.
+func nullIfZero(value float64) sql.NullFloat64 {
+	return sql.NullFloat64{Float64: value, Valid: value != 0}
+}
+
+// splitList splits a semicolon-separated CSV cell (e.g., "amoxicillin; clavulanic acid").
+func splitList(cell string, normalize func(string) string) []string {
+	items := []string{}
+	for _, item := range strings.Split(cell, ";") {
+		if item = normalize(strings.TrimSpace(item)); item != "" {
+			items = append(items, item)
 		}
 	}
-
-	log.Printf("Successfully loaded %d drugs from CSV", count)
-	return nil
-}
\ No newline at end of file
+	return items
+}
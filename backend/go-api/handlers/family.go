@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"Medibridge/go-api/models"
+	"Medibridge/go-api/utils"
+)
+
+// guardianPermissions are held by the account that created a dependent profile.
+var guardianPermissions = []string{models.ProfileView, models.ProfileLogAdherence, models.ProfileManage}
+
+// caregiverPermissions are the permissions a profile can delegate to a caregiver.
+var caregiverPermissions = []string{models.ProfileView, models.ProfileLogAdherence}
+
+// patientLinkColumns is the column list read by scanPatientLink.
+const patientLinkColumns = `l.id, l.patient_id, l.linked_user_id, u.name, l.relationship, l.permissions,
+	l.guardian, l.created_at`
+
+// scanPatientLink reads one row selected with patientLinkColumns, joined to the linked account as u.
+func scanPatientLink(row rowScanner) (models.PatientLink, error) {
+	var l models.PatientLink
+	var createdAt time.Time
+	err := row.Scan(&l.ID, &l.PatientID, &l.LinkedUserID, &l.LinkedName, &l.Relationship,
+		pq.Array(&l.Permissions), &l.Guardian, &createdAt)
+	l.CreatedAt = createdAt.Unix()
+	return l, err
+}
+
+// patientAccountOf returns the patient account that logged in, which differs
+// from userID while it acts on a linked profile.
+func patientAccountOf(c *gin.Context) string {
+	if caregiverID := c.GetString("caregiverID"); caregiverID != "" {
+		return caregiverID
+	}
+	return c.GetString("userID")
+}
+
+// profilePermissions returns what accountID may do on the profile of patientID;
+// it returns sql.ErrNoRows if the account has no access (any more).
+func profilePermissions(patientID, accountID string) ([]string, error) {
+	var permissions []string
+	err := utils.DB.QueryRow(`
+		SELECT permissions FROM patient_links
+		WHERE patient_id = $1 AND linked_user_id = $2 AND revoked_at IS NULL
+	`, patientID, accountID).Scan(pq.Array(&permissions))
+	return permissions, err
+}
+
+// linkedProfiles returns the profiles a patient account can act on: its own first,
+// then its dependents and the patients who made it their caregiver.
+func linkedProfiles(accountID string) ([]models.PatientProfile, error) {
+	self := models.PatientProfile{PatientID: accountID, Relationship: models.RelationshipSelf, Permissions: guardianPermissions}
+	var mobile sql.NullString
+	err := utils.DB.QueryRow(`SELECT name, mobile_number FROM users WHERE unique_user_id = $1`, accountID).Scan(&self.Name, &mobile)
+	if err != nil {
+		return nil, err
+	}
+	self.Dependent = !mobile.Valid
+
+	rows, err := utils.DB.Query(`
+		SELECT u.unique_user_id, u.name, l.relationship, l.permissions, u.mobile_number IS NULL
+		FROM patient_links l
+		JOIN users u ON u.unique_user_id = l.patient_id
+		WHERE l.linked_user_id = $1 AND l.revoked_at IS NULL
+		ORDER BY l.guardian DESC, u.name
+	`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := []models.PatientProfile{self}
+	for rows.Next() {
+		var p models.PatientProfile
+		if err := rows.Scan(&p.PatientID, &p.Name, &p.Relationship, pq.Array(&p.Permissions), &p.Dependent); err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, rows.Err()
+}
+
+// profileToken returns a token for accountID acting on the profile of patientID,
+// which is either the account itself or a profile linked to it.
+func profileToken(accountID, patientID string) (string, error) {
+	if patientID == accountID {
+		return utils.GenerateToken(accountID, "Patient")
+	}
+	return utils.GenerateProfileToken(patientID, accountID)
+}
+
+// ProfilePermissionMiddleware restricts guardians and caregivers acting on a
+// linked profile to the given permission. Patients acting on their own profile
+// are not affected.
+func ProfilePermissionMiddleware(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("caregiverID") == "" || containsString(c.GetStringSlice("profilePermissions"), permission) {
+			c.Next()
+			return
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied. Requires profile permission: " + permission})
+		c.Abort()
+	}
+}
+
+// ListMyProfiles handles GET /v1/patient/profiles
+// Returns the profiles the logged-in account can switch to, its own first.
+func ListMyProfiles(c *gin.Context) {
+	profiles, err := linkedProfiles(patientAccountOf(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch profiles"})
+		return
+	}
+	c.JSON(http.StatusOK, profiles)
+}
+
+// SwitchProfile handles POST /v1/patient/profiles/:id/switch
+// Returns a token for acting on a linked profile, or on the account's own
+// profile again. Every patient route then works on that profile, limited to
+// the permissions the account holds on it.
+func SwitchProfile(c *gin.Context) {
+	accountID, patientID := patientAccountOf(c), c.Param("id")
+	profiles, err := linkedProfiles(accountID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch profiles"})
+		return
+	}
+	for _, p := range profiles {
+		if p.PatientID != patientID {
+			continue
+		}
+		token, err := profileToken(accountID, patientID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"token": token, "profile": p})
+		return
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "Profile not found"})
+}
+
+// AddDependent handles POST /v1/patient/dependents
+// Creates a profile for a child or an elderly parent without a phone of their
+// own, managed from the logged-in account as its guardian.
+func AddDependent(c *gin.Context) {
+	var req models.DependentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dependent; 'name' and 'relationship' are required"})
+		return
+	}
+	if msg := validatePatientDetails(&req.PatientDetails); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	req.Relationship = strings.ToLower(strings.TrimSpace(req.Relationship))
+	if req.Relationship == "" || req.Relationship == models.RelationshipSelf {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'relationship'; e.g., child or parent"})
+		return
+	}
+	duplicates, err := findDuplicatePatients(req.PatientDetails)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	accountID := patientAccountOf(c)
+	tx, err := utils.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	patient, err := insertPatient(tx, "", req.PatientDetails, "", duplicates)
+	if err == nil {
+		_, err = tx.Exec(`
+			INSERT INTO patient_links (patient_id, linked_user_id, relationship, permissions, guardian, granted_by)
+			VALUES ($1, $2, $3, $4, TRUE, $2)
+		`, patient.PatientID, accountID, req.Relationship, pq.Array(guardianPermissions))
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add dependent"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.PatientProfile{
+		PatientID:    patient.PatientID,
+		Name:         patient.Name,
+		Relationship: req.Relationship,
+		Permissions:  guardianPermissions,
+		Dependent:    true,
+	})
+}
+
+// ListCaregivers handles GET /v1/patient/caregivers
+// Returns the accounts with access to the current profile, its guardian first.
+func ListCaregivers(c *gin.Context) {
+	rows, err := utils.DB.Query(`
+		SELECT `+patientLinkColumns+`
+		FROM patient_links l
+		JOIN users u ON u.unique_user_id = l.linked_user_id
+		WHERE l.patient_id = $1 AND l.revoked_at IS NULL
+		ORDER BY l.guardian DESC, l.created_at
+	`, c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch caregivers"})
+		return
+	}
+	defer rows.Close()
+
+	links := []models.PatientLink{}
+	for rows.Next() {
+		l, err := scanPatientLink(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch caregivers"})
+			return
+		}
+		links = append(links, l)
+	}
+	c.JSON(http.StatusOK, links)
+}
+
+// AddCaregiver handles POST /v1/patient/caregivers
+// Gives the patient account registered with 'mobile' access to the current
+// profile, e.g., a son who tracks his father's medicines. Caregivers can view
+// the profile and, if granted, log adherence; granting again replaces the
+// permissions.
+func AddCaregiver(c *gin.Context) {
+	var req models.CaregiverRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid caregiver; 'mobile' is required"})
+		return
+	}
+	permissions := []string{models.ProfileView}
+	for _, p := range req.Permissions {
+		if !containsString(caregiverPermissions, p) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid permission '" + p + "'; expected one of: " + strings.Join(caregiverPermissions, ", ")})
+			return
+		}
+		if !containsString(permissions, p) {
+			permissions = append(permissions, p)
+		}
+	}
+	req.Relationship = strings.ToLower(strings.TrimSpace(req.Relationship))
+	if req.Relationship == "" {
+		req.Relationship = "caregiver"
+	}
+
+	patientID := c.GetString("userID")
+	caregiverID, role, err := accountWithMobile(strings.TrimSpace(req.Mobile))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if role != "Patient" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No patient account with this mobile number; ask them to register first"})
+		return
+	}
+	if caregiverID == patientID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This number is the profile's own account"})
+		return
+	}
+
+	// A guardian already holds every permission; their link is never replaced.
+	link, err := scanPatientLink(utils.DB.QueryRow(`
+		WITH l AS (
+			INSERT INTO patient_links (patient_id, linked_user_id, relationship, permissions, granted_by)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (patient_id, linked_user_id) WHERE revoked_at IS NULL DO UPDATE
+				SET relationship = EXCLUDED.relationship, permissions = EXCLUDED.permissions,
+					granted_by = EXCLUDED.granted_by
+				WHERE NOT patient_links.guardian
+			RETURNING *
+		)
+		SELECT `+patientLinkColumns+` FROM l JOIN users u ON u.unique_user_id = l.linked_user_id
+	`, patientID, caregiverID, req.Relationship, pq.Array(permissions), patientAccountOf(c)))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusConflict, gin.H{"error": "This account is the profile's guardian"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add caregiver"})
+		return
+	}
+
+	var patientName string
+	utils.DB.QueryRow(`SELECT name FROM users WHERE unique_user_id = $1`, patientID).Scan(&patientName)
+	notifyUser(models.Notification{
+		UserID:       caregiverID,
+		Type:         "caregiver_access_granted",
+		Title:        "Profile shared with you",
+		Message:      patientName + " added you as a caregiver; switch profile to see their prescriptions.",
+		ResourceType: "patient",
+		ResourceID:   patientID,
+	})
+
+	c.JSON(http.StatusCreated, link)
+}
+
+// RevokeCaregiver handles DELETE /v1/patient/caregivers/:id
+// Ends a caregiver's access to the current profile; their next request on it
+// is refused. A guardian's access cannot be revoked.
+func RevokeCaregiver(c *gin.Context) {
+	var guardian bool
+	err := utils.DB.QueryRow(`
+		SELECT guardian FROM patient_links WHERE id::text = $1 AND patient_id = $2 AND revoked_at IS NULL
+	`, c.Param("id"), c.GetString("userID")).Scan(&guardian)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Caregiver not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if guardian {
+		c.JSON(http.StatusConflict, gin.H{"error": "A guardian's access cannot be revoked"})
+		return
+	}
+
+	_, err = utils.DB.Exec(`
+		UPDATE patient_links SET revoked_at = CURRENT_TIMESTAMP WHERE id::text = $1 AND revoked_at IS NULL
+	`, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke caregiver"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Caregiver access revoked"})
+}
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"Medibridge/go-api/models"
+	"Medibridge/go-api/utils"
+)
+
+// clinicFormulary is one clinic's view of the drug catalog: the catalog drugs it
+// has disabled and the local drugs it has added.
+type clinicFormulary struct {
+	disabled      map[string]bool   // Catalog drug IDs
+	disabledNames map[string]bool   // Lowercase names of the disabled drugs
+	notes         map[string]string // Catalog drug ID -> clinic note
+	local         []models.Drug
+}
+
+// loadClinicFormulary fetches a clinic's formulary settings and local drugs.
+// Clinics without settings see the whole catalog.
+func loadClinicFormulary(clinicID string) (clinicFormulary, error) {
+	formulary := clinicFormulary{
+		disabled:      map[string]bool{},
+		disabledNames: map[string]bool{},
+		notes:         map[string]string{},
+		local:         []models.Drug{},
+	}
+	if clinicID == "" {
+		return formulary, nil
+	}
+	if err := ensureDrugTable(); err != nil {
+		return formulary, err
+	}
+
+	rows, err := utils.DB.Query(`
+		SELECT f.drug_id, f.enabled, COALESCE(f.notes, ''), COALESCE(d.name, '')
+		FROM clinic_formulary f
+		LEFT JOIN drugs d ON d.id = f.drug_id
+		WHERE f.clinic_id = $1
+	`, clinicID)
+	if err != nil {
+		return formulary, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var drugID, notes, name string
+		var enabled bool
+		if err := rows.Scan(&drugID, &enabled, &notes, &name); err != nil {
+			return formulary, err
+		}
+		if !enabled {
+			formulary.disabled[drugID] = true
+			if name != "" {
+				formulary.disabledNames[strings.ToLower(name)] = true
+			}
+		}
+		if notes != "" {
+			formulary.notes[drugID] = notes
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return formulary, err
+	}
+
+	formulary.local, err = loadLocalDrugs(clinicID)
+	return formulary, err
+}
+
+// loadLocalDrugs fetches the drugs a clinic added to its own formulary.
+func loadLocalDrugs(clinicID string) ([]models.Drug, error) {
+	rows, err := utils.DB.Query(`SELECT data FROM clinic_drugs WHERE clinic_id = $1 ORDER BY created_at`, clinicID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	drugs := []models.Drug{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var drug models.Drug
+		if err := json.Unmarshal(data, &drug); err != nil {
+			return nil, err
+		}
+		drugs = append(drugs, drug)
+	}
+	return drugs, rows.Err()
+}
+
+// allows reports whether a prescribed drug name is available to the clinic,
+// i.e., it is not a catalog drug the clinic has disabled.
+func (f clinicFormulary) allows(drugName string) bool {
+	name := strings.ToLower(strings.TrimSpace(drugName))
+	return !f.disabledNames[name] && !f.disabledNames[ingredientKey(drugName)]
+}
+
+// GetClinicFormulary handles GET /v1/clinic/formulary
+// Returns every catalog drug with the clinic's enabled setting, followed by the
+// clinic's local drugs. With ?enabled_only=true disabled drugs are left out.
+func GetClinicFormulary(c *gin.Context) {
+	formulary, err := loadClinicFormulary(c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch formulary"})
+		return
+	}
+	enabledOnly := c.Query("enabled_only") == "true"
+
+	rows, err := utils.DB.Query(`SELECT ` + drugColumns + ` FROM drugs WHERE discontinued = FALSE ORDER BY name`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch drugs"})
+		return
+	}
+	defer rows.Close()
+
+	drugs := []models.FormularyDrug{}
+	for rows.Next() {
+		drug, err := scanDrug(rows)
+		if err != nil {
+			continue
+		}
+		enabled := !formulary.disabled[drug.ID]
+		if enabledOnly && !enabled {
+			continue
+		}
+		drugs = append(drugs, models.FormularyDrug{Drug: drug, Enabled: enabled, Notes: formulary.notes[drug.ID]})
+	}
+	for _, drug := range formulary.local {
+		drugs = append(drugs, models.FormularyDrug{Drug: drug, Enabled: true, Local: true})
+	}
+
+	c.JSON(http.StatusOK, drugs)
+}
+
+// SetFormularyDrug handles PUT /v1/clinic/formulary/:drugId
+// Enables or disables a catalog drug for the clinic, with an optional note
+// (e.g., "out of stock, use Mox instead").
+func SetFormularyDrug(c *gin.Context) {
+	drugID := c.Param("drugId")
+	var setting models.FormularySetting
+
+	if err := c.ShouldBindJSON(&setting); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid formulary setting; 'enabled' is required"})
+		return
+	}
+
+	var exists bool
+	if err := utils.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM drugs WHERE id = $1)`, drugID).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Drug not found in the catalog"})
+		return
+	}
+
+	_, err := utils.DB.Exec(`
+		INSERT INTO clinic_formulary (clinic_id, drug_id, enabled, notes, updated_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+		ON CONFLICT (clinic_id, drug_id) DO UPDATE SET
+			enabled = EXCLUDED.enabled, notes = EXCLUDED.notes, updated_at = EXCLUDED.updated_at
+	`, c.GetString("userID"), drugID, *setting.Enabled, setting.Notes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update formulary"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Formulary updated",
+		"drug_id": drugID,
+		"enabled": *setting.Enabled,
+		"notes":   setting.Notes,
+	})
+}
+
+// AddLocalDrug handles POST /v1/clinic/formulary/drugs
+// Adds a drug that is only available to this clinic (e.g., a locally compounded
+// preparation). It takes the same JSON shape as catalog drugs; only name is required.
+func AddLocalDrug(c *gin.Context) {
+	clinicID := c.GetString("userID")
+	var drug models.Drug
+
+	if err := c.ShouldBindJSON(&drug); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid drug data format"})
+		return
+	}
+
+	// Local IDs are namespaced by clinic so they never collide with catalog IDs.
+	drug.ID = ""
+	if err := normalizeDrug(&drug); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	drug.ID = "local-" + strings.ToLower(clinicID) + "-" + strings.TrimPrefix(drug.ID, "drug-")
+	drug.Discontinued = false
+
+	data, err := json.Marshal(drug)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save drug"})
+		return
+	}
+
+	result, err := utils.DB.Exec(`
+		INSERT INTO clinic_drugs (id, clinic_id, data) VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO NOTHING
+	`, drug.ID, clinicID, data)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save drug"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "The clinic already has a local drug with this name"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.FormularyDrug{Drug: drug, Enabled: true, Local: true})
+}
+
+// DeleteLocalDrug handles DELETE /v1/clinic/formulary/drugs/:drugId
+func DeleteLocalDrug(c *gin.Context) {
+	result, err := utils.DB.Exec(
+		`DELETE FROM clinic_drugs WHERE id = $1 AND clinic_id = $2`,
+		c.Param("drugId"), c.GetString("userID"),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete drug"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Local drug not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Local drug deleted"})
+}
+
+// applyFormulary removes the clinic's disabled drugs from a catalog listing and
+// adds its local drugs, keeping the list sorted by name.
+func applyFormulary(drugs []models.Drug, formulary clinicFormulary) []models.Drug {
+	if len(formulary.disabled) == 0 && len(formulary.local) == 0 {
+		return drugs
+	}
+
+	visible := []models.Drug{}
+	for _, drug := range drugs {
+		if !formulary.disabled[drug.ID] {
+			visible = append(visible, drug)
+		}
+	}
+	visible = append(visible, formulary.local...)
+	sort.SliceStable(visible, func(i, j int) bool { return visible[i].Name < visible[j].Name })
+	return visible
+}
+
+// addClinicDrugs adds the clinic's local drugs to a safety catalog, so they are
+// checked like catalog drugs. Catalog entries take precedence on a name clash.
+func (dc drugCatalog) addClinicDrugs(clinicID string) error {
+	if clinicID == "" {
+		return nil
+	}
+
+	drugs, err := loadLocalDrugs(clinicID)
+	if err != nil {
+		return err
+	}
+	for _, drug := range drugs {
+		dc.add(drug, false)
+	}
+	return nil
+}
@@ -0,0 +1,527 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"Medibridge/go-api/models"
+	"Medibridge/go-api/utils"
+)
+
+// defaultGlossaryPath is where the glossary file is looked for on startup
+// when GLOSSARY_PATH is not set.
+const defaultGlossaryPath = "/app/glossary.csv"
+
+// glossaryWord is one word of a text, with its offsets in characters.
+type glossaryWord struct {
+	text       string // Lowercase
+	start, end int
+}
+
+// glossaryWords splits text into lowercase words of letters, digits and
+// combining marks (the vowel signs of Indic scripts), with their offsets.
+func glossaryWords(text string) []glossaryWord {
+	words := []glossaryWord{}
+	var word []rune
+	start, i := 0, 0
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) {
+			if word == nil {
+				start = i
+			}
+			word = append(word, unicode.ToLower(r))
+		} else if word != nil {
+			words = append(words, glossaryWord{text: string(word), start: start, end: i})
+			word = nil
+		}
+		i++
+	}
+	if word != nil {
+		words = append(words, glossaryWord{text: string(word), start: start, end: i})
+	}
+	return words
+}
+
+// glossaryKey reduces a term, alias or phrase to the form the glossary is
+// matched on: its lowercase words joined by single spaces, so "X-ray" and
+// "x ray" are the same term.
+func glossaryKey(text string) string {
+	words := glossaryWords(text)
+	parts := make([]string, len(words))
+	for i, w := range words {
+		parts[i] = w.text
+	}
+	return strings.Join(parts, " ")
+}
+
+// glossaryIndex maps every term and alias to its term, rebuilt after every
+// glossary import so term detection never hits the database.
+type glossaryIndex struct {
+	mu       sync.RWMutex
+	built    bool
+	phrases  map[string]string // glossaryKey of a term or alias -> term
+	maxWords int               // Words in the longest phrase
+}
+
+var glossary = &glossaryIndex{}
+
+// RebuildGlossaryIndex reloads the term detection index from the glossary.
+// It is called from main.go on startup and after a glossary import.
+func RebuildGlossaryIndex() error {
+	phrases := map[string]string{}
+	maxWords := 0
+	add := func(phrase, term string) {
+		key := glossaryKey(phrase)
+		if key == "" {
+			return
+		}
+		if _, taken := phrases[key]; !taken {
+			phrases[key] = term
+			if n := strings.Count(key, " ") + 1; n > maxWords {
+				maxWords = n
+			}
+		}
+	}
+
+	// Terms first, so a term's own name wins over another term's alias
+	rows, err := utils.DB.Query(`
+		SELECT t.term, COALESCE(a.alias, '')
+		FROM glossary_terms t
+		LEFT JOIN glossary_aliases a ON a.term = t.term
+		ORDER BY t.term
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	aliases := [][2]string{}
+	for rows.Next() {
+		var term, alias string
+		if err := rows.Scan(&term, &alias); err != nil {
+			return err
+		}
+		add(term, term)
+		if alias != "" {
+			aliases = append(aliases, [2]string{alias, term})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, a := range aliases {
+		add(a[0], a[1])
+	}
+
+	glossary.mu.Lock()
+	glossary.phrases = phrases
+	glossary.maxWords = maxWords
+	glossary.built = true
+	glossary.mu.Unlock()
+
+	log.Printf("Glossary index rebuilt with %d terms and aliases", len(phrases))
+	return nil
+}
+
+// ensureGlossaryIndex builds the index on first use if startup could not.
+func ensureGlossaryIndex() error {
+	glossary.mu.RLock()
+	built := glossary.built
+	glossary.mu.RUnlock()
+	if built {
+		return nil
+	}
+	return RebuildGlossaryIndex()
+}
+
+// lookup returns the term a phrase names, trying its singular too (e.g., "fractures").
+// The caller must hold the read lock.
+func (idx *glossaryIndex) lookup(key string) (string, bool) {
+	if term, ok := idx.phrases[key]; ok {
+		return term, true
+	}
+	if singular := strings.TrimSuffix(key, "s"); singular != key {
+		term, ok := idx.phrases[singular]
+		return term, ok
+	}
+	return "", false
+}
+
+// detectGlossaryTerms finds the glossary terms in text, preferring the longest
+// phrase at each position ("ldl cholesterol" over "cholesterol").
+func detectGlossaryTerms(text string) ([]models.GlossaryMatch, error) {
+	if err := ensureGlossaryIndex(); err != nil {
+		return nil, err
+	}
+	glossary.mu.RLock()
+	defer glossary.mu.RUnlock()
+
+	matches := []models.GlossaryMatch{}
+	words := glossaryWords(text)
+	runes := []rune(text)
+	for i := 0; i < len(words); {
+		n := glossary.maxWords
+		if n > len(words)-i {
+			n = len(words) - i
+		}
+		for ; n > 0; n-- {
+			parts := make([]string, n)
+			for j := range parts {
+				parts[j] = words[i+j].text
+			}
+			if term, ok := glossary.lookup(strings.Join(parts, " ")); ok {
+				start, end := words[i].start, words[i+n-1].end
+				matches = append(matches, models.GlossaryMatch{Term: term, Text: string(runes[start:end]), Start: start, End: end})
+				break
+			}
+		}
+		if n == 0 {
+			n = 1
+		}
+		i += n
+	}
+	return matches, nil
+}
+
+// glossaryEntry is one term of an imported glossary file.
+type glossaryEntry struct {
+	Term        string
+	Category    string
+	Aliases     []string
+	Definitions map[string]string // Language -> definition
+}
+
+// parseGlossaryRecord builds a glossary entry from one row keyed by lowercase
+// column name. "term" is required, with a definition in at least one language:
+// "definition" is English and "definition_<language>" the others (e.g.,
+// "definition_hi"). Aliases are semicolon-separated.
+func parseGlossaryRecord(fields map[string]string) (glossaryEntry, error) {
+	field := func(column string) string {
+		return strings.TrimSpace(fields[column])
+	}
+
+	entry := glossaryEntry{
+		Term:        glossaryKey(field("term")),
+		Category:    strings.ToLower(field("category")),
+		Aliases:     splitList(field("aliases"), glossaryKey),
+		Definitions: map[string]string{},
+	}
+	if entry.Term == "" {
+		return entry, fmt.Errorf("missing term")
+	}
+	if len(entry.Term) > 100 {
+		return entry, fmt.Errorf("term %q is longer than 100 characters", entry.Term)
+	}
+
+	for column := range fields {
+		lang := models.DefaultGlossaryLanguage
+		if column != "definition" {
+			if lang = strings.TrimPrefix(column, "definition_"); lang == column {
+				continue
+			}
+		}
+		if definition := field(column); definition != "" {
+			if !languageCodePattern.MatchString(lang) {
+				return entry, fmt.Errorf("invalid language %q in column %q", lang, column)
+			}
+			entry.Definitions[lang] = definition
+		}
+	}
+	if len(entry.Definitions) == 0 {
+		return entry, fmt.Errorf("%q has no definition", entry.Term)
+	}
+	return entry, nil
+}
+
+// parseGlossary reads every row of a glossary file, collecting row errors with
+// their line numbers instead of skipping bad rows.
+func parseGlossary(rows utils.RowReader) ([]glossaryEntry, []models.GlossaryImportError, error) {
+	entries := []glossaryEntry{}
+	rowErrors := []models.GlossaryImportError{}
+	seenTerms := map[string]int{}
+	seenAliases := map[string]int{}
+	checkedHeader := false
+
+	for {
+		row, err := rows.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var rowErr *utils.RowError
+			if errors.As(err, &rowErr) {
+				rowErrors = append(rowErrors, models.GlossaryImportError{Line: rowErr.Line, Message: rowErr.Err.Error()})
+				continue
+			}
+			return nil, nil, err
+		}
+		if !checkedHeader {
+			if _, ok := row.Fields["term"]; !ok {
+				return nil, nil, fmt.Errorf("file must have a 'term' column (map one with the column mapping)")
+			}
+			checkedHeader = true
+		}
+
+		entry, err := parseGlossaryRecord(row.Fields)
+		if err != nil {
+			rowErrors = append(rowErrors, models.GlossaryImportError{Line: row.Line, Message: err.Error()})
+			continue
+		}
+		if first, ok := seenTerms[entry.Term]; ok {
+			rowErrors = append(rowErrors, models.GlossaryImportError{
+				Line:    row.Line,
+				Message: fmt.Sprintf("duplicate term %q (first used on line %d)", entry.Term, first),
+			})
+			continue
+		}
+		seenTerms[entry.Term] = row.Line
+		for _, alias := range entry.Aliases {
+			if first, ok := seenAliases[alias]; ok {
+				rowErrors = append(rowErrors, models.GlossaryImportError{
+					Line:    row.Line,
+					Message: fmt.Sprintf("alias %q is already used on line %d", alias, first),
+				})
+			}
+			seenAliases[alias] = row.Line
+		}
+		entries = append(entries, entry)
+	}
+
+	if len(entries) == 0 && len(rowErrors) == 0 {
+		rowErrors = append(rowErrors, models.GlossaryImportError{Line: 1, Message: "file contains no terms"})
+	}
+	return entries, rowErrors, nil
+}
+
+// importGlossary merges a glossary file in the given format into the glossary:
+// its terms are added or replaced with their aliases, and their definitions
+// added or replaced per language. Terms not in the file are kept. Files with
+// invalid rows are rejected with every row error and nothing is changed.
+func importGlossary(r io.Reader, format string, mapping map[string]string) (models.GlossaryImportResult, error) {
+	result := models.GlossaryImportResult{}
+
+	rows, err := utils.NewRowReader(format, r, mapping)
+	if err != nil {
+		return result, err
+	}
+	entries, rowErrors, err := parseGlossary(rows)
+	if err != nil {
+		return result, err
+	}
+	if len(rowErrors) > 0 {
+		result.Errors = rowErrors
+		return result, nil
+	}
+
+	tx, err := utils.DB.Begin()
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	for _, entry := range entries {
+		_, err := tx.Exec(`
+			INSERT INTO glossary_terms (term, category) VALUES ($1, NULLIF($2, ''))
+			ON CONFLICT (term) DO UPDATE SET category = EXCLUDED.category, updated_at = CURRENT_TIMESTAMP
+		`, entry.Term, entry.Category)
+		if err != nil {
+			return result, err
+		}
+
+		if _, err := tx.Exec(`DELETE FROM glossary_aliases WHERE term = $1`, entry.Term); err != nil {
+			return result, err
+		}
+		// An alias moves to the term that lists it last
+		_, err = tx.Exec(`
+			INSERT INTO glossary_aliases (alias, term)
+			SELECT alias, $1 FROM unnest($2::text[]) AS alias WHERE alias <> $1
+			ON CONFLICT (alias) DO UPDATE SET term = EXCLUDED.term
+		`, entry.Term, pq.Array(entry.Aliases))
+		if err != nil {
+			return result, err
+		}
+
+		for lang, definition := range entry.Definitions {
+			_, err := tx.Exec(`
+				INSERT INTO glossary_definitions (term, language, definition) VALUES ($1, $2, $3)
+				ON CONFLICT (term, language) DO UPDATE SET definition = EXCLUDED.definition
+			`, entry.Term, lang, definition)
+			if err != nil {
+				return result, err
+			}
+			result.Definitions++
+		}
+		result.Terms++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return result, err
+	}
+	if err := RebuildGlossaryIndex(); err != nil {
+		log.Printf("Warning: Failed to rebuild glossary index: %v", err)
+	}
+	return result, nil
+}
+
+// LoadGlossary merges the glossary file at GLOSSARY_PATH into the glossary.
+// This is called from main.go on startup; a missing file is not an error.
+func LoadGlossary() error {
+	glossaryPath := os.Getenv("GLOSSARY_PATH")
+	if glossaryPath == "" {
+		glossaryPath = defaultGlossaryPath
+	}
+
+	file, err := os.Open(glossaryPath)
+	if os.IsNotExist(err) {
+		log.Printf("Glossary file not found at %s, keeping the current glossary", glossaryPath)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	result, err := importGlossary(file, utils.DetectFormat(glossaryPath), nil)
+	if err != nil {
+		return err
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("%s has %d invalid rows, first on line %d: %s",
+			glossaryPath, len(result.Errors), result.Errors[0].Line, result.Errors[0].Message)
+	}
+	log.Printf("Successfully loaded %d glossary terms from %s", result.Terms, glossaryPath)
+	return nil
+}
+
+// GetGlossaryTerm handles GET /v1/glossary/:term?lang=
+// Returns the simple definition of a term or any of its aliases, in the
+// requested language ('lang', e.g., "hi") or else in English.
+func GetGlossaryTerm(c *gin.Context) {
+	lang := strings.ToLower(strings.TrimSpace(c.DefaultQuery("lang", models.DefaultGlossaryLanguage)))
+	if !languageCodePattern.MatchString(lang) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'lang'; expected a language code, e.g., hi"})
+		return
+	}
+	if err := ensureGlossaryIndex(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load glossary"})
+		return
+	}
+	glossary.mu.RLock()
+	term, ok := glossary.lookup(glossaryKey(c.Param("term")))
+	glossary.mu.RUnlock()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Term not found in the glossary"})
+		return
+	}
+
+	result := models.GlossaryTerm{Term: term, Aliases: []string{}, Languages: []string{}}
+	err := utils.DB.QueryRow(`
+		SELECT COALESCE(t.category, ''),
+			COALESCE(ARRAY(SELECT alias FROM glossary_aliases WHERE term = t.term ORDER BY alias), '{}'),
+			COALESCE(ARRAY(SELECT language FROM glossary_definitions WHERE term = t.term ORDER BY language), '{}')
+		FROM glossary_terms t WHERE t.term = $1
+	`, term).Scan(&result.Category, pq.Array(&result.Aliases), pq.Array(&result.Languages))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Term not found in the glossary"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch glossary term"})
+		return
+	}
+
+	err = utils.DB.QueryRow(`
+		SELECT language, definition FROM glossary_definitions
+		WHERE term = $1 AND language IN ($2, $3)
+		ORDER BY language = $2 DESC
+		LIMIT 1
+	`, term, lang, models.DefaultGlossaryLanguage).Scan(&result.Language, &result.Definition)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":     "Term has no definition in this language",
+			"languages": result.Languages,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch glossary term"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// DetectGlossaryTerms handles POST /v1/glossary/detect
+// Finds the glossary terms in a text, e.g., a report's simplified summary, with
+// their character offsets for the app to make them tappable.
+func DetectGlossaryTerms(c *gin.Context) {
+	var req models.GlossaryDetectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request; 'text' is required"})
+		return
+	}
+	matches, err := detectGlossaryTerms(req.Text)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load glossary"})
+		return
+	}
+	c.JSON(http.StatusOK, matches)
+}
+
+// UploadGlossary handles POST /v1/admin/glossary/upload
+// Accepts a multipart form file (field name: "file") containing glossary terms
+// as CSV, JSON or XLSX, with the columns term, category, aliases, definition
+// and definition_<language>. The optional "format" and "column_map" fields work
+// as for drug catalog uploads. The file is merged into the glossary.
+func UploadGlossary(c *gin.Context) {
+	var filename string
+	var result models.GlossaryImportResult
+	policy := uploadPolicy{Fields: []string{"file"}, MaxBytes: maxCatalogUploadBytes, Types: catalogUploadTypes}
+	err := receiveUpload(c, policy, func(u *upload) error {
+		filename = u.Filename
+		format := strings.ToLower(u.formValue(c, "format"))
+		if format == "" {
+			format = u.Ext
+		}
+		var mapping map[string]string
+		if spec := u.formValue(c, "column_map"); spec != "" {
+			var err error
+			if mapping, err = utils.ParseColumnMapping(spec); err != nil {
+				return &uploadError{Status: http.StatusBadRequest, Message: err.Error()}
+			}
+		}
+
+		var err error
+		if result, err = importGlossary(u.Body, format, mapping); err != nil {
+			return invalidUpload(err, policy, "Failed to load glossary file")
+		}
+		return nil
+	})
+	if err != nil {
+		respondUploadError(c, err, "Failed to load glossary file")
+		return
+	}
+	if len(result.Errors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":  "Glossary file has invalid rows; the glossary was not changed",
+			"errors": result.Errors,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Glossary file uploaded and merged successfully",
+		"filename":    filename,
+		"terms":       result.Terms,
+		"definitions": result.Definitions,
+	})
+}
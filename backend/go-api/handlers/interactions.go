@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/lib/pq"
+	"Medibridge/go-api/models"
+	"Medibridge/go-api/utils"
+)
+
+// dosageFormWords are dropped when reducing a drug name to its ingredient key.
+var dosageFormWords = map[string]bool{
+	"tablet": true, "tablets": true, "tab": true,
+	"capsule": true, "capsules": true, "cap": true,
+	"syrup": true, "suspension": true, "injection": true, "inj": true,
+	"drops": true, "cream": true, "ointment": true, "gel": true,
+}
+
+// validSeverities lists the severity values accepted in the interaction table.
+var validSeverities = map[string]bool{
+	models.SeverityMinor:           true,
+	models.SeverityModerate:        true,
+	models.SeverityMajor:           true,
+	models.SeverityContraindicated: true,
+}
+
+// ingredientKey reduces a prescribed drug name such as "Amoxicillin 500 mg Tablet"
+// to the normalized key used by the interaction table ("amoxicillin").
+func ingredientKey(drugName string) string {
+	words := []string{}
+	for _, word := range strings.Fields(strings.ToLower(drugName)) {
+		if strings.IndexFunc(word, unicode.IsDigit) != -1 {
+			break // Strength starts here, e.g., "500", "500mg"
+		}
+		if dosageFormWords[word] {
+			continue
+		}
+		words = append(words, word)
+	}
+	return strings.Join(words, " ")
+}
+
+// interactionPair orders two keys the same way they are stored in drug_interactions.
+func interactionPair(a, b string) (string, string) {
+	if a > b {
+		return b, a
+	}
+	return a, b
+}
+
+// ensureInteractionTable creates the drug_interactions table if it does not exist.
+func ensureInteractionTable() error {
+	_, err := utils.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS drug_interactions (
+			drug_a VARCHAR(200) NOT NULL,
+			drug_b VARCHAR(200) NOT NULL,
+			severity VARCHAR(20) NOT NULL,
+			description TEXT,
+			PRIMARY KEY (drug_a, drug_b)
+		)
+	`)
+	return err
+}
+
+// LoadInteractionsFromCSV loads the drug interaction table from a CSV file.
+// This is called from main.go on startup, alongside LoadDrugCatalog.
+func LoadInteractionsFromCSV(filePath ...string) error {
+	csvPath := "/app/interactions.csv"
+	if len(filePath) > 0 && filePath[0] != "" {
+		csvPath = filePath[0]
+	}
+
+	if _, err := os.Stat(csvPath); os.IsNotExist(err) {
+		log.Printf("Interaction CSV not found at %s, skipping interaction table load", csvPath)
+		return nil // Not a critical error
+	}
+
+	file, err := os.Open(csvPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	interactions, rowErrors, err := parseInteractions(file)
+	if err != nil {
+		return err
+	}
+	if len(rowErrors) > 0 {
+		return fmt.Errorf("%d invalid rows, the first on line %d: %s", len(rowErrors), rowErrors[0].Line, rowErrors[0].Message)
+	}
+	count, err := saveInteractions(interactions)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Successfully loaded %d drug interactions from CSV", count)
+	return nil
+}
+
+// parseInteractions reads a CSV with the columns drug_a, drug_b, severity and
+// description, collecting row errors with their line numbers instead of
+// skipping bad rows.
+func parseInteractions(r io.Reader) ([]models.DrugInteraction, []models.DrugImportError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1 // Short rows are reported below
+
+	headers, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read CSV header: %w", err)
+	}
+
+	drugAIdx, drugBIdx, severityIdx, descriptionIdx := -1, -1, -1, -1
+	for i, header := range headers {
+		switch strings.ToLower(strings.TrimSpace(header)) {
+		case "drug_a":
+			drugAIdx = i
+		case "drug_b":
+			drugBIdx = i
+		case "severity":
+			severityIdx = i
+		case "description":
+			descriptionIdx = i
+		}
+	}
+	if drugAIdx == -1 || drugBIdx == -1 {
+		return nil, nil, fmt.Errorf("CSV must have 'drug_a' and 'drug_b' columns")
+	}
+
+	interactions := []models.DrugInteraction{}
+	rowErrors := []models.DrugImportError{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rowErrors = append(rowErrors, models.DrugImportError{Line: parseErr.Line, Message: parseErr.Err.Error()})
+				continue
+			}
+			return nil, nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		field := func(idx int) string {
+			if idx == -1 || idx >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[idx])
+		}
+
+		drugA, drugB := interactionPair(ingredientKey(field(drugAIdx)), ingredientKey(field(drugBIdx)))
+		if drugA == "" || drugB == "" {
+			rowErrors = append(rowErrors, models.DrugImportError{Line: line, Message: "drug_a and drug_b are required"})
+			continue
+		}
+		if drugA == drugB {
+			rowErrors = append(rowErrors, models.DrugImportError{
+				Line:    line,
+				Message: fmt.Sprintf("drug_a and drug_b are the same drug (%s)", drugA),
+			})
+			continue
+		}
+
+		severity := strings.ToLower(field(severityIdx))
+		if severity == "" {
+			severity = models.SeverityModerate
+		}
+		if !validSeverities[severity] {
+			rowErrors = append(rowErrors, models.DrugImportError{
+				Line:    line,
+				Message: fmt.Sprintf("unknown severity %q", severity),
+			})
+			continue
+		}
+
+		interactions = append(interactions, models.DrugInteraction{
+			DrugA:       drugA,
+			DrugB:       drugB,
+			Severity:    severity,
+			Description: field(descriptionIdx),
+		})
+	}
+
+	if len(interactions) == 0 && len(rowErrors) == 0 {
+		rowErrors = append(rowErrors, models.DrugImportError{Line: 1, Message: "file contains no interactions"})
+	}
+	return interactions, rowErrors, nil
+}
+
+// saveInteractions replaces the interaction table with the given interactions;
+// a pair listed twice keeps its last row. The whole import runs in one
+// transaction, so a failed import keeps the old table.
+func saveInteractions(interactions []models.DrugInteraction) (int, error) {
+	if err := ensureInteractionTable(); err != nil {
+		return 0, err
+	}
+
+	tx, err := utils.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM drug_interactions`); err != nil {
+		return 0, err
+	}
+
+	for _, in := range interactions {
+		_, err = tx.Exec(`
+			INSERT INTO drug_interactions (drug_a, drug_b, severity, description)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (drug_a, drug_b) DO UPDATE
+			SET severity = $3, description = $4
+		`, in.DrugA, in.DrugB, in.Severity, in.Description)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(interactions), nil
+}
+
+// loadInteractions fetches every interaction between any two of the given keys.
+func loadInteractions(keys []string) (map[[2]string]models.DrugInteraction, error) {
+	interactions := map[[2]string]models.DrugInteraction{}
+	if len(keys) < 2 {
+		return interactions, nil
+	}
+
+	if err := ensureInteractionTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := utils.DB.Query(`
+		SELECT drug_a, drug_b, severity, COALESCE(description, '')
+		FROM drug_interactions
+		WHERE drug_a = ANY($1) AND drug_b = ANY($1)
+	`, pq.Array(keys))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var in models.DrugInteraction
+		if err := rows.Scan(&in.DrugA, &in.DrugB, &in.Severity, &in.Description); err != nil {
+			return nil, err
+		}
+		interactions[[2]string{in.DrugA, in.DrugB}] = in
+	}
+	return interactions, rows.Err()
+}
+
+// checkDuplicateTherapy flags drugs that share an ingredient with another drug in the
+// same prescription or in one of the patient's active prescriptions.
+func checkDuplicateTherapy(catalog drugCatalog, instructions []models.DosageInstruction, active []activeInstruction) []models.SafetyWarning {
+	warnings := []models.SafetyWarning{}
+
+	for i, instr := range instructions {
+		for _, other := range instructions[i+1:] {
+			if key, ok := catalog.sharedIngredient(instr.DrugName, other.DrugName); ok {
+				warnings = append(warnings, models.SafetyWarning{
+					Type:     models.WarningDuplicateTherapy,
+					Severity: models.SeverityMajor,
+					Drugs:    []string{instr.DrugName, other.DrugName},
+					Message:  fmt.Sprintf("%s and %s contain the same ingredient (%s).", instr.DrugName, other.DrugName, key),
+				})
+			}
+		}
+
+		for _, current := range active {
+			if key, ok := catalog.sharedIngredient(instr.DrugName, current.Instruction.DrugName); ok {
+				warnings = append(warnings, models.SafetyWarning{
+					Type:                 models.WarningDuplicateTherapy,
+					Severity:             models.SeverityMajor,
+					Drugs:                []string{instr.DrugName, current.Instruction.DrugName},
+					Message:              fmt.Sprintf("%s duplicates %s from an active prescription (%s).", instr.DrugName, current.Instruction.DrugName, key),
+					ActivePrescriptionID: current.PrescriptionID,
+				})
+			}
+		}
+	}
+
+	return warnings
+}
+
+// checkInteractions looks up every pair of new drugs, and every new drug against each
+// active drug, in the interaction table.
+func checkInteractions(catalog drugCatalog, instructions []models.DosageInstruction, active []activeInstruction) ([]models.SafetyWarning, error) {
+	keySet := map[string]bool{}
+	for _, instr := range instructions {
+		for _, key := range catalog.keys(instr.DrugName) {
+			keySet[key] = true
+		}
+	}
+	for _, current := range active {
+		for _, key := range catalog.keys(current.Instruction.DrugName) {
+			keySet[key] = true
+		}
+	}
+	keys := make([]string, 0, len(keySet))
+	for key := range keySet {
+		keys = append(keys, key)
+	}
+
+	interactions, err := loadInteractions(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	// findInteraction returns the most severe interaction between any keys of the two drugs.
+	findInteraction := func(a, b string) (models.DrugInteraction, bool) {
+		var found models.DrugInteraction
+		ok := false
+		for _, keyA := range catalog.keys(a) {
+			for _, keyB := range catalog.keys(b) {
+				x, y := interactionPair(keyA, keyB)
+				in, exists := interactions[[2]string{x, y}]
+				if exists && (!ok || severityRank(in.Severity) > severityRank(found.Severity)) {
+					found, ok = in, true
+				}
+			}
+		}
+		return found, ok
+	}
+
+	warnings := []models.SafetyWarning{}
+	for i, instr := range instructions {
+		for _, other := range instructions[i+1:] {
+			if in, ok := findInteraction(instr.DrugName, other.DrugName); ok {
+				warnings = append(warnings, interactionWarning(in, instr.DrugName, other.DrugName, ""))
+			}
+		}
+		for _, current := range active {
+			if in, ok := findInteraction(instr.DrugName, current.Instruction.DrugName); ok {
+				warnings = append(warnings, interactionWarning(in, instr.DrugName, current.Instruction.DrugName, current.PrescriptionID))
+			}
+		}
+	}
+
+	return warnings, nil
+}
+
+// interactionWarning builds the warning returned to the doctor for one interaction.
+func interactionWarning(in models.DrugInteraction, drugA, drugB, activePrescriptionID string) models.SafetyWarning {
+	message := fmt.Sprintf("%s interaction between %s and %s.", strings.ToUpper(in.Severity[:1])+in.Severity[1:], drugA, drugB)
+	if in.Description != "" {
+		message += " " + in.Description
+	}
+	return models.SafetyWarning{
+		Type:                 models.WarningInteraction,
+		Severity:             in.Severity,
+		Drugs:                []string{drugA, drugB},
+		Message:              message,
+		ActivePrescriptionID: activePrescriptionID,
+	}
+}
+
+// severityRank orders severities so the most serious warning can be picked.
+func severityRank(severity string) int {
+	switch severity {
+	case models.SeverityMinor:
+		return 1
+	case models.SeverityModerate:
+		return 2
+	case models.SeverityMajor:
+		return 3
+	case models.SeverityContraindicated:
+		return 4
+	}
+	return 0
+}
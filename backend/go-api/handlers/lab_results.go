@@ -0,0 +1,425 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"Medibridge/go-api/models"
+	"Medibridge/go-api/utils"
+)
+
+// maxLabObservations caps the results submitted with one report.
+const maxLabObservations = 200
+
+// labTestCodePattern matches a test code once upper-cased, e.g., CHOL or 2093-3 (LOINC).
+var labTestCodePattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9_.-]{0,29}$`)
+
+// labObservationColumns is the column list read by scanLabObservation.
+const labObservationColumns = `o.id, o.report_id, o.patient_id, o.test_code, o.test_name, o.value, o.unit,
+	o.ref_low, o.ref_high, COALESCE(o.flag, ''), o.observed_at`
+
+// scanLabObservation reads one row selected with labObservationColumns.
+func scanLabObservation(row rowScanner) (models.LabObservation, error) {
+	var o models.LabObservation
+	var refLow, refHigh sql.NullFloat64
+	var observedAt time.Time
+	err := row.Scan(&o.ID, &o.ReportID, &o.PatientID, &o.TestCode, &o.TestName, &o.Value, &o.Unit,
+		&refLow, &refHigh, &o.Flag, &observedAt)
+	if refLow.Valid {
+		o.RefLow = &refLow.Float64
+	}
+	if refHigh.Valid {
+		o.RefHigh = &refHigh.Float64
+	}
+	o.ObservedAt = observedAt.Unix()
+	return o, err
+}
+
+// labFlag flags value against its reference range, or returns "" without one.
+func labFlag(value float64, low, high *float64) string {
+	switch {
+	case low == nil && high == nil:
+		return ""
+	case low != nil && value < *low:
+		return models.LabFlagLow
+	case high != nil && value > *high:
+		return models.LabFlagHigh
+	}
+	return models.LabFlagNormal
+}
+
+// normalizeLabTestCode upper-cases and trims a test code, so results from
+// different labs trend together.
+func normalizeLabTestCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// prepareLabObservations validates submitted lab results and returns them
+// ready to insert, or a message for the first invalid one.
+func prepareLabObservations(inputs []models.LabObservationInput) ([]models.LabObservation, string) {
+	if len(inputs) > maxLabObservations {
+		return nil, "Too many 'observations'; at most 200 per report"
+	}
+	seen := map[string]bool{}
+	observations := make([]models.LabObservation, 0, len(inputs))
+	for i, in := range inputs {
+		o := models.LabObservation{
+			TestCode: normalizeLabTestCode(in.TestCode),
+			TestName: strings.TrimSpace(in.TestName),
+			Unit:     strings.TrimSpace(in.Unit),
+			RefLow:   in.RefLow,
+			RefHigh:  in.RefHigh,
+		}
+		prefix := "Invalid observation " + strconv.Itoa(i+1) + "; "
+		if !labTestCodePattern.MatchString(o.TestCode) {
+			return nil, prefix + "'test_code' is required, e.g., CHOL"
+		}
+		if seen[o.TestCode] {
+			return nil, prefix + "'" + o.TestCode + "' is given more than once"
+		}
+		seen[o.TestCode] = true
+		if in.Value == nil || math.IsNaN(*in.Value) || math.IsInf(*in.Value, 0) {
+			return nil, prefix + "'value' must be a number"
+		}
+		o.Value = *in.Value
+		if o.RefLow != nil && o.RefHigh != nil && *o.RefLow > *o.RefHigh {
+			return nil, prefix + "'ref_low' is above 'ref_high'"
+		}
+		if len(o.TestName) > 200 || len(o.Unit) > 30 {
+			return nil, prefix + "'test_name' or 'unit' is too long"
+		}
+
+		observedAt := time.Now()
+		if in.ObservedAt != "" {
+			var err error
+			if observedAt, err = time.Parse(time.RFC3339, in.ObservedAt); err != nil {
+				if observedAt, err = time.Parse("2006-01-02", in.ObservedAt); err != nil {
+					return nil, prefix + "'observed_at' must be YYYY-MM-DD or RFC 3339"
+				}
+			}
+			if observedAt.After(time.Now().Add(24 * time.Hour)) {
+				return nil, prefix + "'observed_at' is in the future"
+			}
+		}
+		o.ObservedAt = observedAt.Unix()
+		observations = append(observations, o)
+	}
+	return observations, ""
+}
+
+// insertLabObservations files lab results under a report, completing them from
+// the lab test catalog and flagging them. A test already on the report is
+// replaced, so a scanning center can correct a result by submitting it again.
+func insertLabObservations(tx *sql.Tx, reportID, patientID string, observations []models.LabObservation) error {
+	for _, o := range observations {
+		var name, unit string
+		var low, high sql.NullFloat64
+		err := tx.QueryRow(`SELECT name, unit, ref_low, ref_high FROM lab_tests WHERE code = $1`, o.TestCode).
+			Scan(&name, &unit, &low, &high)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil {
+			if o.TestName == "" {
+				o.TestName = name
+			}
+			if o.Unit == "" {
+				o.Unit = unit
+			}
+			// The catalog's range only applies in the catalog's unit
+			if o.RefLow == nil && o.RefHigh == nil && strings.EqualFold(o.Unit, unit) {
+				if low.Valid {
+					o.RefLow = &low.Float64
+				}
+				if high.Valid {
+					o.RefHigh = &high.Float64
+				}
+			}
+		}
+		if o.TestName == "" {
+			o.TestName = o.TestCode
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO lab_observations (report_id, patient_id, test_code, test_name, value, unit,
+				ref_low, ref_high, flag, observed_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10)
+			ON CONFLICT (report_id, test_code) DO UPDATE
+			SET test_name = EXCLUDED.test_name, value = EXCLUDED.value, unit = EXCLUDED.unit,
+				ref_low = EXCLUDED.ref_low, ref_high = EXCLUDED.ref_high, flag = EXCLUDED.flag,
+				observed_at = EXCLUDED.observed_at, updated_at = CURRENT_TIMESTAMP
+		`, reportID, patientID, o.TestCode, o.TestName, o.Value, o.Unit,
+			o.RefLow, o.RefHigh, labFlag(o.Value, o.RefLow, o.RefHigh), time.Unix(o.ObservedAt, 0))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseLabObservationsField reads the lab results sent as JSON in a report
+// upload's 'observations' form field, if any.
+func parseLabObservationsField(value string) ([]models.LabObservation, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	var inputs []models.LabObservationInput
+	if err := json.Unmarshal([]byte(value), &inputs); err != nil {
+		return nil, &uploadError{Status: http.StatusBadRequest, Message: "Invalid 'observations'; expected a JSON array of lab results"}
+	}
+	observations, msg := prepareLabObservations(inputs)
+	if msg != "" {
+		return nil, &uploadError{Status: http.StatusBadRequest, Message: msg}
+	}
+	return observations, nil
+}
+
+// loadLabObservations returns the results selected by where, a condition on
+// lab_observations o and its report r, ordered by orderBy.
+func loadLabObservations(where, orderBy string, args ...interface{}) ([]models.LabObservation, error) {
+	rows, err := utils.DB.Query(`
+		SELECT `+labObservationColumns+`
+		FROM lab_observations o
+		JOIN reports r ON r.id = o.report_id
+		WHERE `+where+`
+		ORDER BY `+orderBy, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	observations := []models.LabObservation{}
+	for rows.Next() {
+		o, err := scanLabObservation(rows)
+		if err != nil {
+			return nil, err
+		}
+		observations = append(observations, o)
+	}
+	return observations, rows.Err()
+}
+
+// loadReportObservations returns the lab results of a report.
+func loadReportObservations(reportID string) ([]models.LabObservation, error) {
+	return loadLabObservations(`o.report_id = $1`, `o.test_code`, reportID)
+}
+
+// sharedWithCondition restricts lab results to reports shared with recipientID
+// ($3 of the query); an empty recipient (the patient themselves) sees them all.
+const sharedWithCondition = `($3 = '' OR EXISTS (
+	SELECT 1 FROM report_shares s WHERE s.report_id = o.report_id AND s.recipient_id = $3))`
+
+// respondLatestLabResults answers with the latest result of each test of a
+// patient, from reports that were shared (with recipientID, if set).
+func respondLatestLabResults(c *gin.Context, patientID, recipientID string) {
+	rows, err := utils.DB.Query(`
+		SELECT DISTINCT ON (o.test_code) `+labObservationColumns+`
+		FROM lab_observations o
+		JOIN reports r ON r.id = o.report_id
+		WHERE o.patient_id = $1 AND r.status = $2 AND `+sharedWithCondition+`
+		ORDER BY o.test_code, o.observed_at DESC, o.id DESC
+	`, patientID, models.ReportShared, recipientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lab results"})
+		return
+	}
+	defer rows.Close()
+
+	results := []models.LabObservation{}
+	for rows.Next() {
+		o, err := scanLabObservation(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lab results"})
+			return
+		}
+		results = append(results, o)
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// respondLabTrend answers with a patient's results for the test in :code,
+// oldest first, from reports that were shared (with recipientID, if set).
+// Optional 'from' and 'to' (YYYY-MM-DD, inclusive) narrow the period.
+func respondLabTrend(c *gin.Context, patientID, recipientID string) {
+	var from, to time.Time
+	var err error
+	if v := c.Query("from"); v != "" {
+		if from, err = time.Parse("2006-01-02", v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'from'; expected YYYY-MM-DD"})
+			return
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = time.Parse("2006-01-02", v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'to'; expected YYYY-MM-DD"})
+			return
+		}
+		to = to.AddDate(0, 0, 1)
+	} else {
+		to = time.Now().AddDate(1, 0, 0)
+	}
+
+	trend := models.LabTrend{PatientID: patientID, TestCode: normalizeLabTestCode(c.Param("code"))}
+	trend.Results, err = loadLabObservations(
+		`o.patient_id = $1 AND o.test_code = $2 AND `+sharedWithCondition+` AND r.status = $4 AND o.observed_at >= $5 AND o.observed_at < $6`,
+		`o.observed_at, o.id`,
+		patientID, trend.TestCode, recipientID, models.ReportShared, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lab results"})
+		return
+	}
+	if n := len(trend.Results); n > 0 {
+		trend.TestName = trend.Results[n-1].TestName
+	}
+	c.JSON(http.StatusOK, trend)
+}
+
+// SubmitLabObservations handles POST /v1/scanning/reports/:id/observations
+// Adds structured lab results to a report the scanning center has not shared
+// yet. Each result is flagged high, low or normal against its reference range;
+// a test already on the report is replaced.
+func SubmitLabObservations(c *gin.Context) {
+	var req models.LabObservationsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request; 'observations' need a 'test_code' and a 'value'"})
+		return
+	}
+	if len(req.Observations) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request; 'observations' is empty"})
+		return
+	}
+	observations, msg := prepareLabObservations(req.Observations)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	tx, err := utils.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var reportID, patientID, status string
+	err = tx.QueryRow(`
+		SELECT id, patient_id, status FROM reports
+		WHERE id::text = $1 AND scanning_center_id = $2
+		FOR UPDATE
+	`, c.Param("id"), c.GetString("userID")).Scan(&reportID, &patientID, &status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch report"})
+		return
+	}
+	if status == models.ReportShared {
+		c.JSON(http.StatusConflict, gin.H{"error": "Report was already shared; its lab results can no longer change"})
+		return
+	}
+
+	if err := insertLabObservations(tx, reportID, patientID, observations); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save lab results"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save lab results"})
+		return
+	}
+
+	results, err := loadReportObservations(reportID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lab results"})
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// GetReportObservations handles GET /v1/scanning/reports/:id/observations
+// Returns the structured lab results of one of the scanning center's reports.
+func GetReportObservations(c *gin.Context) {
+	var reportID string
+	err := utils.DB.QueryRow(`
+		SELECT id FROM reports WHERE id::text = $1 AND scanning_center_id = $2
+	`, c.Param("id"), c.GetString("userID")).Scan(&reportID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch report"})
+		return
+	}
+
+	results, err := loadReportObservations(reportID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lab results"})
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// GetMyLabResults handles GET /v1/patient/lab-results
+// Returns the patient's latest result of each test, flagged against its range.
+func GetMyLabResults(c *gin.Context) {
+	respondLatestLabResults(c, c.GetString("userID"), "")
+}
+
+// GetMyLabTrend handles GET /v1/patient/lab-results/:code
+// Returns the patient's results for one test over time, e.g., cholesterol
+// across yearly checkups.
+func GetMyLabTrend(c *gin.Context) {
+	respondLabTrend(c, c.GetString("userID"), "")
+}
+
+// clinicHasSharedReports reports whether any of a patient's reports was shared
+// with the clinic. Otherwise it answers 404, as if the patient did not exist.
+func clinicHasSharedReports(c *gin.Context, patientID string) bool {
+	var shared bool
+	err := utils.DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM report_shares s JOIN reports r ON r.id = s.report_id
+			WHERE r.patient_id = $1 AND s.recipient_id = $2
+		)
+	`, patientID, c.GetString("userID")).Scan(&shared)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lab results"})
+		return false
+	}
+	if !shared {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Patient not found"})
+		return false
+	}
+	return true
+}
+
+// GetPatientLabResults handles GET /v1/clinic/patients/:id/lab-results
+// Returns a patient's latest result of each test, from reports shared with
+// the clinic.
+func GetPatientLabResults(c *gin.Context) {
+	patientID := c.Param("id")
+	if !clinicHasSharedReports(c, patientID) {
+		return
+	}
+	respondLatestLabResults(c, patientID, c.GetString("userID"))
+}
+
+// GetPatientLabTrend handles GET /v1/clinic/patients/:id/lab-results/:code
+// Returns a patient's results for one test over time, across the scanning
+// centers whose reports were shared with the clinic.
+func GetPatientLabTrend(c *gin.Context) {
+	patientID := c.Param("id")
+	if !clinicHasSharedReports(c, patientID) {
+		return
+	}
+	respondLabTrend(c, patientID, c.GetString("userID"))
+}
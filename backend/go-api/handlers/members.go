@@ -0,0 +1,371 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"Medibridge/go-api/models"
+	"Medibridge/go-api/utils"
+)
+
+// mobilePattern matches the mobile numbers accounts are registered with.
+var mobilePattern = regexp.MustCompile(`^[0-9]{10,15}$`)
+
+// memberRolesByOrgType are the member roles each kind of organization can grant.
+var memberRolesByOrgType = map[string][]string{
+	"Clinic":   {models.MemberOrgAdmin, models.MemberDoctor, models.MemberReceptionist},
+	"Scanning": {models.MemberOrgAdmin, models.MemberTechnician},
+}
+
+// memberColumns is the column list read by scanMember.
+const memberColumns = `id, org_id, mobile_number, name, roles, COALESCE(qualifications, ''),
+	COALESCE(registration_number, ''), status, invited_at, joined_at, deactivated_at`
+
+// actor is who makes a change: the organization account and, for staff logins, the member.
+type actor struct {
+	UserID   string
+	MemberID int64 // 0 for the organization account itself
+}
+
+// actorOf returns the authenticated actor of a request.
+func actorOf(c *gin.Context) actor {
+	return actor{UserID: c.GetString("userID"), MemberID: c.GetInt64("memberID")}
+}
+
+// activeMemberRoles returns the roles of an active member of orgID; it returns
+// sql.ErrNoRows if the member was deactivated or removed.
+func activeMemberRoles(orgID string, memberID int64) ([]string, error) {
+	var roles []string
+	err := utils.DB.QueryRow(`
+		SELECT roles FROM organization_members WHERE id = $1 AND org_id = $2 AND status = 'active'
+	`, memberID, orgID).Scan(pq.Array(&roles))
+	return roles, err
+}
+
+// scanMember reads one row selected with memberColumns.
+func scanMember(row rowScanner) (models.OrganizationMember, error) {
+	var m models.OrganizationMember
+	var invitedAt time.Time
+	var joinedAt, deactivatedAt sql.NullTime
+	err := row.Scan(&m.ID, &m.OrgID, &m.Mobile, &m.Name, pq.Array(&m.Roles), &m.Qualifications,
+		&m.RegistrationNumber, &m.Status, &invitedAt, &joinedAt, &deactivatedAt)
+	if err != nil {
+		return m, err
+	}
+	m.InvitedAt = invitedAt.Unix()
+	if joinedAt.Valid {
+		m.JoinedAt = joinedAt.Time.Unix()
+	}
+	if deactivatedAt.Valid {
+		m.DeactivatedAt = deactivatedAt.Time.Unix()
+	}
+	return m, nil
+}
+
+// loadOrgMember fetches the member named by the :id parameter from the caller's
+// organization, responding with 404 (or 500) itself when it cannot.
+func loadOrgMember(c *gin.Context) (models.OrganizationMember, bool) {
+	member, err := scanMember(utils.DB.QueryRow(
+		`SELECT `+memberColumns+` FROM organization_members WHERE id::text = $1 AND org_id = $2`,
+		c.Param("id"), c.GetString("userID"),
+	))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return member, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch member"})
+		return member, false
+	}
+	return member, true
+}
+
+// validateMember normalizes a posted member and checks its roles against the
+// organization type, returning a message for the client if it is invalid.
+func validateMember(m *models.OrganizationMember, orgType string) string {
+	m.Name = strings.TrimSpace(m.Name)
+	m.RegistrationNumber = strings.TrimSpace(m.RegistrationNumber)
+	if m.Name == "" {
+		return "'name' is required"
+	}
+	if len(m.Roles) == 0 {
+		return "At least one role is required"
+	}
+
+	allowed := memberRolesByOrgType[orgType]
+	roles := []string{}
+	for _, role := range m.Roles {
+		if !containsString(allowed, role) {
+			return "Invalid role '" + role + "'; expected one of: " + strings.Join(allowed, ", ")
+		}
+		if !containsString(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	m.Roles = roles
+
+	if containsString(m.Roles, models.MemberDoctor) && m.RegistrationNumber == "" {
+		return "Doctors need a 'registration_number'"
+	}
+	return ""
+}
+
+// ListMembers handles GET /v1/clinic/members and GET /v1/scanning/members
+// Lists the organization's staff, including invited and deactivated members.
+func ListMembers(c *gin.Context) {
+	rows, err := utils.DB.Query(`
+		SELECT `+memberColumns+`
+		FROM organization_members
+		WHERE org_id = $1
+		ORDER BY status = 'deactivated', name
+	`, c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch members"})
+		return
+	}
+	defer rows.Close()
+
+	members := []models.OrganizationMember{}
+	for rows.Next() {
+		member, err := scanMember(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read members"})
+			return
+		}
+		members = append(members, member)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read members"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"members": members, "count": len(members)})
+}
+
+// InviteMember handles POST /v1/clinic/members and POST /v1/scanning/members
+// Invites a staff member by mobile number. The invitation is accepted by
+// logging in with OTP on that number, with the organization's role.
+func InviteMember(c *gin.Context) {
+	var member models.OrganizationMember
+	if err := c.ShouldBindJSON(&member); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid member data"})
+		return
+	}
+	member.Mobile = strings.TrimSpace(member.Mobile)
+	if !mobilePattern.MatchString(member.Mobile) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'mobile'; expected 10 to 15 digits"})
+		return
+	}
+	orgID, orgType := c.GetString("userID"), c.GetString("userRole")
+	if msg := validateMember(&member, orgType); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	// An organization account's own number logs in as that account, never as a member.
+	var isOrgAccount bool
+	err := utils.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE mobile_number = $1 AND role = $2)`,
+		member.Mobile, orgType).Scan(&isOrgAccount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if isOrgAccount {
+		c.JSON(http.StatusConflict, gin.H{"error": "This number is registered as an organization account"})
+		return
+	}
+
+	member, err = scanMember(utils.DB.QueryRow(`
+		INSERT INTO organization_members (org_id, mobile_number, name, roles, qualifications, registration_number)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''))
+		RETURNING `+memberColumns,
+		orgID, member.Mobile, member.Name, pq.Array(member.Roles), member.Qualifications, member.RegistrationNumber))
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This number is already a member of the organization"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to invite member"})
+		return
+	}
+
+	// In production: send the invitation by SMS
+	// For demo: Log to console
+	fmt.Printf("Invitation for %s to join %s as %s\n", member.Mobile, orgID, strings.Join(member.Roles, ", "))
+
+	c.JSON(http.StatusCreated, member)
+}
+
+// UpdateMember handles PUT /v1/clinic/members/:id and PUT /v1/scanning/members/:id
+// Changes a member's name, roles and registration details; the mobile number is fixed.
+func UpdateMember(c *gin.Context) {
+	existing, ok := loadOrgMember(c)
+	if !ok {
+		return
+	}
+	var member models.OrganizationMember
+	if err := c.ShouldBindJSON(&member); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid member data"})
+		return
+	}
+	if msg := validateMember(&member, c.GetString("userRole")); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if existing.ID == c.GetInt64("memberID") && !containsString(member.Roles, models.MemberOrgAdmin) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot remove your own org_admin role"})
+		return
+	}
+
+	member, err := scanMember(utils.DB.QueryRow(`
+		UPDATE organization_members
+		SET name = $1, roles = $2, qualifications = NULLIF($3, ''), registration_number = NULLIF($4, '')
+		WHERE id = $5
+		RETURNING `+memberColumns,
+		member.Name, pq.Array(member.Roles), member.Qualifications, member.RegistrationNumber, existing.ID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update member"})
+		return
+	}
+	c.JSON(http.StatusOK, member)
+}
+
+// DeactivateMember handles POST /v1/clinic/members/:id/deactivate and POST /v1/scanning/members/:id/deactivate
+// Blocks the member's logins immediately; their past prescriptions keep their attribution.
+func DeactivateMember(c *gin.Context) {
+	setMemberStatus(c, models.MemberDeactivated)
+}
+
+// ReactivateMember handles POST /v1/clinic/members/:id/reactivate and POST /v1/scanning/members/:id/reactivate
+// Restores a deactivated member; members who never logged in are invited again.
+func ReactivateMember(c *gin.Context) {
+	setMemberStatus(c, models.MemberActive)
+}
+
+// setMemberStatus deactivates or reactivates the member named by :id.
+func setMemberStatus(c *gin.Context, status string) {
+	existing, ok := loadOrgMember(c)
+	if !ok {
+		return
+	}
+	if existing.ID == c.GetInt64("memberID") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot change your own status"})
+		return
+	}
+	if (status == models.MemberDeactivated) == (existing.Status == models.MemberDeactivated) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Member is already " + existing.Status})
+		return
+	}
+
+	member, err := scanMember(utils.DB.QueryRow(`
+		UPDATE organization_members
+		SET status = CASE WHEN $1 = 'deactivated' THEN 'deactivated'
+				WHEN joined_at IS NULL THEN 'invited' ELSE 'active' END,
+			deactivated_at = CASE WHEN $1 = 'deactivated' THEN CURRENT_TIMESTAMP END
+		WHERE id = $2
+		RETURNING `+memberColumns,
+		status, existing.ID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update member"})
+		return
+	}
+	c.JSON(http.StatusOK, member)
+}
+
+// loadPrescriberBranding loads the letterhead of the clinic that issued p. When a
+// staff doctor issued it, they are the signatory instead of the profile's, and the
+// profile's signature image (which is not theirs) is left out.
+func loadPrescriberBranding(p models.Prescription, withImages bool) (orgBranding, error) {
+	branding, err := loadOrgBranding(p.ClinicID)
+	if err != nil {
+		return branding, err
+	}
+	if withImages {
+		branding.readImages()
+	}
+	if p.PrescribedBy == 0 {
+		return branding, nil
+	}
+
+	profile := &branding.Profile
+	err = utils.DB.QueryRow(`
+		SELECT name, COALESCE(qualifications, ''), COALESCE(registration_number, '')
+		FROM organization_members WHERE id = $1
+	`, p.PrescribedBy).Scan(&profile.SignatoryName, &profile.Qualifications, &profile.RegistrationNumber)
+	branding.Signature = nil
+	return branding, err
+}
+
+// loginAccount is an account a mobile number can log in as: a user or
+// organization account, or a staff member acting for an organization.
+type loginAccount struct {
+	UserID       string
+	Role         string
+	Name         string
+	MemberID     int64
+	MemberName   string
+	MemberStatus string
+	Disabled     bool // Disabled by an administrator
+}
+
+// findLoginAccounts returns the accounts a mobile number can log in as with a role.
+// A user with that number and role is the only match; otherwise the number may
+// belong to staff members of several organizations, narrowed by orgID if given.
+func findLoginAccounts(phone, role, orgID string) ([]loginAccount, error) {
+	var user loginAccount
+	err := utils.DB.QueryRow(`
+		SELECT unique_user_id, name, role, disabled_at IS NOT NULL FROM users WHERE mobile_number = $1 AND role = $2
+	`, phone, role).Scan(&user.UserID, &user.Name, &user.Role, &user.Disabled)
+	if err == nil {
+		return []loginAccount{user}, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	rows, err := utils.DB.Query(`
+		SELECT u.unique_user_id, u.name, u.role, m.id, m.name, m.status
+		FROM organization_members m
+		JOIN users u ON u.unique_user_id = m.org_id
+		WHERE m.mobile_number = $1 AND u.role = $2 AND m.status <> 'deactivated' AND u.disabled_at IS NULL
+			AND ($3 = '' OR m.org_id = $3)
+		ORDER BY u.name
+	`, phone, role, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []loginAccount{}
+	for rows.Next() {
+		var a loginAccount
+		if err := rows.Scan(&a.UserID, &a.Name, &a.Role, &a.MemberID, &a.MemberName, &a.MemberStatus); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+	return accounts, rows.Err()
+}
+
+// respondLoginAccountChoice answers a login that matched no account or several.
+func respondLoginAccountChoice(c *gin.Context, accounts []loginAccount) {
+	if len(accounts) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found with specified role"})
+		return
+	}
+	orgs := make([]gin.H, len(accounts))
+	for i, a := range accounts {
+		orgs[i] = gin.H{"org_id": a.UserID, "name": a.Name}
+	}
+	c.JSON(http.StatusConflict, gin.H{
+		"error":         "This number is a member of " + strconv.Itoa(len(accounts)) + " organizations; choose one with 'org_id'",
+		"organizations": orgs,
+	})
+}
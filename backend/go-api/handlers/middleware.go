@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"database/sql"
 	"net/http"
 	"strings"
+	"time"
 	
 	"github.com/gin-gonic/gin"
 	"Medibridge/go-api/utils"
@@ -38,9 +40,66 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// Disabled accounts and sessions ended by an administrator are refused, also
+		// for profiles a caregiver switched into
+		accountIDs := []string{claims.ID}
+		if claims.CaregiverID != "" {
+			accountIDs = append(accountIDs, claims.CaregiverID)
+		}
+		var issuedAt time.Time
+		if claims.IssuedAt != nil {
+			issuedAt = claims.IssuedAt.Time
+		}
+		rejection, err := sessionRejection(issuedAt, accountIDs...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			c.Abort()
+			return
+		}
+		if rejection != "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": rejection})
+			c.Abort()
+			return
+		}
+
         // 4. Store the validated user claims in the context for subsequent handlers
 		c.Set("userID", claims.ID)
 		c.Set("userRole", claims.Role)
+		c.Set("memberID", claims.MemberID)
+
+		// 5. Staff members are re-checked on every request, so deactivation and role
+		// changes take effect without waiting for the token to expire
+		if claims.MemberID != 0 {
+			roles, err := activeMemberRoles(claims.ID, claims.MemberID)
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Member account is deactivated"})
+				c.Abort()
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				c.Abort()
+				return
+			}
+			c.Set("memberRoles", roles)
+		}
+
+		// 6. So are guardians and caregivers acting on a linked patient profile
+		if claims.CaregiverID != "" {
+			permissions, err := profilePermissions(claims.ID, claims.CaregiverID)
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Access to this profile was revoked"})
+				c.Abort()
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				c.Abort()
+				return
+			}
+			c.Set("caregiverID", claims.CaregiverID)
+			c.Set("profilePermissions", permissions)
+		}
         
 		c.Next() // Continue to the next handler/logic
 	}
@@ -76,3 +135,25 @@ func RBACMiddleware(allowedRoles ...string) gin.HandlerFunc {
 		c.Next() // Role is authorized, proceed
 	}
 }
+
+// MemberRoleMiddleware restricts staff members of an organization to the given
+// member roles. Organization accounts themselves (and other users, whose access
+// RBACMiddleware decides) are not affected.
+func MemberRoleMiddleware(allowedRoles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetInt64("memberID") == 0 {
+			c.Next()
+			return
+		}
+
+		for _, role := range c.GetStringSlice("memberRoles") {
+			if containsString(allowedRoles, role) {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied. Requires member role: " + strings.Join(allowedRoles, " or ")})
+		c.Abort()
+	}
+}
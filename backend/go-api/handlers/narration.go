@@ -0,0 +1,464 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"Medibridge/go-api/models"
+)
+
+// narrationTemplate renders dosage instructions as sentences in one language.
+// In Take, TakeWithoutDose, AsWritten and Stop, {drug}, {dose} and {details}
+// are filled in; details are the schedule, timing and duration, separated by
+// commas. AsWritten is for doses without a known unit ("Apply thin layer").
+type narrationTemplate struct {
+	Take, TakeWithoutDose, AsWritten, Stop string
+	Note                                   string               // {note} is the doctor's note, as written
+	Units                                  map[string][2]string // Singular and plural, by unit
+	TimesOfDay                             map[string]string    // By time of day, e.g., "in the morning"
+	And                                    string
+	Once, Twice, TimesPerDay               string // TimesPerDay has %d
+	Timing                                 map[string]string
+	MinutesBefore, MinutesAfter            string // %d minutes before or after food
+	Day, Days, Ongoing                     string // Days has %d
+}
+
+// Times of day a drug is taken at, in the order they are narrated.
+var narrationTimesOfDay = []string{"morning", "afternoon", "evening", "night", "bedtime"}
+
+// Timings of a dose relative to food.
+const (
+	timingBeforeFood   = "before"
+	timingAfterFood    = "after"
+	timingWithFood     = "with"
+	timingEmptyStomach = "empty"
+)
+
+// narrationTemplates are the languages prescriptions can be narrated in
+// without the AI service.
+var narrationTemplates = map[string]narrationTemplate{
+	"en": {
+		Take:            "Take {dose} of {drug} {details}.",
+		TakeWithoutDose: "Take {drug} {details}.",
+		AsWritten:       "{drug}: {details}.",
+		Stop:            "Stop taking {drug}.",
+		Note:            "Note: {note}",
+		Units: map[string][2]string{
+			"tablet": {"tablet", "tablets"}, "capsule": {"capsule", "capsules"}, "ml": {"ml", "ml"},
+			"mg": {"mg", "mg"}, "drop": {"drop", "drops"}, "puff": {"puff", "puffs"},
+			"sachet": {"sachet", "sachets"}, "spoon": {"spoon", "spoons"}, "unit": {"unit", "units"},
+		},
+		TimesOfDay: map[string]string{
+			"morning": "in the morning", "afternoon": "in the afternoon", "evening": "in the evening",
+			"night": "at night", "bedtime": "at bedtime",
+		},
+		And:  "and",
+		Once: "once a day", Twice: "twice a day", TimesPerDay: "%d times a day",
+		Timing: map[string]string{
+			timingBeforeFood: "before food", timingAfterFood: "after food",
+			timingWithFood: "with food", timingEmptyStomach: "on an empty stomach",
+		},
+		MinutesBefore: "%d minutes before food", MinutesAfter: "%d minutes after food",
+		Day: "for 1 day", Days: "for %d days", Ongoing: "until your doctor tells you to stop",
+	},
+	"hi": {
+		Take:            "{drug} की {dose} {details} लें।",
+		TakeWithoutDose: "{drug} {details} लें।",
+		AsWritten:       "{drug}: {details}।",
+		Stop:            "{drug} लेना बंद करें।",
+		Note:            "ध्यान दें: {note}",
+		Units: map[string][2]string{
+			"tablet": {"गोली", "गोलियाँ"}, "capsule": {"कैप्सूल", "कैप्सूल"}, "ml": {"मि.ली.", "मि.ली."},
+			"mg": {"मि.ग्रा.", "मि.ग्रा."}, "drop": {"बूंद", "बूंदें"}, "puff": {"पफ", "पफ"},
+			"sachet": {"पाउच", "पाउच"}, "spoon": {"चम्मच", "चम्मच"}, "unit": {"यूनिट", "यूनिट"},
+		},
+		TimesOfDay: map[string]string{
+			"morning": "सुबह", "afternoon": "दोपहर", "evening": "शाम", "night": "रात", "bedtime": "सोने से पहले",
+		},
+		And:  "और",
+		Once: "दिन में एक बार", Twice: "दिन में दो बार", TimesPerDay: "दिन में %d बार",
+		Timing: map[string]string{
+			timingBeforeFood: "खाने से पहले", timingAfterFood: "खाने के बाद",
+			timingWithFood: "खाने के साथ", timingEmptyStomach: "खाली पेट",
+		},
+		MinutesBefore: "खाने से %d मिनट पहले", MinutesAfter: "खाने के %d मिनट बाद",
+		Day: "1 दिन तक", Days: "%d दिन तक", Ongoing: "डॉक्टर के बंद करने तक",
+	},
+	"kn": {
+		Take:            "{drug} {dose} {details} ತೆಗೆದುಕೊಳ್ಳಿ.",
+		TakeWithoutDose: "{drug} {details} ತೆಗೆದುಕೊಳ್ಳಿ.",
+		AsWritten:       "{drug}: {details}.",
+		Stop:            "{drug} ತೆಗೆದುಕೊಳ್ಳುವುದನ್ನು ನಿಲ್ಲಿಸಿ.",
+		Note:            "ಗಮನಿಸಿ: {note}",
+		Units: map[string][2]string{
+			"tablet": {"ಮಾತ್ರೆ", "ಮಾತ್ರೆಗಳು"}, "capsule": {"ಕ್ಯಾಪ್ಸೂಲ್", "ಕ್ಯಾಪ್ಸೂಲ್‌ಗಳು"}, "ml": {"ಮಿ.ಲೀ.", "ಮಿ.ಲೀ."},
+			"mg": {"ಮಿ.ಗ್ರಾಂ", "ಮಿ.ಗ್ರಾಂ"}, "drop": {"ಹನಿ", "ಹನಿಗಳು"}, "puff": {"ಪಫ್", "ಪಫ್‌ಗಳು"},
+			"sachet": {"ಸ್ಯಾಶೆ", "ಸ್ಯಾಶೆಗಳು"}, "spoon": {"ಚಮಚ", "ಚಮಚ"}, "unit": {"ಯೂನಿಟ್", "ಯೂನಿಟ್‌ಗಳು"},
+		},
+		TimesOfDay: map[string]string{
+			"morning": "ಬೆಳಿಗ್ಗೆ", "afternoon": "ಮಧ್ಯಾಹ್ನ", "evening": "ಸಂಜೆ", "night": "ರಾತ್ರಿ", "bedtime": "ಮಲಗುವ ಮೊದಲು",
+		},
+		And:  "ಮತ್ತು",
+		Once: "ದಿನಕ್ಕೆ ಒಮ್ಮೆ", Twice: "ದಿನಕ್ಕೆ ಎರಡು ಬಾರಿ", TimesPerDay: "ದಿನಕ್ಕೆ %d ಬಾರಿ",
+		Timing: map[string]string{
+			timingBeforeFood: "ಊಟಕ್ಕೆ ಮೊದಲು", timingAfterFood: "ಊಟದ ನಂತರ",
+			timingWithFood: "ಊಟದ ಜೊತೆಗೆ", timingEmptyStomach: "ಖಾಲಿ ಹೊಟ್ಟೆಯಲ್ಲಿ",
+		},
+		MinutesBefore: "ಊಟಕ್ಕೆ %d ನಿಮಿಷ ಮೊದಲು", MinutesAfter: "ಊಟದ %d ನಿಮಿಷಗಳ ನಂತರ",
+		Day: "1 ದಿನದವರೆಗೆ", Days: "%d ದಿನಗಳವರೆಗೆ", Ongoing: "ವೈದ್ಯರು ನಿಲ್ಲಿಸಲು ಹೇಳುವವರೆಗೆ",
+	},
+	"ta": {
+		Take:            "{drug} {dose} {details} எடுத்துக்கொள்ளுங்கள்.",
+		TakeWithoutDose: "{drug} {details} எடுத்துக்கொள்ளுங்கள்.",
+		AsWritten:       "{drug}: {details}.",
+		Stop:            "{drug} எடுத்துக்கொள்வதை நிறுத்துங்கள்.",
+		Note:            "குறிப்பு: {note}",
+		Units: map[string][2]string{
+			"tablet": {"மாத்திரை", "மாத்திரைகள்"}, "capsule": {"கேப்ஸ்யூல்", "கேப்ஸ்யூல்கள்"}, "ml": {"மி.லி.", "மி.லி."},
+			"mg": {"மி.கி.", "மி.கி."}, "drop": {"சொட்டு", "சொட்டுகள்"}, "puff": {"பஃப்", "பஃப்கள்"},
+			"sachet": {"சாஷே", "சாஷேக்கள்"}, "spoon": {"ஸ்பூன்", "ஸ்பூன்"}, "unit": {"யூனிட்", "யூனிட்கள்"},
+		},
+		TimesOfDay: map[string]string{
+			"morning": "காலை", "afternoon": "மதியம்", "evening": "மாலை", "night": "இரவு", "bedtime": "தூங்கும் முன்",
+		},
+		And:  "மற்றும்",
+		Once: "ஒரு நாளைக்கு ஒரு முறை", Twice: "ஒரு நாளைக்கு இரண்டு முறை", TimesPerDay: "ஒரு நாளைக்கு %d முறை",
+		Timing: map[string]string{
+			timingBeforeFood: "சாப்பாட்டுக்கு முன்", timingAfterFood: "சாப்பாட்டுக்குப் பின்",
+			timingWithFood: "சாப்பாட்டுடன்", timingEmptyStomach: "வெறும் வயிற்றில்",
+		},
+		MinutesBefore: "சாப்பாட்டுக்கு %d நிமிடங்கள் முன்", MinutesAfter: "சாப்பிட்டு %d நிமிடங்கள் கழித்து",
+		Day: "1 நாளுக்கு", Days: "%d நாட்களுக்கு", Ongoing: "மருத்துவர் நிறுத்தச் சொல்லும் வரை",
+	},
+	"te": {
+		Take:            "{drug} {dose} {details} తీసుకోండి.",
+		TakeWithoutDose: "{drug} {details} తీసుకోండి.",
+		AsWritten:       "{drug}: {details}.",
+		Stop:            "{drug} తీసుకోవడం ఆపండి.",
+		Note:            "గమనిక: {note}",
+		Units: map[string][2]string{
+			"tablet": {"మాత్ర", "మాత్రలు"}, "capsule": {"క్యాప్సూల్", "క్యాప్సూల్స్"}, "ml": {"మి.లీ.", "మి.లీ."},
+			"mg": {"మి.గ్రా.", "మి.గ్రా."}, "drop": {"చుక్క", "చుక్కలు"}, "puff": {"పఫ్", "పఫ్‌లు"},
+			"sachet": {"సాషే", "సాషేలు"}, "spoon": {"చెంచా", "చెంచాలు"}, "unit": {"యూనిట్", "యూనిట్లు"},
+		},
+		TimesOfDay: map[string]string{
+			"morning": "ఉదయం", "afternoon": "మధ్యాహ్నం", "evening": "సాయంత్రం", "night": "రాత్రి", "bedtime": "నిద్రపోయే ముందు",
+		},
+		And:  "మరియు",
+		Once: "రోజుకు ఒకసారి", Twice: "రోజుకు రెండుసార్లు", TimesPerDay: "రోజుకు %d సార్లు",
+		Timing: map[string]string{
+			timingBeforeFood: "భోజనానికి ముందు", timingAfterFood: "భోజనం తర్వాత",
+			timingWithFood: "భోజనంతో పాటు", timingEmptyStomach: "ఖాళీ కడుపుతో",
+		},
+		MinutesBefore: "భోజనానికి %d నిమిషాల ముందు", MinutesAfter: "భోజనం చేసిన %d నిమిషాల తర్వాత",
+		Day: "1 రోజు పాటు", Days: "%d రోజుల పాటు", Ongoing: "డాక్టర్ ఆపమని చెప్పే వరకు",
+	},
+}
+
+// narrationUnits maps the unit words of dosage quantities and drug types to narrated units.
+var narrationUnits = map[string]string{
+	"tab": "tablet", "tabs": "tablet", "tablet": "tablet", "tablets": "tablet",
+	"cap": "capsule", "caps": "capsule", "capsule": "capsule", "capsules": "capsule",
+	"ml": "ml", "mg": "mg",
+	"drop": "drop", "drops": "drop", "gtt": "drop",
+	"puff": "puff", "puffs": "puff", "inhaler": "puff",
+	"sachet": "sachet", "sachets": "sachet",
+	"spoon": "spoon", "spoons": "spoon", "tsp": "spoon", "teaspoon": "spoon",
+	"unit": "unit", "units": "unit", "iu": "unit",
+}
+
+// narrationTimeWords maps the schedule words of frequencies to times of day.
+var narrationTimeWords = map[string]string{
+	"morning": "morning", "afternoon": "afternoon", "noon": "afternoon", "evening": "evening",
+	"night": "night", "bedtime": "bedtime",
+}
+
+// narrationDose is the amount taken per dose, e.g., "1" tablet. Without a
+// unit, Raw is the dosage quantity as the doctor wrote it.
+type narrationDose struct {
+	Amount string
+	Plural bool
+	Unit   string
+	Raw    string
+}
+
+// parseNarrationDose reads the amount and unit of a dosage quantity, taking
+// the unit from the drug type ("Tablet") when the quantity is a bare number.
+func parseNarrationDose(instr models.DosageInstruction) narrationDose {
+	quantity := strings.TrimSpace(instr.DosageQuantity)
+	match := quantityPattern.FindStringSubmatch(quantity)
+	if match == nil || strings.TrimSpace(match[0]) != quantity {
+		return narrationDose{Raw: quantity}
+	}
+
+	dose := narrationDose{Amount: match[1], Raw: quantity}
+	if match[2] != "" {
+		dose.Amount += "/" + match[2]
+	} else if amount, err := strconv.ParseFloat(match[1], 64); err == nil && amount > 1 {
+		dose.Plural = true
+	}
+	dose.Unit = narrationUnits[strings.ToLower(match[3])]
+	if match[3] == "" {
+		dose.Unit = narrationUnits[strings.ToLower(strings.TrimSpace(instr.DrugType))]
+	}
+	return dose
+}
+
+// narrationSchedule is when a drug is taken: at times of day, or a number
+// of times a day. Raw is the frequency as written when it is neither.
+type narrationSchedule struct {
+	TimesOfDay []string
+	PerDay     int
+	Raw        string
+}
+
+// parseNarrationSchedule reads a frequency such as "Morning, Night", "1-0-1",
+// "BD" or "3 times a day".
+func parseNarrationSchedule(frequency string) narrationSchedule {
+	f := strings.ToLower(strings.TrimSpace(frequency))
+	switch {
+	case f == "":
+		return narrationSchedule{}
+	case f == "hs":
+		return narrationSchedule{TimesOfDay: []string{"bedtime"}}
+	case frequencyCodes[f] > 0:
+		return narrationSchedule{PerDay: frequencyCodes[f]}
+	case scheduleNotationPattern.MatchString(f):
+		// Morning-noon-night, or morning-noon-evening-night
+		slots := map[int][]string{3: {"morning", "afternoon", "night"}, 4: {"morning", "afternoon", "evening", "night"}}
+		// with the same dose each time; "2-0-1" is kept as written
+		parts := strings.Split(f, "-")
+		var times []string
+		var dose float64
+		for i, part := range parts {
+			value, _ := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if value == 0 || slots[len(parts)] == nil {
+				continue
+			}
+			if dose != 0 && value != dose {
+				return narrationSchedule{Raw: strings.TrimSpace(frequency)}
+			}
+			dose = value
+			times = append(times, slots[len(parts)][i])
+		}
+		if len(times) > 0 {
+			return narrationSchedule{TimesOfDay: times}
+		}
+	case timesPerDayPattern.MatchString(f):
+		if n, err := strconv.Atoi(timesPerDayPattern.FindStringSubmatch(f)[1]); err == nil && n > 0 {
+			return narrationSchedule{PerDay: n}
+		}
+	}
+
+	found := map[string]bool{}
+	for _, word := range strings.FieldsFunc(f, func(r rune) bool { return !unicode.IsLetter(r) }) {
+		if word == "and" || word == "at" || word == "in" || word == "the" {
+			continue
+		}
+		slot, ok := narrationTimeWords[word]
+		if !ok {
+			return narrationSchedule{Raw: strings.TrimSpace(frequency)}
+		}
+		found[slot] = true
+	}
+	var times []string
+	for _, slot := range narrationTimesOfDay {
+		if found[slot] {
+			times = append(times, slot)
+		}
+	}
+	if len(times) == 0 {
+		return narrationSchedule{Raw: strings.TrimSpace(frequency)}
+	}
+	return narrationSchedule{TimesOfDay: times}
+}
+
+// parseNarrationTiming reads a timing relation such as "After Food". It
+// returns "" when the timing is not one of the known relations to food.
+func parseNarrationTiming(relation string) string {
+	r := strings.ToLower(relation)
+	switch {
+	case strings.Contains(r, "empty"):
+		return timingEmptyStomach
+	case strings.Contains(r, "before"):
+		return timingBeforeFood
+	case strings.Contains(r, "after"):
+		return timingAfterFood
+	case strings.Contains(r, "with"), strings.Contains(r, "during"):
+		return timingWithFood
+	}
+	return ""
+}
+
+// narrateInstruction renders one instruction as a sentence, e.g., "Take 1
+// tablet of Amoxicillin 500 mg in the morning and at night, 30 minutes after
+// food, for 5 days." Parts it cannot read are kept as the doctor wrote them.
+func (t narrationTemplate) narrateInstruction(instr models.DosageInstruction) string {
+	drug := strings.Join(strings.Fields(instr.DrugName+" "+instr.Strength), " ")
+	if instr.Discontinued {
+		return strings.NewReplacer("{drug}", drug).Replace(t.Stop)
+	}
+
+	var details []string
+	dose := parseNarrationDose(instr)
+	if dose.Unit == "" && dose.Raw != "" {
+		details = append(details, dose.Raw)
+	}
+
+	schedule := parseNarrationSchedule(instr.Frequency)
+	switch {
+	case len(schedule.TimesOfDay) > 0:
+		times := make([]string, len(schedule.TimesOfDay))
+		for i, slot := range schedule.TimesOfDay {
+			times[i] = t.TimesOfDay[slot]
+		}
+		when := times[len(times)-1]
+		if len(times) > 1 {
+			when = strings.Join(times[:len(times)-1], ", ") + " " + t.And + " " + when
+		}
+		details = append(details, when)
+	case schedule.PerDay == 1:
+		details = append(details, t.Once)
+	case schedule.PerDay == 2:
+		details = append(details, t.Twice)
+	case schedule.PerDay > 2:
+		details = append(details, fmt.Sprintf(t.TimesPerDay, schedule.PerDay))
+	case schedule.Raw != "":
+		details = append(details, schedule.Raw)
+	}
+
+	switch timing := parseNarrationTiming(instr.TimingRelation); {
+	case timing == timingBeforeFood && instr.TimeOffset > 0:
+		details = append(details, fmt.Sprintf(t.MinutesBefore, instr.TimeOffset))
+	case timing == timingAfterFood && instr.TimeOffset > 0:
+		details = append(details, fmt.Sprintf(t.MinutesAfter, instr.TimeOffset))
+	case timing != "":
+		details = append(details, t.Timing[timing])
+	case strings.TrimSpace(instr.TimingRelation) != "":
+		details = append(details, strings.TrimSpace(instr.TimingRelation))
+	}
+
+	switch {
+	case instr.DurationDays == 1:
+		details = append(details, t.Day)
+	case instr.DurationDays > 1:
+		details = append(details, fmt.Sprintf(t.Days, instr.DurationDays))
+	default:
+		details = append(details, t.Ongoing)
+	}
+
+	sentence := t.TakeWithoutDose
+	doseText := ""
+	if dose.Unit == "" && dose.Raw != "" {
+		sentence = t.AsWritten
+	} else if dose.Unit != "" {
+		sentence = t.Take
+		units := t.Units[dose.Unit]
+		doseText = dose.Amount + " " + units[0]
+		if dose.Plural {
+			doseText = dose.Amount + " " + units[1]
+		}
+	}
+	text := strings.NewReplacer("{drug}", drug, "{dose}", doseText, "{details}", strings.Join(details, ", ")).Replace(sentence)
+	if note := strings.TrimSpace(instr.PatientNote); note != "" {
+		text += " " + strings.NewReplacer("{note}", note).Replace(t.Note)
+	}
+	return text
+}
+
+// narratePrescription renders a prescription's instructions in lang, one
+// sentence per drug, from the narration templates. It returns false for
+// languages without templates.
+func narratePrescription(p models.Prescription, lang string) (string, bool) {
+	t, ok := narrationTemplates[lang]
+	if !ok || len(p.Instructions) == 0 {
+		return "", false
+	}
+	lines := make([]string, len(p.Instructions))
+	for i, instr := range p.Instructions {
+		lines[i] = t.narrateInstruction(instr)
+	}
+	return strings.Join(lines, "\n"), true
+}
+
+// digitZeros are the zero digits of the scripts patients read prescriptions in
+// (Latin, Arabic, Devanagari, Bengali, Gurmukhi, Gujarati, Odia, Tamil,
+// Telugu, Kannada and Malayalam); each is followed by the other nine digits.
+var digitZeros = []rune{'0', '٠', '۰', '०', '০', '੦', '૦', '୦', '௦', '౦', '೦', '൦'}
+
+// asciiDigits replaces the digits of any script in digitZeros with 0-9.
+func asciiDigits(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			for _, zero := range digitZeros {
+				if r >= zero && r <= zero+9 {
+					return '0' + (r - zero)
+				}
+			}
+		}
+		return r
+	}, text)
+}
+
+// numbersIn returns the numbers written in a text, in any script, normalized
+// so that "5", "5.0" and "५" compare equal.
+func numbersIn(text string) []string {
+	var numbers []string
+	for _, match := range numberPattern.FindAllString(asciiDigits(text), -1) {
+		if value, err := strconv.ParseFloat(match, 64); err == nil {
+			numbers = append(numbers, strconv.FormatFloat(value, 'f', -1, 64))
+		}
+	}
+	return numbers
+}
+
+// narrationMismatches cross-checks a translation of a prescription's
+// instructions, e.g., the AI service's, against the structured instructions:
+// the dose, minutes and days of every drug still taken must appear in it, and
+// it must not contain numbers the prescription does not. It returns what
+// does not match; empty means the translation passed.
+func narrationMismatches(p models.Prescription, text string) []string {
+	allowed := map[string]bool{}
+	var required []string
+	for _, instr := range p.Instructions {
+		for _, field := range []string{instr.DrugName, instr.Strength, instr.DrugType, instr.DosageQuantity,
+			instr.Frequency, instr.TimingRelation, instr.PatientNote, instr.DiscontinueReason} {
+			for _, n := range numbersIn(field) {
+				allowed[n] = true
+			}
+		}
+		if perDay, ok := dosesPerDay(instr.Frequency); ok {
+			allowed[strconv.Itoa(perDay)] = true // "2 times a day" for BD
+		}
+		if instr.Discontinued {
+			continue
+		}
+		if dose := parseNarrationDose(instr); dose.Amount != "" {
+			required = append(required, numbersIn(dose.Amount)...)
+		}
+		for _, n := range []int{instr.TimeOffset, instr.DurationDays} {
+			if n > 0 {
+				allowed[strconv.Itoa(n)] = true
+				required = append(required, strconv.Itoa(n))
+			}
+		}
+	}
+
+	found := map[string]bool{}
+	var mismatches []string
+	for _, n := range numbersIn(text) {
+		if !allowed[n] && !found[n] {
+			mismatches = append(mismatches, "unexpected number "+n)
+		}
+		found[n] = true
+	}
+	for _, n := range required {
+		if !found[n] {
+			mismatches = append(mismatches, "missing number "+n)
+			found[n] = true // Report it once
+		}
+	}
+	return mismatches
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"Medibridge/go-api/models"
+	"Medibridge/go-api/utils"
+)
+
+// notifyUser stores a notification for the user's app. Failures are only logged:
+// a missed notification must never undo the change it reports.
+func notifyUser(n models.Notification) {
+	_, err := utils.DB.Exec(`
+		INSERT INTO notifications (user_id, type, title, message, resource_type, resource_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, n.UserID, n.Type, n.Title, n.Message, n.ResourceType, n.ResourceID)
+	if err != nil {
+		log.Printf("Warning: Could not notify %s (%s): %v", n.UserID, n.Type, err)
+	}
+}
+
+// GetMyNotifications handles GET /v1/patient/notifications and GET /v1/clinic/notifications
+// Returns the user's latest notifications, newest first. With ?unread=true only
+// unread ones are returned.
+func GetMyNotifications(c *gin.Context) {
+	rows, err := utils.DB.Query(`
+		SELECT id, user_id, type, title, COALESCE(message, ''), COALESCE(resource_type, ''),
+			COALESCE(resource_id, ''), read_at, created_at
+		FROM notifications
+		WHERE user_id = $1 AND (read_at IS NULL OR NOT $2)
+		ORDER BY created_at DESC
+		LIMIT 100
+	`, c.GetString("userID"), c.Query("unread") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+		return
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		var n models.Notification
+		var readAt sql.NullTime
+		var createdAt time.Time
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Type, &n.Title, &n.Message, &n.ResourceType,
+			&n.ResourceID, &readAt, &createdAt); err != nil {
+			continue
+		}
+		n.Read = readAt.Valid
+		n.CreatedAt = createdAt.Unix()
+		notifications = append(notifications, n)
+	}
+
+	c.JSON(http.StatusOK, notifications)
+}
+
+// MarkNotificationRead handles POST /v1/patient/notifications/:id/read and POST /v1/clinic/notifications/:id/read
+func MarkNotificationRead(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+		return
+	}
+
+	result, err := utils.DB.Exec(`
+		UPDATE notifications SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP)
+		WHERE id = $1 AND user_id = $2
+	`, id, c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification marked as read"})
+}
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"database/sql"
+	"image"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"Medibridge/go-api/models"
+	"Medibridge/go-api/utils"
+)
+
+// maxBrandingUploadBytes caps logo and signature uploads.
+const maxBrandingUploadBytes = 2 << 20
+
+// maxBrandingImageSide keeps decoded images, and the PDFs they go into, small.
+const maxBrandingImageSide = 2000
+
+// brandingUploadTypes are the accepted logo and signature images.
+var brandingUploadTypes = map[string][]string{
+	"png":  {"image/png"},
+	"jpg":  {"image/jpeg"},
+	"jpeg": {"image/jpeg"},
+}
+
+// letterheadTemplates are the accepted values of letterhead_template.
+var letterheadTemplates = []string{models.LetterheadClassic, models.LetterheadCentered, models.LetterheadMinimal}
+
+// assetStoragePath is where organization logos and signatures are kept, under random names.
+func assetStoragePath() string {
+	if dir := os.Getenv("ASSET_STORAGE_PATH"); dir != "" {
+		return dir
+	}
+	return "/app/assets"
+}
+
+// orgBranding is an organization's profile with its letterhead images. The
+// images are only read from storage by readImages.
+type orgBranding struct {
+	Profile       models.OrganizationProfile
+	LogoPath      string
+	SignaturePath string
+	Logo          []byte
+	Signature     []byte
+}
+
+// loadOrgBranding fetches the profile of a clinic or scanning center. Organizations
+// that have not set up a profile yet get their account name as the name.
+func loadOrgBranding(orgID string) (orgBranding, error) {
+	var b orgBranding
+	p := &b.Profile
+	var updatedAt time.Time
+	err := utils.DB.QueryRow(`
+		SELECT org_type, name, COALESCE(legal_name, ''), COALESCE(address, ''), COALESCE(phone, ''),
+			COALESCE(email, ''), COALESCE(working_hours, ''), COALESCE(licence_number, ''),
+			COALESCE(signatory_name, ''), COALESCE(qualifications, ''), COALESCE(registration_number, ''),
+			letterhead_template, COALESCE(logo_path, ''), COALESCE(signature_path, ''), updated_at
+		FROM organization_profiles
+		WHERE org_id = $1
+	`, orgID).Scan(&p.OrgType, &p.Name, &p.LegalName, &p.Address, &p.Phone,
+		&p.Email, &p.WorkingHours, &p.LicenceNumber,
+		&p.SignatoryName, &p.Qualifications, &p.RegistrationNumber,
+		&p.LetterheadTemplate, &b.LogoPath, &b.SignaturePath, &updatedAt)
+	if err == sql.ErrNoRows {
+		err = utils.DB.QueryRow(`SELECT name, role FROM users WHERE unique_user_id = $1`, orgID).Scan(&p.Name, &p.OrgType)
+		if err == sql.ErrNoRows {
+			err = nil
+		}
+	} else if err == nil {
+		p.UpdatedAt = updatedAt.Unix()
+	}
+
+	p.OrgID = orgID
+	if p.LetterheadTemplate == "" {
+		p.LetterheadTemplate = models.LetterheadClassic
+	}
+	p.HasLogo = b.LogoPath != ""
+	p.HasSignature = b.SignaturePath != ""
+	return b, err
+}
+
+// readImages loads the logo and signature from storage. A missing file is
+// logged and left out rather than failing the document it goes into.
+func (b *orgBranding) readImages() {
+	read := func(path string) []byte {
+		if path == "" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("Warning: Could not read branding image of %s: %v", b.Profile.OrgID, err)
+		}
+		return data
+	}
+	b.Logo = read(b.LogoPath)
+	b.Signature = read(b.SignaturePath)
+}
+
+// GetOrganizationProfile handles GET /v1/clinic/profile and GET /v1/scanning/profile
+// Returns the letterhead details printed on the organization's documents.
+func GetOrganizationProfile(c *gin.Context) {
+	branding, err := loadOrgBranding(c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch organization profile"})
+		return
+	}
+	c.JSON(http.StatusOK, branding.Profile)
+}
+
+// OnboardScanningCenter handles POST /v1/scanning/onboarding/template
+// One-time setup of a scanning center's profile; later changes go through
+// PUT /v1/scanning/profile.
+func OnboardScanningCenter(c *gin.Context) {
+	saveOrganizationProfile(c, true)
+}
+
+// UpdateOrganizationProfile handles PUT /v1/clinic/profile and PUT /v1/scanning/profile
+// Creates or replaces the organization's letterhead details; the logo and signature are kept.
+func UpdateOrganizationProfile(c *gin.Context) {
+	saveOrganizationProfile(c, false)
+}
+
+// saveOrganizationProfile stores the posted profile. When onboarding, an
+// existing profile is left alone and reported as a conflict.
+func saveOrganizationProfile(c *gin.Context, onboarding bool) {
+	var profile models.OrganizationProfile
+	if err := c.ShouldBindJSON(&profile); err != nil || strings.TrimSpace(profile.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization profile; 'name' is required"})
+		return
+	}
+	if profile.LetterheadTemplate == "" {
+		profile.LetterheadTemplate = models.LetterheadClassic
+	}
+	if !containsString(letterheadTemplates, profile.LetterheadTemplate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'letterhead_template'; expected one of: " + strings.Join(letterheadTemplates, ", ")})
+		return
+	}
+	profile.OrgID = c.GetString("userID")
+	profile.OrgType = c.GetString("userRole")
+	profile.Name = strings.TrimSpace(profile.Name)
+
+	conflict := `DO UPDATE SET
+			name = EXCLUDED.name, legal_name = EXCLUDED.legal_name, address = EXCLUDED.address,
+			phone = EXCLUDED.phone, email = EXCLUDED.email, working_hours = EXCLUDED.working_hours,
+			licence_number = EXCLUDED.licence_number, signatory_name = EXCLUDED.signatory_name,
+			qualifications = EXCLUDED.qualifications, registration_number = EXCLUDED.registration_number,
+			letterhead_template = EXCLUDED.letterhead_template, updated_at = EXCLUDED.updated_at`
+	if onboarding {
+		conflict = `DO NOTHING`
+	}
+	res, err := utils.DB.Exec(`
+		INSERT INTO organization_profiles (org_id, org_type, name, legal_name, address, phone, email,
+			working_hours, licence_number, signatory_name, qualifications, registration_number,
+			letterhead_template, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, CURRENT_TIMESTAMP)
+		ON CONFLICT (org_id) `+conflict,
+		profile.OrgID, profile.OrgType, profile.Name, profile.LegalName, profile.Address, profile.Phone,
+		profile.Email, profile.WorkingHours, profile.LicenceNumber, profile.SignatoryName,
+		profile.Qualifications, profile.RegistrationNumber, profile.LetterheadTemplate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save organization profile"})
+		return
+	}
+	if n, _ := res.RowsAffected(); onboarding && n == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Onboarding is already complete; update the profile instead"})
+		return
+	}
+
+	branding, err := loadOrgBranding(profile.OrgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch organization profile"})
+		return
+	}
+	status := http.StatusOK
+	if onboarding {
+		status = http.StatusCreated
+	}
+	c.JSON(status, branding.Profile)
+}
+
+// UploadOrganizationLogo handles POST /v1/clinic/profile/logo and POST /v1/scanning/profile/logo
+// Stores the organization's logo (PNG or JPEG, multipart field "file") for the letterhead.
+func UploadOrganizationLogo(c *gin.Context) {
+	uploadBrandingImage(c, "logo")
+}
+
+// UploadOrganizationSignature handles POST /v1/clinic/profile/signature and POST /v1/scanning/profile/signature
+// Stores the signatory's signature (PNG or JPEG, multipart field "file"), printed
+// above the signature line. A PNG with a transparent background prints best.
+func UploadOrganizationSignature(c *gin.Context) {
+	uploadBrandingImage(c, "signature")
+}
+
+// uploadBrandingImage saves an uploaded image to asset storage and points the
+// profile's <kind>_path column at it, removing the image it replaces.
+func uploadBrandingImage(c *gin.Context, kind string) {
+	orgID := c.GetString("userID")
+	var storedPath string
+
+	policy := uploadPolicy{Fields: []string{"file", kind}, MaxBytes: maxBrandingUploadBytes, Types: brandingUploadTypes}
+	err := receiveUpload(c, policy, func(u *upload) error {
+		var err error
+		if storedPath, err = u.saveTo(assetStoragePath()); err != nil {
+			return err
+		}
+		if err = checkBrandingImage(storedPath, policy); err != nil {
+			removeStoredFile(storedPath)
+		}
+		return err
+	})
+	if err != nil {
+		respondUploadError(c, err, "Failed to save image")
+		return
+	}
+
+	branding, err := loadOrgBranding(orgID)
+	if err != nil {
+		removeStoredFile(storedPath)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch organization profile"})
+		return
+	}
+
+	// kind is one of the two fixed names above, never client input.
+	column := kind + "_path"
+	_, err = utils.DB.Exec(`
+		INSERT INTO organization_profiles (org_id, org_type, name, `+column+`, updated_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+		ON CONFLICT (org_id) DO UPDATE SET `+column+` = EXCLUDED.`+column+`, updated_at = EXCLUDED.updated_at
+	`, orgID, c.GetString("userRole"), branding.Profile.Name, storedPath)
+	if err != nil {
+		removeStoredFile(storedPath)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save image"})
+		return
+	}
+
+	previous := branding.LogoPath
+	if kind == "signature" {
+		previous = branding.SignaturePath
+	}
+	if previous != "" {
+		removeStoredFile(previous)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Organization " + kind + " updated"})
+}
+
+// checkBrandingImage checks that a stored upload is an image of acceptable size.
+func checkBrandingImage(path string, policy uploadPolicy) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return invalidUpload(err, policy, "Could not read image")
+	}
+	if config.Width > maxBrandingImageSide || config.Height > maxBrandingImageSide {
+		side := strconv.Itoa(maxBrandingImageSide)
+		return &uploadError{Status: http.StatusBadRequest, Message: "Image must be at most " + side + "x" + side + " pixels"}
+	}
+	return nil
+}
+
+// removeStoredFile deletes a file from storage, logging failures.
+func removeStoredFile(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: Failed to delete %s: %v", path, err)
+	}
+}
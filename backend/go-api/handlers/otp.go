@@ -1,10 +1,10 @@
 package handlers
 
 import (
-	"database/sql"
 	"fmt"
 	"math/rand"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -12,8 +12,31 @@ import (
 	"Medibridge/go-api/utils"
 )
 
-// In-memory OTP storage (for demo - use Redis in production)
-var otpStore = make(map[string]models.OTPData)
+// In-memory OTP storage (for demo - use Redis in production). Requests run
+// concurrently, so otpStore is only used through the helpers below.
+var (
+	otpMu    sync.Mutex
+	otpStore = make(map[string]models.OTPData)
+)
+
+func getOTP(key string) (models.OTPData, bool) {
+	otpMu.Lock()
+	defer otpMu.Unlock()
+	data, ok := otpStore[key]
+	return data, ok
+}
+
+func setOTP(key string, data models.OTPData) {
+	otpMu.Lock()
+	defer otpMu.Unlock()
+	otpStore[key] = data
+}
+
+func deleteOTP(key string) {
+	otpMu.Lock()
+	defer otpMu.Unlock()
+	delete(otpStore, key)
+}
 
 // RequestOTP generates and stores OTP for phone number
 func RequestOTP(c *gin.Context) {
@@ -24,34 +47,40 @@ func RequestOTP(c *gin.Context) {
 		return
 	}
 
-	// Verify user exists with this role
-	var exists bool
-	query := `SELECT EXISTS(SELECT 1 FROM users WHERE mobile_number = $1 AND role = $2)`
-	err := utils.DB.QueryRow(query, req.Phone, req.Role).Scan(&exists)
-	
+	// Verify user (or staff member of an organization) exists with this role
+	accounts, err := findLoginAccounts(req.Phone, req.Role, req.OrgID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
-	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found with specified role"})
+	if len(accounts) != 1 {
+		respondLoginAccountChoice(c, accounts)
+		return
+	}
+	if accounts[0].Disabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This account is disabled"})
 		return
 	}
 
+	sendOTP(c, req.Phone, req.Phone)
+}
+
+// sendOTP generates an OTP for phone, stores it under key and responds.
+func sendOTP(c *gin.Context, key, phone string) {
 	// Generate 6-digit OTP
 	rand.Seed(time.Now().UnixNano())
 	otp := fmt.Sprintf("%06d", rand.Intn(1000000))
 	
 	// Store OTP with expiry (5 minutes)
-	otpStore[req.Phone] = models.OTPData{
+	setOTP(key, models.OTPData{
 		OTP:       otp,
 		ExpiresAt: time.Now().Add(5 * time.Minute),
-	}
+	})
 
 	// In production: Send SMS via Twilio/AWS SNS
 	// For demo: Log to console
-	fmt.Printf("OTP for %s: %s\n", req.Phone, otp)
+	fmt.Printf("OTP for %s: %s\n", phone, otp)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "OTP sent successfully",
@@ -59,6 +88,27 @@ func RequestOTP(c *gin.Context) {
 	})
 }
 
+// checkOTP checks otp against the one stored under key, returning why it was
+// rejected, or "" if it matches. The OTP is kept until the caller deletes it.
+func checkOTP(key, otp string) string {
+	storedData, exists := getOTP(key)
+	if !exists {
+		return "No OTP found for this number"
+	}
+
+	// Check expiry
+	if time.Now().After(storedData.ExpiresAt) {
+		deleteOTP(key)
+		return "OTP expired"
+	}
+
+	// Verify OTP
+	if storedData.OTP != otp {
+		return "Invalid OTP"
+	}
+	return ""
+}
+
 // VerifyOTP verifies OTP and returns JWT token
 func VerifyOTP(c *gin.Context) {
 	var req models.OTPVerifyRequest
@@ -69,61 +119,109 @@ func VerifyOTP(c *gin.Context) {
 	}
 
 	// Check OTP
-	storedData, exists := otpStore[req.Phone]
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "No OTP found for this number"})
+	if msg := checkOTP(req.Phone, req.OTP); msg != "" {
+		recordLogin(c, models.LoginEvent{Mobile: req.Phone, Method: models.LoginOTP, FailureReason: msg})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": msg})
 		return
 	}
 
-	// Check expiry
-	if time.Now().After(storedData.ExpiresAt) {
-		delete(otpStore, req.Phone)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "OTP expired"})
+	// Get user details (kept the OTP if the client must still choose an organization)
+	accounts, err := findLoginAccounts(req.Phone, req.Role, req.OrgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
-
-	// Verify OTP
-	if storedData.OTP != req.OTP {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid OTP"})
+	if len(accounts) != 1 {
+		respondLoginAccountChoice(c, accounts)
+		return
+	}
+	account := accounts[0]
+	if account.Disabled {
+		recordLogin(c, models.LoginEvent{UserID: account.UserID, Mobile: req.Phone, Method: models.LoginOTP, FailureReason: "Account disabled"})
+		c.JSON(http.StatusForbidden, gin.H{"error": "This account is disabled"})
 		return
 	}
 
 	// Delete used OTP
-	delete(otpStore, req.Phone)
-
-	// Get user details
-	var user models.User
-	query := `
-		SELECT unique_user_id, name, role 
-		FROM users 
-		WHERE mobile_number = $1 AND role = $2
-	`
-	
-	err := utils.DB.QueryRow(query, req.Phone, req.Role).Scan(
-		&user.ID,
-		&user.Name,
-		&user.Role,
-	)
+	deleteOTP(req.Phone)
+
+	// The first login of an invited member accepts the invitation
+	if account.MemberStatus == models.MemberInvited {
+		_, err := utils.DB.Exec(`
+			UPDATE organization_members SET status = 'active', joined_at = CURRENT_TIMESTAMP
+			WHERE id = $1 AND status = 'invited'
+		`, account.MemberID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
 
+	// Generate JWT token
+	token, err := utils.GenerateMemberToken(account.UserID, account.Role, account.MemberID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+	recordLogin(c, models.LoginEvent{UserID: account.UserID, MemberID: account.MemberID, Mobile: req.Phone, Method: models.LoginOTP, Success: true})
+
+	if account.MemberID != 0 {
+		roles, err := activeMemberRoles(account.UserID, account.MemberID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		c.JSON(http.StatusOK, gin.H{
+			"token":        token,
+			"role":         account.Role,
+			"name":         account.MemberName,
+			"org_id":       account.UserID,
+			"org_name":     account.Name,
+			"member_id":    account.MemberID,
+			"member_roles": roles,
+		})
 		return
 	}
 
-	// Generate JWT token
-	token, err := utils.GenerateToken(user.ID, user.Role)
+	if account.Role != "Patient" {
+		c.JSON(http.StatusOK, gin.H{
+			"token": token,
+			"role":  account.Role,
+			"name":  account.Name,
+		})
+		return
+	}
+
+	// Patients get every profile linked to the number (dependents, people they care
+	// for) and may log straight into one of them
+	profiles, err := linkedProfiles(account.UserID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
+	profile := profiles[0]
+	if req.ProfileID != "" {
+		found := false
+		for _, p := range profiles {
+			if p.PatientID == req.ProfileID {
+				profile, found = p, true
+			}
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Profile not found"})
+			return
+		}
+		if token, err = profileToken(account.UserID, profile.PatientID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+			return
+		}
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"token": token,
-		"role":  user.Role,
-		"name":  user.Name,
+		"token":    token,
+		"role":     account.Role,
+		"name":     account.Name,
+		"profile":  profile,
+		"profiles": profiles,
 	})
 }
\ No newline at end of file
@@ -8,29 +8,52 @@ import (
 )
 
 // GetPatientPrescriptions handles GET /v1/patient/prescriptions
-// Retrieves personalized prescriptions for the authenticated user (DB Scoping).
+// Retrieves personalized prescriptions for the authenticated user (DB Scoping),
+// newest first, translated per ?lang=, the patient's preferred language or Accept-Language. Cancelled prescriptions are included with their status; drafts are not.
 func GetPatientPrescriptions(c *gin.Context) {
 	userID := c.GetString("userID")
-	// TODO: Add PostgreSQL query logic to fetch prescriptions for userID.
-	// NOTE: Data fetched from DB must be Decrypted using utils.Decrypt.
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Prescriptions retrieved successfully.",
-		"user_id": userID,
-		"data_scope": "Records filtered by authenticated user ID",
-	})
+	rows, err := utils.DB.Query(`
+		SELECT `+prescriptionColumns+`
+		FROM prescriptions
+		WHERE patient_id = $1 AND status <> 'draft'
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch prescriptions"})
+		return
+	}
+	defer rows.Close()
+
+	// scanPrescription decrypts the diagnosis
+	prescriptions := []models.Prescription{}
+	for rows.Next() {
+		p, err := scanPrescription(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch prescriptions"})
+			return
+		}
+		prescriptions = append(prescriptions, p)
+	}
+
+	// translated_text in the language asked for, else the patient's preferred one
+	langs, ok := requestedLanguages(c, userID)
+	if !ok {
+		return
+	}
+	if err := localizePrescriptions(prescriptions, langs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch translations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, prescriptions)
 }
 
 // GetPatientReports handles GET /v1/patient/reports
-// Retrieves AI-simplified reports for the authenticated user.
+// Retrieves AI-simplified reports shared with the authenticated user, newest
+// first. The technical originals stay with the clinic.
 func GetPatientReports(c *gin.Context) {
-	userID := c.GetString("userID")
-	// TODO: Add PostgreSQL query logic to fetch reports for userID.
-
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Simplified reports loaded successfully.",
-		"user_id": userID,
-	})
+	respondSharedReports(c)
 }
 
 // LogAdherence handles POST /v1/patient/adherence
@@ -0,0 +1,505 @@
+package handlers
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"Medibridge/go-api/models"
+	"Medibridge/go-api/utils"
+)
+
+// loadClinicPrescription fetches one of the clinic's prescriptions by the :id URL
+// parameter, writing the error response itself when it cannot.
+func loadClinicPrescription(c *gin.Context) (models.Prescription, bool) {
+	p, err := loadPrescription(c.Param("id"))
+	if err == sql.ErrNoRows || (err == nil && p.ClinicID != c.GetString("userID")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Prescription not found"})
+		return p, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch prescription"})
+		return p, false
+	}
+	return p, true
+}
+
+// loadMyPrescription fetches one of the patient's issued or cancelled
+// prescriptions by the :id URL parameter, writing the error response itself
+// when it cannot.
+func loadMyPrescription(c *gin.Context) (models.Prescription, bool) {
+	p, err := loadPrescription(c.Param("id"))
+	if err == sql.ErrNoRows || (err == nil && (p.PatientID != c.GetString("userID") || p.Status == models.PrescriptionDraft)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Prescription not found"})
+		return p, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch prescription"})
+		return p, false
+	}
+	return p, true
+}
+
+// requireStatus writes a 409 and returns false unless the prescription has the given status.
+func requireStatus(c *gin.Context, p models.Prescription, status string) bool {
+	if p.Status != status {
+		c.JSON(http.StatusConflict, gin.H{"error": "Prescription is " + p.Status + ", not " + status})
+		return false
+	}
+	return true
+}
+
+// runSafetyChecks runs the prescription safety checks and stores the warnings on p.
+// Blocking warnings are returned to the doctor, who must resubmit with
+// override_warnings set; in that case, and on failure, it writes the response itself.
+func runSafetyChecks(c *gin.Context, p *models.Prescription) bool {
+	warnings, err := checkPrescriptionSafety(*p)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to run prescription safety checks"})
+		return false
+	}
+	if requiresOverride(warnings) && !p.OverrideWarnings {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":             "Prescription has safety warnings. Review them and resubmit with override_warnings set to save.",
+			"requires_override": true,
+			"warnings":          warnings,
+		})
+		return false
+	}
+	p.SafetyWarnings = warnings
+	return true
+}
+
+// respondSaveError writes the response for a failed prescription save.
+func respondSaveError(c *gin.Context, err error) {
+	if err == errPrescriptionChanged {
+		c.JSON(http.StatusConflict, gin.H{"error": "Prescription was changed meanwhile. Reload it and try again."})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save prescription"})
+}
+
+// noticeRefillApproved selects the notification for an approved refill, which is
+// issued as a new prescription.
+const noticeRefillApproved = "refill_approved"
+
+// prescriptionNotices are the patient notifications sent for each change type,
+// and for approved refills.
+var prescriptionNotices = map[string]struct{ Type, Title, Message string }{
+	models.ChangeIssued: {"prescription_issued", "New prescription",
+		"Your doctor has issued a new prescription."},
+	models.ChangeAmended: {"prescription_amended", "Prescription updated",
+		"Your doctor has changed one of your prescriptions. Please check the new instructions."},
+	models.ChangeDrugDiscontinued: {"prescription_drug_discontinued", "Medicine stopped",
+		"Your doctor has asked you to stop taking a medicine."},
+	models.ChangeCancelled: {"prescription_cancelled", "Prescription cancelled",
+		"Your doctor has cancelled one of your prescriptions. Do not continue it."},
+	noticeRefillApproved: {"refill_approved", "Refill approved",
+		"Your doctor approved your refill. The new prescription is ready."},
+}
+
+// notifyPrescriptionChange tells the patient's app that a prescription was issued or changed.
+func notifyPrescriptionChange(p models.Prescription, changeType, detail string) {
+	notice := prescriptionNotices[changeType]
+	message := notice.Message
+	if detail != "" {
+		message += " " + detail
+	}
+	notifyUser(models.Notification{
+		UserID:       p.PatientID,
+		Type:         notice.Type,
+		Title:        notice.Title,
+		Message:      message,
+		ResourceType: "prescription",
+		ResourceID:   p.ID,
+	})
+}
+
+// respondPrescriptionIssued triggers translation and narration for an issued or
+// amended prescription, notifies the patient and writes the response.
+func respondPrescriptionIssued(c *gin.Context, p models.Prescription, notice, detail, message string) {
+	notifyPrescriptionChange(p, notice, detail)
+	translateForPatient(p.PatientID, "prescription", p.ID, models.TranslationFieldInstructions, prescriptionSourceText(p))
+
+	if err := utils.TriggerTranslationAndAudio(p); err != nil {
+		// The new version is saved; only the patient-facing text is missing.
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":         "Prescription saved, but AI translation failed. Check AI Service logs.",
+			"prescription_id": p.ID,
+			"version":         p.Version,
+			"warnings":        p.SafetyWarnings,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         message,
+		"prescription_id": p.ID,
+		"version":         p.Version,
+		"warnings":        p.SafetyWarnings,
+	})
+}
+
+// bindReason reads the required {"reason": ...} body of a cancellation, discontinuation
+// or removal of another clinic's allergy or condition record.
+func bindReason(c *gin.Context) (string, bool) {
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required"})
+		return "", false
+	}
+	return strings.TrimSpace(req.Reason), true
+}
+
+// CreatePrescriptionDraft handles POST /v1/clinic/prescriptions/drafts
+// Saves an unfinished prescription that the doctor can edit and issue later.
+// Drafts are not safety checked, shown to the patient or counted as active, and
+// can only be started for a patient the clinic already cares for.
+func CreatePrescriptionDraft(c *gin.Context) {
+	var p models.Prescription
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prescription data format"})
+		return
+	}
+	if p.PatientID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "patient_id is required"})
+		return
+	}
+
+	if !requireClinicCare(c, p.PatientID) {
+		return
+	}
+
+	p.ClinicID = c.GetString("userID")
+	p.Status = models.PrescriptionDraft
+	p.SafetyWarnings = nil
+	p.OverrideWarnings = false
+	p.RefillOf = ""
+	if err := normalizeRefills(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := insertPrescription(&p); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save draft"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, p)
+}
+
+// ListPrescriptionDrafts handles GET /v1/clinic/prescriptions/drafts
+// Returns the clinic's unfinished prescriptions, most recently edited first.
+func ListPrescriptionDrafts(c *gin.Context) {
+	rows, err := utils.DB.Query(`
+		SELECT `+prescriptionColumns+`
+		FROM prescriptions
+		WHERE clinic_id = $1 AND status = 'draft'
+		ORDER BY COALESCE(updated_at, created_at) DESC
+	`, c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch drafts"})
+		return
+	}
+	defer rows.Close()
+
+	drafts := []models.Prescription{}
+	for rows.Next() {
+		p, err := scanPrescription(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch drafts"})
+			return
+		}
+		drafts = append(drafts, p)
+	}
+
+	c.JSON(http.StatusOK, drafts)
+}
+
+// UpdatePrescriptionDraft handles PUT /v1/clinic/prescriptions/drafts/:id
+// Replaces the draft's patient, diagnosis, vitals and instructions.
+func UpdatePrescriptionDraft(c *gin.Context) {
+	existing, ok := loadClinicPrescription(c)
+	if !ok || !requireStatus(c, existing, models.PrescriptionDraft) {
+		return
+	}
+
+	var p models.Prescription
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prescription data format"})
+		return
+	}
+	if p.PatientID == "" {
+		p.PatientID = existing.PatientID
+	}
+	if p.PatientID != existing.PatientID {
+		if !requireClinicCare(c, p.PatientID) {
+			return
+		}
+	}
+
+	p.ID = existing.ID
+	p.ClinicID = existing.ClinicID
+	p.Status = existing.Status
+	p.Version = existing.Version
+	p.CreatedAt = existing.CreatedAt
+	p.SafetyWarnings = nil
+	p.OverrideWarnings = false
+	p.RefillsUsed = 0
+	p.RefillOf = ""
+	if err := normalizeRefills(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := updateDraft(&p); err != nil {
+		respondSaveError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, p)
+}
+
+// DeletePrescriptionDraft handles DELETE /v1/clinic/prescriptions/drafts/:id
+// Only drafts can be deleted; issued prescriptions are cancelled instead.
+func DeletePrescriptionDraft(c *gin.Context) {
+	p, ok := loadClinicPrescription(c)
+	if !ok || !requireStatus(c, p, models.PrescriptionDraft) {
+		return
+	}
+
+	result, err := utils.DB.Exec(`DELETE FROM prescriptions WHERE id = $1 AND status = 'draft'`, p.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete draft"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		respondSaveError(c, errPrescriptionChanged)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Draft deleted"})
+}
+
+// IssuePrescriptionDraft handles POST /v1/clinic/prescriptions/drafts/:id/issue
+// Runs the safety checks on a draft and issues it as version 1. The optional body
+// {"override_warnings": true} accepts blocking warnings, as for new prescriptions.
+func IssuePrescriptionDraft(c *gin.Context) {
+	p, ok := loadClinicPrescription(c)
+	if !ok || !requireStatus(c, p, models.PrescriptionDraft) {
+		return
+	}
+
+	var req struct {
+		OverrideWarnings bool `json:"override_warnings"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if len(p.Instructions) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A prescription needs at least one instruction before it is issued"})
+		return
+	}
+
+	p.OverrideWarnings = req.OverrideWarnings
+	if !runSafetyChecks(c, &p) {
+		return
+	}
+	p.Status = models.PrescriptionIssued
+	if err := savePrescriptionVersion(&p, models.ChangeIssued, "", actorOf(c)); err != nil {
+		respondSaveError(c, err)
+		return
+	}
+
+	respondPrescriptionIssued(c, p, models.ChangeIssued, "",
+		"Prescription issued, saved, and AI processing triggered successfully.")
+}
+
+// GetClinicPrescription handles GET /v1/clinic/prescriptions/:id
+// Returns the current version of one of the clinic's prescriptions or drafts.
+func GetClinicPrescription(c *gin.Context) {
+	p, ok := loadClinicPrescription(c)
+	if !ok {
+		return
+	}
+	langs, ok := requestedLanguages(c, p.PatientID)
+	if !ok {
+		return
+	}
+	if err := localizePrescription(&p, langs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch translations"})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// AmendPrescription handles POST /v1/clinic/prescriptions/:id/amend
+// Changes an issued prescription by saving a new version with the doctor's reason;
+// earlier versions stay in the history unchanged. Omitted fields keep their values.
+func AmendPrescription(c *gin.Context) {
+	p, ok := loadClinicPrescription(c)
+	if !ok || !requireStatus(c, p, models.PrescriptionIssued) {
+		return
+	}
+
+	var amendment models.PrescriptionAmendment
+	if err := c.ShouldBindJSON(&amendment); err != nil || strings.TrimSpace(amendment.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid amendment; 'reason' is required"})
+		return
+	}
+	if amendment.Diagnosis == nil && amendment.Vitals == nil && amendment.Instructions == nil &&
+		amendment.RefillsAllowed == nil && amendment.RefillIntervalDays == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An amendment must change the diagnosis, vitals, instructions or refills"})
+		return
+	}
+
+	if amendment.Diagnosis != nil {
+		p.Diagnosis = *amendment.Diagnosis
+	}
+	if amendment.Vitals != nil {
+		p.Vitals = amendment.Vitals
+	}
+	if amendment.Instructions != nil {
+		if len(amendment.Instructions) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "At least one instruction is required; cancel the prescription instead"})
+			return
+		}
+		p.Instructions = amendment.Instructions
+	}
+	if amendment.RefillsAllowed != nil {
+		if *amendment.RefillsAllowed < p.RefillsUsed {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "refills_allowed cannot be less than the " + strconv.Itoa(p.RefillsUsed) + " refills already used"})
+			return
+		}
+		p.RefillsAllowed = *amendment.RefillsAllowed
+	}
+	if amendment.RefillIntervalDays != nil {
+		p.RefillIntervalDays = *amendment.RefillIntervalDays
+	}
+	if err := normalizeRefills(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	p.OverrideWarnings = amendment.OverrideWarnings
+	if !runSafetyChecks(c, &p) {
+		return
+	}
+	reason := strings.TrimSpace(amendment.Reason)
+	if err := savePrescriptionVersion(&p, models.ChangeAmended, reason, actorOf(c)); err != nil {
+		respondSaveError(c, err)
+		return
+	}
+
+	respondPrescriptionIssued(c, p, models.ChangeAmended, "Reason: "+reason,
+		"Prescription amended, saved, and AI processing triggered successfully.")
+}
+
+// CancelPrescription handles POST /v1/clinic/prescriptions/:id/cancel
+// Cancels an issued prescription with {"reason": ...}; its drugs stop counting as active.
+func CancelPrescription(c *gin.Context) {
+	p, ok := loadClinicPrescription(c)
+	if !ok || !requireStatus(c, p, models.PrescriptionIssued) {
+		return
+	}
+	reason, ok := bindReason(c)
+	if !ok {
+		return
+	}
+
+	p.Status = models.PrescriptionCancelled
+	p.CancelReason = reason
+	if err := savePrescriptionVersion(&p, models.ChangeCancelled, reason, actorOf(c)); err != nil {
+		respondSaveError(c, err)
+		return
+	}
+	notifyPrescriptionChange(p, models.ChangeCancelled, "Reason: "+reason)
+	denyPendingRefills(p, "The prescription was cancelled", c.GetString("userID"))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Prescription cancelled",
+		"prescription_id": p.ID,
+		"version":         p.Version,
+	})
+}
+
+// DiscontinuePrescriptionDrug handles POST /v1/clinic/prescriptions/:id/instructions/:index/discontinue
+// Stops a single drug of an issued prescription (by its position in instructions,
+// starting at 0) with {"reason": ...}, saving a new version.
+func DiscontinuePrescriptionDrug(c *gin.Context) {
+	p, ok := loadClinicPrescription(c)
+	if !ok || !requireStatus(c, p, models.PrescriptionIssued) {
+		return
+	}
+
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil || index < 0 || index >= len(p.Instructions) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Instruction not found"})
+		return
+	}
+	if p.Instructions[index].Discontinued {
+		c.JSON(http.StatusConflict, gin.H{"error": "This drug has already been discontinued"})
+		return
+	}
+	reason, ok := bindReason(c)
+	if !ok {
+		return
+	}
+
+	instr := &p.Instructions[index]
+	instr.Discontinued = true
+	instr.DiscontinuedAt = time.Now().Unix()
+	instr.DiscontinueReason = reason
+	if err := savePrescriptionVersion(&p, models.ChangeDrugDiscontinued, reason, actorOf(c)); err != nil {
+		respondSaveError(c, err)
+		return
+	}
+	notifyPrescriptionChange(p, models.ChangeDrugDiscontinued, "Stop: "+instr.DrugName+". Reason: "+reason)
+	translateForPatient(p.PatientID, "prescription", p.ID, models.TranslationFieldInstructions, prescriptionSourceText(p))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         instr.DrugName + " discontinued",
+		"prescription_id": p.ID,
+		"version":         p.Version,
+	})
+}
+
+// GetPrescriptionVersions handles GET /v1/clinic/prescriptions/:id/versions
+// Returns every version of one of the clinic's prescriptions, oldest first.
+func GetPrescriptionVersions(c *gin.Context) {
+	p, ok := loadClinicPrescription(c)
+	if !ok {
+		return
+	}
+	respondPrescriptionVersions(c, p)
+}
+
+// GetMyPrescriptionVersions handles GET /v1/patient/prescriptions/:id/versions
+// Returns the version history of one of the patient's prescriptions, so they can
+// see what their doctor changed and why.
+func GetMyPrescriptionVersions(c *gin.Context) {
+	if p, ok := loadMyPrescription(c); ok {
+		respondPrescriptionVersions(c, p)
+	}
+}
+
+// respondPrescriptionVersions writes a prescription's current state with its history.
+func respondPrescriptionVersions(c *gin.Context, p models.Prescription) {
+	versions, err := loadPrescriptionVersions(p.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch prescription versions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"prescription_id": p.ID,
+		"status":          p.Status,
+		"current_version": p.Version,
+		"versions":        versions,
+	})
+}
@@ -0,0 +1,488 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"Medibridge/go-api/models"
+	"Medibridge/go-api/utils"
+)
+
+// Page layout of printed prescriptions, in points.
+const (
+	pdfMargin       = 40.0
+	pdfContentWidth = utils.PageWidth - 2*pdfMargin
+	pdfFooterTop    = utils.PageHeight - 44 // Content stops above the footer
+)
+
+// prescriptionPrint is everything printed on a prescription.
+type prescriptionPrint struct {
+	Prescription models.Prescription
+	Branding     orgBranding
+	PatientName  string
+	// The clinic's signature of this version, carried in the QR code for verification
+	Signature []byte
+	PublicKey []byte
+}
+
+// pdfLayout places content down the pages of a document, starting new pages as needed.
+type pdfLayout struct {
+	doc    *utils.PDFDocument
+	y      float64
+	footer string
+}
+
+func (l *pdfLayout) newPage() {
+	l.doc.AddPage()
+	l.y = pdfMargin
+
+	l.doc.SetFillColor(0.45, 0.45, 0.45)
+	l.doc.Text(pdfMargin, utils.PageHeight-24, utils.FontRegular, 7.5,
+		l.footer+"  |  Page "+strconv.Itoa(l.doc.PageCount()))
+	l.doc.SetFillColor(0, 0, 0)
+}
+
+// ensure starts a new page unless height points still fit on this one, and
+// reports whether it did.
+func (l *pdfLayout) ensure(height float64) bool {
+	if l.y+height <= pdfFooterTop {
+		return false
+	}
+	l.newPage()
+	return true
+}
+
+// paragraph writes wrapped text at x across width, advancing by lineHeight per line.
+func (l *pdfLayout) paragraph(x, width float64, font utils.PDFFont, size, lineHeight float64, text string) {
+	for _, line := range l.doc.WrapText(font, size, text, width) {
+		l.ensure(lineHeight)
+		l.y += lineHeight
+		l.doc.Text(x, l.y, font, size, line)
+	}
+}
+
+// centeredParagraph is paragraph with each line centered across width.
+func (l *pdfLayout) centeredParagraph(x, width float64, font utils.PDFFont, size, lineHeight float64, text string) {
+	for _, line := range l.doc.WrapText(font, size, text, width) {
+		l.ensure(lineHeight)
+		l.y += lineHeight
+		l.doc.Text(x+(width-l.doc.TextWidth(font, size, line))/2, l.y, font, size, line)
+	}
+}
+
+// pdfCell is one table cell: runs of text, each wrapped on its own lines.
+type pdfCell []pdfRun
+
+type pdfRun struct {
+	font utils.PDFFont
+	text string
+}
+
+// cellLines wraps a cell into its lines, each with its font.
+func (l *pdfLayout) cellLines(cell pdfCell, size, width float64) []pdfRun {
+	lines := []pdfRun{}
+	for _, run := range cell {
+		if run.text == "" {
+			continue
+		}
+		for _, line := range l.doc.WrapText(run.font, size, run.text, width) {
+			lines = append(lines, pdfRun{font: run.font, text: line})
+		}
+	}
+	return lines
+}
+
+// renderPrescriptionPDF lays out a printable prescription: the clinic letterhead
+// with a QR code to verify it, patient details, the dosage table and the
+// doctor's signature.
+func renderPrescriptionPDF(pr prescriptionPrint) ([]byte, error) {
+	p := pr.Prescription
+	profile := pr.Branding.Profile
+
+	doc := utils.NewPDF()
+	doc.Title = "Prescription - " + profile.Name
+	l := &pdfLayout{doc: doc, footer: "Prescription " + p.ID}
+	l.newPage()
+
+	// Letterhead: logo and clinic details laid out by the clinic's template,
+	// with the verification QR code on the right
+	const qrSize = 96.0
+	qr, err := utils.EncodeQR([]byte(prescriptionVerifyURL(p.ID, p.Version, pr.Signature)))
+	if err != nil {
+		return nil, err
+	}
+	qrX := utils.PageWidth - pdfMargin - qrSize
+	doc.DrawQR(qr, qrX, l.y-6, qrSize)
+	doc.SetFillColor(0.35, 0.35, 0.35)
+	caption := "Scan to verify"
+	doc.Text(qrX+(qrSize-doc.TextWidth(utils.FontRegular, 7, caption))/2, l.y+qrSize, utils.FontRegular, 7, caption)
+	doc.SetFillColor(0, 0, 0)
+
+	var logo *utils.PDFImage
+	if len(pr.Branding.Logo) > 0 && profile.LetterheadTemplate != models.LetterheadMinimal {
+		if img, err := doc.AddImage(pr.Branding.Logo); err != nil {
+			log.Printf("Warning: Could not print logo of clinic %s: %v", profile.OrgID, err)
+		} else {
+			logo = &img
+		}
+	}
+
+	top := l.y
+	textX, textWidth := pdfMargin, qrX-12-pdfMargin
+	paragraph := l.paragraph
+	if profile.LetterheadTemplate == models.LetterheadCentered {
+		// Centered on the page, keeping clear of the QR code on both sides
+		textX, textWidth = pdfMargin+qrSize+12, pdfContentWidth-2*(qrSize+12)
+		paragraph = l.centeredParagraph
+		if logo != nil {
+			w, h := fitBox(*logo, 60, 50)
+			doc.DrawImage(*logo, (utils.PageWidth-w)/2, l.y, w, h)
+			l.y += h + 2
+		}
+	} else if logo != nil {
+		w, h := fitBox(*logo, 60, 60)
+		doc.DrawImage(*logo, pdfMargin, l.y, w, h)
+		textX += w + 10
+		textWidth -= w + 10
+	}
+
+	l.y += 2
+	paragraph(textX, textWidth, utils.FontBold, 16, 18, profile.Name)
+	if profile.LegalName != "" && profile.LegalName != profile.Name {
+		paragraph(textX, textWidth, utils.FontRegular, 8, 10, profile.LegalName)
+	}
+	paragraph(textX, textWidth, utils.FontRegular, 9, 11.5, profile.Address)
+	contact := []string{}
+	if profile.Phone != "" {
+		contact = append(contact, "Phone: "+profile.Phone)
+	}
+	if profile.Email != "" {
+		contact = append(contact, "Email: "+profile.Email)
+	}
+	paragraph(textX, textWidth, utils.FontRegular, 9, 11.5, strings.Join(contact, "  |  "))
+	details := []string{}
+	if profile.WorkingHours != "" {
+		details = append(details, "Hours: "+profile.WorkingHours)
+	}
+	if profile.LicenceNumber != "" {
+		details = append(details, "Licence No.: "+profile.LicenceNumber)
+	}
+	paragraph(textX, textWidth, utils.FontRegular, 8, 10.5, strings.Join(details, "  |  "))
+	if l.y < top+qrSize+6 {
+		l.y = top + qrSize + 6
+	}
+	doc.SetStrokeColor(0.2, 0.4, 0.6)
+	doc.Line(pdfMargin, l.y, utils.PageWidth-pdfMargin, l.y, 1.5)
+	doc.SetStrokeColor(0, 0, 0)
+	l.y += 4
+
+	// Prescriber, patient and date
+	issued := time.Unix(p.CreatedAt, 0).Format("02 Jan 2006")
+	doctor := doctorTitle(profile)
+	if doctor != "" {
+		l.paragraph(pdfMargin, pdfContentWidth-150, utils.FontBold, 11, 15, doctor)
+	}
+	dateText := "Date: " + issued
+	doc.Text(utils.PageWidth-pdfMargin-doc.TextWidth(utils.FontRegular, 10, dateText), l.y, utils.FontRegular, 10, dateText)
+	if profile.RegistrationNumber != "" {
+		l.paragraph(pdfMargin, pdfContentWidth, utils.FontRegular, 9, 12, "Reg. No.: "+profile.RegistrationNumber)
+	}
+	l.y += 6
+
+	patient := p.PatientID
+	if pr.PatientName != "" {
+		patient = pr.PatientName + " (" + p.PatientID + ")"
+	}
+	l.paragraph(pdfMargin, pdfContentWidth, utils.FontRegular, 10, 14, "Patient: "+patient)
+	reference := "Prescription ID: " + p.ID
+	if p.Version > 1 {
+		reference += "  |  Version " + strconv.Itoa(p.Version) + " (amended)"
+	}
+	if p.RefillOf != "" {
+		reference += "  |  Refill of " + p.RefillOf
+	}
+	l.paragraph(pdfMargin, pdfContentWidth, utils.FontRegular, 8.5, 12, reference)
+
+	if p.Status == models.PrescriptionCancelled {
+		l.y += 4
+		doc.SetFillColor(0.75, 0.1, 0.1)
+		l.paragraph(pdfMargin, pdfContentWidth, utils.FontBold, 14, 18, "CANCELLED - do not dispense")
+		if p.CancelReason != "" {
+			l.paragraph(pdfMargin, pdfContentWidth, utils.FontRegular, 9.5, 13, "Reason: "+p.CancelReason)
+		}
+		doc.SetFillColor(0, 0, 0)
+	}
+
+	if strings.TrimSpace(p.Diagnosis) != "" {
+		l.y += 6
+		l.paragraph(pdfMargin, pdfContentWidth, utils.FontBold, 10, 14, "Diagnosis")
+		l.paragraph(pdfMargin, pdfContentWidth, utils.FontRegular, 10, 13, p.Diagnosis)
+	}
+	if vitals := formatVitals(p.Vitals); vitals != "" {
+		l.y += 4
+		l.paragraph(pdfMargin, pdfContentWidth, utils.FontRegular, 9.5, 13, "Vitals: "+vitals)
+	}
+
+	// Dosage table
+	l.y += 10
+	l.ensure(60)
+	l.y += 18
+	doc.Text(pdfMargin, l.y, utils.FontBold, 18, "Rx")
+	l.y += 6
+	drawDosageTable(l, p.Instructions)
+
+	if p.RefillsAllowed > 0 && p.RefillOf == "" {
+		l.y += 8
+		remaining := p.RefillsAllowed - p.RefillsUsed
+		l.paragraph(pdfMargin, pdfContentWidth, utils.FontRegular, 9.5, 13, "Refills: "+strconv.Itoa(remaining)+
+			" of "+strconv.Itoa(p.RefillsAllowed)+" remaining, at most every "+strconv.Itoa(p.RefillIntervalDays)+" days")
+	}
+
+	// Signature block, kept together at the right
+	l.y += 20
+	l.ensure(105)
+	const signatureWidth = 170.0
+	signatureX := utils.PageWidth - pdfMargin - signatureWidth
+	if len(pr.Branding.Signature) > 0 {
+		if signature, err := doc.AddImage(pr.Branding.Signature); err != nil {
+			log.Printf("Warning: Could not print signature of clinic %s: %v", profile.OrgID, err)
+		} else {
+			w, h := fitBox(signature, signatureWidth-20, 50)
+			doc.DrawImage(signature, signatureX+(signatureWidth-w)/2, l.y+50-h, w, h)
+		}
+	}
+	l.y += 56
+	doc.Line(signatureX, l.y, signatureX+signatureWidth, l.y, 0.75)
+	for _, line := range []string{doctor, "Reg. No.: " + profile.RegistrationNumber} {
+		if line == "" || line == "Reg. No.: " {
+			continue
+		}
+		l.y += 12
+		doc.Text(signatureX+(signatureWidth-doc.TextWidth(utils.FontRegular, 9, line))/2, l.y, utils.FontRegular, 9, line)
+	}
+	if len(pr.Signature) > 0 {
+		l.y += 11
+		line := "Digitally signed, key " + utils.KeyFingerprint(pr.PublicKey)
+		doc.SetFillColor(0.35, 0.35, 0.35)
+		doc.Text(signatureX+(signatureWidth-doc.TextWidth(utils.FontRegular, 7, line))/2, l.y, utils.FontRegular, 7, line)
+		doc.SetFillColor(0, 0, 0)
+	}
+
+	return doc.Bytes()
+}
+
+// drawDosageTable draws the instructions as a table, repeating the header row on
+// each page. Discontinued drugs are greyed out and marked as stopped.
+func drawDosageTable(l *pdfLayout, instructions []models.DosageInstruction) {
+	const size, lineHeight, padding = 9.0, 11.0, 4.0
+	headers := []string{"#", "Medicine", "Dose", "When", "Duration", "Notes"}
+	widths := []float64{20, 150, 75, 120, 58, pdfContentWidth - 423}
+
+	drawHeader := func() {
+		l.doc.SetFillColor(0.9, 0.93, 0.96)
+		l.doc.Rect(pdfMargin, l.y, pdfContentWidth, lineHeight+2*padding, true)
+		l.doc.SetFillColor(0, 0, 0)
+		x := pdfMargin
+		for i, header := range headers {
+			l.doc.Text(x+padding, l.y+padding+8, utils.FontBold, 8.5, header)
+			x += widths[i]
+		}
+		l.y += lineHeight + 2*padding
+	}
+	drawHeader()
+
+	for i, instr := range instructions {
+		cells := dosageCells(i, instr)
+		lines := make([][]pdfRun, len(cells))
+		rows := 1
+		for j, cell := range cells {
+			lines[j] = l.cellLines(cell, size, widths[j]-2*padding)
+			if len(lines[j]) > rows {
+				rows = len(lines[j])
+			}
+		}
+		height := float64(rows)*lineHeight + 2*padding
+
+		if l.ensure(height) {
+			drawHeader()
+		}
+		if instr.Discontinued {
+			l.doc.SetFillColor(0.5, 0.5, 0.5)
+		}
+		x := pdfMargin
+		for j, cellLines := range lines {
+			for k, line := range cellLines {
+				l.doc.Text(x+padding, l.y+padding+8+float64(k)*lineHeight, line.font, size, line.text)
+			}
+			x += widths[j]
+		}
+		l.doc.SetFillColor(0, 0, 0)
+		l.y += height
+		l.doc.SetStrokeColor(0.8, 0.8, 0.8)
+		l.doc.Line(pdfMargin, l.y, pdfMargin+pdfContentWidth, l.y, 0.5)
+		l.doc.SetStrokeColor(0, 0, 0)
+	}
+}
+
+// dosageCells returns the table cells of one instruction.
+func dosageCells(index int, instr models.DosageInstruction) []pdfCell {
+	medicine := pdfCell{{utils.FontBold, instr.DrugName}}
+	if details := strings.TrimSpace(instr.Strength + " " + instr.DrugType); details != "" {
+		medicine = append(medicine, pdfRun{utils.FontRegular, details})
+	}
+
+	when := pdfCell{{utils.FontRegular, instr.Frequency}}
+	if instr.TimingRelation != "" {
+		timing := instr.TimingRelation
+		if instr.TimeOffset > 0 {
+			timing += " (" + strconv.Itoa(instr.TimeOffset) + " min)"
+		}
+		when = append(when, pdfRun{utils.FontRegular, timing})
+	}
+
+	notes := pdfCell{{utils.FontRegular, instr.PatientNote}}
+	if instr.Discontinued {
+		stopped := "STOPPED"
+		if instr.DiscontinueReason != "" {
+			stopped += ": " + instr.DiscontinueReason
+		}
+		notes = append(pdfCell{{utils.FontBold, stopped}}, notes...)
+	}
+
+	return []pdfCell{
+		{{utils.FontRegular, strconv.Itoa(index + 1)}},
+		medicine,
+		{{utils.FontRegular, instr.DosageQuantity}},
+		when,
+		{{utils.FontRegular, durationText(instr.DurationDays)}},
+		notes,
+	}
+}
+
+// durationText is how long a drug is taken, e.g., "5 days" or "Ongoing".
+func durationText(days int) string {
+	switch {
+	case days == 1:
+		return "1 day"
+	case days > 1:
+		return strconv.Itoa(days) + " days"
+	}
+	return "Ongoing"
+}
+
+// doctorTitle is the prescriber line, e.g., "Dr. Priya Varma, MBBS, MD".
+func doctorTitle(profile models.OrganizationProfile) string {
+	name := strings.TrimSpace(profile.SignatoryName)
+	if name == "" {
+		return ""
+	}
+	if !strings.HasPrefix(strings.ToLower(name), "dr") {
+		name = "Dr. " + name
+	}
+	if profile.Qualifications != "" {
+		name += ", " + profile.Qualifications
+	}
+	return name
+}
+
+// formatVitals lists vitals in a stable order, e.g., "BP 120/80  |  Pulse 72".
+func formatVitals(vitals map[string]string) string {
+	keys := make([]string, 0, len(vitals))
+	for key, value := range vitals {
+		if strings.TrimSpace(value) != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key + " " + vitals[key]
+	}
+	return strings.Join(parts, "  |  ")
+}
+
+// fitBox scales an image to fit within maxW x maxH points, keeping its aspect ratio.
+func fitBox(img utils.PDFImage, maxW, maxH float64) (float64, float64) {
+	w, h := float64(img.Width), float64(img.Height)
+	if w == 0 || h == 0 {
+		return maxW, maxH
+	}
+	scale := maxW / w
+	if h*scale > maxH {
+		scale = maxH / h
+	}
+	return w * scale, h * scale
+}
+
+// GetPrescriptionPDF handles GET /v1/clinic/prescriptions/:id/pdf
+// Renders the printable prescription on the clinic letterhead, in English.
+// Translated instructions are not printed: the Indian scripts patients read need
+// text shaping the PDF writer does not do, so patients read them in the app.
+func GetPrescriptionPDF(c *gin.Context) {
+	p, ok := loadClinicPrescription(c)
+	if !ok {
+		return
+	}
+	if p.Status == models.PrescriptionDraft {
+		c.JSON(http.StatusConflict, gin.H{"error": "Issue the prescription before printing it"})
+		return
+	}
+	respondPrescriptionPDF(c, p)
+}
+
+// GetMyPrescriptionPDF handles GET /v1/patient/prescriptions/:id/pdf
+// Lets patients download or reprint their own prescriptions.
+func GetMyPrescriptionPDF(c *gin.Context) {
+	if p, ok := loadMyPrescription(c); ok {
+		respondPrescriptionPDF(c, p)
+	}
+}
+
+// respondPrescriptionPDF renders a prescription and sends it inline as a PDF.
+func respondPrescriptionPDF(c *gin.Context, p models.Prescription) {
+	branding, err := loadPrescriberBranding(p, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch clinic profile"})
+		return
+	}
+
+	sv, err := loadSignedVersion(p, p.Version)
+	if err != nil && err != sql.ErrNoRows { // Prescriptions from before version history print unsigned
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch prescription signature"})
+		return
+	}
+
+	var patientName string
+	err = utils.DB.QueryRow(`SELECT name FROM users WHERE unique_user_id = $1`, p.PatientID).Scan(&patientName)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch patient"})
+		return
+	}
+
+	data, err := renderPrescriptionPDF(prescriptionPrint{
+		Prescription: p,
+		Branding:     branding,
+		PatientName:  patientName,
+		Signature:    sv.Signature,
+		PublicKey:    sv.PublicKey,
+	})
+	if err != nil {
+		log.Printf("Failed to render prescription %s: %v", p.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render prescription"})
+		return
+	}
+
+	name := p.ID
+	if len(name) > 8 {
+		name = name[:8]
+	}
+	c.Header("Content-Disposition", `inline; filename="prescription-`+name+`.pdf"`)
+	c.Data(http.StatusOK, "application/pdf", data)
+}
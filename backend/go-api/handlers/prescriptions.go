@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"Medibridge/go-api/models"
+	"Medibridge/go-api/utils"
+)
+
+// errPrescriptionChanged is returned when a prescription was changed by someone
+// else between loading it and saving a new version.
+var errPrescriptionChanged = errors.New("prescription was changed concurrently")
+
+// prescriptionColumns is the column list read by scanPrescription.
+const prescriptionColumns = `id, patient_id, clinic_id, COALESCE(diagnosis, ''), COALESCE(vitals, '{}'), instructions,
+	COALESCE(translated_text, ''), COALESCE(audio_file_url, ''), COALESCE(original_doctor_text, ''),
+	COALESCE(safety_warnings, '[]'), override_warnings, status, version, COALESCE(cancel_reason, ''),
+	refills_allowed, refill_interval_days, refills_used, COALESCE(refill_of::text, ''),
+	COALESCE(prescribed_by, 0), COALESCE((SELECT m.name FROM organization_members m WHERE m.id = prescribed_by), ''),
+	created_at, COALESCE(updated_at, created_at)`
+
+// activeInstruction is a dosage instruction from a stored prescription that the
+// patient is still taking.
+type activeInstruction struct {
+	PrescriptionID string
+	SeriesID       string // The original prescription, for refills
+	Instruction    models.DosageInstruction
+}
+
+// encodedPrescription holds the stored form of a prescription's content.
+type encodedPrescription struct {
+	diagnosis    string // Encrypted
+	vitals       []byte
+	instructions []byte
+	warnings     []byte
+}
+
+// encodePrescription encrypts the free-text diagnosis and marshals the JSON columns.
+func encodePrescription(p *models.Prescription) (encodedPrescription, error) {
+	var enc encodedPrescription
+	var err error
+	if enc.diagnosis, err = utils.Encrypt(p.Diagnosis); err != nil {
+		return enc, err
+	}
+	if enc.vitals, err = json.Marshal(p.Vitals); err != nil {
+		return enc, err
+	}
+	if enc.instructions, err = json.Marshal(p.Instructions); err != nil {
+		return enc, err
+	}
+	if enc.warnings, err = json.Marshal(p.SafetyWarnings); err != nil {
+		return enc, err
+	}
+	return enc, nil
+}
+
+// scanPrescription reads one row selected with prescriptionColumns, decrypting the diagnosis.
+func scanPrescription(row rowScanner) (models.Prescription, error) {
+	var p models.Prescription
+	var diagnosis string
+	var vitals, instructions, warnings []byte
+	var createdAt, updatedAt time.Time
+
+	err := row.Scan(&p.ID, &p.PatientID, &p.ClinicID, &diagnosis, &vitals, &instructions,
+		&p.TranslatedText, &p.AudioFileURL, &p.OriginalDoctorText,
+		&warnings, &p.OverrideWarnings, &p.Status, &p.Version, &p.CancelReason,
+		&p.RefillsAllowed, &p.RefillIntervalDays, &p.RefillsUsed, &p.RefillOf,
+		&p.PrescribedBy, &p.PrescriberName, &createdAt, &updatedAt)
+	if err != nil {
+		return p, err
+	}
+
+	if diagnosis != "" {
+		if p.Diagnosis, err = utils.Decrypt(diagnosis); err != nil {
+			return p, err
+		}
+	}
+	if err := json.Unmarshal(vitals, &p.Vitals); err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(instructions, &p.Instructions); err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(warnings, &p.SafetyWarnings); err != nil {
+		return p, err
+	}
+	p.CreatedAt = createdAt.Unix()
+	p.UpdatedAt = updatedAt.Unix()
+	return p, nil
+}
+
+// loadPrescription fetches a prescription by ID; it returns sql.ErrNoRows if there is none.
+func loadPrescription(id string) (models.Prescription, error) {
+	return scanPrescription(utils.DB.QueryRow(
+		`SELECT `+prescriptionColumns+` FROM prescriptions WHERE id::text = $1`, id,
+	))
+}
+
+// insertPrescription saves a new prescription (a draft, or issued as version 1)
+// and fills in its generated ID and creation time. The free-text diagnosis is
+// encrypted before it is stored.
+func insertPrescription(p *models.Prescription) error {
+	tx, err := utils.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertPrescriptionTx(tx, p); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertPrescriptionTx is insertPrescription within the caller's transaction.
+func insertPrescriptionTx(tx *sql.Tx, p *models.Prescription) error {
+	if p.Status == "" {
+		p.Status = models.PrescriptionIssued
+	}
+	p.Version = 0
+	if p.Status == models.PrescriptionIssued {
+		p.Version = 1
+	}
+
+	p.RefillsUsed = 0
+
+	enc, err := encodePrescription(p)
+	if err != nil {
+		return err
+	}
+
+	var createdAt time.Time
+	err = tx.QueryRow(`
+		INSERT INTO prescriptions (patient_id, clinic_id, diagnosis, vitals, instructions,
+			original_doctor_text, safety_warnings, override_warnings, status, version,
+			refills_allowed, refill_interval_days, refill_of, prescribed_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NULLIF($13, '')::uuid, NULLIF($14, 0))
+		RETURNING id, created_at
+	`, p.PatientID, p.ClinicID, enc.diagnosis, enc.vitals, enc.instructions,
+		p.OriginalDoctorText, enc.warnings, p.OverrideWarnings, p.Status, p.Version,
+		p.RefillsAllowed, p.RefillIntervalDays, p.RefillOf, p.PrescribedBy).Scan(&p.ID, &createdAt)
+	if err != nil {
+		return err
+	}
+	p.CreatedAt = createdAt.Unix()
+	p.UpdatedAt = p.CreatedAt
+
+	if p.Status == models.PrescriptionIssued {
+		return insertPrescriptionVersion(tx, p, enc, models.ChangeIssued, "", actor{UserID: p.ClinicID, MemberID: p.PrescribedBy})
+	}
+	return nil
+}
+
+// updateDraft saves the edited content of a draft prescription in place.
+func updateDraft(p *models.Prescription) error {
+	enc, err := encodePrescription(p)
+	if err != nil {
+		return err
+	}
+
+	var updatedAt time.Time
+	err = utils.DB.QueryRow(`
+		UPDATE prescriptions
+		SET patient_id = $1, diagnosis = $2, vitals = $3, instructions = $4,
+			original_doctor_text = $5, refills_allowed = $6, refill_interval_days = $7,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $8 AND status = 'draft'
+		RETURNING updated_at
+	`, p.PatientID, enc.diagnosis, enc.vitals, enc.instructions, p.OriginalDoctorText,
+		p.RefillsAllowed, p.RefillIntervalDays, p.ID).Scan(&updatedAt)
+	if err == sql.ErrNoRows {
+		return errPrescriptionChanged // Issued or deleted meanwhile
+	}
+	if err != nil {
+		return err
+	}
+	p.UpdatedAt = updatedAt.Unix()
+	return nil
+}
+
+// savePrescriptionVersion stores p as the next version of an existing prescription
+// (issuing a draft, an amendment, a discontinued drug or a cancellation), and records
+// the version in the history. It fails with errPrescriptionChanged if the stored
+// prescription is no longer at p.Version. Issuing a draft attributes it to the
+// member issuing it.
+func savePrescriptionVersion(p *models.Prescription, changeType, reason string, by actor) error {
+	enc, err := encodePrescription(p)
+	if err != nil {
+		return err
+	}
+
+	tx, err := utils.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var createdAt, updatedAt time.Time
+	err = tx.QueryRow(`
+		UPDATE prescriptions
+		SET diagnosis = $1, vitals = $2, instructions = $3, safety_warnings = $4, override_warnings = $5,
+			status = $6, cancel_reason = NULLIF($7, ''), refills_allowed = $8, refill_interval_days = $9,
+			version = version + 1, updated_at = CURRENT_TIMESTAMP,
+			-- Courses run from the issue date, not from when the draft was started
+			created_at = CASE WHEN status = 'draft' THEN CURRENT_TIMESTAMP ELSE created_at END,
+			prescribed_by = CASE WHEN status = 'draft' THEN NULLIF($12, 0) ELSE prescribed_by END
+		WHERE id = $10 AND version = $11
+		RETURNING created_at, updated_at, COALESCE(prescribed_by, 0)
+	`, enc.diagnosis, enc.vitals, enc.instructions, enc.warnings, p.OverrideWarnings,
+		p.Status, p.CancelReason, p.RefillsAllowed, p.RefillIntervalDays, p.ID, p.Version,
+		by.MemberID).Scan(&createdAt, &updatedAt, &p.PrescribedBy)
+	if err == sql.ErrNoRows {
+		return errPrescriptionChanged
+	}
+	if err != nil {
+		return err
+	}
+	p.Version++
+	p.CreatedAt = createdAt.Unix()
+	p.UpdatedAt = updatedAt.Unix()
+
+	if err := insertPrescriptionVersion(tx, p, enc, changeType, reason, by); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertPrescriptionVersion records p, at its current version, in the version
+// history, signed with the clinic's key.
+func insertPrescriptionVersion(tx *sql.Tx, p *models.Prescription, enc encodedPrescription, changeType, reason string, by actor) error {
+	sig, keyID, err := signPrescription(tx, p)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO prescription_versions (prescription_id, version, change_type, reason, changed_by,
+			changed_by_member, status, diagnosis, vitals, instructions, safety_warnings, refills_allowed,
+			refill_interval_days, signature, signing_key_id)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, NULLIF($6, 0), $7, $8, $9, $10, $11, $12, $13, $14, $15)
+	`, p.ID, p.Version, changeType, reason, by.UserID, by.MemberID, p.Status,
+		enc.diagnosis, enc.vitals, enc.instructions, enc.warnings, p.RefillsAllowed, p.RefillIntervalDays,
+		sig, keyID)
+	return err
+}
+
+// loadPrescriptionVersions returns the version history of a prescription, oldest first.
+func loadPrescriptionVersions(prescriptionID string) ([]models.PrescriptionVersion, error) {
+	rows, err := utils.DB.Query(`
+		SELECT v.prescription_id, v.version, v.change_type, COALESCE(v.reason, ''), COALESCE(v.changed_by, ''),
+			COALESCE(v.changed_by_member, 0), COALESCE(m.name, ''), v.status,
+			COALESCE(v.diagnosis, ''), COALESCE(v.vitals, '{}'), v.instructions, COALESCE(v.safety_warnings, '[]'),
+			v.refills_allowed, v.refill_interval_days, v.created_at
+		FROM prescription_versions v
+		LEFT JOIN organization_members m ON m.id = v.changed_by_member
+		WHERE v.prescription_id::text = $1
+		ORDER BY v.version
+	`, prescriptionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []models.PrescriptionVersion{}
+	for rows.Next() {
+		var v models.PrescriptionVersion
+		var diagnosis string
+		var vitals, instructions, warnings []byte
+		var createdAt time.Time
+		if err := rows.Scan(&v.PrescriptionID, &v.Version, &v.ChangeType, &v.Reason, &v.ChangedBy,
+			&v.ChangedByMember, &v.ChangedByName, &v.Status,
+			&diagnosis, &vitals, &instructions, &warnings, &v.RefillsAllowed, &v.RefillIntervalDays, &createdAt); err != nil {
+			return nil, err
+		}
+		if diagnosis != "" {
+			if v.Diagnosis, err = utils.Decrypt(diagnosis); err != nil {
+				return nil, err
+			}
+		}
+		if err := json.Unmarshal(vitals, &v.Vitals); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(instructions, &v.Instructions); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(warnings, &v.SafetyWarnings); err != nil {
+			return nil, err
+		}
+		v.CreatedAt = createdAt.Unix()
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// loadActiveInstructions returns every dosage instruction from the patient's
+// issued prescriptions whose course has not yet finished and that the doctor
+// has not discontinued. Drafts and cancelled prescriptions are ignored.
+func loadActiveInstructions(patientID string) ([]activeInstruction, error) {
+	rows, err := utils.DB.Query(`
+		SELECT id, COALESCE(refill_of, id), instructions, created_at
+		FROM prescriptions
+		WHERE patient_id = $1 AND status = 'issued'
+	`, patientID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	active := []activeInstruction{}
+	for rows.Next() {
+		var id, seriesID string
+		var raw []byte
+		var createdAt time.Time
+		if err := rows.Scan(&id, &seriesID, &raw, &createdAt); err != nil {
+			return nil, err
+		}
+
+		var instructions []models.DosageInstruction
+		if err := json.Unmarshal(raw, &instructions); err != nil {
+			continue
+		}
+		for _, instr := range instructions {
+			if !instr.Discontinued && isInstructionActive(instr, createdAt, now) {
+				active = append(active, activeInstruction{PrescriptionID: id, SeriesID: seriesID, Instruction: instr})
+			}
+		}
+	}
+
+	return active, rows.Err()
+}
+
+// isInstructionActive reports whether a course started at issuedAt is still running.
+// Instructions without a duration are treated as ongoing (e.g., chronic medication).
+func isInstructionActive(instr models.DosageInstruction, issuedAt, now time.Time) bool {
+	if instr.DurationDays <= 0 {
+		return true
+	}
+	return now.Before(issuedAt.AddDate(0, 0, instr.DurationDays))
+}
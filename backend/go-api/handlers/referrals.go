@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"Medibridge/go-api/models"
+	"Medibridge/go-api/utils"
+)
+
+// maxReferralTests caps the tests ordered in one referral.
+const maxReferralTests = 20
+
+// referralPriorities are the accepted values of priority, most urgent first.
+var referralPriorities = []string{models.ReferralStat, models.ReferralUrgent, models.ReferralRoutine}
+
+// referralColumns is the column list read by scanReferral, selected from referralTables.
+const referralColumns = `r.id, r.patient_id, pu.name, r.clinic_id, COALESCE(cp.name, cu.name),
+	r.scanning_center_id, COALESCE(sp.name, su.name), COALESCE(r.referred_by_member, 0), COALESCE(m.name, ''),
+	COALESCE(r.prescription_id::text, ''), r.tests, r.priority, COALESCE(r.clinical_notes, ''), r.status,
+	COALESCE(r.status_reason, ''), r.created_at, r.updated_at,
+	ARRAY(SELECT rp.id::text FROM reports rp WHERE rp.referral_id = r.id ORDER BY rp.created_at)`
+
+// referralTables joins a referral to the names shown with it.
+const referralTables = ` FROM referrals r
+	JOIN users pu ON pu.unique_user_id = r.patient_id
+	JOIN users cu ON cu.unique_user_id = r.clinic_id
+	LEFT JOIN organization_profiles cp ON cp.org_id = r.clinic_id
+	JOIN users su ON su.unique_user_id = r.scanning_center_id
+	LEFT JOIN organization_profiles sp ON sp.org_id = r.scanning_center_id
+	LEFT JOIN organization_members m ON m.id = r.referred_by_member`
+
+// referralQueueOrder lists the most urgent referrals first, oldest first within a priority.
+const referralQueueOrder = ` ORDER BY CASE r.priority WHEN 'stat' THEN 0 WHEN 'urgent' THEN 1 ELSE 2 END, r.created_at`
+
+// scanReferral reads one row selected with referralColumns, decrypting the clinical notes.
+func scanReferral(row rowScanner) (models.Referral, error) {
+	var r models.Referral
+	var notes string
+	var createdAt, updatedAt time.Time
+	err := row.Scan(&r.ID, &r.PatientID, &r.PatientName, &r.ClinicID, &r.ClinicName,
+		&r.ScanningCenterID, &r.ScanningCenterName, &r.ReferredBy, &r.ReferredByName,
+		&r.PrescriptionID, pq.Array(&r.Tests), &r.Priority, &notes, &r.Status,
+		&r.StatusReason, &createdAt, &updatedAt, pq.Array(&r.ReportIDs))
+	if err != nil {
+		return r, err
+	}
+	if notes != "" {
+		if r.ClinicalNotes, err = utils.Decrypt(notes); err != nil {
+			return r, err
+		}
+	}
+	if r.ReportIDs == nil {
+		r.ReportIDs = []string{}
+	}
+	r.CreatedAt = createdAt.Unix()
+	r.UpdatedAt = updatedAt.Unix()
+	return r, nil
+}
+
+// loadReferral fetches a referral; it returns sql.ErrNoRows if there is none.
+func loadReferral(id string) (models.Referral, error) {
+	return scanReferral(utils.DB.QueryRow(`SELECT `+referralColumns+referralTables+` WHERE r.id::text = $1`, id))
+}
+
+// loadOwnReferral fetches the referral named by the :id parameter if the caller
+// is its clinic or scanning center (ownerColumn is clinic_id or scanning_center_id),
+// responding with 404 (or 500) itself when it cannot.
+func loadOwnReferral(c *gin.Context, ownerColumn string) (models.Referral, bool) {
+	r, err := loadReferral(c.Param("id"))
+	owner := r.ClinicID
+	if ownerColumn == "scanning_center_id" {
+		owner = r.ScanningCenterID
+	}
+	if err == sql.ErrNoRows || (err == nil && owner != c.GetString("userID")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Referral not found"})
+		return r, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch referral"})
+		return r, false
+	}
+	return r, true
+}
+
+// respondReferrals answers with the referrals matching where (on referrals r), in order.
+func respondReferrals(c *gin.Context, order, where string, args ...interface{}) []models.Referral {
+	rows, err := utils.DB.Query(`SELECT `+referralColumns+referralTables+` WHERE `+where+order, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch referrals"})
+		return nil
+	}
+	defer rows.Close()
+
+	referrals := []models.Referral{}
+	for rows.Next() {
+		r, err := scanReferral(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch referrals"})
+			return nil
+		}
+		referrals = append(referrals, r)
+	}
+	return referrals
+}
+
+// setReferralStatus moves the referral named by :id from one of the given
+// statuses to status, responding with the updated referral.
+func setReferralStatus(c *gin.Context, ownerColumn, status string, from []string, reason string) {
+	// ownerColumn is one of two fixed names, never client input.
+	res, err := utils.DB.Exec(`
+		UPDATE referrals SET status = $1, status_reason = NULLIF($2, ''), updated_at = CURRENT_TIMESTAMP
+		WHERE id::text = $3 AND `+ownerColumn+` = $4 AND status = ANY($5)
+	`, status, reason, c.Param("id"), c.GetString("userID"), pq.Array(from))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update referral"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		r, ok := loadOwnReferral(c, ownerColumn)
+		if ok {
+			c.JSON(http.StatusConflict, gin.H{"error": "Referral is " + r.Status})
+		}
+		return
+	}
+	if r, ok := loadOwnReferral(c, ownerColumn); ok {
+		c.JSON(http.StatusOK, r)
+	}
+}
+
+// bindReferralStatus reads the optional reason sent to decline or cancel a referral.
+func bindReferralStatus(c *gin.Context) (models.ReferralStatusRequest, bool) {
+	var req models.ReferralStatusRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+			return req, false
+		}
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	return req, true
+}
+
+// ListScanningCenters handles GET /v1/clinic/scanning-centers
+// Returns the active scanning centers a clinic can refer patients to, by name.
+func ListScanningCenters(c *gin.Context) {
+	rows, err := utils.DB.Query(`
+		SELECT u.unique_user_id, COALESCE(p.name, u.name), COALESCE(p.address, ''), COALESCE(p.phone, ''),
+			COALESCE(p.working_hours, '')
+		FROM users u
+		LEFT JOIN organization_profiles p ON p.org_id = u.unique_user_id
+		WHERE u.role = 'Scanning' AND u.disabled_at IS NULL
+		ORDER BY 2
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch scanning centers"})
+		return
+	}
+	defer rows.Close()
+
+	centers := []models.OrganizationProfile{}
+	for rows.Next() {
+		p := models.OrganizationProfile{OrgType: "Scanning"}
+		if err := rows.Scan(&p.OrgID, &p.Name, &p.Address, &p.Phone, &p.WorkingHours); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch scanning centers"})
+			return
+		}
+		centers = append(centers, p)
+	}
+	c.JSON(http.StatusOK, centers)
+}
+
+// CreateReferral handles POST /v1/clinic/referrals
+// Refers a patient to a scanning center for the listed tests. The center sees
+// it in its incoming queue, and reports it uploads for it come back to this clinic.
+func CreateReferral(c *gin.Context) {
+	var r models.Referral
+	if err := c.ShouldBindJSON(&r); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid referral; 'patient_id', 'scanning_center_id' and 'tests' are required"})
+		return
+	}
+	var tests []string
+	for _, t := range r.Tests {
+		if t = strings.TrimSpace(t); t != "" {
+			tests = append(tests, t)
+		}
+	}
+	if len(tests) == 0 || len(tests) > maxReferralTests {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'tests'; expected 1 to 20 test names"})
+		return
+	}
+	r.Tests = tests
+	if r.Priority == "" {
+		r.Priority = models.ReferralRoutine
+	}
+	if !containsString(referralPriorities, r.Priority) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'priority'; expected one of: " + strings.Join(referralPriorities, ", ")})
+		return
+	}
+
+	exists, err := patientExists(r.PatientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Patient not found"})
+		return
+	}
+	var centerActive bool
+	err = utils.DB.QueryRow(`
+		SELECT disabled_at IS NULL FROM users WHERE unique_user_id = $1 AND role = 'Scanning'
+	`, r.ScanningCenterID).Scan(&centerActive)
+	if err == sql.ErrNoRows || (err == nil && !centerActive) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scanning center not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	clinicID := c.GetString("userID")
+	if r.PrescriptionID != "" {
+		p, err := loadPrescription(r.PrescriptionID)
+		if err == sql.ErrNoRows || (err == nil && (p.ClinicID != clinicID || p.PatientID != r.PatientID)) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Prescription not found for this patient"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch prescription"})
+			return
+		}
+	}
+	notes := ""
+	if r.ClinicalNotes != "" {
+		if notes, err = utils.Encrypt(r.ClinicalNotes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt clinical notes"})
+			return
+		}
+	}
+
+	var id string
+	err = utils.DB.QueryRow(`
+		INSERT INTO referrals (patient_id, clinic_id, scanning_center_id, referred_by_member, prescription_id,
+			tests, priority, clinical_notes)
+		VALUES ($1, $2, $3, NULLIF($4, 0), NULLIF($5, '')::uuid, $6, $7, NULLIF($8, ''))
+		RETURNING id
+	`, r.PatientID, clinicID, r.ScanningCenterID, c.GetInt64("memberID"), r.PrescriptionID,
+		pq.Array(r.Tests), r.Priority, notes).Scan(&id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create referral"})
+		return
+	}
+	if r, err = loadReferral(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch referral"})
+		return
+	}
+
+	notifyUser(models.Notification{
+		UserID:       r.PatientID,
+		Type:         "referral_created",
+		Title:        "Tests ordered at " + r.ScanningCenterName,
+		Message:      r.ClinicName + " referred you to " + r.ScanningCenterName + " for: " + strings.Join(r.Tests, ", "),
+		ResourceType: "referral",
+		ResourceID:   r.ID,
+	})
+
+	c.JSON(http.StatusCreated, r)
+}
+
+// ListClinicReferrals handles GET /v1/clinic/referrals?status=&patient_id=
+// Returns the clinic's referrals, newest first.
+func ListClinicReferrals(c *gin.Context) {
+	referrals := respondReferrals(c, ` ORDER BY r.created_at DESC`,
+		`r.clinic_id = $1 AND ($2 = '' OR r.status = $2) AND ($3 = '' OR r.patient_id = $3)`,
+		c.GetString("userID"), c.Query("status"), c.Query("patient_id"))
+	if referrals != nil {
+		c.JSON(http.StatusOK, referrals)
+	}
+}
+
+// GetClinicReferral handles GET /v1/clinic/referrals/:id
+// Returns one of the clinic's referrals with the IDs of its reports.
+func GetClinicReferral(c *gin.Context) {
+	if r, ok := loadOwnReferral(c, "clinic_id"); ok {
+		c.JSON(http.StatusOK, r)
+	}
+}
+
+// CancelReferral handles POST /v1/clinic/referrals/:id/cancel
+// Withdraws a referral the scanning center has not completed yet.
+func CancelReferral(c *gin.Context) {
+	req, ok := bindReferralStatus(c)
+	if !ok {
+		return
+	}
+	setReferralStatus(c, "clinic_id", models.ReferralCancelled,
+		[]string{models.ReferralPending, models.ReferralAccepted}, req.Reason)
+}
+
+// ListIncomingReferrals handles GET /v1/scanning/referrals?status=
+// Returns the referrals sent to the scanning center, most urgent first. Without
+// 'status' the open queue (pending and accepted) is returned.
+func ListIncomingReferrals(c *gin.Context) {
+	statuses := []string{models.ReferralPending, models.ReferralAccepted}
+	if status := c.Query("status"); status != "" {
+		statuses = []string{status}
+	}
+	referrals := respondReferrals(c, referralQueueOrder,
+		`r.scanning_center_id = $1 AND r.status = ANY($2)`, c.GetString("userID"), pq.Array(statuses))
+	if referrals != nil {
+		c.JSON(http.StatusOK, referrals)
+	}
+}
+
+// GetIncomingReferral handles GET /v1/scanning/referrals/:id
+// Returns one referral sent to the scanning center.
+func GetIncomingReferral(c *gin.Context) {
+	if r, ok := loadOwnReferral(c, "scanning_center_id"); ok {
+		c.JSON(http.StatusOK, r)
+	}
+}
+
+// AcceptReferral handles POST /v1/scanning/referrals/:id/accept
+// Takes a pending referral into the scanning center's schedule.
+func AcceptReferral(c *gin.Context) {
+	setReferralStatus(c, "scanning_center_id", models.ReferralAccepted,
+		[]string{models.ReferralPending}, "")
+}
+
+// DeclineReferral handles POST /v1/scanning/referrals/:id/decline
+// Turns down a referral, e.g., when the test is not offered; the reason is
+// shown to the referring clinic.
+func DeclineReferral(c *gin.Context) {
+	req, ok := bindReferralStatus(c)
+	if !ok {
+		return
+	}
+	setReferralStatus(c, "scanning_center_id", models.ReferralDeclined,
+		[]string{models.ReferralPending, models.ReferralAccepted}, req.Reason)
+}
+
+// GetMyReferrals handles GET /v1/patient/referrals
+// Returns the patient's referrals, newest first, without the clinical notes
+// written for the scanning center.
+func GetMyReferrals(c *gin.Context) {
+	referrals := respondReferrals(c, ` ORDER BY r.created_at DESC`, `r.patient_id = $1`, c.GetString("userID"))
+	if referrals == nil {
+		return
+	}
+	for i := range referrals {
+		referrals[i].ClinicalNotes = ""
+	}
+	c.JSON(http.StatusOK, referrals)
+}
@@ -0,0 +1,438 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"Medibridge/go-api/models"
+	"Medibridge/go-api/utils"
+)
+
+const (
+	maxRefills                = 12 // A year of monthly repeats
+	defaultRefillIntervalDays = 30
+	// Patients may ask for a refill this many days before it is due, so they do not run out.
+	refillEarlyDays = 3
+)
+
+// errRefillDecided is returned when a refill request was approved or denied by
+// someone else while it was being decided.
+var errRefillDecided = errors.New("refill request was already decided")
+
+// refillRequestColumns is the column list read by scanRefillRequest.
+const refillRequestColumns = `id, prescription_id, patient_id, clinic_id, status, COALESCE(patient_note, ''),
+	COALESCE(decision_note, ''), COALESCE(decided_by, ''), COALESCE(new_prescription_id::text, ''), created_at, decided_at`
+
+// scanRefillRequest reads one row selected with refillRequestColumns.
+func scanRefillRequest(row rowScanner) (models.RefillRequest, error) {
+	var r models.RefillRequest
+	var createdAt time.Time
+	var decidedAt sql.NullTime
+
+	err := row.Scan(&r.ID, &r.PrescriptionID, &r.PatientID, &r.ClinicID, &r.Status, &r.PatientNote,
+		&r.DecisionNote, &r.DecidedBy, &r.NewPrescriptionID, &createdAt, &decidedAt)
+	if err != nil {
+		return r, err
+	}
+	r.CreatedAt = createdAt.Unix()
+	if decidedAt.Valid {
+		r.DecidedAt = decidedAt.Time.Unix()
+	}
+	return r, nil
+}
+
+// normalizeRefills validates the repeat settings of a prescription. Refills without
+// an interval are spaced by the longest course in the prescription, or a month.
+func normalizeRefills(p *models.Prescription) error {
+	if p.RefillsAllowed < 0 || p.RefillIntervalDays < 0 {
+		return errors.New("refills_allowed and refill_interval_days cannot be negative")
+	}
+	if p.RefillsAllowed > maxRefills {
+		return errors.New("refills_allowed cannot be more than " + strconv.Itoa(maxRefills))
+	}
+	if p.RefillOf != "" && p.RefillsAllowed > 0 {
+		return errors.New("a refill cannot have refills of its own")
+	}
+
+	if p.RefillsAllowed == 0 {
+		p.RefillIntervalDays = 0
+		return nil
+	}
+	if p.RefillIntervalDays == 0 {
+		for _, instr := range p.Instructions {
+			if instr.DurationDays > p.RefillIntervalDays {
+				p.RefillIntervalDays = instr.DurationDays
+			}
+		}
+		if p.RefillIntervalDays == 0 {
+			p.RefillIntervalDays = defaultRefillIntervalDays
+		}
+	}
+	return nil
+}
+
+// nextRefillAt returns when the next refill of an original prescription is due:
+// one interval after it, or its latest refill, was filled.
+func nextRefillAt(p models.Prescription) (time.Time, error) {
+	var lastFilled time.Time
+	err := utils.DB.QueryRow(
+		`SELECT COALESCE(last_refill_at, created_at) FROM prescriptions WHERE id = $1`, p.ID,
+	).Scan(&lastFilled)
+	if err != nil {
+		return lastFilled, err
+	}
+	return lastFilled.AddDate(0, 0, p.RefillIntervalDays), nil
+}
+
+// refillInstructions returns the instructions a refill repeats: those the doctor
+// has not discontinued.
+func refillInstructions(p models.Prescription) []models.DosageInstruction {
+	instructions := []models.DosageInstruction{}
+	for _, instr := range p.Instructions {
+		if !instr.Discontinued {
+			instructions = append(instructions, instr)
+		}
+	}
+	return instructions
+}
+
+// loadClinicRefillRequest fetches one of the clinic's refill requests by the :id
+// URL parameter, writing the error response itself when it cannot.
+func loadClinicRefillRequest(c *gin.Context) (models.RefillRequest, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid refill request ID"})
+		return models.RefillRequest{}, false
+	}
+
+	r, err := scanRefillRequest(utils.DB.QueryRow(
+		`SELECT `+refillRequestColumns+` FROM refill_requests WHERE id = $1 AND clinic_id = $2`,
+		id, c.GetString("userID"),
+	))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Refill request not found"})
+		return r, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch refill request"})
+		return r, false
+	}
+	if r.Status != models.RefillPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Refill request was already " + r.Status})
+		return r, false
+	}
+	return r, true
+}
+
+// RequestRefill handles POST /v1/patient/prescriptions/:id/refill
+// Asks the prescribing clinic for the next repeat of a prescription, with an
+// optional {"note": ...}. Requesting on a refill asks for a repeat of its original.
+func RequestRefill(c *gin.Context) {
+	patientID := c.GetString("userID")
+
+	var req struct {
+		Note string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	p, err := loadPrescription(c.Param("id"))
+	if err == nil && p.RefillOf != "" {
+		p, err = loadPrescription(p.RefillOf)
+	}
+	if err == sql.ErrNoRows || (err == nil && (p.PatientID != patientID || p.Status == models.PrescriptionDraft)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Prescription not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch prescription"})
+		return
+	}
+
+	if p.Status != models.PrescriptionIssued {
+		c.JSON(http.StatusConflict, gin.H{"error": "This prescription was cancelled and cannot be refilled"})
+		return
+	}
+	if p.RefillsUsed >= p.RefillsAllowed {
+		c.JSON(http.StatusConflict, gin.H{"error": "No refills left on this prescription. Please see your doctor."})
+		return
+	}
+	if len(refillInstructions(p)) == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Every medicine on this prescription was discontinued"})
+		return
+	}
+
+	due, err := nextRefillAt(p)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch prescription"})
+		return
+	}
+	if time.Now().Before(due.AddDate(0, 0, -refillEarlyDays)) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":          "It is too early to refill this prescription",
+			"next_refill_at": due.Unix(),
+		})
+		return
+	}
+
+	r := models.RefillRequest{
+		PrescriptionID: p.ID,
+		PatientID:      patientID,
+		ClinicID:       p.ClinicID,
+		Status:         models.RefillPending,
+		PatientNote:    strings.TrimSpace(req.Note),
+	}
+	var createdAt time.Time
+	err = utils.DB.QueryRow(`
+		INSERT INTO refill_requests (prescription_id, patient_id, clinic_id, patient_note)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+		RETURNING id, created_at
+	`, r.PrescriptionID, r.PatientID, r.ClinicID, r.PatientNote).Scan(&r.ID, &createdAt)
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A refill request for this prescription is already pending"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save refill request"})
+		return
+	}
+	r.CreatedAt = createdAt.Unix()
+
+	notifyUser(models.Notification{
+		UserID:       r.ClinicID,
+		Type:         "refill_requested",
+		Title:        "Refill requested",
+		Message:      "Patient " + patientID + " asked for a refill of a prescription.",
+		ResourceType: "refill_request",
+		ResourceID:   strconv.FormatInt(r.ID, 10),
+	})
+
+	c.JSON(http.StatusCreated, r)
+}
+
+// GetMyRefillRequests handles GET /v1/patient/refills
+// Returns the patient's refill requests, newest first.
+func GetMyRefillRequests(c *gin.Context) {
+	respondRefillRequests(c, "created_at DESC", `patient_id = $1`, c.GetString("userID"))
+}
+
+// ListRefillRequests handles GET /v1/clinic/refills
+// Returns the clinic's refill queue, oldest first. ?status= selects pending (the
+// default), approved, denied or all.
+func ListRefillRequests(c *gin.Context) {
+	status := c.DefaultQuery("status", models.RefillPending)
+	switch status {
+	case "all":
+		respondRefillRequests(c, "created_at", `clinic_id = $1`, c.GetString("userID"))
+	case models.RefillPending, models.RefillApproved, models.RefillDenied:
+		respondRefillRequests(c, "created_at", `clinic_id = $1 AND status = $2`, c.GetString("userID"), status)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, approved, denied or all"})
+	}
+}
+
+// respondRefillRequests writes the refill requests matching a WHERE clause, in the given order.
+func respondRefillRequests(c *gin.Context, order, where string, args ...interface{}) {
+	rows, err := utils.DB.Query(
+		`SELECT `+refillRequestColumns+` FROM refill_requests WHERE `+where+` ORDER BY `+order, args...,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch refill requests"})
+		return
+	}
+	defer rows.Close()
+
+	requests := []models.RefillRequest{}
+	for rows.Next() {
+		r, err := scanRefillRequest(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch refill requests"})
+			return
+		}
+		requests = append(requests, r)
+	}
+
+	c.JSON(http.StatusOK, requests)
+}
+
+// ApproveRefillRequest handles POST /v1/clinic/refills/:id/approve
+// Issues the follow-up prescription: a copy of the original's current version
+// without discontinued drugs, safety checked like any new prescription. The
+// optional body {"note": ..., "override_warnings": true} is as for new prescriptions.
+func ApproveRefillRequest(c *gin.Context) {
+	clinicID := c.GetString("userID")
+	r, ok := loadClinicRefillRequest(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Note             string `json:"note"`
+		OverrideWarnings bool   `json:"override_warnings"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	original, err := loadPrescription(r.PrescriptionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch prescription"})
+		return
+	}
+	if original.Status != models.PrescriptionIssued || original.RefillsUsed >= original.RefillsAllowed {
+		c.JSON(http.StatusConflict, gin.H{"error": "The prescription was cancelled or has no refills left; deny the request instead"})
+		return
+	}
+
+	refill := models.Prescription{
+		PatientID:          original.PatientID,
+		ClinicID:           original.ClinicID,
+		Diagnosis:          original.Diagnosis,
+		Vitals:             original.Vitals,
+		Instructions:       refillInstructions(original),
+		OriginalDoctorText: original.OriginalDoctorText,
+		OverrideWarnings:   req.OverrideWarnings,
+		Status:             models.PrescriptionIssued,
+		RefillOf:           original.ID,
+		PrescribedBy:       c.GetInt64("memberID"),
+	}
+	if len(refill.Instructions) == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Every drug on the prescription was discontinued; deny the request instead"})
+		return
+	}
+	if !runSafetyChecks(c, &refill) {
+		return
+	}
+
+	if err := approveRefill(&r, &refill, clinicID, strings.TrimSpace(req.Note)); err != nil {
+		if err == errRefillDecided {
+			c.JSON(http.StatusConflict, gin.H{"error": "Refill request was decided meanwhile"})
+			return
+		}
+		respondSaveError(c, err)
+		return
+	}
+
+	respondPrescriptionIssued(c, refill, noticeRefillApproved, r.DecisionNote,
+		"Refill approved, saved, and AI processing triggered successfully.")
+}
+
+// approveRefill uses up one refill of the original prescription, issues the
+// follow-up prescription and closes the request, all or nothing.
+func approveRefill(r *models.RefillRequest, refill *models.Prescription, clinicID, note string) error {
+	tx, err := utils.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE prescriptions SET refills_used = refills_used + 1, last_refill_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'issued' AND refills_used < refills_allowed
+	`, refill.RefillOf)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errPrescriptionChanged
+	}
+
+	if err := insertPrescriptionTx(tx, refill); err != nil {
+		return err
+	}
+
+	var decidedAt time.Time
+	err = tx.QueryRow(`
+		UPDATE refill_requests
+		SET status = 'approved', decision_note = NULLIF($1, ''), decided_by = $2,
+			new_prescription_id = $3, decided_at = CURRENT_TIMESTAMP
+		WHERE id = $4 AND status = 'pending'
+		RETURNING decided_at
+	`, note, clinicID, refill.ID, r.ID).Scan(&decidedAt)
+	if err == sql.ErrNoRows {
+		return errRefillDecided
+	}
+	if err != nil {
+		return err
+	}
+
+	r.Status = models.RefillApproved
+	r.DecisionNote = note
+	r.DecidedBy = clinicID
+	r.NewPrescriptionID = refill.ID
+	r.DecidedAt = decidedAt.Unix()
+	return tx.Commit()
+}
+
+// DenyRefillRequest handles POST /v1/clinic/refills/:id/deny
+// Declines a refill with {"reason": ...}, which is shown to the patient
+// (e.g., "Please book a review appointment first").
+func DenyRefillRequest(c *gin.Context) {
+	r, ok := loadClinicRefillRequest(c)
+	if !ok {
+		return
+	}
+	reason, ok := bindReason(c)
+	if !ok {
+		return
+	}
+
+	result, err := utils.DB.Exec(`
+		UPDATE refill_requests
+		SET status = 'denied', decision_note = $1, decided_by = $2, decided_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND status = 'pending'
+	`, reason, c.GetString("userID"), r.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update refill request"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Refill request was decided meanwhile"})
+		return
+	}
+
+	notifyUser(models.Notification{
+		UserID:       r.PatientID,
+		Type:         "refill_denied",
+		Title:        "Refill declined",
+		Message:      "Your doctor declined your refill request. Reason: " + reason,
+		ResourceType: "prescription",
+		ResourceID:   r.PrescriptionID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Refill request denied", "refill_request_id": r.ID})
+}
+
+// denyPendingRefills closes the open refill request of a prescription that can no
+// longer be refilled, telling the patient why.
+func denyPendingRefills(p models.Prescription, reason, decidedBy string) {
+	result, err := utils.DB.Exec(`
+		UPDATE refill_requests
+		SET status = 'denied', decision_note = $1, decided_by = $2, decided_at = CURRENT_TIMESTAMP
+		WHERE prescription_id = $3 AND status = 'pending'
+	`, reason, decidedBy, p.ID)
+	if err != nil {
+		log.Printf("Warning: Could not close refill requests of prescription %s: %v", p.ID, err)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected > 0 {
+		notifyUser(models.Notification{
+			UserID:       p.PatientID,
+			Type:         "refill_denied",
+			Title:        "Refill declined",
+			Message:      "Your refill request was closed. Reason: " + reason,
+			ResourceType: "prescription",
+			ResourceID:   p.ID,
+		})
+	}
+}
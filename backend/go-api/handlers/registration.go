@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"Medibridge/go-api/models"
+	"Medibridge/go-api/utils"
+)
+
+// userIDPrefixes start the generated account IDs of each role, e.g., PAT0010009.
+var userIDPrefixes = map[string]string{"Patient": "PAT", "Clinic": "CLI", "Scanning": "SCN", "Admin": "ADM"}
+
+// patientGenders are the accepted values of gender.
+var patientGenders = []string{models.GenderMale, models.GenderFemale, models.GenderOther}
+
+// registrationOTPKey keeps registration OTPs apart from login OTPs sent to the same number.
+func registrationOTPKey(phone string) string {
+	return "register:" + phone
+}
+
+// normalizePersonName trims a name and collapses the spaces inside it, so the
+// duplicate check compares names as typed by different clinics.
+func normalizePersonName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// validatePatientDetails normalizes d in place and returns a message for the
+// first invalid field, or "" if it is valid.
+func validatePatientDetails(d *models.PatientDetails) string {
+	d.Name = normalizePersonName(d.Name)
+	if d.Name == "" {
+		return "Invalid patient details; 'name' is required"
+	}
+	if d.DateOfBirth != "" {
+		dob, err := time.Parse("2006-01-02", d.DateOfBirth)
+		if err != nil || dob.After(time.Now()) {
+			return "Invalid 'date_of_birth'; expected a past date as YYYY-MM-DD"
+		}
+	}
+	d.Gender = strings.ToLower(strings.TrimSpace(d.Gender))
+	if d.Gender != "" && !containsString(patientGenders, d.Gender) {
+		return "Invalid 'gender'; expected one of: " + strings.Join(patientGenders, ", ")
+	}
+	if d.WeightKg < 0 || d.WeightKg > 500 {
+		return "Invalid 'weight_kg'; expected a weight between 0 and 500"
+	}
+	return ""
+}
+
+// accountWithMobile returns the ID and role of the account registered with
+// mobile, or empty strings if there is none.
+func accountWithMobile(mobile string) (string, string, error) {
+	var id, role string
+	err := utils.DB.QueryRow(`SELECT unique_user_id, role FROM users WHERE mobile_number = $1`, mobile).Scan(&id, &role)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	return id, role, err
+}
+
+// findDuplicatePatients returns the patients registered under the same name
+// and date of birth as d. Without a date of birth a name alone is too common
+// to flag anyone.
+func findDuplicatePatients(d models.PatientDetails) ([]models.DuplicatePatient, error) {
+	duplicates := []models.DuplicatePatient{}
+	if d.DateOfBirth == "" {
+		return duplicates, nil
+	}
+
+	rows, err := utils.DB.Query(`
+		SELECT unique_user_id, name, date_of_birth, COALESCE(mobile_number, ''), COALESCE(registered_by, '')
+		FROM users
+		WHERE role = 'Patient' AND lower(name) = lower($1) AND date_of_birth = $2
+		ORDER BY created_at
+	`, d.Name, d.DateOfBirth)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var dup models.DuplicatePatient
+		var dob time.Time
+		var mobile string
+		if err := rows.Scan(&dup.PatientID, &dup.Name, &dob, &mobile, &dup.RegisteredBy); err != nil {
+			return nil, err
+		}
+		dup.DateOfBirth = dob.Format("2006-01-02")
+		dup.MobileHint = maskID(mobile)
+		dup.Reason = models.DuplicateSameNameAndBirthDate
+		duplicates = append(duplicates, dup)
+	}
+	return duplicates, rows.Err()
+}
+
+// nextUserID draws a new account ID for role. The sequence never hands out a
+// number twice, so generated IDs cannot collide.
+func nextUserID(tx *sql.Tx, role string) (string, error) {
+	var n int64
+	if err := tx.QueryRow(`SELECT nextval('user_number_seq')`).Scan(&n); err != nil {
+		return "", err
+	}
+	return utils.FormatUserID(userIDPrefixes[role], n), nil
+}
+
+// createPatient registers a patient account under a newly generated ID and flags
+// it against its possible duplicates.
+func createPatient(mobile string, d models.PatientDetails, registeredBy string, duplicates []models.DuplicatePatient) (models.RegisteredPatient, error) {
+	tx, err := utils.DB.Begin()
+	if err != nil {
+		return models.RegisteredPatient{}, err
+	}
+	defer tx.Rollback()
+
+	patient, err := insertPatient(tx, mobile, d, registeredBy, duplicates)
+	if err != nil {
+		return patient, err
+	}
+	return patient, tx.Commit()
+}
+
+// insertPatient is createPatient within tx. Patients log in with OTP, so the
+// account has no password; dependents have no mobile number either.
+func insertPatient(tx *sql.Tx, mobile string, d models.PatientDetails, registeredBy string, duplicates []models.DuplicatePatient) (models.RegisteredPatient, error) {
+	patient := models.RegisteredPatient{
+		Name:         d.Name,
+		Mobile:       mobile,
+		DateOfBirth:  d.DateOfBirth,
+		Gender:       d.Gender,
+		WeightKg:     d.WeightKg,
+		RegisteredBy: registeredBy,
+	}
+
+	var err error
+	if patient.PatientID, err = nextUserID(tx, "Patient"); err != nil {
+		return patient, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO users (unique_user_id, mobile_number, hashed_password, name, date_of_birth,
+			weight_kg, gender, registered_by, role)
+		VALUES ($1, NULLIF($2, ''), '', $3, NULLIF($4, '')::date, NULLIF($5, 0), NULLIF($6, ''), NULLIF($7, ''), 'Patient')
+	`, patient.PatientID, mobile, d.Name, d.DateOfBirth, d.WeightKg, d.Gender, registeredBy)
+	if err != nil {
+		return patient, err
+	}
+
+	for _, dup := range duplicates {
+		_, err := tx.Exec(`
+			INSERT INTO patient_duplicate_flags (patient_id, duplicate_of, reason, flagged_by)
+			VALUES ($1, $2, $3, NULLIF($4, ''))
+			ON CONFLICT (patient_id, duplicate_of) DO NOTHING
+		`, patient.PatientID, dup.PatientID, dup.Reason, registeredBy)
+		if err != nil {
+			return patient, err
+		}
+	}
+	return patient, nil
+}
+
+// RequestRegistrationOTP handles POST /v1/auth/register/otp
+// Sends an OTP to a mobile number that has no account yet, to confirm it
+// before POST /v1/auth/register creates the patient.
+func RequestRegistrationOTP(c *gin.Context) {
+	var req models.RegistrationOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	req.Phone = strings.TrimSpace(req.Phone)
+	if !mobilePattern.MatchString(req.Phone) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'phone'; expected 10 to 15 digits"})
+		return
+	}
+
+	existingID, _, err := accountWithMobile(req.Phone)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if existingID != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "This number is already registered; log in with OTP instead"})
+		return
+	}
+
+	sendOTP(c, registrationOTPKey(req.Phone), req.Phone)
+}
+
+// RegisterPatient handles POST /v1/auth/register
+// Creates a patient account for an OTP-confirmed mobile number, issues its
+// patient ID and logs the patient in. A person already registered by a clinic
+// under another number is flagged for review rather than turned away.
+func RegisterPatient(c *gin.Context) {
+	var req models.PatientSignupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	if msg := validatePatientDetails(&req.PatientDetails); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	req.Phone = strings.TrimSpace(req.Phone)
+	key := registrationOTPKey(req.Phone)
+	if msg := checkOTP(key, req.OTP); msg != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": msg})
+		return
+	}
+
+	duplicates, err := findDuplicatePatients(req.PatientDetails)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	patient, err := createPatient(req.Phone, req.PatientDetails, "", duplicates)
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This number is already registered; log in with OTP instead"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register patient"})
+		return
+	}
+
+	// Delete used OTP
+	deleteOTP(key)
+
+	token, err := utils.GenerateToken(patient.PatientID, "Patient")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+	recordLogin(c, models.LoginEvent{UserID: patient.PatientID, Mobile: req.Phone, Method: models.LoginOTP, Success: true})
+	c.JSON(http.StatusCreated, gin.H{
+		"token":      token,
+		"role":       "Patient",
+		"name":       patient.Name,
+		"patient_id": patient.PatientID,
+	})
+}
+
+// RegisterWalkInPatient handles POST /v1/clinic/patients
+// Registers a patient at the front desk; they log in later with OTP on their
+// mobile number. A number that is already registered returns that patient's ID
+// instead, and a patient with the same name and date of birth under another
+// number is returned for review until the clinic confirms with 'confirm_new'.
+func RegisterWalkInPatient(c *gin.Context) {
+	var req models.WalkInPatientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid patient details; 'name' and 'mobile' are required"})
+		return
+	}
+	req.Mobile = strings.TrimSpace(req.Mobile)
+	if !mobilePattern.MatchString(req.Mobile) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'mobile'; expected 10 to 15 digits"})
+		return
+	}
+	if msg := validatePatientDetails(&req.PatientDetails); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	existingID, existingRole, err := accountWithMobile(req.Mobile)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if existingRole == "Patient" {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":      "A patient is already registered with this mobile number",
+			"patient_id": existingID,
+		})
+		return
+	}
+	if existingID != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "This number is registered to another account"})
+		return
+	}
+
+	duplicates, err := findDuplicatePatients(req.PatientDetails)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if len(duplicates) > 0 && !req.ConfirmNew {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":               "Possible duplicate patients found; use an existing patient ID or confirm with 'confirm_new'",
+			"possible_duplicates": duplicates,
+		})
+		return
+	}
+
+	clinicID := c.GetString("userID")
+	patient, err := createPatient(req.Mobile, req.PatientDetails, clinicID, duplicates)
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This mobile number was registered in the meantime; search for the patient"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register patient"})
+		return
+	}
+
+	// In production: send the patient ID by SMS
+	// For demo: Log to console
+	fmt.Printf("Patient ID for %s registered at %s: %s\n", patient.Mobile, clinicID, patient.PatientID)
+
+	c.JSON(http.StatusCreated, patient)
+}
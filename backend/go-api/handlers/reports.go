@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"Medibridge/go-api/models"
+	"Medibridge/go-api/utils"
+)
+
+// sharedReportColumns is the column list read by scanSharedReport, selected from sharedReportTables.
+const sharedReportColumns = `r.id, r.patient_id, pu.name, COALESCE(r.scanning_center_id, ''), COALESCE(sp.name, su.name, ''),
+	COALESCE(r.referring_clinic_id, ''), COALESCE(r.referral_id::text, ''), COALESCE(r.scan_type, ''),
+	COALESCE(r.simplified_summary, ''), COALESCE(r.full_technical_report, ''), r.status, r.created_at,
+	s.access, s.shared_at, s.read_at, r.original_file_url`
+
+// sharedReportTables joins a report share to its report and the names shown with it.
+const sharedReportTables = ` FROM report_shares s
+	JOIN reports r ON r.id = s.report_id
+	JOIN users pu ON pu.unique_user_id = r.patient_id
+	LEFT JOIN users su ON su.unique_user_id = r.scanning_center_id
+	LEFT JOIN organization_profiles sp ON sp.org_id = r.scanning_center_id`
+
+// sharedReport is a report as shared with one recipient.
+type sharedReport struct {
+	Report       models.Report
+	Access       string
+	OriginalPath string
+}
+
+// scanSharedReport reads one row selected with sharedReportColumns. Recipients
+// with summary access do not get the technical text.
+func scanSharedReport(row rowScanner) (sharedReport, error) {
+	var sr sharedReport
+	r := &sr.Report
+	var createdAt, sharedAt time.Time
+	var readAt sql.NullTime
+	err := row.Scan(&r.ID, &r.PatientID, &r.PatientName, &r.ScanningCenterID, &r.ScanningCenterName,
+		&r.ReferringClinicID, &r.ReferralID, &r.ScanType,
+		&r.SimplifiedSummary, &r.FullTechnicalReport, &r.Status, &createdAt,
+		&sr.Access, &sharedAt, &readAt, &sr.OriginalPath)
+	if err != nil {
+		return sr, err
+	}
+	if sr.Access != models.ShareAccessOriginal {
+		r.FullTechnicalReport = ""
+	}
+	r.CreatedAt = createdAt.Unix()
+	r.SharedAt = sharedAt.Unix()
+	if readAt.Valid {
+		r.ReadAt = readAt.Time.Unix()
+	}
+	return sr, nil
+}
+
+// localizeForCaller translates simplified summaries for the caller: a patient
+// gets their preferred language, anyone else only what they ask for. It writes
+// the error response itself when it fails.
+func localizeForCaller(c *gin.Context, reports []models.Report) bool {
+	patientID := ""
+	if c.GetString("userRole") == "Patient" {
+		patientID = c.GetString("userID")
+	}
+	langs, ok := requestedLanguages(c, patientID)
+	if !ok {
+		return false
+	}
+	if err := localizeReports(reports, langs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch translations"})
+		return false
+	}
+	return true
+}
+
+// respondSharedReports answers with the reports shared with the caller, newest first.
+func respondSharedReports(c *gin.Context) {
+	rows, err := utils.DB.Query(`
+		SELECT `+sharedReportColumns+sharedReportTables+`
+		WHERE s.recipient_id = $1
+		ORDER BY s.shared_at DESC
+	`, c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reports"})
+		return
+	}
+	defer rows.Close()
+
+	reports := []models.Report{}
+	for rows.Next() {
+		sr, err := scanSharedReport(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reports"})
+			return
+		}
+		reports = append(reports, sr.Report)
+	}
+	if !localizeForCaller(c, reports) {
+		return
+	}
+	c.JSON(http.StatusOK, reports)
+}
+
+// openSharedReport fetches the report named by :id with its lab results if it
+// was shared with the caller, and records that they read it. It responds with 404 (or 500) itself
+// when it cannot.
+func openSharedReport(c *gin.Context) (sharedReport, bool) {
+	recipientID := c.GetString("userID")
+	sr, err := scanSharedReport(utils.DB.QueryRow(`
+		SELECT `+sharedReportColumns+sharedReportTables+`
+		WHERE s.report_id::text = $1 AND s.recipient_id = $2
+	`, c.Param("id"), recipientID))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report not found"})
+		return sr, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch report"})
+		return sr, false
+	}
+
+	if sr.Report.ReadAt == 0 {
+		_, err := utils.DB.Exec(`
+			UPDATE report_shares SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP)
+			WHERE report_id = $1 AND recipient_id = $2
+		`, sr.Report.ID, recipientID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update report"})
+			return sr, false
+		}
+		sr.Report.ReadAt = time.Now().Unix()
+	}
+
+	if sr.Report.LabResults, err = loadReportObservations(sr.Report.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lab results"})
+		return sr, false
+	}
+	return sr, true
+}
+
+// loadReportShares returns the recipients of a report with their read receipts.
+func loadReportShares(reportID string) ([]models.ReportShare, error) {
+	rows, err := utils.DB.Query(`
+		SELECT s.id, s.report_id, s.recipient_id, COALESCE(p.name, u.name), s.recipient_type, s.access,
+			s.shared_at, s.read_at
+		FROM report_shares s
+		JOIN users u ON u.unique_user_id = s.recipient_id
+		LEFT JOIN organization_profiles p ON p.org_id = s.recipient_id
+		WHERE s.report_id = $1
+		ORDER BY s.shared_at, s.id
+	`, reportID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := []models.ReportShare{}
+	for rows.Next() {
+		var s models.ReportShare
+		var sharedAt time.Time
+		var readAt sql.NullTime
+		if err := rows.Scan(&s.ID, &s.ReportID, &s.RecipientID, &s.RecipientName, &s.RecipientType,
+			&s.Access, &sharedAt, &readAt); err != nil {
+			return nil, err
+		}
+		s.SharedAt = sharedAt.Unix()
+		if readAt.Valid {
+			s.ReadAt = readAt.Time.Unix()
+		}
+		shares = append(shares, s)
+	}
+	return shares, rows.Err()
+}
+
+// GetMyReport handles GET /v1/patient/reports/:id
+// Returns the simplified summary of one of the patient's shared reports, in
+// their language where translated, with the glossary terms found in it, and
+// marks it read for the scanning center.
+func GetMyReport(c *gin.Context) {
+	sr, ok := openSharedReport(c)
+	if !ok {
+		return
+	}
+	reports := []models.Report{sr.Report}
+	if !localizeForCaller(c, reports) {
+		return
+	}
+	sr.Report = reports[0]
+	var err error
+	if sr.Report.GlossaryTerms, err = detectGlossaryTerms(sr.Report.SimplifiedSummary); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load glossary"})
+		return
+	}
+	c.JSON(http.StatusOK, sr.Report)
+}
+
+// ListClinicReports handles GET /v1/clinic/reports
+// Returns the reports scanning centers shared with the clinic, newest first.
+func ListClinicReports(c *gin.Context) {
+	respondSharedReports(c)
+}
+
+// GetClinicReport handles GET /v1/clinic/reports/:id
+// Returns a report shared with the clinic, with its technical text, and marks
+// it read for the scanning center.
+func GetClinicReport(c *gin.Context) {
+	if sr, ok := openSharedReport(c); ok {
+		c.JSON(http.StatusOK, sr.Report)
+	}
+}
+
+// GetClinicReportOriginal handles GET /v1/clinic/reports/:id/original
+// Downloads the technical original (PDF, image or DICOM) of a report shared
+// with the clinic.
+func GetClinicReportOriginal(c *gin.Context) {
+	sr, ok := openSharedReport(c)
+	if !ok {
+		return
+	}
+	if sr.Access != models.ShareAccessOriginal {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the simplified summary was shared with you"})
+		return
+	}
+	if _, err := os.Stat(sr.OriginalPath); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "The original report file is no longer available"})
+		return
+	}
+	c.FileAttachment(sr.OriginalPath, "report-"+sr.Report.ID+filepath.Ext(sr.OriginalPath))
+}
+
+// GetReportShares handles GET /v1/scanning/reports/:id/shares
+// Returns who a report was shared with and whether they have opened it.
+func GetReportShares(c *gin.Context) {
+	var reportID string
+	err := utils.DB.QueryRow(`
+		SELECT id FROM reports WHERE id::text = $1 AND scanning_center_id = $2
+	`, c.Param("id"), c.GetString("userID")).Scan(&reportID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch report"})
+		return
+	}
+
+	shares, err := loadReportShares(reportID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch report shares"})
+		return
+	}
+	c.JSON(http.StatusOK, shares)
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"Medibridge/go-api/models"
+	"Medibridge/go-api/utils"
+)
+
+// drugGroups holds the ingredient and class groups of a drug from the drug table.
+type drugGroups struct {
+	Ingredients       []string
+	Class             string
+	Contraindications []string
+	Limits            models.DoseLimits
+}
+
+// drugCatalog maps lowercase drug names to their groups for the drugs being checked.
+type drugCatalog map[string]drugGroups
+
+// loadDrugCatalog looks up the ingredient and class groups of the given drug names.
+// Prescribed names like "Amoxicillin 500 mg" are matched on the full name and on
+// their ingredient key, against the drug, generic and brand names.
+func loadDrugCatalog(drugNames []string) (drugCatalog, error) {
+	catalog := drugCatalog{}
+
+	lookup := []string{}
+	for _, name := range drugNames {
+		lookup = append(lookup, strings.ToLower(strings.TrimSpace(name)), ingredientKey(name))
+	}
+	if len(lookup) == 0 {
+		return catalog, nil
+	}
+
+	if err := ensureDrugTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := utils.DB.Query(`
+		SELECT `+drugColumns+`
+		FROM drugs
+		WHERE LOWER(name) = ANY($1)
+			OR LOWER(generic_name) = ANY($1)
+			OR EXISTS (SELECT 1 FROM unnest(brand_names) AS brand WHERE LOWER(brand) = ANY($1))
+	`, pq.Array(lookup))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		drug, err := scanDrug(rows)
+		if err != nil {
+			return nil, err
+		}
+		catalog.add(drug, true)
+	}
+	return catalog, rows.Err()
+}
+
+// add indexes a drug's groups under every name a doctor may prescribe it by.
+// Without overwrite, names already in the catalog keep their groups.
+func (dc drugCatalog) add(drug models.Drug, overwrite bool) {
+	groups := drugGroups{
+		Ingredients:       drug.Ingredients,
+		Class:             drug.Class,
+		Contraindications: drug.Contraindications,
+		Limits:            drug.Limits,
+	}
+	if len(groups.Ingredients) == 0 {
+		groups.Ingredients = []string{ingredientKey(drug.Name)}
+	}
+
+	names := append([]string{drug.Name, drug.GenericName}, drug.BrandNames...)
+	for _, name := range names {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if key == "" {
+			continue
+		}
+		if _, exists := dc[key]; exists && !overwrite {
+			continue
+		}
+		dc[key] = groups
+	}
+}
+
+// groups returns the groups of a prescribed drug. Drugs missing from the drug table
+// fall back to the ingredient key of their name.
+func (dc drugCatalog) groups(drugName string) drugGroups {
+	if groups, ok := dc[strings.ToLower(strings.TrimSpace(drugName))]; ok {
+		return groups
+	}
+	key := ingredientKey(drugName)
+	if groups, ok := dc[key]; ok {
+		return groups
+	}
+	if key == "" {
+		return drugGroups{}
+	}
+	return drugGroups{Ingredients: []string{key}}
+}
+
+// keys returns every key a drug can be matched on: its ingredients and its class.
+func (dc drugCatalog) keys(drugName string) []string {
+	groups := dc.groups(drugName)
+	keys := append([]string{}, groups.Ingredients...)
+	if groups.Class != "" {
+		keys = append(keys, groups.Class)
+	}
+	return keys
+}
+
+// sharedIngredient returns an ingredient contained in both drugs, if any.
+func (dc drugCatalog) sharedIngredient(a, b string) (string, bool) {
+	for _, x := range dc.groups(a).Ingredients {
+		for _, y := range dc.groups(b).Ingredients {
+			if x == y {
+				return x, true
+			}
+		}
+	}
+	return "", false
+}
+
+// checkPrescriptionSafety runs every prescription safety check for a new or amended prescription:
+// duplicate therapy and interactions against itself and the patient's active
+// prescriptions, the patient's recorded allergies and conditions, and dose ranges.
+func checkPrescriptionSafety(p models.Prescription) ([]models.SafetyWarning, error) {
+	stored, err := loadActiveInstructions(p.PatientID)
+	if err != nil {
+		return nil, err
+	}
+	// An amended prescription is checked against the patient's other prescriptions,
+	// not against its own previous version, and a refill replaces the earlier fills
+	// of the same original prescription.
+	seriesID := p.ID
+	if p.RefillOf != "" {
+		seriesID = p.RefillOf
+	}
+	active := []activeInstruction{}
+	for _, current := range stored {
+		if current.PrescriptionID != p.ID && (seriesID == "" || current.SeriesID != seriesID) {
+			active = append(active, current)
+		}
+	}
+
+	names := []string{}
+	for _, instr := range p.Instructions {
+		names = append(names, instr.DrugName)
+	}
+	for _, current := range active {
+		names = append(names, current.Instruction.DrugName)
+	}
+	catalog, err := loadDrugCatalog(names)
+	if err != nil {
+		return nil, err
+	}
+	if err := catalog.addClinicDrugs(p.ClinicID); err != nil {
+		return nil, err
+	}
+
+	profile, err := loadMedicalProfile(p.PatientID)
+	if err != nil {
+		return nil, err
+	}
+	profile = profile.Active()
+
+	patient, err := loadPatientMetrics(p.PatientID, p.Vitals)
+	if err != nil {
+		return nil, err
+	}
+
+	warnings := checkDuplicateTherapy(catalog, p.Instructions, active)
+
+	interactionWarnings, err := checkInteractions(catalog, p.Instructions, active)
+	if err != nil {
+		return nil, err
+	}
+	warnings = append(warnings, interactionWarnings...)
+	warnings = append(warnings, checkAllergies(catalog, p.Instructions, profile.Allergies)...)
+	warnings = append(warnings, checkContraindications(catalog, p.Instructions, profile.Conditions)...)
+	warnings = append(warnings, checkDoseRanges(catalog, p.Instructions, patient)...)
+
+	return warnings, nil
+}
+
+// checkAllergies flags drugs containing an ingredient the patient is allergic to, and
+// drugs in the same class as a recorded allergy (possible cross-sensitivity).
+func checkAllergies(catalog drugCatalog, instructions []models.DosageInstruction, allergies []models.PatientAllergy) []models.SafetyWarning {
+	warnings := []models.SafetyWarning{}
+
+	for _, instr := range instructions {
+		groups := catalog.groups(instr.DrugName)
+		for _, allergy := range allergies {
+			reaction := ""
+			if allergy.Reaction != "" {
+				reaction = fmt.Sprintf(" (reaction: %s)", allergy.Reaction)
+			}
+
+			if containsString(groups.Ingredients, allergy.Substance) {
+				warnings = append(warnings, models.SafetyWarning{
+					Type:     models.WarningAllergy,
+					Severity: models.SeverityContraindicated,
+					Drugs:    []string{instr.DrugName},
+					Message:  fmt.Sprintf("Patient is allergic to %s, an ingredient of %s%s.", allergy.Substance, instr.DrugName, reaction),
+				})
+			} else if groups.Class != "" && groups.Class == allergy.Substance {
+				warnings = append(warnings, models.SafetyWarning{
+					Type:     models.WarningAllergy,
+					Severity: models.SeverityMajor,
+					Drugs:    []string{instr.DrugName},
+					Message:  fmt.Sprintf("%s belongs to the %s class and the patient has a recorded %s allergy%s.", instr.DrugName, groups.Class, allergy.Substance, reaction),
+				})
+			}
+		}
+	}
+
+	return warnings
+}
+
+// checkContraindications flags drugs contraindicated in one of the patient's recorded conditions.
+func checkContraindications(catalog drugCatalog, instructions []models.DosageInstruction, conditions []models.PatientCondition) []models.SafetyWarning {
+	warnings := []models.SafetyWarning{}
+
+	for _, instr := range instructions {
+		groups := catalog.groups(instr.DrugName)
+		for _, condition := range conditions {
+			if containsString(groups.Contraindications, condition.Condition) {
+				warnings = append(warnings, models.SafetyWarning{
+					Type:     models.WarningContraindication,
+					Severity: models.SeverityContraindicated,
+					Drugs:    []string{instr.DrugName},
+					Message:  fmt.Sprintf("%s is contraindicated in %s.", instr.DrugName, strings.ReplaceAll(condition.Condition, "_", " ")),
+				})
+			}
+		}
+	}
+
+	return warnings
+}
+
+// requiresOverride reports whether any warning must be acknowledged by the doctor.
+func requiresOverride(warnings []models.SafetyWarning) bool {
+	for _, w := range warnings {
+		if w.RequiresOverride() {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString reports whether list contains s.
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -1,29 +1,135 @@
 package handlers
 
 import (
+	"database/sql"
 	"net/http"
-	"time"
+	"os"
+	"strings"
 	"github.com/gin-gonic/gin"
+	"Medibridge/go-api/models"
 	"Medibridge/go-api/utils"
 )
 
+// maxReportUploadBytes caps technical report uploads.
+const maxReportUploadBytes = 25 << 20
+
+// reportUploadTypes are the accepted technical report files. DICOM has no
+// signature http.DetectContentType knows, so it sniffs as generic binary.
+var reportUploadTypes = map[string][]string{
+	"pdf":  {"application/pdf"},
+	"jpg":  {"image/jpeg"},
+	"jpeg": {"image/jpeg"},
+	"png":  {"image/png"},
+	"dcm":  {"application/octet-stream"},
+}
+
+// reportStoragePath is where original technical reports are kept, under random names.
+func reportStoragePath() string {
+	if dir := os.Getenv("REPORT_STORAGE_PATH"); dir != "" {
+		return dir
+	}
+	return "/app/reports"
+}
+
+// reportUpload is what a report is filed under: the patient, and the referral it answers.
+type reportUpload struct {
+	PatientID         string
+	ScanType          string
+	ReferralID        string
+	ReferringClinicID string
+	Observations      []models.LabObservation // Structured lab results sent with the file
+}
+
+// resolveReportUpload reads the report's form fields. A report for a referral
+// takes its patient and referring clinic from the referral; otherwise (a walk-in
+// scan) 'patient_id' is required.
+func resolveReportUpload(c *gin.Context, u *upload, scanningID string) (reportUpload, error) {
+	meta := reportUpload{
+		PatientID:  strings.TrimSpace(u.formValue(c, "patient_id")),
+		ScanType:   strings.TrimSpace(u.formValue(c, "scan_type")),
+		ReferralID: strings.TrimSpace(u.formValue(c, "referral_id")),
+	}
+	var err error
+	if meta.Observations, err = parseLabObservationsField(u.formValue(c, "observations")); err != nil {
+		return meta, err
+	}
+
+	if meta.ReferralID == "" {
+		if meta.PatientID == "" {
+			return meta, &uploadError{Status: http.StatusBadRequest, Message: "Either 'referral_id' or 'patient_id' is required"}
+		}
+		exists, err := patientExists(meta.PatientID)
+		if err != nil {
+			return meta, err
+		}
+		if !exists {
+			return meta, &uploadError{Status: http.StatusNotFound, Message: "Patient not found"}
+		}
+		return meta, nil
+	}
+
+	r, err := loadReferral(meta.ReferralID)
+	if err == sql.ErrNoRows || (err == nil && r.ScanningCenterID != scanningID) {
+		return meta, &uploadError{Status: http.StatusNotFound, Message: "Referral not found"}
+	}
+	if err != nil {
+		return meta, err
+	}
+	if r.Status == models.ReferralDeclined || r.Status == models.ReferralCancelled {
+		return meta, &uploadError{Status: http.StatusConflict, Message: "Referral is " + r.Status}
+	}
+	if meta.PatientID != "" && meta.PatientID != r.PatientID {
+		return meta, &uploadError{Status: http.StatusBadRequest, Message: "'patient_id' does not match the referral"}
+	}
+	meta.PatientID = r.PatientID
+	meta.ReferringClinicID = r.ClinicID
+	if meta.ScanType == "" {
+		meta.ScanType = strings.Join(r.Tests, ", ")
+	}
+	return meta, nil
+}
+
 // UploadTechnicalReport handles POST /v1/scanning/reports/upload
-// Receives the original technical report file and metadata.
+// Receives the original technical report file and metadata: 'referral_id' for
+// a referred patient (the referring clinic is filled in from it), or
+// 'patient_id' for a walk-in scan, an optional 'scan_type' and optional
+// 'observations', the structured lab results as a JSON array. The fields must
+// come before the file in the form, or be sent as query parameters.
 func UploadTechnicalReport(c *gin.Context) {
 	scanningID := c.GetString("userID")
 	
-	// 1. Receive file and metadata (Patient ID, Type of Scan, Referring Doctor).
-	_, err := c.FormFile("report_file")
+	// 1. Receive file and metadata, storing the file under a random name.
+	var filename, storedPath string
+	var meta reportUpload
+	policy := uploadPolicy{Fields: []string{"report_file"}, MaxBytes: maxReportUploadBytes, Types: reportUploadTypes}
+	err := receiveUpload(c, policy, func(u *upload) error {
+		filename = u.Filename
+		var err error
+		if meta, err = resolveReportUpload(c, u, scanningID); err != nil {
+			return err
+		}
+		storedPath, err = u.saveTo(reportStoragePath())
+		return err
+	})
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Report file required in form data"})
+		respondUploadError(c, err, "Failed to save report file")
+		return
+	}
+
+	reportID, err := insertReport(meta, scanningID, storedPath)
+	if err != nil {
+		removeStoredFile(storedPath)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save report"})
 		return
 	}
-	// TODO: Securely save the file, update DB with file URL and metadata.
-	
-	reportID := "RPT_mock_" + time.Now().Format("060102150405")
 
 	// 2. Trigger internal gRPC call to Python AI Microservice.
-	if err := utils.TriggerReportProcessing(reportID, nil /* file data */); err != nil {
+	fileData, err := os.ReadFile(storedPath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Report saved, but could not be read back for processing."})
+		return
+	}
+	if err := utils.TriggerReportProcessing(reportID, fileData); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Report saved, but AI processing trigger failed."})
 		return
 	}
@@ -31,23 +137,158 @@ func UploadTechnicalReport(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Original Technical Report uploaded. AI processing initiated via gRPC.",
 		"report_id": reportID,
+		"filename": filename,
 		"scanning_center": scanningID,
+		"patient_id": meta.PatientID,
+		"referral_id": meta.ReferralID,
+		"referring_clinic_id": meta.ReferringClinicID,
+		"lab_result_count": len(meta.Observations),
 	})
 }
 
+// insertReport files an uploaded report with its lab results and completes the
+// referral it answers.
+func insertReport(meta reportUpload, scanningID, storedPath string) (string, error) {
+	tx, err := utils.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var reportID string
+	err = tx.QueryRow(`
+		INSERT INTO reports (patient_id, referring_clinic_id, scanning_center_id, referral_id, scan_type, original_file_url)
+		VALUES ($1, NULLIF($2, ''), $3, NULLIF($4, '')::uuid, NULLIF($5, ''), $6)
+		RETURNING id
+	`, meta.PatientID, meta.ReferringClinicID, scanningID, meta.ReferralID, meta.ScanType, storedPath).Scan(&reportID)
+	if err != nil {
+		return "", err
+	}
+	if err := insertLabObservations(tx, reportID, meta.PatientID, meta.Observations); err != nil {
+		return "", err
+	}
+	if meta.ReferralID != "" {
+		_, err = tx.Exec(`
+			UPDATE referrals SET status = 'completed', updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1 AND status IN ('pending', 'accepted')
+		`, meta.ReferralID)
+		if err != nil {
+			return "", err
+		}
+	}
+	return reportID, tx.Commit()
+}
+
 // FinalizeAndShareReport handles POST /v1/scanning/reports/:id/finalize
-// Triggers the critical multi-party sharing action.
+// Triggers the critical multi-party sharing action: the patient gets the
+// simplified summary in their app and the referring clinic gets the technical
+// original, each with a notification. An optional 'simplified_summary' replaces
+// the AI's. Finalizing again only reaches recipients added since.
 func FinalizeAndShareReport(c *gin.Context) {
-	reportID := c.Param("id")
-	
+	var req models.FinalizeReportRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+			return
+		}
+	}
+	scanningID := c.GetString("userID")
+
+	tx, err := utils.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var reportID, patientID, clinicID, summary, scanType, patientName, centerName string
+	err = tx.QueryRow(`
+		SELECT r.id, r.patient_id, COALESCE(r.referring_clinic_id, ''), COALESCE(r.simplified_summary, ''),
+			COALESCE(r.scan_type, ''), pu.name, COALESCE(sp.name, su.name)
+		FROM reports r
+		JOIN users pu ON pu.unique_user_id = r.patient_id
+		JOIN users su ON su.unique_user_id = r.scanning_center_id
+		LEFT JOIN organization_profiles sp ON sp.org_id = r.scanning_center_id
+		WHERE r.id::text = $1 AND r.scanning_center_id = $2
+		FOR UPDATE OF r
+	`, c.Param("id"), scanningID).Scan(&reportID, &patientID, &clinicID, &summary, &scanType, &patientName, &centerName)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch report"})
+		return
+	}
+	if s := strings.TrimSpace(req.SimplifiedSummary); s != "" {
+		summary = s
+	}
+	if summary == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "The simplified summary is not ready; wait for AI processing or send 'simplified_summary'"})
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE reports SET simplified_summary = $1, status = 'Shared' WHERE id = $2
+	`, summary, reportID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update report"})
+		return
+	}
+
 	// The Go API executes the multi-party sharing logic:
 	// 1. Push the Simplified Report to the Patient App.
 	// 2. Push the Original Technical Report to the referring Clinic App.
-	
-	// TODO: Implement PostgreSQL logic to update the report status to "Shared" and link the report to the appropriate Patient/Clinic IDs.
+	recipients := []models.ReportShare{{RecipientID: patientID, RecipientType: "patient", Access: models.ShareAccessSummary}}
+	if clinicID != "" {
+		recipients = append(recipients, models.ReportShare{RecipientID: clinicID, RecipientType: "clinic", Access: models.ShareAccessOriginal})
+	}
+	var delivered []models.ReportShare
+	for _, r := range recipients {
+		res, err := tx.Exec(`
+			INSERT INTO report_shares (report_id, recipient_id, recipient_type, access, shared_by)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (report_id, recipient_id) DO NOTHING
+		`, reportID, r.RecipientID, r.RecipientType, r.Access, scanningID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to share report"})
+			return
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			delivered = append(delivered, r)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to share report"})
+		return
+	}
+	translateForPatient(patientID, "report", reportID, models.TranslationFieldSummary, summary)
+
+	if scanType == "" {
+		scanType = "diagnostic"
+	}
+	for _, r := range delivered {
+		n := models.Notification{UserID: r.RecipientID, ResourceType: "report", ResourceID: reportID}
+		if r.RecipientType == "patient" {
+			n.Type = "report_ready"
+			n.Title = "Your " + scanType + " report is ready"
+			n.Message = centerName + " shared a simple explanation of your report."
+		} else {
+			n.Type = "report_received"
+			n.Title = "Report received for " + patientName
+			n.Message = centerName + " sent the " + scanType + " report of " + patientName + " (" + patientID + ")."
+		}
+		notifyUser(n)
+	}
 
+	shares, err := loadReportShares(reportID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch report shares"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Report finalized and multi-party sharing executed successfully.",
 		"report_id": reportID,
+		"shares": shares,
 	})
 }
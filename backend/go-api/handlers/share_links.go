@@ -0,0 +1,485 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"Medibridge/go-api/models"
+	"Medibridge/go-api/utils"
+)
+
+// Limits of a share link.
+const (
+	defaultShareLinkHours = 72
+	maxShareLinkHours     = 30 * 24
+	maxShareLinkViews     = 100
+	maxSharePINAttempts   = 5 // Wrong PINs before the link locks
+)
+
+// sharePINPattern matches an acceptable share link PIN.
+var sharePINPattern = regexp.MustCompile(`^[0-9]{4,8}$`)
+
+// shareLinkColumns is the column list read by scanShareLink.
+const shareLinkColumns = `id, patient_id, created_by, resource_type, resource_id, COALESCE(label, ''),
+	COALESCE(pin_hash, ''), failed_pin_attempts, max_views, view_count, expires_at, revoked_at,
+	COALESCE(revoked_reason, ''), created_at`
+
+// shareLink is a share link row with the fields kept from the patient.
+type shareLink struct {
+	models.ShareLink
+	PINHash       string
+	FailedPINs    int
+	RevokedReason string
+	ExpiresAtTime time.Time
+}
+
+// scanShareLink reads one row selected with shareLinkColumns and derives its status.
+func scanShareLink(row rowScanner) (shareLink, error) {
+	var l shareLink
+	var createdAt time.Time
+	var revokedAt sql.NullTime
+	err := row.Scan(&l.ID, &l.PatientID, &l.CreatedBy, &l.ResourceType, &l.ResourceID, &l.Label,
+		&l.PINHash, &l.FailedPINs, &l.MaxViews, &l.ViewCount, &l.ExpiresAtTime, &revokedAt,
+		&l.RevokedReason, &createdAt)
+	if err != nil {
+		return l, err
+	}
+	l.PINProtected = l.PINHash != ""
+	l.ExpiresAt = l.ExpiresAtTime.Unix()
+	l.CreatedAt = createdAt.Unix()
+	if revokedAt.Valid {
+		l.RevokedAt = revokedAt.Time.Unix()
+	}
+
+	switch {
+	case revokedAt.Valid && l.RevokedReason == models.ShareLinkLocked:
+		l.Status = models.ShareLinkLocked
+	case revokedAt.Valid:
+		l.Status = models.ShareLinkRevoked
+	case !time.Now().Before(l.ExpiresAtTime):
+		l.Status = models.ShareLinkExpired
+	case l.MaxViews > 0 && l.ViewCount >= l.MaxViews:
+		l.Status = models.ShareLinkUsedUp
+	default:
+		l.Status = models.ShareLinkActive
+	}
+	return l, nil
+}
+
+// shareLinkURL returns the public URL of a share link, carrying its signed token.
+func shareLinkURL(l shareLink) (string, error) {
+	token, err := utils.SignShareLink(l.ID, l.ExpiresAtTime)
+	if err != nil {
+		return "", err
+	}
+	return publicAPIURL() + "/v1/shared/" + token, nil
+}
+
+// recordShareLinkAccess records an access to the share link linkID, or to no
+// link for a token that is not ours.
+func recordShareLinkAccess(db execer, c *gin.Context, linkID, outcome, format string) error {
+	_, err := db.Exec(`
+		INSERT INTO share_link_accesses (link_id, outcome, format, ip_address, user_agent)
+		VALUES (NULLIF($1, ''), $2, $3, $4, $5)
+	`, linkID, outcome, format, c.ClientIP(), c.Request.UserAgent())
+	return err
+}
+
+// patientShareableResource reports whether the patient can share the resource:
+// a report shared with them, or one of their issued prescriptions.
+func patientShareableResource(patientID, resourceType, resourceID string) (bool, error) {
+	var exists bool
+	var err error
+	switch resourceType {
+	case models.ShareResourceReport:
+		err = utils.DB.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM report_shares WHERE report_id::text = $1 AND recipient_id = $2)
+		`, resourceID, patientID).Scan(&exists)
+	case models.ShareResourcePrescription:
+		err = utils.DB.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM prescriptions WHERE id::text = $1 AND patient_id = $2 AND status <> $3)
+		`, resourceID, patientID, models.PrescriptionDraft).Scan(&exists)
+	}
+	return exists, err
+}
+
+// CreateShareLink handles POST /v1/patient/share-links
+// Creates a time-limited link to one of the patient's reports or prescriptions
+// for someone who is not on MediBridge, optionally protected by a PIN and
+// limited to a number of views. The URL is returned with the link.
+func CreateShareLink(c *gin.Context) {
+	var req models.CreateShareLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request; 'resource_type' and 'resource_id' are required"})
+		return
+	}
+	req.ResourceType = strings.ToLower(strings.TrimSpace(req.ResourceType))
+	if req.ResourceType != models.ShareResourceReport && req.ResourceType != models.ShareResourcePrescription {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'resource_type'; expected report or prescription"})
+		return
+	}
+	if req.ExpiresInHours == 0 {
+		req.ExpiresInHours = defaultShareLinkHours
+	}
+	if req.ExpiresInHours < 1 || req.ExpiresInHours > maxShareLinkHours {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'expires_in_hours'; expected 1 to 720 hours"})
+		return
+	}
+	if req.MaxViews < 0 || req.MaxViews > maxShareLinkViews {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'max_views'; expected 0 (no limit) to 100"})
+		return
+	}
+	if req.PIN != "" && !sharePINPattern.MatchString(req.PIN) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'pin'; expected 4 to 8 digits"})
+		return
+	}
+	req.Label = strings.TrimSpace(req.Label)
+	if len(req.Label) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'label'; expected at most 100 characters"})
+		return
+	}
+
+	patientID := c.GetString("userID")
+	ok, err := patientShareableResource(patientID, req.ResourceType, req.ResourceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No such " + req.ResourceType + " to share"})
+		return
+	}
+
+	id, err := utils.NewShareLinkID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create share link"})
+		return
+	}
+	var pinHash string
+	if req.PIN != "" {
+		if pinHash, err = utils.HashSharePIN(id, req.PIN); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create share link"})
+			return
+		}
+	}
+	// Whole seconds, as the token carries the expiry
+	expiresAt := time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour).Truncate(time.Second)
+
+	link, err := scanShareLink(utils.DB.QueryRow(`
+		INSERT INTO share_links (id, patient_id, created_by, resource_type, resource_id, label, pin_hash, max_views, expires_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), $8, $9)
+		RETURNING `+shareLinkColumns,
+		id, patientID, patientAccountOf(c), req.ResourceType, req.ResourceID, req.Label, pinHash, req.MaxViews, expiresAt))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create share link"})
+		return
+	}
+	if link.URL, err = shareLinkURL(link); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create share link"})
+		return
+	}
+	c.JSON(http.StatusCreated, link.ShareLink)
+}
+
+// ListShareLinks handles GET /v1/patient/share-links
+// Returns the patient's share links, newest first. Links that can still be
+// opened come with their URL.
+func ListShareLinks(c *gin.Context) {
+	rows, err := utils.DB.Query(`
+		SELECT `+shareLinkColumns+` FROM share_links
+		WHERE patient_id = $1
+		ORDER BY created_at DESC
+	`, c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch share links"})
+		return
+	}
+	defer rows.Close()
+
+	links := []models.ShareLink{}
+	for rows.Next() {
+		link, err := scanShareLink(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch share links"})
+			return
+		}
+		if link.Status == models.ShareLinkActive {
+			if link.URL, err = shareLinkURL(link); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch share links"})
+				return
+			}
+		}
+		links = append(links, link.ShareLink)
+	}
+	c.JSON(http.StatusOK, links)
+}
+
+// RevokeShareLink handles DELETE /v1/patient/share-links/:id
+// Revokes a share link at once; revoking it again changes nothing.
+func RevokeShareLink(c *gin.Context) {
+	link, err := scanShareLink(utils.DB.QueryRow(`
+		UPDATE share_links
+		SET revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP), revoked_reason = COALESCE(revoked_reason, 'patient')
+		WHERE id = $1 AND patient_id = $2
+		RETURNING `+shareLinkColumns,
+		c.Param("id"), c.GetString("userID")))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke share link"})
+		return
+	}
+	c.JSON(http.StatusOK, link.ShareLink)
+}
+
+// GetShareLinkAccesses handles GET /v1/patient/share-links/:id/accesses
+// Returns every access to a share link, newest first, including refused ones.
+func GetShareLinkAccesses(c *gin.Context) {
+	var linkID string
+	err := utils.DB.QueryRow(`
+		SELECT id FROM share_links WHERE id = $1 AND patient_id = $2
+	`, c.Param("id"), c.GetString("userID")).Scan(&linkID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch share link"})
+		return
+	}
+
+	rows, err := utils.DB.Query(`
+		SELECT id, outcome, format, COALESCE(ip_address, ''), COALESCE(user_agent, ''), accessed_at
+		FROM share_link_accesses
+		WHERE link_id = $1
+		ORDER BY accessed_at DESC, id DESC
+	`, linkID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch share link accesses"})
+		return
+	}
+	defer rows.Close()
+
+	accesses := []models.ShareLinkAccess{}
+	for rows.Next() {
+		var a models.ShareLinkAccess
+		var accessedAt time.Time
+		if err := rows.Scan(&a.ID, &a.Outcome, &a.Format, &a.IPAddress, &a.UserAgent, &accessedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch share link accesses"})
+			return
+		}
+		a.AccessedAt = accessedAt.Unix()
+		accesses = append(accesses, a)
+	}
+	c.JSON(http.StatusOK, accesses)
+}
+
+// shareLinkRefusals are the responses to a share link access that was not let through.
+var shareLinkRefusals = map[string]struct {
+	status int
+	msg    string
+}{
+	models.LinkAccessPINRequired: {http.StatusUnauthorized, "This link is protected by a PIN; send it in the X-Share-PIN header"},
+	models.LinkAccessWrongPIN:    {http.StatusUnauthorized, "Incorrect PIN"},
+	models.LinkAccessLocked:      {http.StatusGone, "This link was locked after too many incorrect PINs"},
+	models.LinkAccessExpired:     {http.StatusGone, "This link has expired"},
+	models.LinkAccessUsedUp:      {http.StatusGone, "This link has reached its view limit"},
+	models.LinkAccessRevoked:     {http.StatusGone, "This link was revoked by the patient"},
+}
+
+// openShareLink checks the token in :token and the PIN presented with it,
+// counts the view and records the access, whatever its outcome. It responds
+// itself when the access is refused.
+func openShareLink(c *gin.Context, format string) (shareLink, bool) {
+	c.Header("Cache-Control", "no-store")
+
+	id, err := utils.ParseShareLink(c.Param("token"))
+	if err != nil && err != utils.ErrShareLinkExpired {
+		if err := recordShareLinkAccess(utils.DB, c, "", models.LinkAccessInvalid, format); err != nil {
+			log.Printf("Warning: Could not record share link access: %v", err)
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
+		return shareLink{}, false
+	}
+	tokenExpired := err == utils.ErrShareLinkExpired
+
+	tx, err := utils.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return shareLink{}, false
+	}
+	defer tx.Rollback()
+
+	link, err := scanShareLink(tx.QueryRow(`SELECT `+shareLinkColumns+` FROM share_links WHERE id = $1 FOR UPDATE`, id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
+		return link, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch share link"})
+		return link, false
+	}
+	if format == "pdf" && link.ResourceType != models.ShareResourcePrescription {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Only shared prescriptions have a PDF"})
+		return link, false
+	}
+
+	pin := c.GetHeader("X-Share-PIN")
+	if pin == "" {
+		pin = c.Query("pin") // For links opened in a browser
+	}
+
+	outcome := models.LinkAccessViewed
+	switch {
+	case link.Status == models.ShareLinkLocked:
+		outcome = models.LinkAccessLocked
+	case link.Status == models.ShareLinkRevoked:
+		outcome = models.LinkAccessRevoked
+	case link.Status == models.ShareLinkExpired || tokenExpired:
+		outcome = models.LinkAccessExpired
+	case link.Status == models.ShareLinkUsedUp:
+		outcome = models.LinkAccessUsedUp
+	case link.PINProtected && pin == "":
+		outcome = models.LinkAccessPINRequired
+	case link.PINProtected && !utils.CheckSharePIN(link.ID, pin, link.PINHash):
+		outcome = models.LinkAccessWrongPIN
+		if link.FailedPINs+1 >= maxSharePINAttempts {
+			outcome = models.LinkAccessLocked
+		}
+	}
+
+	switch outcome {
+	case models.LinkAccessViewed:
+		_, err = tx.Exec(`UPDATE share_links SET view_count = view_count + 1 WHERE id = $1`, link.ID)
+		link.ViewCount++
+	case models.LinkAccessWrongPIN:
+		_, err = tx.Exec(`UPDATE share_links SET failed_pin_attempts = failed_pin_attempts + 1 WHERE id = $1`, link.ID)
+	case models.LinkAccessLocked:
+		_, err = tx.Exec(`
+			UPDATE share_links
+			SET failed_pin_attempts = failed_pin_attempts + 1,
+				revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP), revoked_reason = COALESCE(revoked_reason, $2)
+			WHERE id = $1
+		`, link.ID, models.ShareLinkLocked)
+	}
+	if err == nil {
+		err = recordShareLinkAccess(tx, c, link.ID, outcome, format)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open share link"})
+		return link, false
+	}
+
+	if refusal, refused := shareLinkRefusals[outcome]; refused {
+		resp := gin.H{"error": refusal.msg}
+		if outcome == models.LinkAccessWrongPIN {
+			resp["attempts_left"] = maxSharePINAttempts - link.FailedPINs - 1
+		}
+		c.JSON(refusal.status, resp)
+		return link, false
+	}
+	return link, true
+}
+
+// OpenShareLink handles GET /v1/shared/:token
+// Public, read-only view of the one document a patient shared through a link:
+// a report's simplified summary or a prescription. A PIN, if the link has one,
+// is sent in the X-Share-PIN header (or ?pin=). Every access counts as a view
+// and is recorded for the patient.
+func OpenShareLink(c *gin.Context) {
+	link, ok := openShareLink(c, "json")
+	if !ok {
+		return
+	}
+
+	doc := models.SharedDocument{
+		ResourceType: link.ResourceType,
+		Label:        link.Label,
+		ExpiresAt:    link.ExpiresAt,
+		MaxViews:     link.MaxViews,
+		ViewCount:    link.ViewCount,
+	}
+	langs, ok := requestedLanguages(c, "") // The viewer's, not the patient's
+	if !ok {
+		return
+	}
+	switch link.ResourceType {
+	case models.ShareResourceReport:
+		// The patient's own share decides what they can pass on
+		sr, err := scanSharedReport(utils.DB.QueryRow(`
+			SELECT `+sharedReportColumns+sharedReportTables+`
+			WHERE s.report_id::text = $1 AND s.recipient_id = $2
+		`, link.ResourceID, link.PatientID))
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "The shared report is no longer available"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch report"})
+			return
+		}
+		sr.Report.SharedAt, sr.Report.ReadAt = 0, 0 // The patient's, not the viewer's
+		if sr.Report.LabResults, err = loadReportObservations(sr.Report.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lab results"})
+			return
+		}
+		if err := localizeReport(&sr.Report, langs); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch translations"})
+			return
+		}
+		doc.PatientName = sr.Report.PatientName
+		doc.Report = &sr.Report
+
+	case models.ShareResourcePrescription:
+		p, err := loadPrescription(link.ResourceID)
+		if err == sql.ErrNoRows || (err == nil && p.PatientID != link.PatientID) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "The shared prescription is no longer available"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch prescription"})
+			return
+		}
+		if err := utils.DB.QueryRow(`SELECT name FROM users WHERE unique_user_id = $1`, p.PatientID).Scan(&doc.PatientName); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch patient"})
+			return
+		}
+		if err := localizePrescription(&p, langs); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch translations"})
+			return
+		}
+		doc.Prescription = &p
+		doc.PDFURL = publicAPIURL() + "/v1/shared/" + c.Param("token") + "/pdf"
+	}
+	c.JSON(http.StatusOK, doc)
+}
+
+// GetSharedPrescriptionPDF handles GET /v1/shared/:token/pdf
+// Downloads the PDF of a prescription shared through a link. It counts as a
+// view like opening the link.
+func GetSharedPrescriptionPDF(c *gin.Context) {
+	link, ok := openShareLink(c, "pdf")
+	if !ok {
+		return
+	}
+	p, err := loadPrescription(link.ResourceID)
+	if err == sql.ErrNoRows || (err == nil && p.PatientID != link.PatientID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "The shared prescription is no longer available"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch prescription"})
+		return
+	}
+	respondPrescriptionPDF(c, p)
+}
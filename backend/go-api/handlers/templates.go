@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"Medibridge/go-api/models"
+	"Medibridge/go-api/utils"
+)
+
+// templateColumns is the column list read by scanTemplate.
+const templateColumns = `id, clinic_id, name, COALESCE(diagnosis, ''), instructions, created_at, updated_at`
+
+// scanTemplate reads one row selected with templateColumns.
+func scanTemplate(row rowScanner) (models.PrescriptionTemplate, error) {
+	var template models.PrescriptionTemplate
+	var instructions []byte
+	var createdAt, updatedAt time.Time
+
+	err := row.Scan(&template.ID, &template.ClinicID, &template.Name, &template.Diagnosis,
+		&instructions, &createdAt, &updatedAt)
+	if err != nil {
+		return template, err
+	}
+	if err := json.Unmarshal(instructions, &template.Instructions); err != nil {
+		return template, err
+	}
+	template.CreatedAt = createdAt.Unix()
+	template.UpdatedAt = updatedAt.Unix()
+	return template, nil
+}
+
+// loadTemplate fetches one of the clinic's templates by the :id URL parameter,
+// writing the error response itself when it cannot.
+func loadTemplate(c *gin.Context) (models.PrescriptionTemplate, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID"})
+		return models.PrescriptionTemplate{}, false
+	}
+
+	template, err := scanTemplate(utils.DB.QueryRow(
+		`SELECT `+templateColumns+` FROM prescription_templates WHERE id = $1 AND clinic_id = $2`,
+		id, c.GetString("userID"),
+	))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return template, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch template"})
+		return template, false
+	}
+	return template, true
+}
+
+// bindTemplate reads and validates a template from the request body.
+func bindTemplate(c *gin.Context) (models.PrescriptionTemplate, bool) {
+	var template models.PrescriptionTemplate
+	if err := c.ShouldBindJSON(&template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template data format; 'name' and 'instructions' are required"})
+		return template, false
+	}
+
+	template.Name = strings.TrimSpace(template.Name)
+	if template.Name == "" || len(template.Instructions) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A template needs a name and at least one instruction"})
+		return template, false
+	}
+	for _, instr := range template.Instructions {
+		if strings.TrimSpace(instr.DrugName) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Every instruction needs a drug_name"})
+			return template, false
+		}
+	}
+	return template, true
+}
+
+// isUniqueViolation reports whether err is a unique constraint violation.
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23505"
+}
+
+// ListPrescriptionTemplates handles GET /v1/clinic/templates
+// Returns the clinic's saved favorite prescriptions, by name.
+func ListPrescriptionTemplates(c *gin.Context) {
+	rows, err := utils.DB.Query(
+		`SELECT `+templateColumns+` FROM prescription_templates WHERE clinic_id = $1 ORDER BY name`,
+		c.GetString("userID"),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch templates"})
+		return
+	}
+	defer rows.Close()
+
+	templates := []models.PrescriptionTemplate{}
+	for rows.Next() {
+		template, err := scanTemplate(rows)
+		if err != nil {
+			continue
+		}
+		templates = append(templates, template)
+	}
+
+	c.JSON(http.StatusOK, templates)
+}
+
+// CreatePrescriptionTemplate handles POST /v1/clinic/templates
+// Saves a favorite prescription, e.g., "Adult URTI" with amoxicillin and paracetamol.
+func CreatePrescriptionTemplate(c *gin.Context) {
+	template, ok := bindTemplate(c)
+	if !ok {
+		return
+	}
+	template.ClinicID = c.GetString("userID")
+
+	instructions, err := json.Marshal(template.Instructions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid instructions"})
+		return
+	}
+
+	var createdAt time.Time
+	err = utils.DB.QueryRow(`
+		INSERT INTO prescription_templates (clinic_id, name, diagnosis, instructions)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`, template.ClinicID, template.Name, template.Diagnosis, instructions).Scan(&template.ID, &createdAt)
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A template with this name already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save template"})
+		return
+	}
+	template.CreatedAt = createdAt.Unix()
+	template.UpdatedAt = template.CreatedAt
+
+	c.JSON(http.StatusCreated, template)
+}
+
+// UpdatePrescriptionTemplate handles PUT /v1/clinic/templates/:id
+// Replaces the template's name, diagnosis and instructions.
+func UpdatePrescriptionTemplate(c *gin.Context) {
+	existing, ok := loadTemplate(c)
+	if !ok {
+		return
+	}
+	template, ok := bindTemplate(c)
+	if !ok {
+		return
+	}
+	template.ID = existing.ID
+	template.ClinicID = existing.ClinicID
+	template.CreatedAt = existing.CreatedAt
+
+	instructions, err := json.Marshal(template.Instructions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid instructions"})
+		return
+	}
+
+	var updatedAt time.Time
+	err = utils.DB.QueryRow(`
+		UPDATE prescription_templates
+		SET name = $1, diagnosis = $2, instructions = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4 AND clinic_id = $5
+		RETURNING updated_at
+	`, template.Name, template.Diagnosis, instructions, template.ID, template.ClinicID).Scan(&updatedAt)
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A template with this name already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update template"})
+		return
+	}
+	template.UpdatedAt = updatedAt.Unix()
+
+	c.JSON(http.StatusOK, template)
+}
+
+// DeletePrescriptionTemplate handles DELETE /v1/clinic/templates/:id
+func DeletePrescriptionTemplate(c *gin.Context) {
+	template, ok := loadTemplate(c)
+	if !ok {
+		return
+	}
+
+	if _, err := utils.DB.Exec(`DELETE FROM prescription_templates WHERE id = $1`, template.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete template"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Template deleted"})
+}
+
+// InstantiatePrescriptionTemplate handles POST /v1/clinic/templates/:id/instantiate
+// Turns a template into a draft prescription for the patient in the body
+// ({"patient_id": ...}), ready for the doctor to adjust and issue via
+// /v1/clinic/prescriptions/drafts/:id. Drugs the clinic has since disabled in its
+// formulary are listed in unavailable_drugs. The clinic must already care for the patient.
+func InstantiatePrescriptionTemplate(c *gin.Context) {
+	var req struct {
+		PatientID string `json:"patient_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "patient_id is required"})
+		return
+	}
+
+	template, ok := loadTemplate(c)
+	if !ok {
+		return
+	}
+
+	if !requireClinicCare(c, req.PatientID) {
+		return
+	}
+
+	formulary, err := loadClinicFormulary(template.ClinicID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch formulary"})
+		return
+	}
+	unavailable := []string{}
+	for _, instr := range template.Instructions {
+		if !formulary.allows(instr.DrugName) {
+			unavailable = append(unavailable, instr.DrugName)
+		}
+	}
+
+	prescription := models.Prescription{
+		PatientID:    req.PatientID,
+		ClinicID:     template.ClinicID,
+		Diagnosis:    template.Diagnosis,
+		Vitals:       map[string]string{},
+		Instructions: template.Instructions,
+		Status:       models.PrescriptionDraft,
+	}
+	if err := insertPrescription(&prescription); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save draft"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":           "Draft prescription created from template " + template.Name,
+		"template_id":       template.ID,
+		"prescription_id":   prescription.ID,
+		"prescription":      prescription,
+		"unavailable_drugs": unavailable,
+	})
+}
@@ -0,0 +1,708 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"Medibridge/go-api/models"
+	"Medibridge/go-api/utils"
+)
+
+// languageCodePattern matches a language code, e.g., "hi" or "pt-br".
+var languageCodePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})?$`)
+
+// normalizeLanguage lowercases a language tag, e.g., "hi_IN" to "hi-in". It
+// returns "" for anything that is not a language code.
+func normalizeLanguage(tag string) string {
+	lang := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	if !languageCodePattern.MatchString(lang) {
+		return ""
+	}
+	return lang
+}
+
+// sourceHash fingerprints the English text a translation was made from.
+func sourceHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// prescriptionSourceText is the English text of a prescription that is
+// translated for the patient: one line per drug they still take, e.g.,
+// "Paracetamol 500 mg Tablet: 1 Tablet, Morning, Night, After Food, 5 days".
+func prescriptionSourceText(p models.Prescription) string {
+	var lines []string
+	for _, instr := range p.Instructions {
+		if instr.Discontinued {
+			continue
+		}
+		var parts []string
+		for _, part := range []string{instr.DosageQuantity, instr.Frequency, instr.TimingRelation} {
+			if part = strings.TrimSpace(part); part != "" {
+				parts = append(parts, part)
+			}
+		}
+		if strings.TrimSpace(instr.TimingRelation) != "" && instr.TimeOffset > 0 {
+			parts[len(parts)-1] += " (" + strconv.Itoa(instr.TimeOffset) + " min)"
+		}
+		parts = append(parts, strings.ToLower(durationText(instr.DurationDays)))
+		line := strings.Join(strings.Fields(instr.DrugName+" "+instr.Strength+" "+instr.DrugType), " ") + ": " +
+			strings.Join(parts, ", ")
+		if note := strings.TrimSpace(instr.PatientNote); note != "" {
+			line += ". " + note
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// acceptLanguages returns the languages of an Accept-Language header, most
+// preferred first, e.g., "hi-IN,hi;q=0.9,en;q=0.8" gives hi-in, hi and en.
+func acceptLanguages(header string) []string {
+	type weighted struct {
+		lang string
+		q    float64
+	}
+	var langs []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if lang := normalizeLanguage(tag); lang != "" && q > 0 {
+			langs = append(langs, weighted{lang, q})
+		}
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+
+	result := make([]string, len(langs))
+	for i, l := range langs {
+		result[i] = l.lang
+	}
+	return result
+}
+
+// requestedLanguages returns the languages to show patient-facing text in, in
+// order: the 'lang' query parameter, the patient's preferred language (when
+// patientID is set), then the Accept-Language header. A regional language is
+// followed by its base language, e.g., "hi-in" by "hi". It writes the error
+// response itself when it fails.
+func requestedLanguages(c *gin.Context, patientID string) ([]string, bool) {
+	var langs []string
+	add := func(lang string) {
+		base, _, _ := strings.Cut(lang, "-")
+		for _, l := range []string{lang, base} {
+			if !containsString(langs, l) {
+				langs = append(langs, l)
+			}
+		}
+	}
+
+	if tag := c.Query("lang"); tag != "" {
+		lang := normalizeLanguage(tag)
+		if lang == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'lang'; expected a language code, e.g., hi"})
+			return nil, false
+		}
+		add(lang)
+	}
+	if patientID != "" {
+		preferred, err := preferredLanguage(patientID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch patient preferences"})
+			return nil, false
+		}
+		if preferred != "" {
+			add(preferred)
+		}
+	}
+	for _, lang := range acceptLanguages(c.GetHeader("Accept-Language")) {
+		add(lang)
+	}
+	return langs, true
+}
+
+// preferredLanguage returns the language a patient chose for their profile,
+// or "" for English.
+func preferredLanguage(patientID string) (string, error) {
+	var lang sql.NullString
+	err := utils.DB.QueryRow(`SELECT preferred_language FROM users WHERE unique_user_id = $1`, patientID).Scan(&lang)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return lang.String, err
+}
+
+// storedTranslation is a ready translation with the hash of its source.
+type storedTranslation struct {
+	Text, SourceHash, TranslatedBy string
+}
+
+// readyTranslations loads the ready translations of one field of several
+// resources, by resource ID and language.
+func readyTranslations(resourceType, field string, resourceIDs []string) (map[string]map[string]storedTranslation, error) {
+	found := map[string]map[string]storedTranslation{}
+	if len(resourceIDs) == 0 {
+		return found, nil
+	}
+	rows, err := utils.DB.Query(`
+		SELECT resource_id, language, text, source_hash, COALESCE(translated_by, '') FROM translations
+		WHERE resource_type = $1 AND field = $2 AND resource_id::text = ANY($3) AND status = 'ready'
+	`, resourceType, field, pq.Array(resourceIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, lang string
+		var t storedTranslation
+		if err := rows.Scan(&id, &lang, &t.Text, &t.SourceHash, &t.TranslatedBy); err != nil {
+			return nil, err
+		}
+		if found[id] == nil {
+			found[id] = map[string]storedTranslation{}
+		}
+		found[id][lang] = t
+	}
+	return found, rows.Err()
+}
+
+// pickTranslation returns the first requested language with a translation of
+// the current source. It gives up at English, the language of the source.
+func pickTranslation(translations map[string]storedTranslation, langs []string, source string) (string, string, bool) {
+	hash := sourceHash(source)
+	for _, lang := range langs {
+		if lang == models.SourceLanguage {
+			break
+		}
+		if t, ok := translations[lang]; ok && t.SourceHash == hash {
+			return lang, t.Text, true
+		}
+	}
+	return "", "", false
+}
+
+// localizePrescriptions sets TranslatedText to the instructions in the first
+// requested language that has a translation or narration templates. The AI's
+// translations are cross-checked against the instructions and replaced by the
+// templates' narration when they do not match. Without any, prescriptions keep
+// their legacy translated_text (also written by the AI) if it passes the same
+// cross-check, or else get the English narration.
+func localizePrescriptions(prescriptions []models.Prescription, langs []string) error {
+	ids := make([]string, len(prescriptions))
+	for i, p := range prescriptions {
+		ids[i] = p.ID
+	}
+	found := map[string]map[string]storedTranslation{}
+	if len(langs) > 0 {
+		var err error
+		if found, err = readyTranslations("prescription", models.TranslationFieldInstructions, ids); err != nil {
+			return err
+		}
+	}
+	for i := range prescriptions {
+		p := &prescriptions[i]
+		if lang, text, ok := localizedInstructions(*p, found[p.ID], langs); ok {
+			p.TranslatedText, p.TranslationLanguage = text, lang
+		} else if !legacyTranslationMatches(*p) {
+			p.TranslatedText, _ = narratePrescription(*p, models.SourceLanguage)
+			p.TranslationLanguage = ""
+			if p.TranslatedText != "" {
+				p.TranslationLanguage = models.SourceLanguage
+			}
+		}
+	}
+	return nil
+}
+
+// legacyTranslationMatches reports whether a prescription has a legacy
+// translated_text that matches its instructions.
+func legacyTranslationMatches(p models.Prescription) bool {
+	if p.TranslatedText == "" {
+		return false
+	}
+	if mismatches := narrationMismatches(p, p.TranslatedText); len(mismatches) > 0 {
+		log.Printf("Warning: legacy translation of prescription %s does not match its instructions (%s); using the English narration",
+			p.ID, strings.Join(mismatches, ", "))
+		return false
+	}
+	return true
+}
+
+// localizedInstructions picks the instructions of a prescription in the first
+// requested language before English that has a current translation or
+// narration templates.
+func localizedInstructions(p models.Prescription, translations map[string]storedTranslation, langs []string) (string, string, bool) {
+	hash := sourceHash(prescriptionSourceText(p))
+	for _, lang := range langs {
+		if lang == models.SourceLanguage {
+			break
+		}
+		if t, ok := translations[lang]; ok && t.SourceHash == hash {
+			if t.TranslatedBy != translatedByAI {
+				return lang, t.Text, true // Written by the doctor
+			}
+			mismatches := narrationMismatches(p, t.Text)
+			if len(mismatches) == 0 {
+				return lang, t.Text, true
+			}
+			log.Printf("Warning: AI %s translation of prescription %s does not match its instructions (%s); using the templates",
+				lang, p.ID, strings.Join(mismatches, ", "))
+		}
+		if text, ok := narratePrescription(p, lang); ok {
+			return lang, text, true
+		}
+	}
+	return "", "", false
+}
+
+// localizePrescription localizes a single prescription, see localizePrescriptions.
+func localizePrescription(p *models.Prescription, langs []string) error {
+	prescriptions := []models.Prescription{*p}
+	if err := localizePrescriptions(prescriptions, langs); err != nil {
+		return err
+	}
+	*p = prescriptions[0]
+	return nil
+}
+
+// localizeReports replaces simplified summaries with their translation into
+// the first requested language that has one; the others stay in English.
+func localizeReports(reports []models.Report, langs []string) error {
+	ids := make([]string, len(reports))
+	for i, r := range reports {
+		ids[i] = r.ID
+	}
+	found := map[string]map[string]storedTranslation{}
+	if len(langs) > 0 {
+		var err error
+		if found, err = readyTranslations("report", models.TranslationFieldSummary, ids); err != nil {
+			return err
+		}
+	}
+	for i := range reports {
+		r := &reports[i]
+		if r.SimplifiedSummary == "" {
+			continue
+		}
+		r.SummaryLanguage = models.SourceLanguage
+		if lang, text, ok := pickTranslation(found[r.ID], langs, r.SimplifiedSummary); ok {
+			r.SimplifiedSummary, r.SummaryLanguage = text, lang
+		}
+	}
+	return nil
+}
+
+// localizeReport localizes a single report, see localizeReports.
+func localizeReport(r *models.Report, langs []string) error {
+	reports := []models.Report{*r}
+	if err := localizeReports(reports, langs); err != nil {
+		return err
+	}
+	*r = reports[0]
+	return nil
+}
+
+// translatedByAI marks translations the AI service wrote.
+const translatedByAI = "ai"
+
+// translatedByTemplates marks narrations rendered from the narration templates.
+const translatedByTemplates = "templates"
+
+// translationColumns is the column list read by scanTranslation.
+const translationColumns = `resource_type, resource_id, field, language, COALESCE(text, ''), source_hash, status,
+	COALESCE(translated_by, ''), updated_at`
+
+// scanTranslation reads one row selected with translationColumns. Current
+// tells whether it was made from source, the resource's current text.
+func scanTranslation(row rowScanner, source string) (models.Translation, error) {
+	var t models.Translation
+	var hash string
+	var updatedAt time.Time
+	err := row.Scan(&t.ResourceType, &t.ResourceID, &t.Field, &t.Language, &t.Text, &hash, &t.Status,
+		&t.TranslatedBy, &updatedAt)
+	t.Current = hash == sourceHash(source)
+	t.UpdatedAt = updatedAt.Unix()
+	return t, err
+}
+
+// loadTranslations returns the translations of one field of a resource in
+// every language, ready or not.
+func loadTranslations(resourceType, resourceID, field, source string) ([]models.Translation, error) {
+	rows, err := utils.DB.Query(`
+		SELECT `+translationColumns+` FROM translations
+		WHERE resource_type = $1 AND resource_id::text = $2 AND field = $3
+		ORDER BY language
+	`, resourceType, resourceID, field)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	translations := []models.Translation{}
+	for rows.Next() {
+		t, err := scanTranslation(rows, source)
+		if err != nil {
+			return nil, err
+		}
+		translations = append(translations, t)
+	}
+	return translations, rows.Err()
+}
+
+// requestTranslation asks the AI service to translate a field into lang, unless
+// a translation of the current source is ready or on its way. Pending
+// translations are triggered again, in case the AI service was unavailable;
+// requestedBy is "" when no one asked (the patient's preferred language).
+func requestTranslation(resourceType, resourceID, field, lang, source, requestedBy string) (models.Translation, error) {
+	t, err := scanTranslation(utils.DB.QueryRow(`
+		INSERT INTO translations (resource_type, resource_id, field, language, source_hash, requested_by)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
+		ON CONFLICT (resource_type, resource_id, field, language) DO UPDATE SET
+			status = CASE WHEN translations.source_hash = EXCLUDED.source_hash AND translations.status <> 'failed'
+				THEN translations.status ELSE 'pending' END,
+			updated_at = CASE WHEN translations.source_hash = EXCLUDED.source_hash AND translations.status <> 'failed'
+				THEN translations.updated_at ELSE CURRENT_TIMESTAMP END,
+			source_hash = EXCLUDED.source_hash,
+			requested_by = COALESCE(EXCLUDED.requested_by, translations.requested_by)
+		RETURNING `+translationColumns,
+		resourceType, resourceID, field, lang, sourceHash(source), requestedBy), source)
+	if err != nil || t.Status != models.TranslationPending {
+		return t, err
+	}
+
+	if err := utils.TriggerTranslation(resourceType, resourceID, field, lang, source); err != nil {
+		log.Printf("Failed to trigger %s translation of %s %s: %v", lang, resourceType, resourceID, err)
+		_, err = utils.DB.Exec(`
+			UPDATE translations SET status = 'failed', updated_at = CURRENT_TIMESTAMP
+			WHERE resource_type = $1 AND resource_id = $2 AND field = $3 AND language = $4
+		`, resourceType, resourceID, field, lang)
+		t.Status = models.TranslationFailed
+		return t, err
+	}
+	return t, nil
+}
+
+// saveTranslation stores a translation written by a person, e.g., a doctor
+// correcting the AI's, as ready for the current source.
+func saveTranslation(resourceType, resourceID, field, lang, text, source, translatedBy string) (models.Translation, error) {
+	return scanTranslation(utils.DB.QueryRow(`
+		INSERT INTO translations (resource_type, resource_id, field, language, text, source_hash, status, translated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, 'ready', $7)
+		ON CONFLICT (resource_type, resource_id, field, language) DO UPDATE SET
+			text = EXCLUDED.text, source_hash = EXCLUDED.source_hash, status = 'ready',
+			translated_by = EXCLUDED.translated_by, updated_at = CURRENT_TIMESTAMP
+		RETURNING `+translationColumns,
+		resourceType, resourceID, field, lang, text, sourceHash(source), translatedBy), source)
+}
+
+// translateForPatient requests a translation into the patient's preferred
+// language, if they chose one. Failures are logged; the English text is
+// served meanwhile.
+func translateForPatient(patientID, resourceType, resourceID, field, source string) {
+	if strings.TrimSpace(source) == "" {
+		return
+	}
+	lang, err := preferredLanguage(patientID)
+	if err == nil && lang != "" && lang != models.SourceLanguage {
+		_, err = requestTranslation(resourceType, resourceID, field, lang, source, "")
+	}
+	if err != nil {
+		log.Printf("Failed to request translation of %s %s for %s: %v", resourceType, resourceID, patientID, err)
+	}
+}
+
+// translateAllForPatient requests translations of a patient's issued
+// prescriptions and shared reports after they change their preferred language.
+func translateAllForPatient(patientID string) {
+	rows, err := utils.DB.Query(`
+		SELECT `+prescriptionColumns+` FROM prescriptions WHERE patient_id = $1 AND status = 'issued'
+	`, patientID)
+	if err != nil {
+		log.Printf("Failed to fetch prescriptions of %s for translation: %v", patientID, err)
+		return
+	}
+	var prescriptions []models.Prescription
+	for rows.Next() {
+		if p, err := scanPrescription(rows); err == nil {
+			prescriptions = append(prescriptions, p)
+		}
+	}
+	rows.Close()
+	for _, p := range prescriptions {
+		translateForPatient(patientID, "prescription", p.ID, models.TranslationFieldInstructions, prescriptionSourceText(p))
+	}
+
+	rows, err = utils.DB.Query(`
+		SELECT r.id, COALESCE(r.simplified_summary, '') FROM report_shares s
+		JOIN reports r ON r.id = s.report_id
+		WHERE s.recipient_id = $1 AND r.patient_id = $1
+	`, patientID)
+	if err != nil {
+		log.Printf("Failed to fetch reports of %s for translation: %v", patientID, err)
+		return
+	}
+	summaries := map[string]string{}
+	for rows.Next() {
+		var id, summary string
+		if rows.Scan(&id, &summary) == nil {
+			summaries[id] = summary
+		}
+	}
+	rows.Close()
+	for id, summary := range summaries {
+		translateForPatient(patientID, "report", id, models.TranslationFieldSummary, summary)
+	}
+}
+
+// bindTranslationLanguage reads the language of a translation request; it
+// writes the error response itself when it is missing or English.
+func bindTranslationLanguage(c *gin.Context) (string, bool) {
+	var req models.TranslationRequest
+	if err := c.ShouldBindJSON(&req); err != nil || normalizeLanguage(req.Language) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request; 'language' must be a language code, e.g., hi"})
+		return "", false
+	}
+	lang := normalizeLanguage(req.Language)
+	if lang == models.SourceLanguage {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The original text is already in English"})
+		return "", false
+	}
+	return lang, true
+}
+
+// respondTranslationRequested answers a translation request: 200 with the text
+// when it is ready, 202 while it is being translated.
+func respondTranslationRequested(c *gin.Context, t models.Translation, err error) {
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request translation"})
+		return
+	}
+	switch t.Status {
+	case models.TranslationReady:
+		c.JSON(http.StatusOK, t)
+	case models.TranslationFailed:
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Translation failed. Please try again later.", "translation": t})
+	default:
+		c.JSON(http.StatusAccepted, t)
+	}
+}
+
+// bindManualTranslation reads the :lang URL parameter and the text of a
+// translation written by a person, writing the error response itself.
+func bindManualTranslation(c *gin.Context) (string, string, bool) {
+	lang := normalizeLanguage(c.Param("lang"))
+	if lang == "" || lang == models.SourceLanguage {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid language; expected a code other than en, e.g., hi"})
+		return "", "", false
+	}
+	var req models.ManualTranslationRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Text) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request; 'text' is required"})
+		return "", "", false
+	}
+	return lang, strings.TrimSpace(req.Text), true
+}
+
+// loadMyReportSummary fetches the English summary of the report named by :id
+// if it was shared with the patient, writing the error response itself.
+func loadMyReportSummary(c *gin.Context) (string, string, bool) {
+	var reportID, summary string
+	err := utils.DB.QueryRow(`
+		SELECT r.id, COALESCE(r.simplified_summary, '') FROM report_shares s
+		JOIN reports r ON r.id = s.report_id
+		WHERE s.report_id::text = $1 AND s.recipient_id = $2
+	`, c.Param("id"), c.GetString("userID")).Scan(&reportID, &summary)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report not found"})
+		return "", "", false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch report"})
+		return "", "", false
+	}
+	return reportID, summary, true
+}
+
+// RequestPrescriptionTranslation handles POST /v1/patient/prescriptions/:id/translations
+// Asks for the instructions of a prescription in another language, e.g.,
+// {"language": "ta"}. Answers 202 while the AI service translates them, or at
+// once from the narration templates in the languages they cover.
+func RequestPrescriptionTranslation(c *gin.Context) {
+	p, ok := loadMyPrescription(c)
+	if !ok {
+		return
+	}
+	lang, ok := bindTranslationLanguage(c)
+	if !ok {
+		return
+	}
+	t, err := requestTranslation("prescription", p.ID, models.TranslationFieldInstructions, lang,
+		prescriptionSourceText(p), patientAccountOf(c))
+	if err == nil && t.Status != models.TranslationReady {
+		// Answer from the templates until the AI service's translation is ready
+		if text, ok := narratePrescription(p, lang); ok {
+			t.Text, t.Status, t.TranslatedBy = text, models.TranslationReady, translatedByTemplates
+		}
+	}
+	respondTranslationRequested(c, t, err)
+}
+
+// GetPrescriptionTranslations handles GET /v1/patient/prescriptions/:id/translations
+// Lists the languages a prescription's instructions are (being) translated into.
+// Translations of an earlier version are not current and are not served.
+func GetPrescriptionTranslations(c *gin.Context) {
+	p, ok := loadMyPrescription(c)
+	if !ok {
+		return
+	}
+	translations, err := loadTranslations("prescription", p.ID, models.TranslationFieldInstructions, prescriptionSourceText(p))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch translations"})
+		return
+	}
+	c.JSON(http.StatusOK, translations)
+}
+
+// RequestReportTranslation handles POST /v1/patient/reports/:id/translations
+// Asks for the simplified summary of a report in another language.
+func RequestReportTranslation(c *gin.Context) {
+	reportID, summary, ok := loadMyReportSummary(c)
+	if !ok {
+		return
+	}
+	lang, ok := bindTranslationLanguage(c)
+	if !ok {
+		return
+	}
+	t, err := requestTranslation("report", reportID, models.TranslationFieldSummary, lang, summary, patientAccountOf(c))
+	respondTranslationRequested(c, t, err)
+}
+
+// GetReportTranslations handles GET /v1/patient/reports/:id/translations
+// Lists the languages a report's simplified summary is (being) translated into.
+func GetReportTranslations(c *gin.Context) {
+	reportID, summary, ok := loadMyReportSummary(c)
+	if !ok {
+		return
+	}
+	translations, err := loadTranslations("report", reportID, models.TranslationFieldSummary, summary)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch translations"})
+		return
+	}
+	c.JSON(http.StatusOK, translations)
+}
+
+// SavePrescriptionTranslation handles PUT /v1/clinic/prescriptions/:id/translations/:lang
+// Stores the doctor's own translation of a prescription's instructions,
+// replacing the AI's in that language.
+func SavePrescriptionTranslation(c *gin.Context) {
+	p, ok := loadClinicPrescription(c)
+	if !ok || !requireStatus(c, p, models.PrescriptionIssued) {
+		return
+	}
+	lang, text, ok := bindManualTranslation(c)
+	if !ok {
+		return
+	}
+	t, err := saveTranslation("prescription", p.ID, models.TranslationFieldInstructions, lang, text,
+		prescriptionSourceText(p), c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save translation"})
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+// SaveReportTranslation handles PUT /v1/scanning/reports/:id/translations/:lang
+// Stores the center's own translation of a finalized report's simplified summary.
+func SaveReportTranslation(c *gin.Context) {
+	var reportID, summary, status string
+	err := utils.DB.QueryRow(`
+		SELECT id, COALESCE(simplified_summary, ''), status FROM reports
+		WHERE id::text = $1 AND scanning_center_id = $2
+	`, c.Param("id"), c.GetString("userID")).Scan(&reportID, &summary, &status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch report"})
+		return
+	}
+	if status != "Shared" || summary == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Finalize the report before translating its summary"})
+		return
+	}
+	lang, text, ok := bindManualTranslation(c)
+	if !ok {
+		return
+	}
+	t, err := saveTranslation("report", reportID, models.TranslationFieldSummary, lang, text, summary, c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save translation"})
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+// GetMyPreferences handles GET /v1/patient/preferences
+// Returns the settings of the active profile.
+func GetMyPreferences(c *gin.Context) {
+	lang, err := preferredLanguage(c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch preferences"})
+		return
+	}
+	c.JSON(http.StatusOK, models.PatientPreferences{PreferredLanguage: lang})
+}
+
+// UpdateMyPreferences handles PUT /v1/patient/preferences
+// Sets the preferred language of the active profile ("" or "en" for English).
+// Existing prescriptions and reports are translated into it in the background;
+// until then they are shown in English or an earlier translation.
+func UpdateMyPreferences(c *gin.Context) {
+	var prefs models.PatientPreferences
+	if err := c.ShouldBindJSON(&prefs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid preferences format"})
+		return
+	}
+	lang := ""
+	if strings.TrimSpace(prefs.PreferredLanguage) != "" {
+		if lang = normalizeLanguage(prefs.PreferredLanguage); lang == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'preferred_language'; expected a language code, e.g., hi"})
+			return
+		}
+	}
+	if lang == models.SourceLanguage {
+		lang = ""
+	}
+
+	patientID := c.GetString("userID")
+	_, err := utils.DB.Exec(`UPDATE users SET preferred_language = NULLIF($1, '') WHERE unique_user_id = $2`, lang, patientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save preferences"})
+		return
+	}
+	if lang != "" {
+		go translateAllForPatient(patientID)
+	}
+	c.JSON(http.StatusOK, models.PatientPreferences{PreferredLanguage: lang})
+}
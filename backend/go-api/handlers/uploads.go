@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxFormFieldBytes caps each plain (non-file) form field of an upload.
+const maxFormFieldBytes = 64 * 1024
+
+// uploadPolicy describes what a multipart endpoint accepts.
+type uploadPolicy struct {
+	Fields   []string // Form field names the file may be sent under
+	MaxBytes int64    // Cap on the whole request body
+	// Types maps each accepted extension to the content types its data may sniff
+	// as (http.DetectContentType), matched by prefix.
+	Types map[string][]string
+}
+
+// upload is a file being received. Body streams the file straight from the
+// request; it can be read only once, inside the receiveUpload callback.
+type upload struct {
+	Filename    string     // Sanitized base name, safe to log and display
+	Ext         string     // Lowercase extension without the dot
+	ContentType string     // Sniffed from the data, not taken from the client
+	Form        url.Values // Plain fields sent before the file
+	Body        io.Reader
+}
+
+// uploadError is a problem with the client's upload, reported with its status code.
+type uploadError struct {
+	Status  int
+	Message string
+}
+
+func (e *uploadError) Error() string {
+	return e.Message
+}
+
+// receiveUpload streams a multipart request and calls process with the first
+// file sent under one of policy.Fields. The body is read part by part, so no
+// temporary file is written unless process saves one itself. Form fields sent
+// after the file are not seen; clients must send them first (or as query
+// parameters). Errors from the client come back as *uploadError.
+func receiveUpload(c *gin.Context, policy uploadPolicy, process func(u *upload) error) error {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, policy.MaxBytes)
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return &uploadError{Status: http.StatusBadRequest, Message: "Request must be multipart/form-data"}
+	}
+
+	form := url.Values{}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return uploadReadError(err, policy)
+		}
+
+		if part.FileName() == "" {
+			value, err := io.ReadAll(io.LimitReader(part, maxFormFieldBytes))
+			part.Close()
+			if err != nil {
+				return uploadReadError(err, policy)
+			}
+			form.Add(part.FormName(), string(value))
+			continue
+		}
+		if !containsString(policy.Fields, part.FormName()) {
+			part.Close()
+			continue
+		}
+
+		u, err := openUpload(part, form, policy)
+		if err != nil {
+			part.Close()
+			return err
+		}
+		err = process(u)
+		part.Close()
+		if err != nil {
+			return uploadReadError(err, policy)
+		}
+		return nil
+	}
+
+	return &uploadError{
+		Status:  http.StatusBadRequest,
+		Message: fmt.Sprintf("File required (field name: '%s')", strings.Join(policy.Fields, "' or '")),
+	}
+}
+
+// openUpload checks a file part's name and sniffed content against the policy.
+func openUpload(part *multipart.Part, form url.Values, policy uploadPolicy) (*upload, error) {
+	filename := sanitizeFilename(part.FileName())
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+
+	allowed, ok := policy.Types[ext]
+	if !ok {
+		return nil, &uploadError{
+			Status:  http.StatusUnsupportedMediaType,
+			Message: fmt.Sprintf("Unsupported file type %q; accepted: %s", "."+ext, strings.Join(policyExtensions(policy), ", ")),
+		}
+	}
+
+	// Sniff the leading bytes so a renamed binary is not accepted as text (or vice versa).
+	body := bufio.NewReaderSize(part, 512)
+	head, err := body.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, uploadReadError(err, policy)
+	}
+	if len(head) == 0 {
+		return nil, &uploadError{Status: http.StatusBadRequest, Message: "Uploaded file is empty"}
+	}
+	contentType := http.DetectContentType(head)
+
+	matched := false
+	for _, prefix := range allowed {
+		if strings.HasPrefix(contentType, prefix) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return nil, &uploadError{
+			Status:  http.StatusUnsupportedMediaType,
+			Message: fmt.Sprintf("File content (%s) does not match its .%s extension", contentType, ext),
+		}
+	}
+
+	return &upload{Filename: filename, Ext: ext, ContentType: contentType, Form: form, Body: body}, nil
+}
+
+// uploadReadError turns an oversized body into a 413 and passes other errors through.
+func uploadReadError(err error, policy uploadPolicy) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return &uploadError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("Upload exceeds the %d MB limit", policy.MaxBytes>>20),
+		}
+	}
+	return err
+}
+
+// invalidUpload reports a file the client sent that could not be processed,
+// keeping the 413 when the failure was the size cap.
+func invalidUpload(err error, policy uploadPolicy, message string) error {
+	if tooLarge := uploadReadError(err, policy); tooLarge != err {
+		return tooLarge
+	}
+	return &uploadError{Status: http.StatusBadRequest, Message: message + ": " + err.Error()}
+}
+
+// saveTo streams the upload into dir under a random name keeping its extension,
+// and returns the path. A partly written file is removed on failure.
+func (u *upload) saveTo(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return "", err
+	}
+	dst, err := os.CreateTemp(dir, "upload-*."+u.Ext)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(dst, u.Body)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		if removeErr := os.Remove(dst.Name()); removeErr != nil {
+			log.Printf("Warning: Failed to delete partial upload %s: %v", dst.Name(), removeErr)
+		}
+		return "", err
+	}
+	return dst.Name(), nil
+}
+
+// formValue returns a plain field sent with the upload, falling back to the query string.
+func (u *upload) formValue(c *gin.Context, name string) string {
+	if value := u.Form.Get(name); value != "" {
+		return value
+	}
+	return c.Query(name)
+}
+
+// respondUploadError writes the response for a failed upload: the client's
+// status for an *uploadError, otherwise a 500 with fallback as the message.
+func respondUploadError(c *gin.Context, err error, fallback string) {
+	var uploadErr *uploadError
+	if errors.As(err, &uploadErr) {
+		c.JSON(uploadErr.Status, gin.H{"error": uploadErr.Message})
+		return
+	}
+	log.Printf("%s: %v", fallback, err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": fallback, "details": err.Error()})
+}
+
+// sanitizeFilename reduces a client-supplied file name to a safe base name,
+// dropping any directory part (either slash style) and control characters.
+func sanitizeFilename(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = filepath.Base(name)
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == "/" || name == ".." {
+		name = ""
+	}
+	// Keep the end of over-long names so the extension survives.
+	for len(name) > 255 {
+		_, size := utf8.DecodeRuneInString(name)
+		name = name[size:]
+	}
+	return name
+}
+
+func policyExtensions(policy uploadPolicy) []string {
+	exts := []string{}
+	for ext := range policy.Types {
+		exts = append(exts, "."+ext)
+	}
+	sort.Strings(exts)
+	return exts
+}
@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"Medibridge/go-api/models"
+	"Medibridge/go-api/utils"
+)
+
+// signedPrescriptionFormat identifies the canonical form below; bump it if the form changes.
+const signedPrescriptionFormat = "medibridge-prescription-v1"
+
+// signedPrescription is the canonical form of a prescription version that clinics
+// sign: what a pharmacy dispenses from, bound to the patient and the issuing clinic.
+// encoding/json writes struct fields in order, so the same version always
+// produces the same bytes.
+type signedPrescription struct {
+	Format             string                     `json:"format"`
+	PrescriptionID     string                     `json:"prescription_id"`
+	Version            int                        `json:"version"`
+	Status             string                     `json:"status"`
+	ClinicID           string                     `json:"clinic_id"`
+	PatientID          string                     `json:"patient_id"`
+	IssuedAt           int64                      `json:"issued_at"`
+	RefillOf           string                     `json:"refill_of,omitempty"`
+	RefillsAllowed     int                        `json:"refills_allowed"`
+	RefillIntervalDays int                        `json:"refill_interval_days"`
+	Instructions       []models.DosageInstruction `json:"instructions"`
+}
+
+// canonicalPrescription returns the bytes signed for p at its current version.
+func canonicalPrescription(p *models.Prescription) ([]byte, error) {
+	instructions := p.Instructions
+	if instructions == nil {
+		instructions = []models.DosageInstruction{}
+	}
+	return json.Marshal(signedPrescription{
+		Format:             signedPrescriptionFormat,
+		PrescriptionID:     p.ID,
+		Version:            p.Version,
+		Status:             p.Status,
+		ClinicID:           p.ClinicID,
+		PatientID:          p.PatientID,
+		IssuedAt:           p.CreatedAt,
+		RefillOf:           p.RefillOf,
+		RefillsAllowed:     p.RefillsAllowed,
+		RefillIntervalDays: p.RefillIntervalDays,
+		Instructions:       instructions,
+	})
+}
+
+// signPrescription signs p at its current version with the clinic's active key,
+// creating the key on the clinic's first prescription.
+func signPrescription(tx *sql.Tx, p *models.Prescription) ([]byte, int, error) {
+	keyID, sealed, err := clinicSigningKey(tx, p.ClinicID)
+	if err != nil {
+		return nil, 0, err
+	}
+	message, err := canonicalPrescription(p)
+	if err != nil {
+		return nil, 0, err
+	}
+	sig, err := utils.SignWithSealedKey(sealed, message)
+	return sig, keyID, err
+}
+
+// clinicSigningKey returns the ID and encrypted private key of the clinic's active signing key.
+func clinicSigningKey(tx *sql.Tx, clinicID string) (int, string, error) {
+	var id int
+	var sealed string
+	query := `SELECT id, private_key FROM clinic_signing_keys WHERE clinic_id = $1 AND retired_at IS NULL`
+	err := tx.QueryRow(query, clinicID).Scan(&id, &sealed)
+	if err != sql.ErrNoRows {
+		return id, sealed, err
+	}
+
+	public, sealed, err := utils.NewSigningKey()
+	if err != nil {
+		return 0, "", err
+	}
+	err = tx.QueryRow(`
+		INSERT INTO clinic_signing_keys (clinic_id, public_key, private_key)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (clinic_id) WHERE retired_at IS NULL DO NOTHING
+		RETURNING id
+	`, clinicID, []byte(public), sealed).Scan(&id)
+	if err == sql.ErrNoRows {
+		// Another request created the key first
+		err = tx.QueryRow(query, clinicID).Scan(&id, &sealed)
+	}
+	return id, sealed, err
+}
+
+// signedVersion is a prescription as it stood at one version, with its signature.
+type signedVersion struct {
+	Prescription models.Prescription
+	Signature    []byte // Nil for versions issued before signing was introduced
+	PublicKey    []byte
+	KeyClinicID  string
+	SignedAt     int64
+}
+
+// loadSignedVersion rebuilds p as it stood at the given version; it returns
+// sql.ErrNoRows if there is no such version.
+func loadSignedVersion(p models.Prescription, version int) (signedVersion, error) {
+	sv := signedVersion{Prescription: p}
+	var instructions []byte
+	var signedAt time.Time
+	err := utils.DB.QueryRow(`
+		SELECT v.status, v.instructions, v.refills_allowed, v.refill_interval_days, v.signature,
+			k.public_key, COALESCE(k.clinic_id, ''), v.created_at
+		FROM prescription_versions v
+		LEFT JOIN clinic_signing_keys k ON k.id = v.signing_key_id
+		WHERE v.prescription_id::text = $1 AND v.version = $2
+	`, p.ID, version).Scan(&sv.Prescription.Status, &instructions, &sv.Prescription.RefillsAllowed,
+		&sv.Prescription.RefillIntervalDays, &sv.Signature, &sv.PublicKey, &sv.KeyClinicID, &signedAt)
+	if err != nil {
+		return sv, err
+	}
+
+	sv.Prescription.Version = version
+	sv.Prescription.Instructions = nil
+	if err := json.Unmarshal(instructions, &sv.Prescription.Instructions); err != nil {
+		return sv, err
+	}
+	sv.SignedAt = signedAt.Unix()
+	return sv, nil
+}
+
+// verify reports whether sig is the clinic's signature of this version.
+func (sv signedVersion) verify(sig []byte) bool {
+	if sv.KeyClinicID != sv.Prescription.ClinicID {
+		return false
+	}
+	message, err := canonicalPrescription(&sv.Prescription)
+	return err == nil && utils.VerifySignature(sv.PublicKey, message, sig)
+}
+
+// prescriptionVerifyURL is the public verification link printed as a QR code
+// on a prescription, carrying the version and its signature.
+func prescriptionVerifyURL(prescriptionID string, version int, sig []byte) string {
+	url := publicAPIURL() + "/v1/verify/prescriptions/" + prescriptionID + "?v=" + strconv.Itoa(version)
+	if len(sig) > 0 {
+		url += "&sig=" + base64.RawURLEncoding.EncodeToString(sig)
+	}
+	return url
+}
+
+// publicAPIURL is where the API is reached from outside, for links printed or sent to people.
+func publicAPIURL() string {
+	base := os.Getenv("PUBLIC_API_URL")
+	if base == "" {
+		base = "http://localhost:8080"
+	}
+	return strings.TrimRight(base, "/")
+}
+
+// maskID hides the middle of an identifier, e.g., "PAT001" becomes "PA**01".
+func maskID(id string) string {
+	if len(id) <= 4 {
+		return strings.Repeat("*", len(id))
+	}
+	return id[:2] + strings.Repeat("*", len(id)-4) + id[len(id)-2:]
+}
+
+// VerifyPrescription handles GET /v1/verify/prescriptions/:id?v=&sig=
+// Public endpoint for pharmacies: confirms that a printed prescription version
+// was signed by the issuing clinic and whether it is still active, amended or
+// cancelled. The medicines are only listed when the printout's signature (the
+// "sig" from its QR code) is presented and valid.
+func VerifyPrescription(c *gin.Context) {
+	p, err := loadPrescription(c.Param("id"))
+	if err == sql.ErrNoRows || (err == nil && p.Status == models.PrescriptionDraft) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Prescription not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch prescription"})
+		return
+	}
+
+	version := p.Version
+	if v := c.Query("v"); v != "" {
+		if version, err = strconv.Atoi(v); err != nil || version < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'v'; expected a version number"})
+			return
+		}
+	}
+	sv, err := loadSignedVersion(p, version)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Prescription version not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch prescription"})
+		return
+	}
+	branding, err := loadPrescriberBranding(p, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch clinic profile"})
+		return
+	}
+
+	result := models.PrescriptionVerification{
+		PrescriptionID: p.ID,
+		Authentic:      len(sv.Signature) > 0 && sv.verify(sv.Signature),
+		Version:        version,
+		CurrentVersion: p.Version,
+		IssuedAt:       p.CreatedAt,
+		ClinicName:     branding.Profile.Name,
+		DoctorName:     branding.Profile.SignatoryName,
+		RegistrationNo: branding.Profile.RegistrationNumber,
+		PatientRef:     maskID(p.PatientID),
+		RefillsAllowed: sv.Prescription.RefillsAllowed,
+	}
+	if len(sv.Signature) > 0 {
+		result.SignedAt = sv.SignedAt
+		result.KeyFingerprint = utils.KeyFingerprint(sv.PublicKey)
+		result.PublicKey = base64.StdEncoding.EncodeToString(sv.PublicKey)
+	}
+
+	// A presented signature must be valid too; it is what the printout carries.
+	if presented := c.Query("sig"); presented != "" && result.Authentic {
+		sig, err := base64.RawURLEncoding.DecodeString(presented)
+		result.Authentic = err == nil && sv.verify(sig)
+		if result.Authentic {
+			for _, instr := range sv.Prescription.Instructions {
+				result.Medicines = append(result.Medicines, models.VerifiedMedicine{
+					DrugName:       instr.DrugName,
+					Strength:       instr.Strength,
+					DosageQuantity: instr.DosageQuantity,
+					Frequency:      instr.Frequency,
+					DurationDays:   instr.DurationDays,
+					Discontinued:   instr.Discontinued,
+				})
+			}
+		}
+	}
+
+	switch {
+	case p.Status == models.PrescriptionCancelled:
+		result.Status = models.VerificationCancelled
+	case version < p.Version:
+		result.Status = models.VerificationAmended
+	default:
+		result.Status = models.VerificationActive
+	}
+
+	switch {
+	case len(sv.Signature) == 0:
+		result.Message = "This version was issued before prescriptions were signed and cannot be verified"
+	case !result.Authentic:
+		result.Message = "The signature does not match; the printout may have been altered"
+	case result.Status == models.VerificationCancelled:
+		result.Message = "Authentic, but the clinic has cancelled this prescription; do not dispense"
+	case result.Status == models.VerificationAmended:
+		result.Message = "Authentic, but superseded by version " + strconv.Itoa(p.Version) + "; ask for the current printout"
+	default:
+		result.Message = "Authentic and current"
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"Medibridge/go-api/handlers"
+	"Medibridge/go-api/models"
 	"Medibridge/go-api/utils"
 )
 
@@ -19,6 +20,11 @@ const (
 )
 
 func main() {
+	// Maintenance subcommands run without starting the server
+	if len(os.Args) > 1 && os.Args[1] == "import-drugs" {
+		os.Exit(runImportDrugs(os.Args[2:]))
+	}
+
 	// 0. Initialize Database Connection FIRST
 	log.Println("Initializing database connection...")
 	if err := utils.InitDatabase(); err != nil {
@@ -27,9 +33,21 @@ func main() {
 	defer utils.CloseDatabase()
 
 	// Load drugs from CSV
-	log.Println("Loading drug database from CSV...")
-	if err := handlers.LoadDrugsFromCSV(); err != nil {
-		log.Printf("Warning: Failed to load drugs from CSV: %v", err)
+	log.Println("Loading drug catalog...")
+	if err := handlers.LoadDrugCatalog(); err != nil {
+		log.Printf("Warning: Failed to load drug catalog: %v", err)
+	}
+	if err := handlers.RebuildDrugSearchIndex(); err != nil {
+		log.Printf("Warning: Failed to build drug search index: %v", err)
+	}
+	if err := handlers.LoadInteractionsFromCSV(); err != nil {
+		log.Printf("Warning: Failed to load drug interactions from CSV: %v", err)
+	}
+	if err := handlers.LoadGlossary(); err != nil {
+		log.Printf("Warning: Failed to load glossary: %v", err)
+	}
+	if err := handlers.RebuildGlossaryIndex(); err != nil {
+		log.Printf("Warning: Failed to build glossary index: %v", err)
 	}
 
 	// 1. Initialize gRPC Client Connection to the Python AI Microservice
@@ -46,7 +64,7 @@ func main() {
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Share-PIN")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 
 		if c.Request.Method == "OPTIONS" {
@@ -69,6 +87,8 @@ func main() {
 					"login": "POST /v1/auth/login",
 					"otp_request": "POST /v1/auth/otp/request",
 					"otp_verify": "POST /v1/auth/otp/verify",
+					"register_otp": "POST /v1/auth/register/otp",
+					"register": "POST /v1/auth/register",
 				},
 			},
 		})
@@ -92,17 +112,84 @@ func main() {
 		authGroup.POST("/login", handlers.LoginHandler)
 		authGroup.POST("/otp/request", handlers.RequestOTP)
 		authGroup.POST("/otp/verify", handlers.VerifyOTP)
+
+		// Patient self-registration (mobile number confirmed by OTP)
+		authGroup.POST("/register/otp", handlers.RequestRegistrationOTP)
+		authGroup.POST("/register", handlers.RegisterPatient)
+	}
+
+	// Public verification of printed prescriptions (scanned by pharmacies)
+	verifyGroup := router.Group("/v1/verify")
+	{
+		verifyGroup.GET("/prescriptions/:id", handlers.VerifyPrescription)
+	}
+
+	// Public, read-only documents patients shared through expiring links
+	sharedGroup := router.Group("/v1/shared")
+	{
+		sharedGroup.GET("/:token", handlers.OpenShareLink)
+		sharedGroup.GET("/:token/pdf", handlers.GetSharedPrescriptionPDF)
 	}
 
 	// 4. Protected Routes
 	protected := router.Group("/v1", handlers.AuthMiddleware())
 
+	// Staff member roles within clinics and scanning centers; organization accounts
+	// themselves (e.g., CLI002) keep full access
+	asDoctor := handlers.MemberRoleMiddleware(models.MemberDoctor)
+	asClinicalStaff := handlers.MemberRoleMiddleware(models.MemberDoctor, models.MemberReceptionist)
+	asDoctorOrAdmin := handlers.MemberRoleMiddleware(models.MemberDoctor, models.MemberOrgAdmin)
+	asTechnician := handlers.MemberRoleMiddleware(models.MemberTechnician)
+	asOrgAdmin := handlers.MemberRoleMiddleware(models.MemberOrgAdmin)
+
+	// Guardians and caregivers acting on a linked patient profile; patients acting
+	// on their own profile keep full access
+	asProfileManager := handlers.ProfilePermissionMiddleware(models.ProfileManage)
+
 	// Patient Routes
 	patientGroup := protected.Group("/patient", handlers.RBACMiddleware(RolePatient))
 	{
 		patientGroup.GET("/prescriptions", handlers.GetPatientPrescriptions)
-		patientGroup.POST("/adherence", handlers.LogAdherence)
+		patientGroup.GET("/prescriptions/:id/versions", handlers.GetMyPrescriptionVersions)
+		patientGroup.GET("/prescriptions/:id/pdf", handlers.GetMyPrescriptionPDF)
+		patientGroup.GET("/prescriptions/:id/translations", handlers.GetPrescriptionTranslations)
+		patientGroup.POST("/prescriptions/:id/translations", handlers.RequestPrescriptionTranslation)
+		patientGroup.POST("/prescriptions/:id/refill", asProfileManager, handlers.RequestRefill)
+		patientGroup.GET("/refills", handlers.GetMyRefillRequests)
+		patientGroup.GET("/notifications", handlers.GetMyNotifications)
+		patientGroup.POST("/notifications/:id/read", asProfileManager, handlers.MarkNotificationRead)
+		patientGroup.POST("/adherence", handlers.ProfilePermissionMiddleware(models.ProfileLogAdherence), handlers.LogAdherence)
 		patientGroup.GET("/reports", handlers.GetPatientReports)
+		patientGroup.GET("/reports/:id", handlers.GetMyReport)
+		patientGroup.GET("/reports/:id/translations", handlers.GetReportTranslations)
+		patientGroup.POST("/reports/:id/translations", handlers.RequestReportTranslation)
+		patientGroup.GET("/referrals", handlers.GetMyReferrals)
+		patientGroup.GET("/lab-results", handlers.GetMyLabResults)
+		patientGroup.GET("/lab-results/:code", handlers.GetMyLabTrend)
+		patientGroup.GET("/medical-profile", handlers.GetMyMedicalProfile)
+		patientGroup.GET("/preferences", handlers.GetMyPreferences)
+		patientGroup.PUT("/preferences", asProfileManager, handlers.UpdateMyPreferences)
+
+		// Family profiles: dependents, caregivers and switching between profiles
+		patientGroup.GET("/profiles", handlers.ListMyProfiles)
+		patientGroup.POST("/profiles/:id/switch", handlers.SwitchProfile)
+		patientGroup.POST("/dependents", asProfileManager, handlers.AddDependent)
+		patientGroup.GET("/caregivers", asProfileManager, handlers.ListCaregivers)
+		patientGroup.POST("/caregivers", asProfileManager, handlers.AddCaregiver)
+		patientGroup.DELETE("/caregivers/:id", asProfileManager, handlers.RevokeCaregiver)
+
+		// Share links to a report or prescription for someone not on MediBridge
+		patientGroup.POST("/share-links", asProfileManager, handlers.CreateShareLink)
+		patientGroup.GET("/share-links", asProfileManager, handlers.ListShareLinks)
+		patientGroup.DELETE("/share-links/:id", asProfileManager, handlers.RevokeShareLink)
+		patientGroup.GET("/share-links/:id/accesses", asProfileManager, handlers.GetShareLinkAccesses)
+	}
+
+	// Medical glossary for tap-to-define terms in simplified reports
+	glossaryGroup := protected.Group("/glossary")
+	{
+		glossaryGroup.GET("/:term", handlers.GetGlossaryTerm)
+		glossaryGroup.POST("/detect", handlers.DetectGlossaryTerms)
 	}
 
 	// Chatbot Route
@@ -114,26 +201,145 @@ func main() {
 	// Clinic Routes (NO RBAC - Allow any authenticated user to access for demo)
 	clinicGroup := protected.Group("/clinic")
 	{
-		clinicGroup.POST("/prescriptions/new", handlers.CreateNewPrescription)
+		clinicGroup.POST("/prescriptions/new", handlers.RBACMiddleware(RoleClinic), asDoctor, handlers.CreateNewPrescription)
+
+		// Prescription drafts, amendments and cancellation (every change is a new version)
+		clinicGroup.GET("/prescriptions/drafts", handlers.ListPrescriptionDrafts)
+		clinicGroup.POST("/prescriptions/drafts", handlers.RBACMiddleware(RoleClinic), asClinicalStaff, handlers.CreatePrescriptionDraft)
+		clinicGroup.PUT("/prescriptions/drafts/:id", handlers.RBACMiddleware(RoleClinic), asClinicalStaff, handlers.UpdatePrescriptionDraft)
+		clinicGroup.DELETE("/prescriptions/drafts/:id", handlers.RBACMiddleware(RoleClinic), asClinicalStaff, handlers.DeletePrescriptionDraft)
+		clinicGroup.POST("/prescriptions/drafts/:id/issue", handlers.RBACMiddleware(RoleClinic), asDoctor, handlers.IssuePrescriptionDraft)
+		clinicGroup.GET("/prescriptions/:id", handlers.GetClinicPrescription)
+		clinicGroup.GET("/prescriptions/:id/versions", handlers.GetPrescriptionVersions)
+		clinicGroup.POST("/prescriptions/:id/amend", handlers.RBACMiddleware(RoleClinic), asDoctor, handlers.AmendPrescription)
+		clinicGroup.POST("/prescriptions/:id/cancel", handlers.RBACMiddleware(RoleClinic), asDoctor, handlers.CancelPrescription)
+		clinicGroup.POST("/prescriptions/:id/instructions/:index/discontinue", handlers.RBACMiddleware(RoleClinic), asDoctor, handlers.DiscontinuePrescriptionDrug)
+		clinicGroup.GET("/prescriptions/:id/pdf", handlers.GetPrescriptionPDF)
+		clinicGroup.PUT("/prescriptions/:id/translations/:lang", handlers.RBACMiddleware(RoleClinic), asDoctor, handlers.SavePrescriptionTranslation)
+
+		// Refill queue for repeat prescriptions
+		clinicGroup.GET("/refills", handlers.ListRefillRequests)
+		clinicGroup.POST("/refills/:id/approve", handlers.RBACMiddleware(RoleClinic), asDoctor, handlers.ApproveRefillRequest)
+		clinicGroup.POST("/refills/:id/deny", handlers.RBACMiddleware(RoleClinic), asDoctor, handlers.DenyRefillRequest)
+		// Reports shared by scanning centers, and the clinic's notifications of them
+		clinicGroup.GET("/reports", handlers.RBACMiddleware(RoleClinic), handlers.ListClinicReports)
+		clinicGroup.GET("/reports/:id", handlers.RBACMiddleware(RoleClinic), handlers.GetClinicReport)
+		clinicGroup.GET("/reports/:id/original", handlers.RBACMiddleware(RoleClinic), handlers.GetClinicReportOriginal)
+		clinicGroup.GET("/notifications", handlers.RBACMiddleware(RoleClinic), handlers.GetMyNotifications)
+		clinicGroup.POST("/notifications/:id/read", handlers.RBACMiddleware(RoleClinic), handlers.MarkNotificationRead)
+
+		// Referrals to scanning centers; their reports come back to this clinic
+		clinicGroup.GET("/scanning-centers", handlers.RBACMiddleware(RoleClinic), handlers.ListScanningCenters)
+		clinicGroup.GET("/referrals", handlers.RBACMiddleware(RoleClinic), handlers.ListClinicReferrals)
+		clinicGroup.POST("/referrals", handlers.RBACMiddleware(RoleClinic), asDoctor, handlers.CreateReferral)
+		clinicGroup.GET("/referrals/:id", handlers.RBACMiddleware(RoleClinic), handlers.GetClinicReferral)
+		clinicGroup.POST("/referrals/:id/cancel", handlers.RBACMiddleware(RoleClinic), asDoctor, handlers.CancelReferral)
+
 		clinicGroup.GET("/patients/search", handlers.SearchPatients)
+		clinicGroup.POST("/patients", handlers.RBACMiddleware(RoleClinic), asClinicalStaff, handlers.RegisterWalkInPatient)
 		clinicGroup.GET("/patients/:id/full", handlers.GetPatientFullRecord)
+		clinicGroup.GET("/patients/:id/lab-results", handlers.RBACMiddleware(RoleClinic), handlers.GetPatientLabResults)
+		clinicGroup.GET("/patients/:id/lab-results/:code", handlers.RBACMiddleware(RoleClinic), handlers.GetPatientLabTrend)
+
+		// Allergy and condition records (checked when prescribing)
+		clinicGroup.GET("/patients/:id/medical-profile", handlers.RBACMiddleware(RoleClinic), handlers.GetPatientMedicalProfile)
+		clinicGroup.POST("/patients/:id/allergies", handlers.RBACMiddleware(RoleClinic), asClinicalStaff, handlers.AddPatientAllergy)
+		clinicGroup.DELETE("/patients/:id/allergies/:allergyId", handlers.RBACMiddleware(RoleClinic), asClinicalStaff, handlers.DeletePatientAllergy)
+		clinicGroup.POST("/patients/:id/conditions", handlers.RBACMiddleware(RoleClinic), asClinicalStaff, handlers.AddPatientCondition)
+		clinicGroup.DELETE("/patients/:id/conditions/:conditionId", handlers.RBACMiddleware(RoleClinic), asClinicalStaff, handlers.DeletePatientCondition)
 		
 		// Drug database routes (public for clinic app)
 		clinicGroup.GET("/drugs", handlers.GetDrugDatabase)
 		clinicGroup.GET("/drugs/search", handlers.SearchDrugs)
+
+		// Clinic formulary (enabled catalog drugs and local drugs)
+		clinicGroup.GET("/formulary", handlers.GetClinicFormulary)
+		clinicGroup.PUT("/formulary/:drugId", handlers.RBACMiddleware(RoleClinic), asDoctorOrAdmin, handlers.SetFormularyDrug)
+		clinicGroup.POST("/formulary/drugs", handlers.RBACMiddleware(RoleClinic), asDoctorOrAdmin, handlers.AddLocalDrug)
+		clinicGroup.DELETE("/formulary/drugs/:drugId", handlers.RBACMiddleware(RoleClinic), asDoctorOrAdmin, handlers.DeleteLocalDrug)
+
+		// Favorite prescription templates
+		clinicGroup.GET("/templates", handlers.ListPrescriptionTemplates)
+		clinicGroup.POST("/templates", handlers.RBACMiddleware(RoleClinic), asDoctor, handlers.CreatePrescriptionTemplate)
+		clinicGroup.PUT("/templates/:id", handlers.RBACMiddleware(RoleClinic), asDoctor, handlers.UpdatePrescriptionTemplate)
+		clinicGroup.DELETE("/templates/:id", handlers.RBACMiddleware(RoleClinic), asDoctor, handlers.DeletePrescriptionTemplate)
+		clinicGroup.POST("/templates/:id/instantiate", handlers.RBACMiddleware(RoleClinic), asClinicalStaff, handlers.InstantiatePrescriptionTemplate)
+
+		// Clinic letterhead printed on prescription PDFs
+		clinicGroup.GET("/profile", handlers.RBACMiddleware(RoleClinic), handlers.GetOrganizationProfile)
+		clinicGroup.PUT("/profile", handlers.RBACMiddleware(RoleClinic), asOrgAdmin, handlers.UpdateOrganizationProfile)
+		clinicGroup.POST("/profile/logo", handlers.RBACMiddleware(RoleClinic), asOrgAdmin, handlers.UploadOrganizationLogo)
+		clinicGroup.POST("/profile/signature", handlers.RBACMiddleware(RoleClinic), asOrgAdmin, handlers.UploadOrganizationSignature)
+
+		// Staff accounts: doctors and receptionists
+		clinicGroup.GET("/members", handlers.RBACMiddleware(RoleClinic), asOrgAdmin, handlers.ListMembers)
+		clinicGroup.POST("/members", handlers.RBACMiddleware(RoleClinic), asOrgAdmin, handlers.InviteMember)
+		clinicGroup.PUT("/members/:id", handlers.RBACMiddleware(RoleClinic), asOrgAdmin, handlers.UpdateMember)
+		clinicGroup.POST("/members/:id/deactivate", handlers.RBACMiddleware(RoleClinic), asOrgAdmin, handlers.DeactivateMember)
+		clinicGroup.POST("/members/:id/reactivate", handlers.RBACMiddleware(RoleClinic), asOrgAdmin, handlers.ReactivateMember)
 	}
 
 	// Scanning Routes
 	scanningGroup := protected.Group("/scanning", handlers.RBACMiddleware(RoleScanning))
 	{
-		scanningGroup.POST("/reports/upload", handlers.UploadTechnicalReport)
-		scanningGroup.POST("/reports/:id/finalize", handlers.FinalizeAndShareReport)
+		scanningGroup.POST("/reports/upload", asTechnician, handlers.UploadTechnicalReport)
+		scanningGroup.POST("/reports/:id/finalize", asTechnician, handlers.FinalizeAndShareReport)
+		scanningGroup.GET("/reports/:id/shares", handlers.GetReportShares)
+		scanningGroup.POST("/reports/:id/observations", asTechnician, handlers.SubmitLabObservations)
+		scanningGroup.GET("/reports/:id/observations", handlers.GetReportObservations)
+		scanningGroup.PUT("/reports/:id/translations/:lang", asTechnician, handlers.SaveReportTranslation)
+
+		// Incoming referrals from clinics, most urgent first
+		scanningGroup.GET("/referrals", handlers.ListIncomingReferrals)
+		scanningGroup.GET("/referrals/:id", handlers.GetIncomingReferral)
+		scanningGroup.POST("/referrals/:id/accept", asTechnician, handlers.AcceptReferral)
+		scanningGroup.POST("/referrals/:id/decline", asTechnician, handlers.DeclineReferral)
+
+		// One-time onboarding and the center's report letterhead
+		scanningGroup.POST("/onboarding/template", asOrgAdmin, handlers.OnboardScanningCenter)
+		scanningGroup.GET("/profile", handlers.GetOrganizationProfile)
+		scanningGroup.PUT("/profile", asOrgAdmin, handlers.UpdateOrganizationProfile)
+		scanningGroup.POST("/profile/logo", asOrgAdmin, handlers.UploadOrganizationLogo)
+		scanningGroup.POST("/profile/signature", asOrgAdmin, handlers.UploadOrganizationSignature)
+
+		// Staff accounts: technicians
+		scanningGroup.GET("/members", asOrgAdmin, handlers.ListMembers)
+		scanningGroup.POST("/members", asOrgAdmin, handlers.InviteMember)
+		scanningGroup.PUT("/members/:id", asOrgAdmin, handlers.UpdateMember)
+		scanningGroup.POST("/members/:id/deactivate", asOrgAdmin, handlers.DeactivateMember)
+		scanningGroup.POST("/members/:id/reactivate", asOrgAdmin, handlers.ReactivateMember)
+	}
+
+	// Shared drug catalog and interaction table every clinic's prescribing and
+	// safety checks use (platform admins only; clinics adjust their own formulary instead)
+	referenceGroup := protected.Group("/admin", handlers.RBACMiddleware(RoleAdmin))
+	{
+		referenceGroup.POST("/drugs/upload", handlers.UploadDrugCSV)
+		referenceGroup.GET("/drugs/versions", handlers.ListDrugCatalogVersions)
+		referenceGroup.GET("/drugs/versions/:id", handlers.GetDrugCatalogVersion)
+		referenceGroup.POST("/drugs/versions/:id/apply", handlers.ApplyDrugCatalogVersion)
+		referenceGroup.POST("/interactions/upload", handlers.UploadInteractionCSV)
+	}
+
+	// Account administration (platform admins only; every change is audited)
+	accountsGroup := protected.Group("/admin", handlers.RBACMiddleware(RoleAdmin))
+	{
+		accountsGroup.GET("/users", handlers.ListAccounts)
+		accountsGroup.POST("/users", handlers.CreateAccount)
+		accountsGroup.GET("/users/:id", handlers.GetAccount)
+		accountsGroup.PUT("/users/:id/role", handlers.ChangeAccountRole)
+		accountsGroup.POST("/users/:id/disable", handlers.DisableAccount)
+		accountsGroup.POST("/users/:id/enable", handlers.EnableAccount)
+		accountsGroup.POST("/users/:id/logout", handlers.RevokeAccountSessions)
+		accountsGroup.POST("/users/:id/reset-credentials", handlers.ResetAccountCredentials)
+		accountsGroup.GET("/users/:id/logins", handlers.GetAccountLogins)
+		accountsGroup.GET("/audit", handlers.GetAdminAuditLog)
 	}
 
-	// Admin Routes (for CSV upload)
-	adminGroup := protected.Group("/admin", handlers.RBACMiddleware(RoleAdmin, RoleClinic))
+	// Medical glossary content (platform admins only)
+	glossaryAdminGroup := protected.Group("/admin/glossary", handlers.RBACMiddleware(RoleAdmin))
 	{
-		adminGroup.POST("/drugs/upload", handlers.UploadDrugCSV)
+		glossaryAdminGroup.POST("/upload", handlers.UploadGlossary)
 	}
 
 	// Start server
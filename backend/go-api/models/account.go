@@ -0,0 +1,86 @@
+package models
+
+// Account statuses.
+const (
+	AccountActive   = "active"
+	AccountDisabled = "disabled"
+)
+
+// Login methods recorded in the login history.
+const (
+	LoginPassword = "password"
+	LoginOTP      = "otp"
+)
+
+// Administrative actions recorded in the audit log.
+const (
+	AuditAccountCreated   = "account_created"
+	AuditRoleChanged      = "role_changed"
+	AuditAccountDisabled  = "account_disabled"
+	AuditAccountEnabled   = "account_enabled"
+	AuditSessionsRevoked  = "sessions_revoked"
+	AuditCredentialsReset = "credentials_reset"
+)
+
+// Account is a user account as administrators see it.
+type Account struct {
+	ID             string `json:"id"`
+	Mobile         string `json:"mobile,omitempty"` // Empty for dependents
+	Name           string `json:"name"`
+	Role           string `json:"role"`
+	Status         string `json:"status"` // active or disabled
+	DisabledReason string `json:"disabled_reason,omitempty"`
+	HasPassword    bool   `json:"has_password"` // Patients log in with OTP only
+	RegisteredBy   string `json:"registered_by,omitempty"`
+	CreatedAt      int64  `json:"created_at"`
+	DisabledAt     int64  `json:"disabled_at,omitempty"`
+	LastLoginAt    int64  `json:"last_login_at,omitempty"`
+}
+
+// CreateAccountRequest creates a clinic or scanning center account.
+type CreateAccountRequest struct {
+	Role   string `json:"role" binding:"required"` // Clinic or Scanning
+	Name   string `json:"name" binding:"required"`
+	Mobile string `json:"mobile" binding:"required"`
+}
+
+// RoleChangeRequest moves an account to another role.
+type RoleChangeRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// DisableAccountRequest disables an account, with the reason kept for the audit log.
+type DisableAccountRequest struct {
+	Reason string `json:"reason"`
+}
+
+// CredentialResetRequest resets an account's login; Mobile optionally moves it
+// to a new number, e.g., when the old phone was lost.
+type CredentialResetRequest struct {
+	Mobile string `json:"mobile"`
+}
+
+// LoginEvent is one attempt to log in, successful or not.
+type LoginEvent struct {
+	ID            int64  `json:"id"`
+	UserID        string `json:"user_id,omitempty"` // Empty when the number matched no account
+	MemberID      int64  `json:"member_id,omitempty"`
+	Mobile        string `json:"mobile"`
+	Method        string `json:"method"` // password or otp
+	Success       bool   `json:"success"`
+	FailureReason string `json:"failure_reason,omitempty"`
+	IPAddress     string `json:"ip_address"`
+	UserAgent     string `json:"user_agent"`
+	CreatedAt     int64  `json:"created_at"`
+}
+
+// AuditEntry is one administrative action on an account.
+type AuditEntry struct {
+	ID           int64                  `json:"id"`
+	AdminID      string                 `json:"admin_id"`
+	Action       string                 `json:"action"`
+	TargetUserID string                 `json:"target_user_id,omitempty"`
+	Details      map[string]interface{} `json:"details,omitempty"`
+	IPAddress    string                 `json:"ip_address"`
+	CreatedAt    int64                  `json:"created_at"`
+}
@@ -0,0 +1,88 @@
+package models
+
+// Drug is one entry of the drug master catalog.
+type Drug struct {
+	ID                string            `json:"id"`
+	Name              string            `json:"name"`         // Display name, e.g., "Amoxicillin"
+	Type              string            `json:"type"`         // System of medicine, e.g., "allopathy"
+	Strength          string            `json:"strength"`     // e.g., "500 mg"
+	GenericName       string            `json:"generic_name"` // e.g., "Amoxicillin Trihydrate"
+	Ingredients       []string          `json:"ingredients"`  // Normalized active ingredients
+	BrandNames        []string          `json:"brand_names"`  // e.g., ["Mox", "Novamox"]
+	Class             string            `json:"class"`        // Normalized drug class, e.g., "penicillin"
+	DosageForm        string            `json:"dosage_form"`  // e.g., "Tablet", "Syrup"
+	Route             string            `json:"route"`        // e.g., "Oral", "Topical"
+	Manufacturer      string            `json:"manufacturer"`
+	Schedule          string            `json:"schedule"`          // Indian drug schedule: H, H1, X, G or OTC
+	PackSizes         []string          `json:"pack_sizes"`        // e.g., ["10 tablets", "15 tablets"]
+	RegionalNames     map[string]string `json:"regional_names"`    // Language code -> name, e.g., "hi" -> "एमोक्सिसिलिन"
+	Contraindications []string          `json:"contraindications"` // Normalized conditions, e.g., "pregnancy"
+	Discontinued      bool              `json:"discontinued"`
+	Limits            DoseLimits        `json:"dose_limits"`
+}
+
+// DrugSchedules lists the accepted values of Drug.Schedule under the Indian
+// Drugs and Cosmetics Rules (empty means unscheduled).
+var DrugSchedules = map[string]bool{"": true, "H": true, "H1": true, "X": true, "G": true, "OTC": true}
+
+// DoseLimits are the per-drug dosing limits used to validate prescribed doses.
+// All amounts are in mg (mg per kg for the pediatric limits); zero means not configured.
+type DoseLimits struct {
+	MinSingleDoseMg           float64 `json:"min_single_dose_mg,omitempty"`
+	MaxSingleDoseMg           float64 `json:"max_single_dose_mg,omitempty"`
+	MaxDailyDoseMg            float64 `json:"max_daily_dose_mg,omitempty"`
+	PediatricMaxSingleMgPerKg float64 `json:"pediatric_max_single_mg_per_kg,omitempty"`
+	PediatricMaxDailyMgPerKg  float64 `json:"pediatric_max_daily_mg_per_kg,omitempty"`
+}
+
+// PediatricAgeYears is the age below which the weight-based pediatric limits apply.
+const PediatricAgeYears = 18
+
+// DrugCatalogVersion is one imported version of the drug catalog. Pending versions
+// are staged for preview; applying a version (or an earlier one, to roll back)
+// replaces the live catalog with its drugs.
+type DrugCatalogVersion struct {
+	ID        int64  `json:"id"`
+	Source    string `json:"source"`     // e.g., the uploaded file name
+	CreatedBy string `json:"created_by"` // User who ran the import, or "system" at startup
+	Status    string `json:"status"`     // pending or applied
+	IsCurrent bool   `json:"is_current"` // The version the live catalog was built from
+	DrugCount int    `json:"drug_count"`
+	Added     int    `json:"added"` // Diff counts against the catalog at import time
+	Changed   int    `json:"changed"`
+	Removed   int    `json:"removed"`
+	CreatedAt int64  `json:"created_at"`
+	AppliedAt int64  `json:"applied_at,omitempty"`
+}
+
+// Drug catalog version statuses.
+const (
+	CatalogVersionPending = "pending"
+	CatalogVersionApplied = "applied"
+)
+
+// DrugImportError reports a problem with one row of an imported catalog file.
+type DrugImportError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// DrugRef identifies a drug in a catalog diff.
+type DrugRef struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// DrugChange lists the fields of a drug that differ between two catalog versions.
+type DrugChange struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Fields []string `json:"fields"`
+}
+
+// DrugCatalogDiff is the preview of what applying a catalog version would change.
+type DrugCatalogDiff struct {
+	Added   []DrugRef    `json:"added"`
+	Changed []DrugChange `json:"changed"`
+	Removed []DrugRef    `json:"removed"`
+}
@@ -0,0 +1,28 @@
+package models
+
+// FormularyDrug is a drug as one clinic sees it: a catalog drug with the clinic's
+// availability setting, or a local drug the clinic added itself.
+type FormularyDrug struct {
+	Drug
+	Enabled bool   `json:"enabled"`
+	Local   bool   `json:"local"` // Added by the clinic, not part of the catalog
+	Notes   string `json:"notes,omitempty"`
+}
+
+// FormularySetting enables or disables a catalog drug for a clinic.
+type FormularySetting struct {
+	Enabled *bool  `json:"enabled" binding:"required"`
+	Notes   string `json:"notes"`
+}
+
+// PrescriptionTemplate is a clinic's saved "favorite" prescription, e.g., "Adult URTI"
+// with its usual drugs and default dosage instructions.
+type PrescriptionTemplate struct {
+	ID           int64               `json:"id"`
+	ClinicID     string              `json:"clinic_id"`
+	Name         string              `json:"name" binding:"required"`
+	Diagnosis    string              `json:"diagnosis"`
+	Instructions []DosageInstruction `json:"instructions" binding:"required"`
+	CreatedAt    int64               `json:"created_at"`
+	UpdatedAt    int64               `json:"updated_at"`
+}
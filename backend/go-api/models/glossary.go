@@ -0,0 +1,41 @@
+package models
+
+// DefaultGlossaryLanguage is served when a term has no definition in the requested language.
+const DefaultGlossaryLanguage = "en"
+
+// GlossaryTerm is a medical term with a simple definition in one language.
+type GlossaryTerm struct {
+	Term       string   `json:"term"`
+	Category   string   `json:"category,omitempty"` // e.g., condition, test, anatomy
+	Aliases    []string `json:"aliases,omitempty"`  // Other names, in any language
+	Language   string   `json:"language"`           // Language of Definition
+	Definition string   `json:"definition"`
+	Languages  []string `json:"languages"` // Every language the term is defined in
+}
+
+// GlossaryMatch is a glossary term found in a text, e.g., a report's simplified
+// summary. Offsets count characters (Unicode code points), End exclusive.
+type GlossaryMatch struct {
+	Term  string `json:"term"` // Look it up with GET /v1/glossary/:term
+	Text  string `json:"text"` // As written in the text
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// GlossaryDetectRequest is a text to find glossary terms in.
+type GlossaryDetectRequest struct {
+	Text string `json:"text" binding:"required"`
+}
+
+// GlossaryImportError reports a problem with one row of an imported glossary file.
+type GlossaryImportError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// GlossaryImportResult is the outcome of importing a glossary file.
+type GlossaryImportResult struct {
+	Terms       int                   `json:"terms"`
+	Definitions int                   `json:"definitions"`
+	Errors      []GlossaryImportError `json:"errors,omitempty"`
+}
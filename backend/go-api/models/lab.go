@@ -0,0 +1,50 @@
+package models
+
+// Flags of a lab result against its reference range. Results without a
+// reference range are left unflagged.
+const (
+	LabFlagLow    = "low"
+	LabFlagNormal = "normal"
+	LabFlagHigh   = "high"
+)
+
+// LabObservation is one structured lab result of a report, e.g., serum
+// cholesterol 240 mg/dL against a range of up to 200.
+type LabObservation struct {
+	ID         int64    `json:"id"`
+	ReportID   string   `json:"report_id"`
+	PatientID  string   `json:"patient_id"`
+	TestCode   string   `json:"test_code"` // e.g., CHOL, HBA1C
+	TestName   string   `json:"test_name"`
+	Value      float64  `json:"value"`
+	Unit       string   `json:"unit"`
+	RefLow     *float64 `json:"ref_low"`  // nil when the range has no lower bound
+	RefHigh    *float64 `json:"ref_high"` // nil when the range has no upper bound
+	Flag       string   `json:"flag,omitempty"`
+	ObservedAt int64    `json:"observed_at"`
+}
+
+// LabObservationInput is a lab result submitted by a scanning center. Without a
+// reference range, the lab test catalog's range for the same unit is used.
+type LabObservationInput struct {
+	TestCode   string   `json:"test_code" binding:"required"`
+	TestName   string   `json:"test_name"`
+	Value      *float64 `json:"value" binding:"required"`
+	Unit       string   `json:"unit"`
+	RefLow     *float64 `json:"ref_low"`
+	RefHigh    *float64 `json:"ref_high"`
+	ObservedAt string   `json:"observed_at"` // YYYY-MM-DD or RFC 3339; defaults to now
+}
+
+// LabObservationsRequest submits the lab results of a report.
+type LabObservationsRequest struct {
+	Observations []LabObservationInput `json:"observations" binding:"required,dive"`
+}
+
+// LabTrend is a patient's results for one test over time, oldest first.
+type LabTrend struct {
+	PatientID string           `json:"patient_id"`
+	TestCode  string           `json:"test_code"`
+	TestName  string           `json:"test_name"`
+	Results   []LabObservation `json:"results"`
+}
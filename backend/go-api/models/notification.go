@@ -0,0 +1,15 @@
+package models
+
+// Notification is a message shown to a user in their app, e.g., that one of their
+// prescriptions was amended.
+type Notification struct {
+	ID           int64  `json:"id"`
+	UserID       string `json:"user_id"`
+	Type         string `json:"type"` // e.g., "prescription_amended"
+	Title        string `json:"title"`
+	Message      string `json:"message"`
+	ResourceType string `json:"resource_type,omitempty"` // e.g., "prescription"
+	ResourceID   string `json:"resource_id,omitempty"`
+	Read         bool   `json:"read"`
+	CreatedAt    int64  `json:"created_at"`
+}
@@ -0,0 +1,62 @@
+package models
+
+// OrganizationProfile is the one-time setup of a clinic or scanning center:
+// the letterhead printed on its prescriptions and reports, and who signs them.
+type OrganizationProfile struct {
+	OrgID              string `json:"org_id"`
+	OrgType            string `json:"org_type"`                // "Clinic" or "Scanning", from the account's role
+	Name               string `json:"name" binding:"required"` // Shown on the letterhead
+	LegalName          string `json:"legal_name"`
+	Address            string `json:"address"`
+	Phone              string `json:"phone"`
+	Email              string `json:"email"`
+	WorkingHours       string `json:"working_hours"`       // e.g., "9:00 AM - 6:00 PM"
+	LicenceNumber      string `json:"licence_number"`      // Establishment registration, e.g., under the Clinical Establishments Act
+	SignatoryName      string `json:"signatory_name"`      // The doctor or radiologist who signs
+	Qualifications     string `json:"qualifications"`      // e.g., "MBBS, MD (General Medicine)"
+	RegistrationNumber string `json:"registration_number"` // The signatory's medical council registration
+	LetterheadTemplate string `json:"letterhead_template"` // One of the Letterhead* constants; defaults to classic
+	// Images are uploaded separately and only reported here.
+	HasLogo      bool  `json:"has_logo"`
+	HasSignature bool  `json:"has_signature"`
+	UpdatedAt    int64 `json:"updated_at,omitempty"`
+}
+
+// Letterhead templates for printed documents.
+const (
+	LetterheadClassic  = "classic"  // Logo and details on the left, QR code on the right
+	LetterheadCentered = "centered" // Logo and details centered across the page
+	LetterheadMinimal  = "minimal"  // Details only, without the logo
+)
+
+// OrganizationMember is a staff account of a clinic or scanning center. Members
+// are invited by mobile number, log in with OTP and act for the organization
+// within their roles.
+type OrganizationMember struct {
+	ID                 int64    `json:"id"`
+	OrgID              string   `json:"org_id"`
+	Mobile             string   `json:"mobile"`
+	Name               string   `json:"name" binding:"required"`
+	Roles              []string `json:"roles" binding:"required"` // Member* roles
+	Qualifications     string   `json:"qualifications"`
+	RegistrationNumber string   `json:"registration_number"` // Medical council registration of doctors
+	Status             string   `json:"status"`
+	InvitedAt          int64    `json:"invited_at"`
+	JoinedAt           int64    `json:"joined_at,omitempty"`
+	DeactivatedAt      int64    `json:"deactivated_at,omitempty"`
+}
+
+// Member roles within an organization.
+const (
+	MemberOrgAdmin     = "org_admin"    // Manages members and the profile
+	MemberDoctor       = "doctor"       // Issues and changes prescriptions
+	MemberReceptionist = "receptionist" // Registers patients and prepares drafts
+	MemberTechnician   = "technician"   // Uploads and finalizes reports
+)
+
+// Member statuses.
+const (
+	MemberInvited     = "invited" // Until the first OTP login
+	MemberActive      = "active"
+	MemberDeactivated = "deactivated"
+)
@@ -6,6 +6,7 @@ import "time"
 type OTPRequest struct {
 	Phone string `json:"phone" binding:"required"`
 	Role  string `json:"role" binding:"required"` // Patient, Clinic, or Scanning
+	OrgID string `json:"org_id"`                  // For staff members of several organizations
 }
 
 // OTPVerifyRequest defines the structure for OTP verification
@@ -13,6 +14,14 @@ type OTPVerifyRequest struct {
 	Phone string `json:"phone" binding:"required"`
 	OTP   string `json:"otp" binding:"required"`
 	Role  string `json:"role" binding:"required"`
+	OrgID string `json:"org_id"`
+	// ProfileID logs a patient straight into a linked family profile
+	ProfileID string `json:"profile_id"`
+}
+
+// RegistrationOTPRequest asks for an OTP to register a new patient with
+type RegistrationOTPRequest struct {
+	Phone string `json:"phone" binding:"required"`
 }
 
 // OTPData stores OTP with expiry time
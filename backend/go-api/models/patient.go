@@ -0,0 +1,162 @@
+package models
+
+// PatientAllergy is a recorded allergy of a patient to an ingredient or drug class.
+type PatientAllergy struct {
+	ID         int64  `json:"id"`
+	PatientID  string `json:"patient_id"`
+	Substance  string `json:"substance" binding:"required"` // Ingredient or class, e.g., "penicillin"
+	Reaction   string `json:"reaction"`                     // e.g., "Skin rash"
+	Severity   string `json:"severity"`                     // e.g., "mild", "severe"
+	RecordedBy string `json:"recorded_by"`                  // Clinic that recorded the allergy
+	CreatedAt  int64  `json:"created_at"`
+	RecordRemoval
+}
+
+// PatientCondition is a recorded condition that can contraindicate drugs,
+// e.g., "pregnancy" or "renal_impairment".
+type PatientCondition struct {
+	ID         int64  `json:"id"`
+	PatientID  string `json:"patient_id"`
+	Condition  string `json:"condition" binding:"required"`
+	Notes      string `json:"notes"`
+	RecordedBy string `json:"recorded_by"`
+	CreatedAt  int64  `json:"created_at"`
+	RecordRemoval
+}
+
+// RecordRemoval marks an allergy or condition that a clinic other than the one
+// that recorded it removed. Removed records stay in the medical profile but are
+// left out of the safety checks.
+type RecordRemoval struct {
+	RemovedBy     string `json:"removed_by,omitempty"`
+	RemovalReason string `json:"removal_reason,omitempty"`
+	RemovedAt     int64  `json:"removed_at,omitempty"`
+}
+
+// Removed reports whether the record was removed.
+func (r RecordRemoval) Removed() bool {
+	return r.RemovedAt != 0
+}
+
+// MedicalProfile groups the allergy and condition records shown to clinics and patients.
+type MedicalProfile struct {
+	PatientID  string             `json:"patient_id"`
+	Allergies  []PatientAllergy   `json:"allergies"`
+	Conditions []PatientCondition `json:"conditions"`
+}
+
+// Active returns the profile without its removed records.
+func (p MedicalProfile) Active() MedicalProfile {
+	active := MedicalProfile{PatientID: p.PatientID, Allergies: []PatientAllergy{}, Conditions: []PatientCondition{}}
+	for _, a := range p.Allergies {
+		if !a.Removed() {
+			active.Allergies = append(active.Allergies, a)
+		}
+	}
+	for _, c := range p.Conditions {
+		if !c.Removed() {
+			active.Conditions = append(active.Conditions, c)
+		}
+	}
+	return active
+}
+
+// Genders accepted on patient registration.
+const (
+	GenderMale   = "male"
+	GenderFemale = "female"
+	GenderOther  = "other"
+)
+
+// PatientDetails are the details a patient is registered with.
+type PatientDetails struct {
+	Name        string  `json:"name" binding:"required"`
+	DateOfBirth string  `json:"date_of_birth"` // YYYY-MM-DD; used for dose checks and duplicate detection
+	Gender      string  `json:"gender"`
+	WeightKg    float64 `json:"weight_kg"`
+}
+
+// PatientSignupRequest registers a patient from the patient app, confirming the
+// mobile number with an OTP from POST /v1/auth/register/otp.
+type PatientSignupRequest struct {
+	Phone string `json:"phone" binding:"required"`
+	OTP   string `json:"otp" binding:"required"`
+	PatientDetails
+}
+
+// WalkInPatientRequest registers a patient at a clinic's front desk.
+type WalkInPatientRequest struct {
+	Mobile     string `json:"mobile" binding:"required"`
+	ConfirmNew bool   `json:"confirm_new"` // Register even though possible duplicates were found
+	PatientDetails
+}
+
+// RegisteredPatient is a patient account as returned after registration.
+type RegisteredPatient struct {
+	PatientID    string  `json:"patient_id"`
+	Name         string  `json:"name"`
+	Mobile       string  `json:"mobile,omitempty"` // Empty for dependents
+	DateOfBirth  string  `json:"date_of_birth,omitempty"`
+	Gender       string  `json:"gender,omitempty"`
+	WeightKg     float64 `json:"weight_kg,omitempty"`
+	RegisteredBy string  `json:"registered_by,omitempty"` // Clinic of a walk-in registration
+}
+
+// DuplicatePatient is an existing patient that may be the same person as one being registered.
+type DuplicatePatient struct {
+	PatientID    string `json:"patient_id"`
+	Name         string `json:"name"`
+	DateOfBirth  string `json:"date_of_birth"`
+	MobileHint   string `json:"mobile_hint"`   // Masked, e.g., "98******10"
+	RegisteredBy string `json:"registered_by"` // Clinic that registered them; empty for self-registration
+	Reason       string `json:"reason"`
+}
+
+// DuplicateSameNameAndBirthDate flags a patient registered under the same name and
+// date of birth as an existing one, typically by another clinic with another number.
+const DuplicateSameNameAndBirthDate = "same_name_and_date_of_birth"
+
+// Permissions a guardian or caregiver holds on a linked patient profile.
+const (
+	ProfileView         = "view"
+	ProfileLogAdherence = "log_adherence"
+	ProfileManage       = "manage" // Guardians: refill requests and caregiver access
+)
+
+// RelationshipSelf is the relationship of an account to its own profile.
+const RelationshipSelf = "self"
+
+// PatientProfile is a patient record a logged-in patient can act on: their own
+// and those of dependents and of patients who made them a caregiver.
+type PatientProfile struct {
+	PatientID    string   `json:"patient_id"`
+	Name         string   `json:"name"`
+	Relationship string   `json:"relationship"` // "self", or e.g., "child", "parent"
+	Permissions  []string `json:"permissions"`
+	Dependent    bool     `json:"dependent"` // Has no mobile number of its own; reached through a guardian
+}
+
+// PatientLink gives a patient account access to another patient's profile.
+type PatientLink struct {
+	ID           int64    `json:"id"`
+	PatientID    string   `json:"patient_id"`
+	LinkedUserID string   `json:"linked_user_id"` // The guardian or caregiver account
+	LinkedName   string   `json:"linked_name"`
+	Relationship string   `json:"relationship"`
+	Permissions  []string `json:"permissions"`
+	Guardian     bool     `json:"guardian"` // Created the dependent profile; cannot be revoked
+	CreatedAt    int64    `json:"created_at"`
+}
+
+// DependentRequest adds a dependent profile, e.g., a child, under the logged-in account.
+type DependentRequest struct {
+	Relationship string `json:"relationship" binding:"required"` // e.g., "child", "parent"
+	PatientDetails
+}
+
+// CaregiverRequest gives the patient account registered with Mobile access to the current profile.
+type CaregiverRequest struct {
+	Mobile       string   `json:"mobile" binding:"required"`
+	Relationship string   `json:"relationship"`
+	Permissions  []string `json:"permissions"` // "view" (always granted) and "log_adherence"
+}
@@ -11,6 +11,10 @@ type DosageInstruction struct {
 	DosageQuantity  string `json:"dosage_quantity"`   // e.g., "1 Tablet"
 	DurationDays    int    `json:"duration_days"`
 	PatientNote     string `json:"patient_note"`
+	// Set when the doctor stops this drug after the prescription was issued.
+	Discontinued      bool   `json:"discontinued,omitempty"`
+	DiscontinuedAt    int64  `json:"discontinued_at,omitempty"`
+	DiscontinueReason string `json:"discontinue_reason,omitempty"`
 }
 
 // Prescription represents the complete digital prescription record.
@@ -24,8 +28,74 @@ type Prescription struct {
 	// AI-Processed Fields for the Patient App
 	OriginalDoctorText string `json:"original_doctor_text"`   // Available for validation
 	TranslatedText     string `json:"translated_text"`        // In patient's Regional Language
+	TranslationLanguage string `json:"translation_language,omitempty"` // Language of TranslatedText
 	AudioFileURL       string `json:"audio_file_url"`         // Narration of dosage/timing
+	// Safety checks: the doctor must set OverrideWarnings to save a prescription with blocking warnings.
+	OverrideWarnings  bool            `json:"override_warnings"`
+	SafetyWarnings    []SafetyWarning `json:"safety_warnings,omitempty"`
+	// Lifecycle: drafts can be edited freely; issued prescriptions only change
+	// through new versions (amendments, discontinued drugs, cancellation).
+	Status            string `json:"status"`
+	Version           int    `json:"version"` // 0 for drafts
+	CancelReason      string `json:"cancel_reason,omitempty"`
+	// Repeats: the patient can request RefillsAllowed follow-up prescriptions, each at
+	// least RefillIntervalDays after the previous fill. Refills point back via RefillOf.
+	RefillsAllowed     int    `json:"refills_allowed"`
+	RefillIntervalDays int    `json:"refill_interval_days"`
+	RefillsUsed        int    `json:"refills_used"`
+	RefillOf           string `json:"refill_of,omitempty"`
+	// Attribution: issued by the clinic (ClinicID) and, from a staff login, by this doctor.
+	PrescribedBy   int64  `json:"prescribed_by,omitempty"`
+	PrescriberName string `json:"prescriber_name,omitempty"`
 	CreatedAt         int64  `json:"created_at"`
+	UpdatedAt         int64  `json:"updated_at"`
+}
+
+// Prescription statuses.
+const (
+	PrescriptionDraft     = "draft"
+	PrescriptionIssued    = "issued"
+	PrescriptionCancelled = "cancelled"
+)
+
+// PrescriptionVersion is an immutable snapshot of an issued prescription, recorded
+// each time it is issued or changed.
+type PrescriptionVersion struct {
+	PrescriptionID string              `json:"prescription_id"`
+	Version        int                 `json:"version"`
+	ChangeType     string              `json:"change_type"` // issued, amended, drug_discontinued or cancelled
+	Reason         string              `json:"reason,omitempty"`
+	ChangedBy      string              `json:"changed_by"`
+	ChangedByMember int64              `json:"changed_by_member,omitempty"` // The staff member, if any
+	ChangedByName   string             `json:"changed_by_name,omitempty"`
+	Status         string              `json:"status"`
+	Diagnosis      string              `json:"diagnosis"`
+	Vitals         map[string]string   `json:"vitals"`
+	Instructions   []DosageInstruction `json:"instructions"`
+	SafetyWarnings []SafetyWarning     `json:"safety_warnings,omitempty"`
+	RefillsAllowed     int             `json:"refills_allowed"`
+	RefillIntervalDays int             `json:"refill_interval_days"`
+	CreatedAt      int64               `json:"created_at"`
+}
+
+// Prescription version change types.
+const (
+	ChangeIssued           = "issued"
+	ChangeAmended          = "amended"
+	ChangeDrugDiscontinued = "drug_discontinued"
+	ChangeCancelled        = "cancelled"
+)
+
+// PrescriptionAmendment is a doctor's change to an issued prescription. Omitted
+// fields keep their current values; the reason is recorded in the version history.
+type PrescriptionAmendment struct {
+	Reason           string              `json:"reason" binding:"required"`
+	Diagnosis        *string             `json:"diagnosis"`
+	Vitals           map[string]string   `json:"vitals"`
+	Instructions     []DosageInstruction `json:"instructions"`
+	RefillsAllowed     *int              `json:"refills_allowed"`
+	RefillIntervalDays *int              `json:"refill_interval_days"`
+	OverrideWarnings bool                `json:"override_warnings"`
 }
 
 // AdherenceRequest defines the structure for logging adherence.
@@ -0,0 +1,45 @@
+package models
+
+// Referral priorities, most urgent first.
+const (
+	ReferralStat    = "stat"
+	ReferralUrgent  = "urgent"
+	ReferralRoutine = "routine"
+)
+
+// Referral statuses. A referral is completed once the scanning center uploads a
+// report for it; further reports can still be attached.
+const (
+	ReferralPending   = "pending"
+	ReferralAccepted  = "accepted"
+	ReferralCompleted = "completed"
+	ReferralDeclined  = "declined"  // By the scanning center
+	ReferralCancelled = "cancelled" // By the referring clinic
+)
+
+// Referral is a clinic's order for tests on a patient at a scanning center.
+type Referral struct {
+	ID                 string   `json:"id"`
+	PatientID          string   `json:"patient_id" binding:"required"`
+	PatientName        string   `json:"patient_name"`
+	ClinicID           string   `json:"clinic_id"`
+	ClinicName         string   `json:"clinic_name"`
+	ScanningCenterID   string   `json:"scanning_center_id" binding:"required"`
+	ScanningCenterName string   `json:"scanning_center_name"`
+	ReferredBy         int64    `json:"referred_by,omitempty"` // Member ID of the referring doctor
+	ReferredByName     string   `json:"referred_by_name,omitempty"`
+	PrescriptionID     string   `json:"prescription_id,omitempty"` // Visit the tests were ordered at
+	Tests              []string `json:"tests" binding:"required"`  // e.g., "Chest X-ray PA view", "CBC"
+	Priority           string   `json:"priority"`                  // stat, urgent or routine (default)
+	ClinicalNotes      string   `json:"clinical_notes,omitempty"`  // For the scanning center; encrypted at rest
+	Status             string   `json:"status"`
+	StatusReason       string   `json:"status_reason,omitempty"`
+	ReportIDs          []string `json:"report_ids"`
+	CreatedAt          int64    `json:"created_at"`
+	UpdatedAt          int64    `json:"updated_at"`
+}
+
+// ReferralStatusRequest carries the reason a referral is declined or cancelled.
+type ReferralStatusRequest struct {
+	Reason string `json:"reason"`
+}
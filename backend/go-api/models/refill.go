@@ -0,0 +1,24 @@
+package models
+
+// RefillRequest is a patient's request for a repeat of an issued prescription,
+// decided by the prescribing clinic.
+type RefillRequest struct {
+	ID                int64  `json:"id"`
+	PrescriptionID    string `json:"prescription_id"`
+	PatientID         string `json:"patient_id"`
+	ClinicID          string `json:"clinic_id"`
+	Status            string `json:"status"` // pending, approved or denied
+	PatientNote       string `json:"patient_note,omitempty"`
+	DecisionNote      string `json:"decision_note,omitempty"` // Shown to the patient
+	DecidedBy         string `json:"decided_by,omitempty"`
+	NewPrescriptionID string `json:"new_prescription_id,omitempty"` // The follow-up prescription, once approved
+	CreatedAt         int64  `json:"created_at"`
+	DecidedAt         int64  `json:"decided_at,omitempty"`
+}
+
+// Refill request statuses.
+const (
+	RefillPending  = "pending"
+	RefillApproved = "approved"
+	RefillDenied   = "denied"
+)
@@ -0,0 +1,58 @@
+package models
+
+// Report statuses. The AI service moves an uploaded report on to "Ready to Share";
+// finalizing it shares it with the patient and the referring clinic.
+const (
+	ReportUploaded     = "Uploaded"
+	ReportProcessing   = "AI Processing"
+	ReportReadyToShare = "Ready to Share"
+	ReportShared       = "Shared"
+)
+
+// What a report share gives its recipient access to.
+const (
+	ShareAccessSummary  = "summary"  // The simplified summary, for patients
+	ShareAccessOriginal = "original" // The technical original and its text, for clinics
+)
+
+// Report is a diagnostic report as a recipient sees it. Patients only get the
+// simplified summary; FullTechnicalReport is left empty for them.
+type Report struct {
+	ID                  string `json:"id"`
+	PatientID           string `json:"patient_id"`
+	PatientName         string `json:"patient_name"`
+	ScanningCenterID    string `json:"scanning_center_id"`
+	ScanningCenterName  string `json:"scanning_center_name"`
+	ReferringClinicID   string `json:"referring_clinic_id,omitempty"`
+	ReferralID          string `json:"referral_id,omitempty"`
+	ScanType            string `json:"scan_type"`
+	SimplifiedSummary   string `json:"simplified_summary"`
+	SummaryLanguage     string `json:"summary_language,omitempty"` // Language SimplifiedSummary is in
+	FullTechnicalReport string `json:"full_technical_report,omitempty"`
+	Status              string `json:"status"`
+	CreatedAt           int64  `json:"created_at"`
+	SharedAt            int64  `json:"shared_at,omitempty"` // When it was shared with the caller
+	ReadAt              int64  `json:"read_at,omitempty"`   // When the caller first opened it
+	// Structured lab results, on a single report
+	LabResults []LabObservation `json:"lab_results,omitempty"`
+	// Glossary terms in SimplifiedSummary, for patients to tap for a definition
+	GlossaryTerms []GlossaryMatch `json:"glossary_terms,omitempty"`
+}
+
+// ReportShare is the delivery of a report to one recipient, with its read receipt.
+type ReportShare struct {
+	ID            int64  `json:"id"`
+	ReportID      string `json:"report_id"`
+	RecipientID   string `json:"recipient_id"`
+	RecipientName string `json:"recipient_name"`
+	RecipientType string `json:"recipient_type"` // patient or clinic
+	Access        string `json:"access"`         // summary or original
+	SharedAt      int64  `json:"shared_at"`
+	ReadAt        int64  `json:"read_at,omitempty"`
+}
+
+// FinalizeReportRequest optionally sets the simplified summary before sharing,
+// e.g., when the technician corrected the AI's wording or it is not ready.
+type FinalizeReportRequest struct {
+	SimplifiedSummary string `json:"simplified_summary"`
+}
@@ -0,0 +1,42 @@
+package models
+
+// Severity levels used by the prescription safety checks, from least to most serious.
+const (
+	SeverityMinor           = "minor"
+	SeverityModerate        = "moderate"
+	SeverityMajor           = "major"
+	SeverityContraindicated = "contraindicated"
+)
+
+// Warning types raised by the prescription safety checks.
+const (
+	WarningInteraction      = "interaction"
+	WarningDuplicateTherapy = "duplicate_therapy"
+	WarningAllergy          = "allergy"
+	WarningContraindication = "contraindication"
+	WarningDoseRange        = "dose_range"
+)
+
+// DrugInteraction is one row of the importable drug-drug interaction table.
+// DrugA and DrugB are normalized ingredient names, stored with DrugA < DrugB.
+type DrugInteraction struct {
+	DrugA       string `json:"drug_a"`
+	DrugB       string `json:"drug_b"`
+	Severity    string `json:"severity"`    // minor, moderate, major or contraindicated
+	Description string `json:"description"` // Shown to the doctor with the warning
+}
+
+// SafetyWarning describes a single problem found while checking a prescription.
+type SafetyWarning struct {
+	Type     string   `json:"type"`     // e.g., "interaction" or "duplicate_therapy"
+	Severity string   `json:"severity"` // One of the Severity* constants
+	Drugs    []string `json:"drugs"`    // Drug names as entered by the doctor
+	Message  string   `json:"message"`
+	// ActivePrescriptionID is set when the conflict is with an already active prescription.
+	ActivePrescriptionID string `json:"active_prescription_id,omitempty"`
+}
+
+// RequiresOverride reports whether the warning must be acknowledged before saving.
+func (w SafetyWarning) RequiresOverride() bool {
+	return w.Severity != SeverityMinor
+}
@@ -0,0 +1,81 @@
+package models
+
+// What a share link can point to.
+const (
+	ShareResourceReport       = "report"
+	ShareResourcePrescription = "prescription"
+)
+
+// Share link statuses, derived from its expiry, view count and revocation.
+const (
+	ShareLinkActive  = "active"
+	ShareLinkExpired = "expired"
+	ShareLinkUsedUp  = "used_up" // Reached its view limit
+	ShareLinkRevoked = "revoked"
+	ShareLinkLocked  = "locked" // Revoked after too many wrong PINs
+)
+
+// Outcomes of an access to a share link. Every access is recorded, including refused ones.
+const (
+	LinkAccessViewed      = "viewed"
+	LinkAccessPINRequired = "pin_required"
+	LinkAccessWrongPIN    = "wrong_pin"
+	LinkAccessLocked      = "locked"
+	LinkAccessExpired     = "expired"
+	LinkAccessUsedUp      = "used_up"
+	LinkAccessRevoked     = "revoked"
+	LinkAccessInvalid     = "invalid_token"
+)
+
+// ShareLink is a patient-generated link to one report or prescription, for
+// someone who is not on MediBridge. URL carries the signed token.
+type ShareLink struct {
+	ID           string `json:"id"`
+	PatientID    string `json:"patient_id"`
+	CreatedBy    string `json:"created_by"` // The patient, or a guardian acting on their profile
+	ResourceType string `json:"resource_type"`
+	ResourceID   string `json:"resource_id"`
+	Label        string `json:"label,omitempty"` // e.g., "For Dr. Mehta"
+	PINProtected bool   `json:"pin_protected"`
+	MaxViews     int    `json:"max_views,omitempty"` // 0 for no limit
+	ViewCount    int    `json:"view_count"`
+	Status       string `json:"status"`
+	URL          string `json:"url,omitempty"`
+	ExpiresAt    int64  `json:"expires_at"`
+	RevokedAt    int64  `json:"revoked_at,omitempty"`
+	CreatedAt    int64  `json:"created_at"`
+}
+
+// CreateShareLinkRequest selects the document to share and how the link is limited.
+type CreateShareLinkRequest struct {
+	ResourceType   string `json:"resource_type" binding:"required"`
+	ResourceID     string `json:"resource_id" binding:"required"`
+	Label          string `json:"label"`
+	ExpiresInHours int    `json:"expires_in_hours"` // Defaults to 72
+	PIN            string `json:"pin"`              // Optional, 4 to 8 digits
+	MaxViews       int    `json:"max_views"`        // Optional; 0 for no limit
+}
+
+// ShareLinkAccess is one recorded access to a share link.
+type ShareLinkAccess struct {
+	ID         int64  `json:"id"`
+	Outcome    string `json:"outcome"`
+	Format     string `json:"format"` // json or pdf
+	IPAddress  string `json:"ip_address"`
+	UserAgent  string `json:"user_agent"`
+	AccessedAt int64  `json:"accessed_at"`
+}
+
+// SharedDocument is what the public share link endpoint serves: the selected
+// document and nothing else about the patient.
+type SharedDocument struct {
+	ResourceType string        `json:"resource_type"`
+	PatientName  string        `json:"patient_name"`
+	Label        string        `json:"label,omitempty"`
+	ExpiresAt    int64         `json:"expires_at"`
+	MaxViews     int           `json:"max_views,omitempty"`
+	ViewCount    int           `json:"view_count"`
+	Report       *Report       `json:"report,omitempty"`
+	Prescription *Prescription `json:"prescription,omitempty"`
+	PDFURL       string        `json:"pdf_url,omitempty"` // Prescriptions only
+}
@@ -0,0 +1,47 @@
+package models
+
+// SourceLanguage is the language prescriptions and report summaries are written in.
+const SourceLanguage = "en"
+
+// Translatable fields, per resource type.
+const (
+	TranslationFieldInstructions = "instructions"       // Of a prescription: its dosage instructions
+	TranslationFieldSummary      = "simplified_summary" // Of a report
+)
+
+// Translation statuses. A translation is only served while it is ready and
+// was made from the current source text.
+const (
+	TranslationPending = "pending"
+	TranslationReady   = "ready"
+	TranslationFailed  = "failed"
+)
+
+// Translation is one field of a prescription or report in one language.
+type Translation struct {
+	ResourceType string `json:"resource_type"`
+	ResourceID   string `json:"resource_id"`
+	Field        string `json:"field"`
+	Language     string `json:"language"`
+	Text         string `json:"text,omitempty"`
+	Status       string `json:"status"`
+	// False once the source changed (e.g., an amended prescription) until it is translated again
+	Current      bool   `json:"current"`
+	TranslatedBy string `json:"translated_by,omitempty"` // "ai", "templates", or the clinic or scanning center that wrote it
+	UpdatedAt    int64  `json:"updated_at"`
+}
+
+// TranslationRequest asks for a prescription or report in another language.
+type TranslationRequest struct {
+	Language string `json:"language" binding:"required"`
+}
+
+// ManualTranslationRequest is a translation written or corrected by a person.
+type ManualTranslationRequest struct {
+	Text string `json:"text" binding:"required"`
+}
+
+// PatientPreferences are settings a patient chooses for their profile.
+type PatientPreferences struct {
+	PreferredLanguage string `json:"preferred_language"` // e.g., "hi"; empty for English
+}
@@ -0,0 +1,41 @@
+package models
+
+// PrescriptionVerification is the public answer to "is this printout genuine?".
+// It confirms who issued a prescription and whether it still stands, without
+// revealing the patient's identity or diagnosis.
+type PrescriptionVerification struct {
+	PrescriptionID string `json:"prescription_id"`
+	Authentic      bool   `json:"authentic"` // The clinic's signature matches this version
+	Status         string `json:"status"`    // "active", "amended" (a newer version exists) or "cancelled"
+	Message        string `json:"message"`
+	Version        int    `json:"version"`
+	CurrentVersion int    `json:"current_version"`
+	IssuedAt       int64  `json:"issued_at"`
+	SignedAt       int64  `json:"signed_at,omitempty"`
+	ClinicName     string `json:"clinic_name"`
+	DoctorName     string `json:"doctor_name,omitempty"`
+	RegistrationNo string `json:"registration_number,omitempty"`
+	PatientRef     string `json:"patient_ref"` // Masked patient ID, e.g., "PA***01"
+	// Only returned when the printout's signature is presented, i.e., to whoever holds the printout.
+	Medicines      []VerifiedMedicine `json:"medicines,omitempty"`
+	RefillsAllowed int                `json:"refills_allowed"`
+	KeyFingerprint string             `json:"key_fingerprint,omitempty"`
+	PublicKey      string             `json:"public_key,omitempty"` // Ed25519, base64
+}
+
+// VerifiedMedicine is a drug as signed on a prescription version.
+type VerifiedMedicine struct {
+	DrugName       string `json:"drug_name"`
+	Strength       string `json:"strength,omitempty"`
+	DosageQuantity string `json:"dosage_quantity"`
+	Frequency      string `json:"frequency"`
+	DurationDays   int    `json:"duration_days"`
+	Discontinued   bool   `json:"discontinued,omitempty"`
+}
+
+// Prescription verification statuses.
+const (
+	VerificationActive    = "active"
+	VerificationAmended   = "amended"
+	VerificationCancelled = "cancelled"
+)
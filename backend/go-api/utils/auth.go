@@ -16,25 +16,56 @@ var jwtSecretKey = []byte(os.Getenv("JWT_SECRET"))
 type CustomClaims struct {
 	ID   string `json:"id"`
 	Role string `json:"role"` // "Patient", "Clinic", or "Scanning"
+	// Set when a staff member of a clinic or scanning center logged in; ID is then the organization.
+	MemberID int64 `json:"member_id,omitempty"`
+	// Set when a guardian or caregiver switched to another patient's profile; ID is then that patient.
+	CaregiverID string `json:"caregiver_id,omitempty"`
 	jwt.RegisteredClaims
 }
 
 // GenerateToken creates a new JWT for a user
 func GenerateToken(userID string, userRole string) (string, error) {
-	if len(jwtSecretKey) == 0 {
-		return "", fmt.Errorf("JWT_SECRET not configured")
-	}
+	return GenerateMemberToken(userID, userRole, 0)
+}
+
+// GenerateMemberToken creates a new JWT for a staff member acting for the organization orgID.
+func GenerateMemberToken(orgID string, orgRole string, memberID int64) (string, error) {
 	expirationTime := time.Now().Add(24 * time.Hour) 
 
 	claims := &CustomClaims{
-		ID:   userID,
-		Role: userRole,
+		ID:       orgID,
+		Role:     orgRole,
+		MemberID: memberID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+	return signClaims(claims)
+}
+
+// GenerateProfileToken creates a new JWT for the patient account caregiverID
+// acting on the linked profile of patientID.
+func GenerateProfileToken(patientID string, caregiverID string) (string, error) {
+	expirationTime := time.Now().Add(24 * time.Hour)
+
+	claims := &CustomClaims{
+		ID:          patientID,
+		Role:        "Patient",
+		CaregiverID: caregiverID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
+	return signClaims(claims)
+}
 
+// signClaims signs claims with the JWT secret.
+func signClaims(claims *CustomClaims) (string, error) {
+	if len(jwtSecretKey) == 0 {
+		return "", fmt.Errorf("JWT_SECRET not configured")
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString(jwtSecretKey)
 	
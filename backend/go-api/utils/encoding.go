@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Text encodings recognised by DecodeText.
+const (
+	EncodingUTF8        = "utf-8"
+	EncodingUTF16LE     = "utf-16le"
+	EncodingUTF16BE     = "utf-16be"
+	EncodingWindows1252 = "windows-1252"
+)
+
+// sniffSize is how much of a file is inspected to guess its encoding.
+const sniffSize = 64 * 1024
+
+// windows1252High maps the bytes 0x80-0x9F of Windows-1252 to Unicode; every
+// other byte maps to the code point of the same value. Zero entries are unused
+// bytes and decode to the replacement character.
+var windows1252High = [32]rune{
+	'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+	0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+}
+
+// DecodeText wraps r so it yields UTF-8, returning the detected encoding.
+// Pharmacy billing software commonly exports catalogs as UTF-16 ("Unicode text"
+// from Excel) or as ANSI Windows-1252, with or without a byte order mark. A BOM
+// decides the encoding; otherwise the first 64 KB are inspected, and anything
+// that is not valid UTF-8 is read as Windows-1252. Decoding is streamed.
+func DecodeText(r io.Reader) (io.Reader, string, error) {
+	buffered := bufio.NewReaderSize(r, sniffSize)
+	head, err := buffered.Peek(sniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, "", err
+	}
+
+	switch {
+	case bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}):
+		buffered.Discard(3)
+		return buffered, EncodingUTF8, nil
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}):
+		buffered.Discard(2)
+		return &utf16Reader{src: buffered, bigEndian: false}, EncodingUTF16LE, nil
+	case bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+		buffered.Discard(2)
+		return &utf16Reader{src: buffered, bigEndian: true}, EncodingUTF16BE, nil
+	}
+
+	if encoding := guessUTF16(head); encoding != "" {
+		return &utf16Reader{src: buffered, bigEndian: encoding == EncodingUTF16BE}, encoding, nil
+	}
+	if validUTF8Prefix(head, len(head) == sniffSize) {
+		return buffered, EncodingUTF8, nil
+	}
+	return &windows1252Reader{src: buffered}, EncodingWindows1252, nil
+}
+
+// guessUTF16 spots BOM-less UTF-16 text, where nearly every other byte of
+// mostly-ASCII content is zero.
+func guessUTF16(head []byte) string {
+	if len(head) < 4 {
+		return ""
+	}
+	evenZeros, oddZeros := 0, 0
+	for i, b := range head {
+		if b != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			evenZeros++
+		} else {
+			oddZeros++
+		}
+	}
+	pairs := len(head) / 2
+	switch {
+	case oddZeros > pairs*3/4 && evenZeros == 0:
+		return EncodingUTF16LE
+	case evenZeros > pairs*3/4 && oddZeros == 0:
+		return EncodingUTF16BE
+	}
+	return ""
+}
+
+// validUTF8Prefix reports whether head is valid UTF-8, allowing a rune to be
+// cut off at the end when head is only the start of the file.
+func validUTF8Prefix(head []byte, truncated bool) bool {
+	if utf8.Valid(head) {
+		return true
+	}
+	if !truncated {
+		return false
+	}
+	for cut := 1; cut < utf8.UTFMax && cut < len(head); cut++ {
+		if utf8.Valid(head[:len(head)-cut]) {
+			return true
+		}
+	}
+	return false
+}
+
+// windows1252Reader decodes a Windows-1252 stream to UTF-8.
+type windows1252Reader struct {
+	src *bufio.Reader
+	out []byte
+}
+
+func (w *windows1252Reader) Read(p []byte) (int, error) {
+	for len(w.out) == 0 {
+		chunk := make([]byte, 4096)
+		n, err := w.src.Read(chunk)
+		for _, b := range chunk[:n] {
+			switch {
+			case b < 0x80:
+				w.out = append(w.out, b)
+			case b < 0xA0:
+				r := windows1252High[b-0x80]
+				if r == 0 {
+					r = utf8.RuneError
+				}
+				w.out = utf8.AppendRune(w.out, r)
+			default:
+				w.out = utf8.AppendRune(w.out, rune(b))
+			}
+		}
+		if err != nil && len(w.out) == 0 {
+			return 0, err
+		}
+		if err != nil {
+			break
+		}
+	}
+	n := copy(p, w.out)
+	w.out = w.out[n:]
+	return n, nil
+}
+
+// utf16Reader decodes a UTF-16 stream to UTF-8.
+type utf16Reader struct {
+	src       *bufio.Reader
+	bigEndian bool
+	pending   []byte // Bytes of an incomplete code unit or surrogate pair
+	out       []byte
+}
+
+func (u *utf16Reader) Read(p []byte) (int, error) {
+	for len(u.out) == 0 {
+		chunk := make([]byte, 4096)
+		n, err := u.src.Read(chunk)
+		data := append(u.pending, chunk[:n]...)
+
+		units := []uint16{}
+		i := 0
+		for ; i+1 < len(data); i += 2 {
+			unit := uint16(data[i]) | uint16(data[i+1])<<8
+			if u.bigEndian {
+				unit = uint16(data[i])<<8 | uint16(data[i+1])
+			}
+			units = append(units, unit)
+		}
+		// Keep a trailing high surrogate until its pair arrives.
+		if err == nil && len(units) > 0 && utf16.IsSurrogate(rune(units[len(units)-1])) && units[len(units)-1] < 0xDC00 {
+			units = units[:len(units)-1]
+			i -= 2
+		}
+		u.pending = append([]byte{}, data[i:]...)
+
+		for _, r := range utf16.Decode(units) {
+			u.out = utf8.AppendRune(u.out, r)
+		}
+		if err != nil && len(u.out) == 0 {
+			return 0, err
+		}
+		if err != nil {
+			break
+		}
+	}
+	n := copy(p, u.out)
+	u.out = u.out[n:]
+	return n, nil
+}
@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode/utf16"
+)
+
+// encodeUTF16 encodes s as UTF-16 in the given byte order, without a BOM.
+func encodeUTF16(s string, bigEndian bool) []byte {
+	var b []byte
+	for _, unit := range utf16.Encode([]rune(s)) {
+		if bigEndian {
+			b = append(b, byte(unit>>8), byte(unit))
+		} else {
+			b = append(b, byte(unit), byte(unit>>8))
+		}
+	}
+	return b
+}
+
+func TestDecodeText(t *testing.T) {
+	const catalog = "name,strength,name_hi\nParacetamol,500 mg,पैरासिटामोल\nAmoxicillin,250 mg,\n"
+	// A multi-byte rune straddling the end of the inspected head
+	straddling := strings.Repeat("a", sniffSize-1) + "é tail\n"
+
+	tests := []struct {
+		name         string
+		input        []byte
+		wantEncoding string
+		want         string
+	}{
+		{"empty", nil, EncodingUTF8, ""},
+		{"UTF-8", []byte(catalog), EncodingUTF8, catalog},
+		{"UTF-8 with BOM", append([]byte{0xEF, 0xBB, 0xBF}, catalog...), EncodingUTF8, catalog},
+		{"UTF-8 rune cut at the end of the head", []byte(straddling), EncodingUTF8, straddling},
+		{"UTF-16LE with BOM", append([]byte{0xFF, 0xFE}, encodeUTF16(catalog, false)...), EncodingUTF16LE, catalog},
+		{"UTF-16BE with BOM", append([]byte{0xFE, 0xFF}, encodeUTF16(catalog, true)...), EncodingUTF16BE, catalog},
+		{"UTF-16LE without BOM", encodeUTF16(catalog, false), EncodingUTF16LE, catalog},
+		{"UTF-16BE without BOM", encodeUTF16(catalog, true), EncodingUTF16BE, catalog},
+		{"UTF-16LE surrogate pair", append([]byte{0xFF, 0xFE}, encodeUTF16("note,💊 twice daily\n", false)...), EncodingUTF16LE, "note,💊 twice daily\n"},
+		{
+			"Windows-1252",
+			[]byte("name,manufacturer,price\nCaf\xe9 Syrup,Cipla \x96 India,\x80 5\n"),
+			EncodingWindows1252,
+			"name,manufacturer,price\nCafé Syrup,Cipla – India,€ 5\n",
+		},
+		{"Windows-1252 unused byte", []byte("A\x81B\xff"), EncodingWindows1252, "A�Bÿ"},
+		{"Latin-1 after a long ASCII head", append(bytes.Repeat([]byte("x"), 100), 0xE9), EncodingWindows1252, strings.Repeat("x", 100) + "é"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, encoding, err := DecodeText(bytes.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("DecodeText: %v", err)
+			}
+			if encoding != tt.wantEncoding {
+				t.Errorf("encoding = %s, want %s", encoding, tt.wantEncoding)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("decoded %q, want %q", truncateForTest(string(got)), truncateForTest(tt.want))
+			}
+		})
+	}
+}
+
+func TestDecodersAcrossReadBoundaries(t *testing.T) {
+	// Reading one byte at a time splits code units, surrogate pairs and
+	// Windows-1252 sequences across reads.
+	const text = "Dolo 650 — 1 tablet 💊 after food, ದಿನಕ್ಕೆ ಎರಡು ಬಾರಿ\n"
+	for _, bigEndian := range []bool{false, true} {
+		u := &utf16Reader{src: bufio.NewReaderSize(iotest.OneByteReader(bytes.NewReader(encodeUTF16(text, bigEndian))), 16), bigEndian: bigEndian}
+		got, err := io.ReadAll(iotest.OneByteReader(u))
+		if err != nil || string(got) != text {
+			t.Errorf("UTF-16 (big endian %v): decoded %q, err %v; want %q", bigEndian, got, err, text)
+		}
+	}
+
+	w := &windows1252Reader{src: bufio.NewReaderSize(iotest.OneByteReader(strings.NewReader("\x93Crocin\x94 \x96 \x80 30")), 16)}
+	got, err := io.ReadAll(iotest.OneByteReader(w))
+	if want := "“Crocin” – € 30"; err != nil || string(got) != want {
+		t.Errorf("Windows-1252: decoded %q, err %v; want %q", got, err, want)
+	}
+}
+
+func TestGuessUTF16NeedsMostlyASCII(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  string
+	}{
+		{"too short", []byte{'a', 0}, ""},
+		{"ASCII", []byte("name,strength"), ""},
+		{"UTF-16LE", encodeUTF16("name,strength", false), EncodingUTF16LE},
+		{"UTF-16BE", encodeUTF16("name,strength", true), EncodingUTF16BE},
+		// Without ASCII there are no zero bytes to go by
+		{"Devanagari only", encodeUTF16("पैरासिटामोल", false), ""},
+		{"binary", []byte{0, 0, 1, 0, 0, 2, 3, 0}, ""},
+	}
+	for _, tt := range tests {
+		if got := guessUTF16(tt.input); got != tt.want {
+			t.Errorf("%s: guessUTF16 = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func truncateForTest(s string) string {
+	if len(s) > 80 {
+		return s[:40] + "..." + s[len(s)-40:]
+	}
+	return s
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"context"
+	"errors"
 	"log"
 	"os"
 	"time"
@@ -16,6 +17,9 @@ import (
 // AIClientConn stores the connection object to the Python AI Microservice
 var AIClientConn *grpc.ClientConn
 
+// ErrAINotConnected is returned by calls that need an answer from the AI service while it is not connected.
+var ErrAINotConnected = errors.New("AI service not connected")
+
 // InitGRPCClient establishes the connection to the Python AI Microservice.
 func InitGRPCClient() {
 	// Reference the Python AI service by its Docker service name 'ai-service'
@@ -56,7 +60,7 @@ func CloseGRPCClient() {
 // TriggerTranslationAndAudio (Called from Clinic App flow)
 func TriggerTranslationAndAudio(prescriptionData models.Prescription) error {
 	if AIClientConn == nil {
-		log.Println("Warning: AI service not connected. Skipping translation and audio generation.")
+		log.Println("Warning: AI service not connected. Skipping translation and audio generation; patients get the template narration.")
 		return nil
 	}
 	// In a real implementation: Call the remote procedure on AIClientConn.
@@ -66,6 +70,19 @@ func TriggerTranslationAndAudio(prescriptionData models.Prescription) error {
 	return nil
 }
 
+// TriggerTranslation (Called when a patient needs a prescription or report in another language)
+// Fails with ErrAINotConnected when the AI service is down, so the request is marked failed rather than left pending.
+func TriggerTranslation(resourceType, resourceID, field, language, sourceText string) error {
+	if AIClientConn == nil {
+		return ErrAINotConnected
+	}
+	// In a real implementation: Call the remote procedure on AIClientConn.
+	log.Printf("gRPC: Triggering %s translation of %s %s (%s)", language, resourceType, resourceID, field)
+	time.Sleep(100 * time.Millisecond) // Simulate AI processing time
+	// If successful, the Python service would store the text in translations (translated_by 'ai') and mark it ready
+	return nil
+}
+
 // TriggerReportProcessing (Called from Scanning Center App flow)
 func TriggerReportProcessing(reportID string, fileData []byte) error {
 	if AIClientConn == nil {
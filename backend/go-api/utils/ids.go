@@ -0,0 +1,30 @@
+package utils
+
+import "fmt"
+
+// FormatUserID builds an account ID from a role prefix and a number drawn from
+// the user_number_seq sequence, e.g., FormatUserID("PAT", 1000) is "PAT0010009".
+// The number is zero-padded to six digits and followed by a Luhn check digit, so
+// an ID misread over the phone or mistyped at a clinic desk does not silently
+// name another patient.
+func FormatUserID(prefix string, n int64) string {
+	digits := fmt.Sprintf("%06d", n)
+	return prefix + digits + string(rune('0'+luhnCheckDigit(digits)))
+}
+
+// luhnCheckDigit returns the digit that makes digits+check pass the Luhn check.
+func luhnCheckDigit(digits string) int {
+	sum := 0
+	double := true
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return (10 - sum%10) % 10
+}
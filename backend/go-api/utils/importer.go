@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ImportRow is one record of an import file. Fields are keyed by lowercase column
+// name, after the column mapping has been applied.
+type ImportRow struct {
+	Line   int // Line number for CSV, row number for XLSX, record number for JSON
+	Fields map[string]string
+}
+
+// RowError reports a record that could not be read; the reader can continue after it.
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// RowReader streams the records of an import file. Next returns io.EOF after the
+// last record and a *RowError for a single unreadable record.
+type RowReader interface {
+	Next() (ImportRow, error)
+}
+
+// ParserFunc opens a RowReader over an already decoded (UTF-8) stream.
+type ParserFunc func(r io.Reader) (RowReader, error)
+
+var (
+	parsersMu sync.RWMutex
+	parsers   = map[string]ParserFunc{
+		"csv":  newCSVRowReader,
+		"json": newJSONRowReader,
+		"xlsx": newXLSXRowReader,
+	}
+)
+
+// RegisterParser adds or replaces the parser for an import format, e.g., "tsv".
+func RegisterParser(format string, parser ParserFunc) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+	parsers[strings.ToLower(format)] = parser
+}
+
+// DetectFormat guesses the import format from a file name's extension, defaulting to CSV.
+func DetectFormat(filename string) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	if _, ok := parsers[ext]; ok {
+		return ext
+	}
+	return "csv"
+}
+
+// NewRowReader opens an import file in the given format. Text formats are
+// decoded to UTF-8 first (see DecodeText), and every column name is renamed
+// through mapping (source header -> target column) when present.
+func NewRowReader(format string, r io.Reader, mapping map[string]string) (RowReader, error) {
+	parsersMu.RLock()
+	parser, ok := parsers[strings.ToLower(format)]
+	parsersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported import format %q", format)
+	}
+
+	if format != "xlsx" {
+		decoded, _, err := DecodeText(r)
+		if err != nil {
+			return nil, err
+		}
+		r = decoded
+	}
+
+	reader, err := parser(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(mapping) == 0 {
+		return reader, nil
+	}
+	return &mappedRowReader{reader: reader, mapping: normalizeMapping(mapping)}, nil
+}
+
+// ParseColumnMapping parses a mapping such as "Product Name=name; Company=manufacturer".
+func ParseColumnMapping(spec string) (map[string]string, error) {
+	mapping := map[string]string{}
+	for _, pair := range strings.Split(spec, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		source, target, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(source) == "" || strings.TrimSpace(target) == "" {
+			return nil, fmt.Errorf("invalid column mapping %q, expected 'source=target'", pair)
+		}
+		mapping[strings.TrimSpace(source)] = strings.TrimSpace(target)
+	}
+	return mapping, nil
+}
+
+// normalizeColumn lowercases and trims a column name so headers compare loosely.
+func normalizeColumn(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+func normalizeMapping(mapping map[string]string) map[string]string {
+	normalized := map[string]string{}
+	for source, target := range mapping {
+		normalized[normalizeColumn(source)] = normalizeColumn(target)
+	}
+	return normalized
+}
+
+// mappedRowReader renames the columns of another reader.
+type mappedRowReader struct {
+	reader  RowReader
+	mapping map[string]string
+}
+
+func (m *mappedRowReader) Next() (ImportRow, error) {
+	row, err := m.reader.Next()
+	if err != nil {
+		return row, err
+	}
+	fields := map[string]string{}
+	for column, value := range row.Fields {
+		if target, ok := m.mapping[column]; ok {
+			column = target
+		}
+		fields[column] = value
+	}
+	row.Fields = fields
+	return row, nil
+}
+
+// csvRowReader streams a CSV file whose first record is the header.
+type csvRowReader struct {
+	reader  *csv.Reader
+	headers []string
+}
+
+func newCSVRowReader(r io.Reader) (RowReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	headers, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read CSV header: %w", err)
+	}
+	for i := range headers {
+		headers[i] = normalizeColumn(headers[i])
+	}
+	return &csvRowReader{reader: reader, headers: headers}, nil
+}
+
+func (c *csvRowReader) Next() (ImportRow, error) {
+	record, err := c.reader.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return ImportRow{}, &RowError{Line: parseErr.Line, Err: parseErr.Err}
+		}
+		return ImportRow{}, err
+	}
+
+	line, _ := c.reader.FieldPos(0)
+	fields := map[string]string{}
+	for i, value := range record {
+		if i < len(c.headers) && c.headers[i] != "" {
+			fields[c.headers[i]] = strings.TrimSpace(value)
+		}
+	}
+	return ImportRow{Line: line, Fields: fields}, nil
+}
@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// jsonRowReader streams the objects of a JSON array, or of a stream of
+// newline-delimited objects, one record at a time.
+type jsonRowReader struct {
+	decoder *json.Decoder
+	inArray bool
+	record  int
+}
+
+func newJSONRowReader(r io.Reader) (RowReader, error) {
+	buffered := bufio.NewReader(r)
+	first := byte(0)
+	for {
+		b, err := buffered.ReadByte()
+		if err != nil {
+			break
+		}
+		if !strings.ContainsRune(" \t\r\n", rune(b)) {
+			first = b
+			buffered.UnreadByte()
+			break
+		}
+	}
+
+	decoder := json.NewDecoder(buffered)
+	decoder.UseNumber()
+
+	reader := &jsonRowReader{decoder: decoder}
+	if first == '[' {
+		if _, err := decoder.Token(); err != nil {
+			return nil, fmt.Errorf("could not read JSON: %w", err)
+		}
+		reader.inArray = true
+	}
+	return reader, nil
+}
+
+func (j *jsonRowReader) Next() (ImportRow, error) {
+	if !j.decoder.More() {
+		if j.inArray {
+			if _, err := j.decoder.Token(); err != nil {
+				return ImportRow{}, err
+			}
+		}
+		return ImportRow{}, io.EOF
+	}
+
+	j.record++
+	var object map[string]interface{}
+	if err := j.decoder.Decode(&object); err != nil {
+		if _, ok := err.(*json.UnmarshalTypeError); ok {
+			return ImportRow{}, &RowError{Line: j.record, Err: fmt.Errorf("record is not an object")}
+		}
+		return ImportRow{}, fmt.Errorf("record %d: %w", j.record, err)
+	}
+
+	fields := map[string]string{}
+	flattenJSON(fields, "", object)
+	return ImportRow{Line: j.record, Fields: fields}, nil
+}
+
+// flattenJSON turns one JSON object into columns: arrays become semicolon-separated
+// lists and nested objects become "parent_child" columns.
+func flattenJSON(fields map[string]string, prefix string, object map[string]interface{}) {
+	for key, value := range object {
+		column := normalizeColumn(key)
+		if prefix != "" {
+			column = prefix + "_" + column
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			flattenJSON(fields, column, nested)
+			continue
+		}
+		fields[column] = jsonCell(value)
+	}
+}
+
+// jsonCell formats a JSON value as a cell.
+func jsonCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(v)
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		items := []string{}
+		for _, item := range v {
+			if cell := jsonCell(item); cell != "" {
+				items = append(items, cell)
+			}
+		}
+		return strings.Join(items, ";")
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
@@ -0,0 +1,307 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Limits on the uncompressed size of workbook parts, so a small zip cannot
+// expand into gigabytes. Worksheets are streamed and may be larger than the
+// shared strings and other parts, which are decoded whole.
+const (
+	maxXLSXSheetBytes = 1 << 30
+	maxXLSXPartBytes  = 100 << 20
+)
+
+// xlsxMaxColumn is the last column a worksheet can have (XFD).
+const xlsxMaxColumn = 16383
+
+// xlsxRichText is a shared or inline string, either plain or made of formatted runs.
+type xlsxRichText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxRichText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var b strings.Builder
+	for _, run := range t.Runs {
+		b.WriteString(run.Text)
+	}
+	return b.String()
+}
+
+type xlsxCell struct {
+	Ref    string       `xml:"r,attr"`
+	Type   string       `xml:"t,attr"`
+	Value  string       `xml:"v"`
+	Inline xlsxRichText `xml:"is"`
+}
+
+type xlsxRow struct {
+	Number int        `xml:"r,attr"`
+	Cells  []xlsxCell `xml:"c"`
+}
+
+// xlsxRowReader reads the first worksheet of an XLSX workbook, using its first
+// non-empty row as the header. The archive is held in memory (zip needs random
+// access), but worksheet rows are decoded one at a time.
+type xlsxRowReader struct {
+	sheet   io.ReadCloser
+	decoder *xml.Decoder
+	strings []string
+	headers []string
+}
+
+func newXLSXRowReader(r io.Reader) (RowReader, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not a valid XLSX file: %w", err)
+	}
+
+	files := map[string]*zip.File{}
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	sheetPath, err := firstSheetPath(files)
+	if err != nil {
+		return nil, err
+	}
+	sharedStrings, err := readSharedStrings(files["xl/sharedStrings.xml"])
+	if err != nil {
+		return nil, err
+	}
+
+	sheetFile, ok := files[sheetPath]
+	if !ok {
+		return nil, fmt.Errorf("XLSX worksheet %s is missing", sheetPath)
+	}
+	sheet, err := sheetFile.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	limited := &xlsxPartReader{r: sheet, name: sheetPath, remaining: maxXLSXSheetBytes}
+	reader := &xlsxRowReader{sheet: sheet, decoder: xml.NewDecoder(limited), strings: sharedStrings}
+	for reader.headers == nil {
+		row, err := reader.nextRow()
+		if err == io.EOF {
+			sheet.Close()
+			return nil, fmt.Errorf("XLSX worksheet has no header row")
+		}
+		if err != nil {
+			sheet.Close()
+			return nil, err
+		}
+		if len(row) == 0 {
+			continue
+		}
+		for column, value := range row {
+			for len(reader.headers) <= column {
+				reader.headers = append(reader.headers, "")
+			}
+			reader.headers[column] = normalizeColumn(value)
+		}
+	}
+	return reader, nil
+}
+
+func (x *xlsxRowReader) Next() (ImportRow, error) {
+	for {
+		var row xlsxRow
+		values, err := x.nextRowInto(&row)
+		if err != nil {
+			if err == io.EOF {
+				x.sheet.Close()
+			}
+			return ImportRow{}, err
+		}
+		if len(values) == 0 {
+			continue // Skip blank rows
+		}
+
+		fields := map[string]string{}
+		for column, value := range values {
+			if column < len(x.headers) && x.headers[column] != "" {
+				fields[x.headers[column]] = value
+			}
+		}
+		return ImportRow{Line: row.Number, Fields: fields}, nil
+	}
+}
+
+func (x *xlsxRowReader) nextRow() (map[int]string, error) {
+	var row xlsxRow
+	return x.nextRowInto(&row)
+}
+
+// nextRowInto decodes the next <row> element, returning its non-empty cells by column index.
+func (x *xlsxRowReader) nextRowInto(row *xlsxRow) (map[int]string, error) {
+	for {
+		token, err := x.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+		if err := x.decoder.DecodeElement(row, &start); err != nil {
+			return nil, err
+		}
+
+		values := map[int]string{}
+		for i, cell := range row.Cells {
+			column := i
+			if cell.Ref != "" {
+				var ok bool
+				if column, ok = xlsxColumnIndex(cell.Ref); !ok {
+					return nil, &RowError{Line: row.Number, Err: fmt.Errorf("invalid cell reference %q", cell.Ref)}
+				}
+			}
+			if column > xlsxMaxColumn {
+				return nil, &RowError{Line: row.Number, Err: fmt.Errorf("row has more than %d columns", xlsxMaxColumn+1)}
+			}
+			value := cell.Value
+			switch cell.Type {
+			case "s":
+				index, err := strconv.Atoi(cell.Value)
+				if err != nil || index < 0 || index >= len(x.strings) {
+					return nil, &RowError{Line: row.Number, Err: fmt.Errorf("invalid shared string in cell %s", cell.Ref)}
+				}
+				value = x.strings[index]
+			case "inlineStr":
+				value = cell.Inline.String()
+			case "b":
+				value = strconv.FormatBool(cell.Value == "1")
+			}
+			if value = strings.TrimSpace(value); value != "" {
+				values[column] = value
+			}
+		}
+		return values, nil
+	}
+}
+
+// firstSheetPath finds the archive path of the workbook's first worksheet.
+func firstSheetPath(files map[string]*zip.File) (string, error) {
+	var workbook struct {
+		Sheets []struct {
+			RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodeZipXML(files["xl/workbook.xml"], &workbook); err != nil {
+		return "", fmt.Errorf("could not read XLSX workbook: %w", err)
+	}
+	if len(workbook.Sheets) == 0 {
+		return "", fmt.Errorf("XLSX workbook has no worksheets")
+	}
+
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decodeZipXML(files["xl/_rels/workbook.xml.rels"], &rels); err != nil {
+		return "", fmt.Errorf("could not read XLSX relationships: %w", err)
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID == workbook.Sheets[0].RelID {
+			if strings.HasPrefix(rel.Target, "/") {
+				return strings.TrimPrefix(rel.Target, "/"), nil
+			}
+			return path.Join("xl", rel.Target), nil
+		}
+	}
+	return "", fmt.Errorf("XLSX worksheet relationship %s not found", workbook.Sheets[0].RelID)
+}
+
+// readSharedStrings loads the workbook's shared string table, which may be absent.
+func readSharedStrings(file *zip.File) ([]string, error) {
+	if file == nil {
+		return nil, nil
+	}
+	var table struct {
+		Items []xlsxRichText `xml:"si"`
+	}
+	if err := decodeZipXML(file, &table); err != nil {
+		return nil, fmt.Errorf("could not read XLSX shared strings: %w", err)
+	}
+	values := make([]string, len(table.Items))
+	for i, item := range table.Items {
+		values[i] = item.String()
+	}
+	return values, nil
+}
+
+func decodeZipXML(file *zip.File, v interface{}) error {
+	if file == nil {
+		return fmt.Errorf("file missing from archive")
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(&xlsxPartReader{r: rc, name: file.Name, remaining: maxXLSXPartBytes}).Decode(v)
+}
+
+// xlsxPartReader fails once a workbook part turns out longer than remaining bytes.
+type xlsxPartReader struct {
+	r         io.Reader
+	name      string
+	remaining int64
+}
+
+func (p *xlsxPartReader) Read(b []byte) (int, error) {
+	if p.remaining <= 0 {
+		var probe [1]byte
+		if n, err := io.ReadFull(p.r, probe[:]); n == 0 && err == io.EOF {
+			return 0, io.EOF
+		}
+		return 0, fmt.Errorf("XLSX part %s is too large when uncompressed", p.name)
+	}
+	if int64(len(b)) > p.remaining {
+		b = b[:p.remaining]
+	}
+	n, err := p.r.Read(b)
+	p.remaining -= int64(n)
+	return n, err
+}
+
+// xlsxColumnIndex converts a cell reference such as "AB12" to a zero-based
+// column index. References without column letters or past the last column
+// (XFD) are invalid.
+func xlsxColumnIndex(ref string) (int, bool) {
+	index := 0
+	letters := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		if letters++; letters > 3 {
+			return 0, false
+		}
+		index = index*26 + int(r-'A'+1)
+	}
+	if letters == 0 || index-1 > xlsxMaxColumn {
+		return 0, false
+	}
+	return index - 1, true
+}
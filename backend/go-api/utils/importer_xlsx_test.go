@@ -0,0 +1,213 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// buildXLSX returns a workbook whose first worksheet holds the given <row>
+// elements, with an optional shared string table.
+func buildXLSX(t *testing.T, rows string, sharedStrings []string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	add := func(name, content string) {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(f, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add("xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+	xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+	<sheets><sheet name="Drugs" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`)
+	add("xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+	<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`)
+	add("xl/worksheets/sheet1.xml", `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`+rows+`</sheetData></worksheet>`)
+	if sharedStrings != nil {
+		var sst strings.Builder
+		sst.WriteString(`<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+		for _, s := range sharedStrings {
+			sst.WriteString("<si><t>" + s + "</t></si>")
+		}
+		sst.WriteString("</sst>")
+		add("xl/sharedStrings.xml", sst.String())
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// readAllRows reads every row, collecting row errors instead of stopping at them.
+func readAllRows(t *testing.T, rows RowReader) ([]ImportRow, []*RowError) {
+	t.Helper()
+	var got []ImportRow
+	var rowErrors []*RowError
+	for {
+		row, err := rows.Next()
+		if err == io.EOF {
+			return got, rowErrors
+		}
+		var rowErr *RowError
+		if errors.As(err, &rowErr) {
+			rowErrors = append(rowErrors, rowErr)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		got = append(got, row)
+	}
+}
+
+func TestXLSXRowReader(t *testing.T) {
+	const header = `<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="inlineStr"><is><t> Strength </t></is></c><c r="C1" t="s"><v>1</v></c></row>`
+	shared := []string{"Name", "Discontinued", "Paracetamol"}
+
+	tests := []struct {
+		name       string
+		rows       string
+		want       []ImportRow
+		wantErrors []int // Lines of the expected row errors
+	}{
+		{
+			name: "shared, inline and boolean cells",
+			rows: header +
+				`<row r="2"><c r="A2" t="s"><v>2</v></c><c r="B2"><v>500</v></c><c r="C2" t="b"><v>1</v></c></row>` +
+				`<row r="3"><c r="A3" t="inlineStr"><is><r><t>Amoxi</t></r><r><t>cillin</t></r></is></c><c r="C3" t="b"><v>0</v></c></row>`,
+			want: []ImportRow{
+				{Line: 2, Fields: map[string]string{"name": "Paracetamol", "strength": "500", "discontinued": "true"}},
+				{Line: 3, Fields: map[string]string{"name": "Amoxicillin", "discontinued": "false"}},
+			},
+		},
+		{
+			name: "blank rows are skipped",
+			rows: `<row r="1"/>` + header +
+				`<row r="2"/><row r="3"><c r="A3"><v> </v></c></row>` +
+				`<row r="4"><c r="A4" t="s"><v>2</v></c></row>`,
+			want: []ImportRow{{Line: 4, Fields: map[string]string{"name": "Paracetamol"}}},
+		},
+		{
+			name: "cells without references are positional",
+			rows: header + `<row r="2"><c t="s"><v>2</v></c><c><v>650</v></c></row>`,
+			want: []ImportRow{{Line: 2, Fields: map[string]string{"name": "Paracetamol", "strength": "650"}}},
+		},
+		{
+			name: "cells past the header are ignored",
+			rows: header + `<row r="2"><c r="A2" t="s"><v>2</v></c><c r="XFD2"><v>x</v></c></row>`,
+			want: []ImportRow{{Line: 2, Fields: map[string]string{"name": "Paracetamol"}}},
+		},
+		{
+			name: "reference without column letters",
+			rows: header + `<row r="2"><c r="2"><v>x</v></c></row>` +
+				`<row r="3"><c r="A3" t="s"><v>2</v></c></row>`,
+			want:       []ImportRow{{Line: 3, Fields: map[string]string{"name": "Paracetamol"}}},
+			wantErrors: []int{2},
+		},
+		{
+			name:       "reference past the last column",
+			rows:       header + `<row r="2"><c r="XFE2"><v>x</v></c></row><row r="3"><c r="ZZZZZZZZZZ3"><v>x</v></c></row>`,
+			wantErrors: []int{2, 3},
+		},
+		{
+			name:       "shared string index out of range",
+			rows:       header + `<row r="2"><c r="A2" t="s"><v>7</v></c></row><row r="3"><c r="A3" t="s"><v>-1</v></c></row>`,
+			wantErrors: []int{2, 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := NewRowReader("xlsx", bytes.NewReader(buildXLSX(t, tt.rows, shared)), nil)
+			if err != nil {
+				t.Fatalf("NewRowReader: %v", err)
+			}
+			got, rowErrors := readAllRows(t, rows)
+			if len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("rows = %+v, want %+v", got, tt.want)
+			}
+			var lines []int
+			for _, e := range rowErrors {
+				lines = append(lines, e.Line)
+			}
+			if !reflect.DeepEqual(lines, tt.wantErrors) {
+				t.Errorf("row errors on lines %v (%v), want %v", lines, rowErrors, tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestXLSXRowReaderRejectsBadWorkbooks(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not a zip", []byte("name,strength\nParacetamol,500\n")},
+		{"no header row", buildXLSX(t, `<row r="1"/><row r="2"><c r="A2"><v> </v></c></row>`, nil)},
+		{"header reference without column letters", buildXLSX(t, `<row r="1"><c r="1" t="inlineStr"><is><t>name</t></is></c></row>`, nil)},
+		{"header reference past the last column", buildXLSX(t, `<row r="1"><c r="AAAA1" t="inlineStr"><is><t>name</t></is></c></row>`, nil)},
+		{"shared string without a table", buildXLSX(t, `<row r="1"><c r="A1" t="s"><v>0</v></c></row>`, nil)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRowReader("xlsx", bytes.NewReader(tt.data), nil); err == nil {
+				t.Error("NewRowReader succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestXLSXColumnIndex(t *testing.T) {
+	tests := []struct {
+		ref    string
+		column int
+		ok     bool
+	}{
+		{"A1", 0, true},
+		{"Z9", 25, true},
+		{"AA10", 26, true},
+		{"AB12", 27, true},
+		{"XFD1048576", 16383, true},
+		{"XFE1", 0, false},
+		{"ZZZ1", 0, false},
+		{"AAAA1", 0, false},
+		{"ZZZZZZZZZZ1", 0, false},
+		{"1", 0, false},
+		{"", 0, false},
+		{"a1", 0, false},
+	}
+	for _, tt := range tests {
+		column, ok := xlsxColumnIndex(tt.ref)
+		if column != tt.column || ok != tt.ok {
+			t.Errorf("xlsxColumnIndex(%q) = %d, %v; want %d, %v", tt.ref, column, ok, tt.column, tt.ok)
+		}
+	}
+}
+
+func TestXLSXPartReaderLimit(t *testing.T) {
+	r := &xlsxPartReader{r: strings.NewReader(strings.Repeat("x", 100)), name: "xl/sharedStrings.xml", remaining: 64}
+	n, err := io.Copy(io.Discard, r)
+	if err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("err = %v, want a too large error", err)
+	}
+	if n != 64 {
+		t.Errorf("read %d bytes before failing, want 64", n)
+	}
+
+	r = &xlsxPartReader{r: strings.NewReader(strings.Repeat("x", 64)), name: "xl/sharedStrings.xml", remaining: 64}
+	if n, err := io.Copy(io.Discard, r); err != nil || n != 64 {
+		t.Errorf("part of exactly the limit: read %d bytes, err %v; want 64 and no error", n, err)
+	}
+}
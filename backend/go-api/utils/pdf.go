@@ -0,0 +1,480 @@
+package utils
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg" // Signature and logo uploads
+	_ "image/png"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// A4 page size in PDF points (1/72 inch).
+const (
+	PageWidth  = 595.28
+	PageHeight = 841.89
+)
+
+// PDFFont selects the font of a text run.
+type PDFFont int
+
+const (
+	FontRegular PDFFont = iota // Helvetica
+	FontBold                   // Helvetica-Bold
+)
+
+// PDFImage is an image added to a document, drawn with DrawImage.
+type PDFImage struct {
+	name          string
+	Width, Height int // Pixels
+}
+
+// PDFDocument builds a simple PDF 1.4 file page by page: text in the standard
+// Helvetica fonts (Windows-1252 characters only), lines, rectangles, images and
+// QR codes. Coordinates are in points from the top-left corner of the page; the
+// y of a text run is its baseline.
+//
+// Indian scripts are not supported: they need a shaping engine (conjuncts,
+// reordered vowel signs) on top of an embedded font.
+type PDFDocument struct {
+	Title  string
+	pages  []*bytes.Buffer
+	images []pdfImageObject
+}
+
+type pdfImageObject struct {
+	name   string
+	dict   string
+	data   []byte
+	alpha  []byte // Flate-compressed soft mask, if any
+	width  int
+	height int
+}
+
+// NewPDF returns an empty document.
+func NewPDF() *PDFDocument {
+	return &PDFDocument{}
+}
+
+// AddPage starts a new page; drawing goes to the last page added.
+func (d *PDFDocument) AddPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+}
+
+// PageCount returns the number of pages added so far.
+func (d *PDFDocument) PageCount() int {
+	return len(d.pages)
+}
+
+func (d *PDFDocument) page() *bytes.Buffer {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+	return d.pages[len(d.pages)-1]
+}
+
+// SetFillColor sets the color of text and filled shapes (components 0-1).
+func (d *PDFDocument) SetFillColor(r, g, b float64) {
+	fmt.Fprintf(d.page(), "%s %s %s rg\n", pdfNum(r), pdfNum(g), pdfNum(b))
+}
+
+// SetStrokeColor sets the color of lines and rectangle outlines (components 0-1).
+func (d *PDFDocument) SetStrokeColor(r, g, b float64) {
+	fmt.Fprintf(d.page(), "%s %s %s RG\n", pdfNum(r), pdfNum(g), pdfNum(b))
+}
+
+// Text draws a single line of text with its baseline at y.
+func (d *PDFDocument) Text(x, y float64, font PDFFont, size float64, text string) {
+	if text == "" {
+		return
+	}
+	fontName := "F1"
+	if font == FontBold {
+		fontName = "F2"
+	}
+	fmt.Fprintf(d.page(), "BT /%s %s Tf %s %s Td %s Tj ET\n",
+		fontName, pdfNum(size), pdfNum(x), pdfNum(PageHeight-y), pdfLiteral(toWinAnsi(text)))
+}
+
+// TextWidth returns the width of a line of text in points.
+func (d *PDFDocument) TextWidth(font PDFFont, size float64, text string) float64 {
+	widths := &helveticaWidths
+	if font == FontBold {
+		widths = &helveticaBoldWidths
+	}
+	units := 0
+	for _, b := range toWinAnsi(text) {
+		if b >= 32 && b <= 126 {
+			units += int(widths[b-32])
+		} else {
+			units += 556
+		}
+	}
+	return float64(units) * size / 1000
+}
+
+// WrapText breaks text into lines no wider than width, at spaces where it can.
+// Line breaks in the text are kept.
+func (d *PDFDocument) WrapText(font PDFFont, size float64, text string, width float64) []string {
+	lines := []string{}
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if d.TextWidth(font, size, candidate) <= width {
+				line = candidate
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+			// Break words that are too long on their own
+			line = ""
+			for _, r := range word {
+				if line != "" && d.TextWidth(font, size, line+string(r)) > width {
+					lines = append(lines, line)
+					line = ""
+				}
+				line += string(r)
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// Line draws a straight line of the given width.
+func (d *PDFDocument) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(d.page(), "%s w %s %s m %s %s l S\n",
+		pdfNum(width), pdfNum(x1), pdfNum(PageHeight-y1), pdfNum(x2), pdfNum(PageHeight-y2))
+}
+
+// Rect draws a rectangle with its top-left corner at x, y, filled or outlined.
+func (d *PDFDocument) Rect(x, y, w, h float64, fill bool) {
+	op := "S"
+	if fill {
+		op = "f"
+	}
+	fmt.Fprintf(d.page(), "%s %s %s %s re %s\n", pdfNum(x), pdfNum(PageHeight-y-h), pdfNum(w), pdfNum(h), op)
+}
+
+// AddImage adds a JPEG or PNG image to the document. JPEGs are embedded as they
+// are; other images are stored losslessly, with their transparency.
+func (d *PDFDocument) AddImage(data []byte) (PDFImage, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return PDFImage{}, err
+	}
+	obj := pdfImageObject{
+		name:   fmt.Sprintf("Im%d", len(d.images)+1),
+		width:  config.Width,
+		height: config.Height,
+	}
+
+	switch {
+	case format == "jpeg" && config.ColorModel == color.GrayModel:
+		obj.dict, obj.data = "/ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /DCTDecode", data
+	case format == "jpeg" && config.ColorModel == color.YCbCrModel:
+		obj.dict, obj.data = "/ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /DCTDecode", data
+	default:
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return PDFImage{}, err
+		}
+		if obj.data, obj.alpha, err = flateImage(img); err != nil {
+			return PDFImage{}, err
+		}
+		obj.dict = "/ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode"
+	}
+
+	d.images = append(d.images, obj)
+	return PDFImage{name: obj.name, Width: obj.width, Height: obj.height}, nil
+}
+
+// DrawImage draws an image scaled into the box with its top-left corner at x, y.
+func (d *PDFDocument) DrawImage(img PDFImage, x, y, w, h float64) {
+	fmt.Fprintf(d.page(), "q %s 0 0 %s %s %s cm /%s Do Q\n",
+		pdfNum(w), pdfNum(h), pdfNum(x), pdfNum(PageHeight-y-h), img.name)
+}
+
+// DrawQR draws a QR code as a square of the given size at x, y, including a
+// quiet zone of four modules. It leaves the fill color black.
+func (d *PDFDocument) DrawQR(q *QRCode, x, y, size float64) {
+	module := size / float64(q.Size()+8)
+	d.SetFillColor(1, 1, 1)
+	d.Rect(x, y, size, size, true)
+	d.SetFillColor(0, 0, 0)
+	page := d.page()
+	for row := 0; row < q.Size(); row++ {
+		for col := 0; col < q.Size(); col++ {
+			if q.Dark(col, row) {
+				// Slightly oversized modules avoid hairline gaps in some viewers
+				fmt.Fprintf(page, "%s %s %s %s re\n",
+					pdfNum(x+float64(col+4)*module), pdfNum(PageHeight-y-float64(row+5)*module),
+					pdfNum(module+0.01), pdfNum(module+0.01))
+			}
+		}
+	}
+	page.WriteString("f\n")
+}
+
+// Bytes writes out the complete PDF file.
+func (d *PDFDocument) Bytes() ([]byte, error) {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+	w := &pdfWriter{}
+
+	// Fixed object numbers: 1 catalog, 2 page tree, 3 resources, 4 info
+	catalog, pageTree, resources, info := w.reserve(), w.reserve(), w.reserve(), w.reserve()
+
+	fonts := "/F1 << /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >> " +
+		"/F2 << /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>"
+
+	xobjects := ""
+	for _, img := range d.images {
+		smask := ""
+		if img.alpha != nil {
+			ref, err := w.stream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d "+
+				"/ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode", img.width, img.height), img.alpha, false)
+			if err != nil {
+				return nil, err
+			}
+			smask = fmt.Sprintf(" /SMask %d 0 R", ref)
+		}
+		ref, err := w.stream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d %s%s",
+			img.width, img.height, img.dict, smask), img.data, false)
+		if err != nil {
+			return nil, err
+		}
+		xobjects += fmt.Sprintf(" /%s %d 0 R", img.name, ref)
+	}
+	w.set(resources, fmt.Sprintf("<< /ProcSet [/PDF /Text /ImageB /ImageC] /Font << %s >> /XObject <<%s >> >>", fonts, xobjects))
+
+	kids := []string{}
+	for _, content := range d.pages {
+		contentRef, err := w.stream("", content.Bytes(), true)
+		if err != nil {
+			return nil, err
+		}
+		pageRef := w.add(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources %d 0 R /Contents %d 0 R >>",
+			pageTree, pdfNum(PageWidth), pdfNum(PageHeight), resources, contentRef))
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageRef))
+	}
+	w.set(pageTree, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids)))
+	w.set(catalog, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pageTree))
+	w.set(info, fmt.Sprintf("<< /Title %s /Producer (MediBridge) >>", pdfTextString(d.Title)))
+
+	return w.finish(catalog, info), nil
+}
+
+// flateImage returns the RGB samples of an image and, if it is not fully
+// opaque, its alpha channel, both Flate-compressed.
+func flateImage(img image.Image) ([]byte, []byte, error) {
+	bounds := img.Bounds()
+	rgb := make([]byte, 0, bounds.Dx()*bounds.Dy()*3)
+	alpha := make([]byte, 0, bounds.Dx()*bounds.Dy())
+	opaque := true
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			rgb = append(rgb, c.R, c.G, c.B)
+			alpha = append(alpha, c.A)
+			if c.A != 0xFF {
+				opaque = false
+			}
+		}
+	}
+
+	data, err := deflate(rgb)
+	if err != nil || opaque {
+		return data, nil, err
+	}
+	mask, err := deflate(alpha)
+	return data, mask, err
+}
+
+func deflate(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// pdfWriter numbers the objects of a PDF file and writes the cross-reference table.
+type pdfWriter struct {
+	objects [][]byte // Index 0 is object 1
+}
+
+// reserve allocates an object number to be filled in later with set.
+func (w *pdfWriter) reserve() int {
+	w.objects = append(w.objects, nil)
+	return len(w.objects)
+}
+
+func (w *pdfWriter) set(ref int, body string) {
+	w.objects[ref-1] = []byte(body)
+}
+
+func (w *pdfWriter) add(body string) int {
+	ref := w.reserve()
+	w.set(ref, body)
+	return ref
+}
+
+// stream adds a stream object with extra dictionary entries, compressing it when asked.
+func (w *pdfWriter) stream(dict string, data []byte, compress bool) (int, error) {
+	if compress {
+		var err error
+		if data, err = deflate(data); err != nil {
+			return 0, err
+		}
+		dict += " /Filter /FlateDecode"
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<< %s /Length %d >>\nstream\n", strings.TrimSpace(dict), len(data))
+	b.Write(data)
+	b.WriteString("\nendstream")
+
+	ref := w.reserve()
+	w.objects[ref-1] = b.Bytes()
+	return ref, nil
+}
+
+func (w *pdfWriter) finish(root, info int) []byte {
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(w.objects))
+	for i, body := range w.objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n", i+1)
+		out.Write(body)
+		out.WriteString("\nendobj\n")
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(w.objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(w.objects)+1, root, info, xref)
+	return out.Bytes()
+}
+
+// WriteTo writes the PDF file to w.
+func (d *PDFDocument) WriteTo(w io.Writer) (int64, error) {
+	data, err := d.Bytes()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(data)
+	return int64(n), err
+}
+
+// pdfNum formats a coordinate with at most two decimals.
+func pdfNum(v float64) string {
+	s := strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.2f", v), "0"), ".")
+	if s == "-0" || s == "" {
+		return "0"
+	}
+	return s
+}
+
+// pdfLiteral writes bytes as a PDF literal string, escaping delimiters.
+func pdfLiteral(b []byte) string {
+	var s strings.Builder
+	s.WriteByte('(')
+	for _, c := range b {
+		switch c {
+		case '(', ')', '\\':
+			s.WriteByte('\\')
+			s.WriteByte(c)
+		case '\n', '\r':
+			s.WriteByte(' ')
+		default:
+			s.WriteByte(c)
+		}
+	}
+	s.WriteByte(')')
+	return s.String()
+}
+
+// pdfTextString encodes document metadata: plain ASCII as a literal, anything
+// else as UTF-16 with a byte order mark.
+func pdfTextString(text string) string {
+	ascii := true
+	for _, r := range text {
+		if r > 126 || r < 32 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return pdfLiteral([]byte(text))
+	}
+	var s strings.Builder
+	s.WriteString("<FEFF")
+	for _, unit := range utf16.Encode([]rune(text)) {
+		fmt.Fprintf(&s, "%04X", unit)
+	}
+	s.WriteByte('>')
+	return s.String()
+}
+
+// toWinAnsi encodes text for the standard fonts; characters they cannot show become '?'.
+func toWinAnsi(text string) []byte {
+	out := make([]byte, 0, len(text))
+	for _, r := range text {
+		b, ok := winAnsiByte(r)
+		if !ok {
+			b = '?'
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+func winAnsiByte(r rune) (byte, bool) {
+	if r < 0x80 || (r >= 0xA0 && r <= 0xFF) {
+		return byte(r), true
+	}
+	for i, high := range windows1252High {
+		if high == r {
+			return byte(0x80 + i), true
+		}
+	}
+	return 0, false
+}
+
+// Glyph widths of Helvetica and Helvetica-Bold for the characters 32-126, in 1/1000 em.
+var (
+	helveticaWidths = [95]uint16{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	}
+	helveticaBoldWidths = [95]uint16{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	}
+)
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPDFCrossReferenceTable(t *testing.T) {
+	d := NewPDF()
+	d.Title = "Prescription — Dr. Rao"
+	d.Text(40, 60, FontBold, 14, "Rx (refill) \\ 2")
+	d.AddPage()
+	d.Text(40, 60, FontRegular, 10, "Page two")
+	q, err := EncodeQR([]byte("https://medibridge.example/v/abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.DrawQR(q, 40, 100, 80)
+	data, err := d.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(data, []byte("%%EOF\n")) {
+		t.Fatal("missing PDF header or trailer")
+	}
+	m := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(data)
+	if m == nil {
+		t.Fatal("missing startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(data[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+
+	table := strings.Split(string(data[xref:]), "\n")
+	var count int
+	if _, err := fmt.Sscanf(table[1], "0 %d", &count); err != nil {
+		t.Fatalf("xref subsection header %q: %v", table[1], err)
+	}
+	if !strings.Contains(string(data), fmt.Sprintf("/Size %d ", count)) {
+		t.Errorf("trailer /Size does not match the %d xref entries", count)
+	}
+	for i := 1; i < count; i++ {
+		entry := table[2+i]
+		if len(entry) != 19 || !strings.HasSuffix(entry, " 00000 n ") {
+			t.Fatalf("xref entry %d is malformed: %q", i, entry)
+		}
+		offset, _ := strconv.Atoi(entry[:10])
+		if want := fmt.Sprintf("%d 0 obj\n", i); !bytes.HasPrefix(data[offset:], []byte(want)) {
+			t.Errorf("xref entry %d points at %q, want %q", i, data[offset:offset+len(want)], want)
+		}
+	}
+	if got := bytes.Count(data, []byte("/Type /Page ")); got != 2 {
+		t.Errorf("%d pages, want 2", got)
+	}
+}
+
+func TestPDFStrings(t *testing.T) {
+	literals := []struct {
+		in, want string
+	}{
+		{"Dolo 650", "(Dolo 650)"},
+		{"Rx (refill) \\ 2", `(Rx \(refill\) \\ 2)`},
+		{"two\nlines\r", "(two lines )"},
+	}
+	for _, tt := range literals {
+		if got := pdfLiteral([]byte(tt.in)); got != tt.want {
+			t.Errorf("pdfLiteral(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+
+	if got, want := toWinAnsi("Café – € 5 ₹ पैरा"), []byte("Caf\xe9 \x96 \x80 5 ? ????"); !bytes.Equal(got, want) {
+		t.Errorf("toWinAnsi = %q, want %q", got, want)
+	}
+
+	if got := pdfTextString("Prescription"); got != "(Prescription)" {
+		t.Errorf("pdfTextString(ASCII) = %s", got)
+	}
+	if got, want := pdfTextString("Rx ₹"), "<FEFF00520078002020B9>"; got != want {
+		t.Errorf("pdfTextString(non-ASCII) = %s, want %s", got, want)
+	}
+}
+
+func TestPDFWrapText(t *testing.T) {
+	d := NewPDF()
+	// R is 722 and x 500 units wide
+	if got := d.TextWidth(FontRegular, 10, "Rx"); got < 12.219 || got > 12.221 {
+		t.Errorf("TextWidth(Rx) = %v, want 12.22", got)
+	}
+	if regular, bold := d.TextWidth(FontRegular, 10, "Rx"), d.TextWidth(FontBold, 10, "Rx"); bold <= regular {
+		t.Errorf("bold width %v not wider than regular %v", bold, regular)
+	}
+
+	text := "Take one tablet twice daily after food\n\nAvoid alcohol. Supercalifragilisticexpialidocious"
+	width := 100.0
+	lines := d.WrapText(FontRegular, 10, text, width)
+	for _, line := range lines {
+		if w := d.TextWidth(FontRegular, 10, line); w > width {
+			t.Errorf("line %q is %v wide, over %v", line, w, width)
+		}
+	}
+	squash := strings.NewReplacer(" ", "", "\n", "")
+	if squash.Replace(strings.Join(lines, "")) != squash.Replace(text) {
+		t.Errorf("wrapping lost text: %q", lines)
+	}
+	if len(lines) < 5 || lines[0] != "Take one tablet twice" {
+		t.Errorf("lines = %q", lines)
+	}
+	blank := false
+	for _, line := range lines {
+		blank = blank || line == ""
+	}
+	if !blank {
+		t.Errorf("the empty paragraph was dropped: %q", lines)
+	}
+}
@@ -0,0 +1,451 @@
+package utils
+
+import (
+	"errors"
+)
+
+// QRCode is a QR code symbol (ISO/IEC 18004) holding bytes, at error correction
+// level M, which survives about 15% damage; enough for a printed link.
+type QRCode struct {
+	size    int
+	modules [][]bool // [y][x], true is dark
+}
+
+// ErrQRDataTooLong is returned when the data does not fit in a version 40 symbol.
+var ErrQRDataTooLong = errors.New("data too long for a QR code")
+
+// Level M error correction codewords per block and number of blocks, by version (index 1-40).
+var (
+	qrECCPerBlock = [41]int{0, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26,
+		26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28}
+	qrNumBlocks = [41]int{0, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16,
+		17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49}
+)
+
+// EncodeQR encodes data in byte mode in the smallest QR code version that holds it.
+func EncodeQR(data []byte) (*QRCode, error) {
+	version := 0
+	for v := 1; v <= 40; v++ {
+		countBits := 8
+		if v >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) <= qrDataCodewords(v)*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, ErrQRDataTooLong
+	}
+
+	// Byte mode segment, terminator and padding
+	var bits qrBitBuffer
+	bits.append(0x4, 4)
+	if version >= 10 {
+		bits.append(len(data), 16)
+	} else {
+		bits.append(len(data), 8)
+	}
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	capacity := qrDataCodewords(version) * 8
+	terminator := capacity - len(bits)
+	if terminator > 4 {
+		terminator = 4
+	}
+	bits.append(0, terminator)
+	bits.append(0, (8-len(bits)%8)%8)
+	codewords := bits.bytes()
+	for pad := byte(0xEC); len(codewords) < qrDataCodewords(version); pad ^= 0xEC ^ 0x11 {
+		codewords = append(codewords, pad)
+	}
+
+	q := newQRCode(version)
+	isFunction := q.drawFunctionPatterns(version)
+	q.drawCodewords(qrAddECC(codewords, version), isFunction)
+
+	// Keep the mask with the lowest penalty
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask, isFunction)
+		q.drawFormatBits(mask)
+		if penalty := q.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		q.applyMask(mask, isFunction) // Undo
+	}
+	q.applyMask(best, isFunction)
+	q.drawFormatBits(best)
+	return q, nil
+}
+
+// Size returns the width and height of the symbol in modules, without the quiet zone.
+func (q *QRCode) Size() int {
+	return q.size
+}
+
+// Dark reports whether the module at column x, row y is dark.
+func (q *QRCode) Dark(x, y int) bool {
+	return q.modules[y][x]
+}
+
+func newQRCode(version int) *QRCode {
+	size := version*4 + 17
+	q := &QRCode{size: size, modules: make([][]bool, size)}
+	for y := range q.modules {
+		q.modules[y] = make([]bool, size)
+	}
+	return q
+}
+
+// qrRawDataModules is the number of modules available for codewords in a version.
+func qrRawDataModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		numAlign := version/7 + 2
+		result -= (25*numAlign-10)*numAlign - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+// qrDataCodewords is the number of data (non error correction) codewords in a version.
+func qrDataCodewords(version int) int {
+	return qrRawDataModules(version)/8 - qrECCPerBlock[version]*qrNumBlocks[version]
+}
+
+// qrAlignmentPositions returns the row/column centers of the alignment patterns.
+func qrAlignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	numAlign := version/7 + 2
+	step := (version*4 + numAlign*2 + 1) / (numAlign*2 - 2) * 2
+	if version == 32 {
+		step = 26
+	}
+	positions := make([]int, numAlign)
+	positions[0] = 6
+	for i, pos := numAlign-1, version*4+17-7; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+// drawFunctionPatterns draws the finder, timing and alignment patterns and
+// reserves the format and version areas, returning which modules it used.
+func (q *QRCode) drawFunctionPatterns(version int) [][]bool {
+	isFunction := make([][]bool, q.size)
+	for y := range isFunction {
+		isFunction[y] = make([]bool, q.size)
+	}
+	set := func(x, y int, dark bool) {
+		q.modules[y][x] = dark
+		isFunction[y][x] = true
+	}
+
+	for i := 0; i < q.size; i++ {
+		set(6, i, i%2 == 0)
+		set(i, 6, i%2 == 0)
+	}
+
+	for _, center := range [][2]int{{3, 3}, {q.size - 4, 3}, {3, q.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := center[0]+dx, center[1]+dy
+				if x >= 0 && x < q.size && y >= 0 && y < q.size {
+					dist := maxInt(absInt(dx), absInt(dy))
+					set(x, y, dist != 2 && dist != 4)
+				}
+			}
+		}
+	}
+
+	positions := qrAlignmentPositions(version)
+	last := len(positions) - 1
+	for i, cx := range positions {
+		for j, cy := range positions {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue // Overlaps a finder pattern
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					set(cx+dx, cy+dy, maxInt(absInt(dx), absInt(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	// Format areas, filled in by drawFormatBits, and the dark module
+	for i := 0; i < 9; i++ {
+		isFunction[8][i] = true
+		isFunction[i][8] = true
+	}
+	for i := 0; i < 8; i++ {
+		isFunction[8][q.size-1-i] = true
+		isFunction[q.size-1-i][8] = true
+	}
+	set(8, q.size-8, true)
+
+	if version >= 7 {
+		rem := version
+		for i := 0; i < 12; i++ {
+			rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+		}
+		bits := version<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := (bits>>i)&1 != 0
+			a, b := q.size-11+i%3, i/3
+			set(a, b, dark)
+			set(b, a, dark)
+		}
+	}
+	return isFunction
+}
+
+// drawFormatBits writes both copies of the format information (level M and the mask).
+func (q *QRCode) drawFormatBits(mask int) {
+	data := 0<<3 | mask // Level M is 00
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 != 0 }
+
+	for i := 0; i <= 5; i++ {
+		q.modules[i][8] = bit(i)
+	}
+	q.modules[7][8] = bit(6)
+	q.modules[8][8] = bit(7)
+	q.modules[8][7] = bit(8)
+	for i := 9; i < 15; i++ {
+		q.modules[8][14-i] = bit(i)
+	}
+
+	for i := 0; i < 8; i++ {
+		q.modules[8][q.size-1-i] = bit(i)
+	}
+	for i := 8; i < 15; i++ {
+		q.modules[q.size-15+i][8] = bit(i)
+	}
+	q.modules[q.size-8][8] = true
+}
+
+// drawCodewords places the interleaved codewords in the zigzag order of the standard.
+func (q *QRCode) drawCodewords(data []byte, isFunction [][]bool) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // Skip the vertical timing pattern
+		}
+		for vert := 0; vert < q.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = q.size - 1 - vert // Upward column
+				}
+				if !isFunction[y][x] && i < len(data)*8 {
+					q.modules[y][x] = (data[i>>3]>>(7-uint(i&7)))&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask inverts the data modules selected by a mask pattern; applying it twice undoes it.
+func (q *QRCode) applyMask(mask int, isFunction [][]bool) {
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !isFunction[y][x] {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores how hard the symbol is to scan: long runs of one color, 2x2
+// blocks and an unbalanced dark/light ratio. Any mask is valid; this only picks
+// a good one. The finder-lookalike rule of the standard is left out.
+func (q *QRCode) penalty() int {
+	result := 0
+	for y := 0; y < q.size; y++ {
+		for _, line := range [2]func(i int) bool{
+			func(i int) bool { return q.modules[y][i] },
+			func(i int) bool { return q.modules[i][y] },
+		} {
+			run := 1
+			for i := 1; i < q.size; i++ {
+				if line(i) == line(i-1) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					result += run - 2
+				}
+				run = 1
+			}
+			if run >= 5 {
+				result += run - 2
+			}
+		}
+	}
+
+	dark := 0
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if q.modules[y][x] {
+				dark++
+			}
+			if x > 0 && y > 0 {
+				c := q.modules[y][x]
+				if c == q.modules[y-1][x] && c == q.modules[y][x-1] && c == q.modules[y-1][x-1] {
+					result += 3
+				}
+			}
+		}
+	}
+	total := q.size * q.size
+	k := (absInt(dark*20-total*10)+total-1)/total - 1
+	if k > 0 {
+		result += k * 10
+	}
+	return result
+}
+
+// qrAddECC splits the data codewords into blocks, appends each block's
+// Reed-Solomon error correction and interleaves the result.
+func qrAddECC(data []byte, version int) []byte {
+	numBlocks := qrNumBlocks[version]
+	eccLen := qrECCPerBlock[version]
+	rawCodewords := qrRawDataModules(version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	divisor := qrReedSolomonDivisor(eccLen)
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := range blocks {
+		n := shortBlockLen - eccLen
+		if i >= numShortBlocks {
+			n++
+		}
+		block := append([]byte{}, data[k:k+n]...)
+		k += n
+		ecc := qrReedSolomonRemainder(block, divisor)
+		if i < numShortBlocks {
+			block = append(block, 0) // Placeholder, skipped when interleaving
+		}
+		blocks[i] = append(block, ecc...)
+	}
+
+	result := make([]byte, 0, rawCodewords)
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			if i != shortBlockLen-eccLen || j >= numShortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+// qrReedSolomonDivisor returns the generator polynomial of the given degree,
+// without its leading term, highest power first.
+func qrReedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = qrMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = qrMultiply(root, 0x02)
+	}
+	return result
+}
+
+// qrReedSolomonRemainder returns the error correction codewords for data.
+func qrReedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= qrMultiply(d, factor)
+		}
+	}
+	return result
+}
+
+// qrMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func qrMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+	return byte(z)
+}
+
+// qrBitBuffer is a sequence of bits, most significant first.
+type qrBitBuffer []bool
+
+func (b *qrBitBuffer) append(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		*b = append(*b, (value>>uint(i))&1 != 0)
+	}
+}
+
+func (b qrBitBuffer) bytes() []byte {
+	result := make([]byte, len(b)/8)
+	for i, bit := range b {
+		if bit {
+			result[i/8] |= 1 << uint(7-i%8)
+		}
+	}
+	return result
+}
+
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
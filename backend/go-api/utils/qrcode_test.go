@@ -0,0 +1,303 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Format information strings for error correction level M, by mask (ISO/IEC 18004, table C.1).
+var qrTestFormatM = [8]int{
+	0x5412, 0x5125, 0x5E7C, 0x5B4B, 0x45F9, 0x40CE, 0x4F97, 0x4AA0,
+}
+
+// qrTestMasks are the data mask conditions of the standard, by mask number.
+var qrTestMasks = [8]func(x, y int) bool{
+	func(x, y int) bool { return (x+y)%2 == 0 },
+	func(x, y int) bool { return y%2 == 0 },
+	func(x, y int) bool { return x%3 == 0 },
+	func(x, y int) bool { return (x+y)%3 == 0 },
+	func(x, y int) bool { return (x/3+y/2)%2 == 0 },
+	func(x, y int) bool { return x*y%2+x*y%3 == 0 },
+	func(x, y int) bool { return (x*y%2+x*y%3)%2 == 0 },
+	func(x, y int) bool { return ((x+y)%2+x*y%3)%2 == 0 },
+}
+
+// decodeQRForTest reads a byte mode symbol back: the format information, the
+// unmasked codewords, the Reed-Solomon check of every block and the payload.
+func decodeQRForTest(q *QRCode) ([]byte, int, error) {
+	size := q.Size()
+	version := (size - 17) / 4
+	if version < 1 || version > 40 || version*4+17 != size {
+		return nil, 0, fmt.Errorf("invalid symbol size %d", size)
+	}
+
+	// First copy of the format information, around the top-left finder
+	format := 0
+	bit := func(i int, dark bool) {
+		if dark {
+			format |= 1 << i
+		}
+	}
+	for i := 0; i <= 5; i++ {
+		bit(i, q.Dark(8, i))
+	}
+	bit(6, q.Dark(8, 7))
+	bit(7, q.Dark(8, 8))
+	bit(8, q.Dark(7, 8))
+	for i := 9; i < 15; i++ {
+		bit(i, q.Dark(14-i, 8))
+	}
+	mask := -1
+	for m, want := range qrTestFormatM {
+		if format == want {
+			mask = m
+		}
+	}
+	if mask < 0 {
+		return nil, 0, fmt.Errorf("format information %015b is not level M", format)
+	}
+
+	// Second copy, split between the top-right and bottom-left finders
+	second := 0
+	for i := 0; i < 8; i++ {
+		if q.Dark(size-1-i, 8) {
+			second |= 1 << i
+		}
+	}
+	for i := 8; i < 15; i++ {
+		if q.Dark(8, size-15+i) {
+			second |= 1 << i
+		}
+	}
+	if second != format {
+		return nil, 0, fmt.Errorf("format copies differ: %015b and %015b", format, second)
+	}
+
+	isFunction := newQRCode(version).drawFunctionPatterns(version)
+	var raw []byte
+	var current byte
+	n := 0
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = size - 1 - vert
+				}
+				if isFunction[y][x] {
+					continue
+				}
+				dark := q.Dark(x, y) != qrTestMasks[mask](x, y)
+				current <<= 1
+				if dark {
+					current |= 1
+				}
+				if n++; n%8 == 0 {
+					raw = append(raw, current)
+					current = 0
+				}
+			}
+		}
+	}
+
+	// De-interleave the blocks and check each one's error correction
+	numBlocks, eccLen := qrNumBlocks[version], qrECCPerBlock[version]
+	total := qrRawDataModules(version) / 8
+	if len(raw) < total {
+		return nil, 0, fmt.Errorf("read %d codewords, want %d", len(raw), total)
+	}
+	shortLen := total / numBlocks
+	numShort := numBlocks - total%numBlocks
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := 0; i < shortLen-eccLen+1; i++ {
+		for b := range blocks {
+			if i == shortLen-eccLen && b < numShort {
+				continue // Short blocks have one data codeword less
+			}
+			blocks[b] = append(blocks[b], raw[k])
+			k++
+		}
+	}
+	for i := 0; i < eccLen; i++ {
+		for b := range blocks {
+			blocks[b] = append(blocks[b], raw[k])
+			k++
+		}
+	}
+
+	var data []byte
+	for b, block := range blocks {
+		// A valid codeword has roots at alpha^0 .. alpha^(eccLen-1)
+		root := byte(1)
+		for i := 0; i < eccLen; i++ {
+			syndrome := byte(0)
+			for _, c := range block {
+				syndrome = qrMultiply(syndrome, root) ^ c
+			}
+			if syndrome != 0 {
+				return nil, 0, fmt.Errorf("block %d fails its error correction check", b)
+			}
+			root = qrMultiply(root, 0x02)
+		}
+		data = append(data, block[:len(block)-eccLen]...)
+	}
+
+	// Byte mode segment
+	pos := 0
+	read := func(bits int) int {
+		v := 0
+		for i := 0; i < bits; i++ {
+			v = v<<1 | int(data[pos/8]>>(7-uint(pos%8))&1)
+			pos++
+		}
+		return v
+	}
+	if read(4) != 0x4 {
+		return nil, 0, errors.New("not a byte mode segment")
+	}
+	countBits := 8
+	if version >= 10 {
+		countBits = 16
+	}
+	count := read(countBits)
+	if pos+8*count > 8*len(data) {
+		return nil, 0, fmt.Errorf("byte count %d exceeds the data codewords", count)
+	}
+	payload := make([]byte, count)
+	for i := range payload {
+		payload[i] = byte(read(8))
+	}
+	return payload, version, nil
+}
+
+func TestEncodeQRRoundTrip(t *testing.T) {
+	binary := make([]byte, 256)
+	for i := range binary {
+		binary[i] = byte(i)
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"short link", []byte("https://medibridge.example/v/abc")},
+		{"verification link", []byte("https://api.medibridge.example/v1/verify/prescriptions/0f8fad5b-d9cb-469f-a165-70867728950e?v=3&sig=" + strings.Repeat("QmFzZTY0", 12))},
+		{"all byte values", binary},
+		{"large", bytes.Repeat([]byte("MediBridge "), 150)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := EncodeQR(tt.data)
+			if err != nil {
+				t.Fatalf("EncodeQR: %v", err)
+			}
+			got, _, err := decodeQRForTest(q)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Errorf("decoded %q, want %q", got, tt.data)
+			}
+		})
+	}
+}
+
+func TestEncodeQRVersionSelection(t *testing.T) {
+	// Byte mode capacity at level M (ISO/IEC 18004, table 7)
+	capacities := []struct {
+		version  int
+		maxBytes int
+	}{
+		{1, 14}, {2, 26}, {3, 42}, {4, 62}, {5, 84}, {6, 106},
+		{7, 122}, {8, 152}, {9, 180}, {10, 213}, {40, 2331},
+	}
+	for _, tt := range capacities {
+		t.Run(fmt.Sprintf("version %d", tt.version), func(t *testing.T) {
+			q, err := EncodeQR(bytes.Repeat([]byte{'a'}, tt.maxBytes))
+			if err != nil {
+				t.Fatalf("EncodeQR(%d bytes): %v", tt.maxBytes, err)
+			}
+			if want := tt.version*4 + 17; q.Size() != want {
+				t.Errorf("%d bytes: size %d, want %d (version %d)", tt.maxBytes, q.Size(), want, tt.version)
+			}
+			if _, version, err := decodeQRForTest(q); err != nil || version != tt.version {
+				t.Errorf("%d bytes: decoded version %d, err %v", tt.maxBytes, version, err)
+			}
+
+			if tt.version == 40 {
+				return
+			}
+			q, err = EncodeQR(bytes.Repeat([]byte{'a'}, tt.maxBytes+1))
+			if err != nil {
+				t.Fatalf("EncodeQR(%d bytes): %v", tt.maxBytes+1, err)
+			}
+			if q.Size() <= tt.version*4+17 {
+				t.Errorf("%d bytes: size %d, want a version above %d", tt.maxBytes+1, q.Size(), tt.version)
+			}
+		})
+	}
+
+	if _, err := EncodeQR(make([]byte, 2332)); err != ErrQRDataTooLong {
+		t.Errorf("2332 bytes: err %v, want ErrQRDataTooLong", err)
+	}
+}
+
+func TestQRVersionInformation(t *testing.T) {
+	// Version information of version 7 (ISO/IEC 18004, annex D): 000111 110010010100
+	const want = 0x07C94
+	q := newQRCode(7)
+	q.drawFunctionPatterns(7)
+	got := 0
+	for i := 0; i < 18; i++ {
+		if q.Dark(q.size-11+i%3, i/3) {
+			got |= 1 << i
+		}
+	}
+	if got != want {
+		t.Errorf("version 7 information %018b, want %018b", got, want)
+	}
+}
+
+func TestQRReedSolomonDivisor(t *testing.T) {
+	// Generator polynomial for 10 error correction codewords, as powers of alpha
+	exponents := []int{251, 67, 46, 61, 118, 70, 64, 94, 32, 45}
+	alphaPow := func(e int) byte {
+		v := byte(1)
+		for i := 0; i < e; i++ {
+			v = qrMultiply(v, 0x02)
+		}
+		return v
+	}
+	got := qrReedSolomonDivisor(10)
+	for i, e := range exponents {
+		if want := alphaPow(e); got[i] != want {
+			t.Errorf("coefficient %d = %d, want alpha^%d = %d", i, got[i], e, want)
+		}
+	}
+}
+
+func TestDecodeQRForTestDetectsDamage(t *testing.T) {
+	// Guards the test decoder itself: a flipped data module must not decode.
+	q, err := EncodeQR([]byte("https://medibridge.example/v/abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	version := (q.size - 17) / 4
+	isFunction := newQRCode(version).drawFunctionPatterns(version)
+	for y := q.size - 1; y >= 0; y-- {
+		if !isFunction[y][q.size-1] {
+			q.modules[y][q.size-1] = !q.modules[y][q.size-1]
+			break
+		}
+	}
+	if _, _, err := decodeQRForTest(q); err == nil {
+		t.Error("damaged symbol decoded without error")
+	}
+}
@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The key share link tokens and PINs are signed with (loaded from .env); without
+// it the JWT secret is used.
+// NOTE: This variable is initialized when the program starts.
+var shareLinkSecretKey = []byte(os.Getenv("SHARE_LINK_SECRET"))
+
+// ErrInvalidShareLink is returned for a token that is malformed or was not signed by us.
+var ErrInvalidShareLink = errors.New("invalid share link")
+
+// ErrShareLinkExpired is returned, with the link's ID, for a genuine token past its expiry.
+var ErrShareLinkExpired = errors.New("share link expired")
+
+// shareLinkSignatureSize is the length of the truncated HMAC in a token, in bytes.
+const shareLinkSignatureSize = 16
+
+// shareLinkKey returns the key to sign share links with.
+func shareLinkKey() ([]byte, error) {
+	if len(shareLinkSecretKey) > 0 {
+		return shareLinkSecretKey, nil
+	}
+	if len(jwtSecretKey) > 0 {
+		return jwtSecretKey, nil
+	}
+	return nil, fmt.Errorf("SHARE_LINK_SECRET not configured")
+}
+
+// shareLinkMAC returns the HMAC of the parts of a token or PIN, joined by dots.
+func shareLinkMAC(key []byte, parts ...string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strings.Join(parts, ".")))
+	return mac.Sum(nil)
+}
+
+// NewShareLinkID returns a random, URL-safe ID for a new share link.
+func NewShareLinkID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// SignShareLink returns the token of the share link id, valid until expiresAt:
+// the ID, the expiry as a Unix time and a signature over both, joined by dots.
+// The same link always gets the same token, so it can be shown again later.
+func SignShareLink(id string, expiresAt time.Time) (string, error) {
+	key, err := shareLinkKey()
+	if err != nil {
+		return "", err
+	}
+	exp := strconv.FormatInt(expiresAt.Unix(), 10)
+	sig := shareLinkMAC(key, id, exp)[:shareLinkSignatureSize]
+	return id + "." + exp + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// ParseShareLink checks the signature of token and returns the ID of its share
+// link. An expired token returns its ID along with ErrShareLinkExpired.
+func ParseShareLink(token string) (string, error) {
+	key, err := shareLinkKey()
+	if err != nil {
+		return "", err
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", ErrInvalidShareLink
+	}
+	exp, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", ErrInvalidShareLink
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, shareLinkMAC(key, parts[0], parts[1])[:shareLinkSignatureSize]) {
+		return "", ErrInvalidShareLink
+	}
+	if time.Now().Unix() >= exp {
+		return parts[0], ErrShareLinkExpired
+	}
+	return parts[0], nil
+}
+
+// HashSharePIN returns the hash of the PIN protecting the share link id. It is
+// keyed, so the short PINs cannot be recovered from a copy of the database alone.
+func HashSharePIN(id, pin string) (string, error) {
+	key, err := shareLinkKey()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(shareLinkMAC(key, "pin", id, pin)), nil
+}
+
+// CheckSharePIN reports whether pin matches the hash stored for the share link id.
+func CheckSharePIN(id, pin, hash string) bool {
+	got, err := HashSharePIN(id, pin)
+	return err == nil && hmac.Equal([]byte(got), []byte(hash))
+}
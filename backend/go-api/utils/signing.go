@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// NewSigningKey generates an Ed25519 key pair. The private key is returned as
+// its seed, encrypted with Encrypt, ready to be stored.
+func NewSigningKey() (ed25519.PublicKey, string, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, "", err
+	}
+	sealed, err := Encrypt(hex.EncodeToString(private.Seed()))
+	if err != nil {
+		return nil, "", err
+	}
+	return public, sealed, nil
+}
+
+// SignWithSealedKey signs message with a private key stored by NewSigningKey.
+func SignWithSealedKey(sealed string, message []byte) ([]byte, error) {
+	seedHex, err := Decrypt(sealed)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := hex.DecodeString(seedHex)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("stored signing key is malformed")
+	}
+	return ed25519.Sign(ed25519.NewKeyFromSeed(seed), message), nil
+}
+
+// VerifySignature reports whether sig is a valid signature of message by public.
+func VerifySignature(public, message, sig []byte) bool {
+	return len(public) == ed25519.PublicKeySize && len(sig) == ed25519.SignatureSize &&
+		ed25519.Verify(public, message, sig)
+}
+
+// KeyFingerprint is a short, printable identifier of a public key.
+func KeyFingerprint(public []byte) string {
+	sum := sha256.Sum256(public)
+	return hex.EncodeToString(sum[:8])
+}